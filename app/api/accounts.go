@@ -0,0 +1,134 @@
+package api
+
+import (
+	"net/http"
+
+	"hotelm/models"
+	"hotelm/service"
+	"hotelm/session"
+)
+
+// loginRequest is the body of POST /api/v1/session.
+type loginRequest struct {
+	Role     string `json:"role"` // "customer", "vendor" or "admin"
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// Login starts a session. The session cookie is set on the response, so API
+// clients authenticate the same way as the browser.
+func Login(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	var err error
+	switch req.Role {
+	case session.RoleCustomer:
+		err = service.LoginCustomer(w, r, req.Email, req.Password)
+	case session.RoleVendor:
+		err = service.LoginVendor(w, r, req.Email, req.Password)
+	case session.RoleAdmin:
+		err = service.LoginAdmin(w, r, req.Email, req.Password)
+	default:
+		WriteError(w, http.StatusBadRequest, "invalid_request", `role must be "customer", "vendor" or "admin"`)
+		return
+	}
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"role": req.Role})
+}
+
+// Logout ends the current session.
+func Logout(w http.ResponseWriter, r *http.Request) {
+	if err := session.ClearCurrentUser(w, r); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// customerRequest is the body of POST /api/v1/customers.
+type customerRequest struct {
+	Name     string `json:"name"`
+	Phone    string `json:"phone"`
+	Email    string `json:"email"`
+	Address  string `json:"address"`
+	Password string `json:"password"`
+}
+
+// RegisterCustomer creates a customer account.
+func RegisterCustomer(w http.ResponseWriter, r *http.Request) {
+	var req customerRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	customer := models.Customer{
+		Name:    req.Name,
+		Phone:   req.Phone,
+		Email:   req.Email,
+		Address: req.Address,
+	}
+	id, err := service.RegisterCustomer(customer, req.Password)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	customer.CustomerID = id
+	writeJSON(w, http.StatusCreated, customer)
+}
+
+// CurrentCustomer returns the logged-in customer.
+func CurrentCustomer(w http.ResponseWriter, r *http.Request) {
+	customer, err := service.GetCurrentCustomer(r.Context())
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, customer)
+}
+
+// vendorRequest is the body of POST /api/v1/vendors.
+type vendorRequest struct {
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+	HotelName string `json:"hotel_name"`
+	Address   string `json:"address"`
+	Password  string `json:"password"`
+}
+
+// RegisterVendor creates a vendor account.
+func RegisterVendor(w http.ResponseWriter, r *http.Request) {
+	var req vendorRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	vendor := models.Vendor{
+		Name:      req.Name,
+		Email:     req.Email,
+		Phone:     req.Phone,
+		HotelName: req.HotelName,
+		Address:   req.Address,
+	}
+	id, err := service.RegisterVendor(vendor, req.Password)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	vendor.VendorID = id
+	writeJSON(w, http.StatusCreated, vendor)
+}
+
+// CurrentVendor returns the logged-in vendor.
+func CurrentVendor(w http.ResponseWriter, r *http.Request) {
+	vendor, err := service.GetCurrentVendor(r.Context())
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, vendor)
+}
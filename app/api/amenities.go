@@ -0,0 +1,82 @@
+package api
+
+import (
+	"net/http"
+
+	"hotelm/models"
+	"hotelm/service"
+)
+
+// amenityRequest is the body of POST /api/v1/admin/amenities and PUT
+// /api/v1/admin/amenities/{id}.
+type amenityRequest struct {
+	Name string `json:"name"`
+}
+
+// writeAmenity writes an amenity of the catalog.
+func writeAmenity(w http.ResponseWriter, id, status int) {
+	amenity, err := service.GetAmenity(id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, status, amenity)
+}
+
+// ListAmenities returns the amenity catalog rooms pick from, by name.
+func ListAmenities(w http.ResponseWriter, r *http.Request) {
+	amenities, err := service.GetAmenities()
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if amenities == nil {
+		amenities = []models.Amenity{}
+	}
+	writeJSON(w, http.StatusOK, amenities)
+}
+
+// CreateAmenity adds an amenity to the catalog.
+func CreateAmenity(w http.ResponseWriter, r *http.Request) {
+	var req amenityRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	id, err := service.CreateAmenity(r.Context(), req.Name)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeAmenity(w, id, http.StatusCreated)
+}
+
+// RenameAmenity renames an amenity of the catalog.
+func RenameAmenity(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req amenityRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := service.RenameAmenity(r.Context(), id, req.Name); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeAmenity(w, id, http.StatusOK)
+}
+
+// DeleteAmenity removes an amenity from the catalog and from the rooms
+// offering it.
+func DeleteAmenity(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if err := service.DeleteAmenity(r.Context(), id); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"hotelm/models"
+	"hotelm/money"
+	"hotelm/service"
+)
+
+// bookingRequest is the body of POST /api/v1/bookings. QuotedTotal is the
+// total of a quote, amount and currency, as returned by QuoteRoom.
+type bookingRequest struct {
+	RoomID        int         `json:"room_id"`
+	CheckinDate   string      `json:"checkin_date"`
+	CheckoutDate  string      `json:"checkout_date"`
+	PaymentMethod string      `json:"payment_method"`
+	QuotedTotal   money.Money `json:"quoted_total"`
+	PromoCode     string      `json:"promo_code"`
+}
+
+// bookingResponse is a booking together with its itemized price.
+type bookingResponse struct {
+	*models.Booking
+	LineItems []models.BookingLineItem `json:"line_items"`
+}
+
+// bookingStatusRequest is the body of PUT /api/v1/bookings/{id}/status.
+type bookingStatusRequest struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// ListBookings returns the logged-in customer's bookings.
+func ListBookings(w http.ResponseWriter, r *http.Request) {
+	bookings, err := service.GetMyBookings(r.Context())
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if bookings == nil {
+		bookings = []models.Booking{}
+	}
+	writeJSON(w, http.StatusOK, bookings)
+}
+
+// CreateBooking books a room for the logged-in customer, with the promo
+// code the quote was priced with, if any.
+func CreateBooking(w http.ResponseWriter, r *http.Request) {
+	var req bookingRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	checkin, ok := parseDate(w, "checkin_date", req.CheckinDate)
+	if !ok {
+		return
+	}
+	checkout, ok := parseDate(w, "checkout_date", req.CheckoutDate)
+	if !ok {
+		return
+	}
+	if !req.QuotedTotal.IsPositive() {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "quoted_total is required, get a quote for the stay first")
+		return
+	}
+	if req.QuotedTotal.Currency == "" {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "quoted_total must include the currency of the quote")
+		return
+	}
+
+	id, err := service.CreateBookingForCustomer(r.Context(), models.Booking{
+		BookingDate:  time.Now(),
+		CheckinDate:  checkin,
+		CheckoutDate: checkout,
+		RoomID:       req.RoomID,
+	}, req.PaymentMethod, req.QuotedTotal, req.PromoCode)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	booking, items, err := service.GetMyBooking(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, bookingResponse{Booking: booking, LineItems: items})
+}
+
+// GetBooking returns a booking of the logged-in customer.
+func GetBooking(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	booking, items, err := service.GetMyBooking(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, bookingResponse{Booking: booking, LineItems: items})
+}
+
+// CancelBooking cancels a booking of the logged-in customer and refunds it
+// under the booking's cancellation policy. The booking is kept with status
+// "cancelled"; an optional reason is read from ?reason=.
+func CancelBooking(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if err := service.CancelBookingForCustomer(r.Context(), id, r.URL.Query().Get("reason")); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CompleteBookingPayment completes the pending payment of a booking of the
+// logged-in customer and returns the booking.
+func CompleteBookingPayment(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if err := service.CompleteBookingPayment(r.Context(), id); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	booking, items, err := service.GetMyBooking(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, bookingResponse{Booking: booking, LineItems: items})
+}
+
+// QuoteCancellation returns the refund the logged-in customer would get for
+// cancelling a booking now.
+func QuoteCancellation(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	quote, err := service.QuoteCancellation(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, quote)
+}
+
+// SetBookingStatus moves a booking to a new status. Customers can cancel
+// their bookings; vendors and admins check guests in and out and record
+// no-shows.
+func SetBookingStatus(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req bookingStatusRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := service.SetBookingStatus(r.Context(), id, req.Status, req.Reason); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	history, err := service.GetBookingHistory(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+// GetBookingHistory returns the status changes of a booking, oldest first.
+func GetBookingHistory(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	history, err := service.GetBookingHistory(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if history == nil {
+		history = []models.BookingStatusEvent{}
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+// ListBookingPayments returns the payments of a booking of the logged-in
+// customer.
+func ListBookingPayments(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	payments, err := service.GetMyBookingPayments(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if payments == nil {
+		payments = []models.Payment{}
+	}
+	writeJSON(w, http.StatusOK, payments)
+}
+
+// reviewRequest is the body of POST /api/v1/reviews.
+type reviewRequest struct {
+	BookingID int    `json:"booking_id"`
+	Rating    int    `json:"rating"`
+	Comment   string `json:"comment"`
+}
+
+// CreateReview posts a review for a completed booking of the logged-in
+// customer.
+func CreateReview(w http.ResponseWriter, r *http.Request) {
+	var req reviewRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	id, err := service.CreateReviewForCustomer(r.Context(), req.BookingID, req.Rating, req.Comment)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]int{"review_id": id})
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"hotelm/models"
+	"hotelm/service"
+)
+
+// ListExchangeRates returns the exchange rates prices are converted with,
+// each against the default currency.
+func ListExchangeRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := service.GetExchangeRates()
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if rates == nil {
+		rates = []models.ExchangeRate{}
+	}
+	writeJSON(w, http.StatusOK, rates)
+}
+
+// SetExchangeRate sets the rate of the {currency} in the path from the body,
+// {"rate": "0.92"}.
+func SetExchangeRate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Rate json.Number `json:"rate"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	currency := strings.ToUpper(r.PathValue("currency"))
+	if err := service.SetExchangeRate(r.Context(), currency, req.Rate.String()); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	ListExchangeRates(w, r)
+}
+
+// DeleteExchangeRate removes the rate of the {currency} in the path.
+func DeleteExchangeRate(w http.ResponseWriter, r *http.Request) {
+	currency := strings.ToUpper(r.PathValue("currency"))
+	if err := service.DeleteExchangeRate(r.Context(), currency); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetDisplayCurrency sets the currency the logged-in customer wants prices
+// shown in from the body, {"display_currency": "EUR"}; "" shows each room's
+// own currency.
+func SetDisplayCurrency(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		DisplayCurrency string `json:"display_currency"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := service.SetDisplayCurrency(r.Context(), req.DisplayCurrency); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	CurrentCustomer(w, r)
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"net/http"
+
+	"hotelm/models"
+	"hotelm/service"
+)
+
+// threadRequest is the body of POST /api/v1/threads. Customers give a room_id
+// or booking_id; vendors must give a booking_id.
+type threadRequest struct {
+	RoomID    int    `json:"room_id"`
+	BookingID int    `json:"booking_id"`
+	Subject   string `json:"subject"`
+	Body      string `json:"body"`
+}
+
+// threadResponse is a thread together with its messages.
+type threadResponse struct {
+	*models.MessageThread
+	Messages []models.Message `json:"messages"`
+}
+
+// messageRequest is the body of POST /api/v1/threads/{id}/messages.
+type messageRequest struct {
+	Body string `json:"body"`
+}
+
+// ListThreads returns the logged-in user's message threads with their unread
+// counts. Admins get every thread.
+func ListThreads(w http.ResponseWriter, r *http.Request) {
+	threads, err := service.GetMyThreads(r.Context())
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if threads == nil {
+		threads = []models.MessageThread{}
+	}
+	writeJSON(w, http.StatusOK, threads)
+}
+
+// CreateThread starts a thread with its first message.
+func CreateThread(w http.ResponseWriter, r *http.Request) {
+	var req threadRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	id, err := service.StartThread(r.Context(), service.NewThread{
+		RoomID:    req.RoomID,
+		BookingID: req.BookingID,
+		Subject:   req.Subject,
+		Body:      req.Body,
+	})
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	thread, messages, err := service.GetThread(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, threadResponse{MessageThread: thread, Messages: messages})
+}
+
+// GetThread returns a thread and its messages, marking them read.
+func GetThread(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	thread, messages, err := service.GetThread(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if messages == nil {
+		messages = []models.Message{}
+	}
+	writeJSON(w, http.StatusOK, threadResponse{MessageThread: thread, Messages: messages})
+}
+
+// CreateMessage posts a reply in a thread.
+func CreateMessage(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req messageRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	messageID, err := service.PostMessage(r.Context(), id, req.Body)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]int{"message_id": messageID})
+}
+
+// UnreadMessages returns the number of unread messages of the logged-in user.
+func UnreadMessages(w http.ResponseWriter, r *http.Request) {
+	count, err := service.CountMyUnreadMessages(r.Context())
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"unread": count})
+}
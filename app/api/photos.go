@@ -0,0 +1,133 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"hotelm/models"
+	"hotelm/service"
+)
+
+// photoOrderRequest is the body of PUT
+// /api/v1/vendor/rooms/{id}/photos/order: every photo of the room, first
+// shown first.
+type photoOrderRequest struct {
+	PhotoIDs []int `json:"photo_ids"`
+}
+
+// writePhotos writes a room's photos, or the error retrieving them.
+func writePhotos(w http.ResponseWriter, photos []models.RoomPhoto, err error) {
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if photos == nil {
+		photos = []models.RoomPhoto{}
+	}
+	writeJSON(w, http.StatusOK, photos)
+}
+
+// ListRoomPhotos returns the photos of a room in display order.
+func ListRoomPhotos(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if _, err := service.GetRoom(id); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	photos, err := service.GetRoomPhotos(id)
+	writePhotos(w, photos, err)
+}
+
+// ListVendorRoomPhotos returns the photos of a room of the logged-in vendor.
+func ListVendorRoomPhotos(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	photos, err := service.GetRoomPhotosForVendor(r.Context(), id)
+	writePhotos(w, photos, err)
+}
+
+// CreateRoomPhoto adds a photo to a room of the logged-in vendor. The body
+// is the image itself; its type is taken from the data, not Content-Type.
+func CreateRoomPhoto(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, service.MaxPhotoBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		WriteError(w, http.StatusRequestEntityTooLarge, "too_large",
+			"photos must be at most "+strconv.Itoa(service.MaxPhotoBytes>>20)+" MB")
+		return
+	}
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_body", "failed to read body: "+err.Error())
+		return
+	}
+	photoID, err := service.AddRoomPhotoForVendor(r.Context(), id, data)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	photo, err := service.GetRoomPhotoForVendor(r.Context(), photoID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, photo)
+}
+
+// OrderRoomPhotos sets the display order of the photos of a room of the
+// logged-in vendor.
+func OrderRoomPhotos(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req photoOrderRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := service.OrderRoomPhotosForVendor(r.Context(), id, req.PhotoIDs); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	photos, err := service.GetRoomPhotosForVendor(r.Context(), id)
+	writePhotos(w, photos, err)
+}
+
+// SetCoverPhoto makes a photo the cover of its room, a room of the
+// logged-in vendor, and returns the room's photos.
+func SetCoverPhoto(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	roomID, err := service.SetCoverPhotoForVendor(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	photos, err := service.GetRoomPhotosForVendor(r.Context(), roomID)
+	writePhotos(w, photos, err)
+}
+
+// DeleteRoomPhoto deletes a photo of a room of the logged-in vendor.
+func DeleteRoomPhoto(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if _, err := service.DeleteRoomPhotoForVendor(r.Context(), id); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"net/http"
+
+	"hotelm/models"
+	"hotelm/money"
+	"hotelm/service"
+)
+
+// promoCodeRequest is the body of POST /api/v1/vendor/promo-codes and
+// POST /api/v1/admin/promo-codes. A code takes either percent or amount
+// off; an amount given bare is in the default currency. Dates are the
+// first and last day the code can be redeemed, both optional.
+type promoCodeRequest struct {
+	Code               string       `json:"code"`
+	Description        string       `json:"description"`
+	Percent            float64      `json:"percent"`
+	Amount             *money.Money `json:"amount"`
+	ValidFrom          string       `json:"valid_from"`
+	ValidUntil         string       `json:"valid_until"`
+	MaxUses            int          `json:"max_uses"`
+	MaxUsesPerCustomer int          `json:"max_uses_per_customer"`
+	MinNights          int          `json:"min_nights"`
+	RoomID             *int         `json:"room_id"`
+	RoomType           string       `json:"room_type"`
+}
+
+// promoCode converts the request to a promo code, writing an error if its
+// dates are invalid.
+func (req promoCodeRequest) promoCode(w http.ResponseWriter) (models.PromoCode, bool) {
+	promo := models.PromoCode{
+		Code:               req.Code,
+		Description:        req.Description,
+		Percent:            req.Percent,
+		Amount:             req.Amount,
+		MaxUses:            req.MaxUses,
+		MaxUsesPerCustomer: req.MaxUsesPerCustomer,
+		MinNights:          req.MinNights,
+		RoomID:             req.RoomID,
+		RoomType:           req.RoomType,
+	}
+	if req.ValidFrom != "" {
+		from, ok := parseDate(w, "valid_from", req.ValidFrom)
+		if !ok {
+			return promo, false
+		}
+		promo.ValidFrom = &from
+	}
+	if req.ValidUntil != "" {
+		until, ok := parseDate(w, "valid_until", req.ValidUntil)
+		if !ok {
+			return promo, false
+		}
+		promo.ValidUntil = &until
+	}
+	return promo, true
+}
+
+// activeRequest is the body of the promo code active endpoints,
+// {"active": false}.
+type activeRequest struct {
+	Active bool `json:"active"`
+}
+
+// writePromoCodes writes a list of promo codes, [] if there are none.
+func writePromoCodes(w http.ResponseWriter, codes []models.PromoCode, err error) {
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if codes == nil {
+		codes = []models.PromoCode{}
+	}
+	writeJSON(w, http.StatusOK, codes)
+}
+
+// writePromoCode writes a promo code, or the error retrieving it.
+func writePromoCode(w http.ResponseWriter, status int, promo *models.PromoCode, err error) {
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, status, promo)
+}
+
+// ListVendorPromoCodes returns the promo codes of the logged-in vendor.
+func ListVendorPromoCodes(w http.ResponseWriter, r *http.Request) {
+	codes, err := service.GetVendorPromoCodes(r.Context())
+	writePromoCodes(w, codes, err)
+}
+
+// CreateVendorPromoCode creates a promo code for the logged-in vendor's
+// rooms.
+func CreateVendorPromoCode(w http.ResponseWriter, r *http.Request) {
+	var req promoCodeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	promo, ok := req.promoCode(w)
+	if !ok {
+		return
+	}
+	id, err := service.CreatePromoCodeForVendor(r.Context(), promo)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	created, err := service.GetPromoCodeForVendor(r.Context(), id)
+	writePromoCode(w, http.StatusCreated, created, err)
+}
+
+// SetVendorPromoCodeActive enables or disables a promo code of the
+// logged-in vendor.
+func SetVendorPromoCodeActive(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req activeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := service.SetPromoCodeActiveForVendor(r.Context(), id, req.Active); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	promo, err := service.GetPromoCodeForVendor(r.Context(), id)
+	writePromoCode(w, http.StatusOK, promo, err)
+}
+
+// ListPromoCodes returns every promo code, platform-wide and of vendors.
+func ListPromoCodes(w http.ResponseWriter, r *http.Request) {
+	codes, err := service.ListAllPromoCodes(r.Context())
+	writePromoCodes(w, codes, err)
+}
+
+// CreatePromoCode creates a platform-wide promo code.
+func CreatePromoCode(w http.ResponseWriter, r *http.Request) {
+	var req promoCodeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	promo, ok := req.promoCode(w)
+	if !ok {
+		return
+	}
+	id, err := service.CreatePlatformPromoCode(r.Context(), promo)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	created, err := service.GetPromoCode(r.Context(), id)
+	writePromoCode(w, http.StatusCreated, created, err)
+}
+
+// SetPromoCodeActive enables or disables any promo code.
+func SetPromoCodeActive(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req activeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := service.SetPromoCodeActive(r.Context(), id, req.Active); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	promo, err := service.GetPromoCode(r.Context(), id)
+	writePromoCode(w, http.StatusOK, promo, err)
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"hotelm/models"
+	"hotelm/service"
+)
+
+// propertyRequest is the body of POST /api/v1/vendor/properties and PUT
+// /api/v1/vendor/properties/{id}. Blank times and timezone take the
+// defaults: check-in from 15:00 and check-out by 11:00, UTC.
+type propertyRequest struct {
+	Name         string   `json:"name"`
+	Address      string   `json:"address"`
+	Latitude     *float64 `json:"latitude"`
+	Longitude    *float64 `json:"longitude"`
+	Timezone     string   `json:"timezone"`
+	CheckinTime  string   `json:"checkin_time"`
+	CheckoutTime string   `json:"checkout_time"`
+	Policies     string   `json:"policies"`
+	Phone        string   `json:"phone"`
+	Email        string   `json:"email"`
+}
+
+// property converts the request to a property.
+func (req propertyRequest) property() models.Property {
+	return models.Property{
+		Name:         req.Name,
+		Address:      req.Address,
+		Latitude:     req.Latitude,
+		Longitude:    req.Longitude,
+		Timezone:     req.Timezone,
+		CheckinTime:  req.CheckinTime,
+		CheckoutTime: req.CheckoutTime,
+		Policies:     req.Policies,
+		Phone:        req.Phone,
+		Email:        req.Email,
+	}
+}
+
+// queryPropertyID reads the optional ?property_id=, 0 if it is absent.
+func queryPropertyID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	value := r.URL.Query().Get("property_id")
+	if value == "" {
+		return 0, true
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 1 {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "property_id must be a property ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// ListProperties returns the properties with rooms listed for booking, by
+// name.
+func ListProperties(w http.ResponseWriter, r *http.Request) {
+	properties, err := service.GetListedProperties()
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if properties == nil {
+		properties = []models.Property{}
+	}
+	writeJSON(w, http.StatusOK, properties)
+}
+
+// GetProperty returns a single property. Its rooms are listed by
+// GET /api/v1/rooms?property_id=.
+func GetProperty(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	property, err := service.GetProperty(id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, property)
+}
+
+// ListVendorProperties returns the logged-in vendor's properties.
+func ListVendorProperties(w http.ResponseWriter, r *http.Request) {
+	properties, err := service.GetVendorProperties(r.Context())
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if properties == nil {
+		properties = []models.Property{}
+	}
+	writeJSON(w, http.StatusOK, properties)
+}
+
+// CreateVendorProperty adds a property for the logged-in vendor.
+func CreateVendorProperty(w http.ResponseWriter, r *http.Request) {
+	var req propertyRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	id, err := service.CreatePropertyForVendor(r.Context(), req.property())
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	property, err := service.GetPropertyForVendor(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, property)
+}
+
+// GetVendorProperty returns a property of the logged-in vendor.
+func GetVendorProperty(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	property, err := service.GetPropertyForVendor(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, property)
+}
+
+// UpdateVendorProperty replaces the details of a property of the logged-in
+// vendor.
+func UpdateVendorProperty(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req propertyRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	property := req.property()
+	property.PropertyID = id
+	if err := service.UpdatePropertyForVendor(r.Context(), property); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	updated, err := service.GetPropertyForVendor(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// DeleteVendorProperty deletes a property of the logged-in vendor that has
+// no rooms left.
+func DeleteVendorProperty(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if err := service.DeletePropertyForVendor(r.Context(), id); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"hotelm/models"
+	"hotelm/money"
+	"hotelm/service"
+)
+
+// ratePlanRequest is the body of POST /api/v1/vendor/rooms/{id}/rate-plans
+// and PUT /api/v1/vendor/rate-plans/{id}. Dates are the first and last
+// night; weekday prices are keyed 0 for Sunday to 6 for Saturday. Prices
+// given as bare amounts are in the room's currency.
+type ratePlanRequest struct {
+	Name          string                       `json:"name"`
+	StartDate     string                       `json:"start_date"`
+	EndDate       string                       `json:"end_date"`
+	Price         money.Money                  `json:"price"`
+	WeekdayPrices map[time.Weekday]money.Money `json:"weekday_prices"`
+	MinStay       int                          `json:"min_stay"`
+	MaxStay       int                          `json:"max_stay"`
+}
+
+// ratePlan converts the request to a rate plan, writing an error if its
+// dates are invalid.
+func (req ratePlanRequest) ratePlan(w http.ResponseWriter) (models.RatePlan, bool) {
+	start, ok := parseDate(w, "start_date", req.StartDate)
+	if !ok {
+		return models.RatePlan{}, false
+	}
+	end, ok := parseDate(w, "end_date", req.EndDate)
+	if !ok {
+		return models.RatePlan{}, false
+	}
+	return models.RatePlan{
+		Name:          req.Name,
+		StartDate:     start,
+		EndDate:       end,
+		Price:         req.Price,
+		WeekdayPrices: req.WeekdayPrices,
+		MinStay:       req.MinStay,
+		MaxStay:       req.MaxStay,
+	}, true
+}
+
+// ListRatePlans returns the rate plans of a room of the logged-in vendor.
+func ListRatePlans(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	plans, err := service.GetRatePlansForVendor(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if plans == nil {
+		plans = []models.RatePlan{}
+	}
+	writeJSON(w, http.StatusOK, plans)
+}
+
+// CreateRatePlan adds a rate plan to a room of the logged-in vendor.
+func CreateRatePlan(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req ratePlanRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	plan, ok := req.ratePlan(w)
+	if !ok {
+		return
+	}
+	planID, err := service.CreateRatePlanForVendor(r.Context(), id, plan)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeRatePlan(w, r, planID, http.StatusCreated)
+}
+
+// writeRatePlan writes a rate plan of the logged-in vendor.
+func writeRatePlan(w http.ResponseWriter, r *http.Request, id, status int) {
+	plan, err := service.GetRatePlanForVendor(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, status, plan)
+}
+
+// UpdateRatePlan replaces a rate plan of the logged-in vendor.
+func UpdateRatePlan(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req ratePlanRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	plan, ok := req.ratePlan(w)
+	if !ok {
+		return
+	}
+	plan.RatePlanID = id
+	if err := service.UpdateRatePlanForVendor(r.Context(), plan); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeRatePlan(w, r, id, http.StatusOK)
+}
+
+// DeleteRatePlan deletes a rate plan of the logged-in vendor.
+func DeleteRatePlan(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if _, err := service.DeleteRatePlanForVendor(r.Context(), id); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetRateCalendar returns the nightly prices of a room of the logged-in
+// vendor for ?month=YYYY-MM, the current month by default.
+func GetRateCalendar(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	month := time.Now()
+	if value := r.URL.Query().Get("month"); value != "" {
+		var err error
+		if month, err = time.Parse("2006-01", value); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid_request", "month must be in YYYY-MM format")
+			return
+		}
+	}
+	calendar, err := service.GetRateCalendarForVendor(r.Context(), id, month)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, calendar)
+}
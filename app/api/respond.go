@@ -0,0 +1,132 @@
+// Package api serves the versioned JSON API under /api/v1. It is a thin layer
+// over the service package, like the HTML handlers, and reports every error
+// in the same envelope.
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"hotelm/payment"
+	"hotelm/repository"
+	"hotelm/service"
+)
+
+// dateLayout is the format of dates in request bodies and query strings.
+const dateLayout = "2006-01-02"
+
+// maxBodyBytes caps the size of a JSON request body.
+const maxBodyBytes = 1 << 20
+
+// errorBody is the payload of an error response.
+type errorBody struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeJSON writes v as {"data": v} with the given status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"data": v}); err != nil {
+		log.Printf("api: failed to encode response: %v", err)
+	}
+}
+
+// WriteError writes {"error": {...}} with the given status. It is exported
+// for middleware that answers API calls.
+func WriteError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	body := errorBody{Status: status, Code: code, Message: message}
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"error": body}); err != nil {
+		log.Printf("api: failed to encode error: %v", err)
+	}
+}
+
+// NotFound answers requests for unknown API paths.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, http.StatusNotFound, "not_found", "no such endpoint")
+}
+
+// writeServiceError maps an error from the service layer to a status code.
+// Unexpected errors are logged and reported without their details.
+func writeServiceError(w http.ResponseWriter, err error) {
+	var invalid *service.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		WriteError(w, http.StatusBadRequest, "invalid_request", invalid.Message)
+	case errors.Is(err, repository.ErrNotFound):
+		WriteError(w, http.StatusNotFound, "not_found", err.Error())
+	case errors.Is(err, service.ErrNoCustomer), errors.Is(err, service.ErrNoVendor), errors.Is(err, service.ErrNoAdmin), errors.Is(err, service.ErrNoUser):
+		WriteError(w, http.StatusUnauthorized, "unauthenticated", err.Error())
+	case errors.Is(err, service.ErrInvalidCredentials):
+		WriteError(w, http.StatusUnauthorized, "invalid_credentials", err.Error())
+	case errors.Is(err, service.ErrPasswordNotSet):
+		WriteError(w, http.StatusForbidden, "password_not_set", err.Error())
+	case errors.Is(err, service.ErrAccountSuspended):
+		WriteError(w, http.StatusForbidden, "account_suspended", err.Error())
+	case errors.Is(err, service.ErrForbidden):
+		WriteError(w, http.StatusForbidden, "forbidden", err.Error())
+	case errors.Is(err, repository.ErrRoomUnavailable):
+		WriteError(w, http.StatusConflict, "room_unavailable", err.Error())
+	case errors.Is(err, service.ErrQuoteChanged):
+		WriteError(w, http.StatusConflict, "quote_changed", err.Error())
+	case errors.Is(err, service.ErrPaymentDeclined):
+		WriteError(w, http.StatusPaymentRequired, "payment_declined", err.Error())
+	case errors.Is(err, payment.ErrTimeout):
+		WriteError(w, http.StatusGatewayTimeout, "payment_timeout", "the payment provider did not answer, please try again")
+	default:
+		log.Printf("api: %v", err)
+		WriteError(w, http.StatusInternalServerError, "internal_error", "internal server error")
+	}
+}
+
+// decodeJSON reads the request body into v, rejecting unknown fields.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_json", "invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// pathID parses the {id} path parameter.
+func pathID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		WriteError(w, http.StatusBadRequest, "invalid_id", "invalid id in path")
+		return 0, false
+	}
+	return id, true
+}
+
+// parseDate parses a YYYY-MM-DD date, naming the field in the error.
+func parseDate(w http.ResponseWriter, field, value string) (time.Time, bool) {
+	t, err := time.Parse(dateLayout, value)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_request", field+" must be a date in YYYY-MM-DD format")
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// stayDates reads the checkin_date and checkout_date query parameters.
+func stayDates(w http.ResponseWriter, r *http.Request) (time.Time, time.Time, bool) {
+	checkin, ok := parseDate(w, "checkin_date", r.URL.Query().Get("checkin_date"))
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	checkout, ok := parseDate(w, "checkout_date", r.URL.Query().Get("checkout_date"))
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	return checkin, checkout, true
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"hotelm/models"
+	"hotelm/service"
+)
+
+// ListRooms searches the rooms free for a stay. It takes the same query
+// parameters as the rooms page; see service.ParseRoomSearch.
+func ListRooms(w http.ResponseWriter, r *http.Request) {
+	filter, err := service.ParseRoomSearch(r.URL.Query())
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	result, err := service.SearchRooms(filter)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// GetRoom returns a single room.
+func GetRoom(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	room, err := service.GetRoom(id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, room)
+}
+
+// ListRoomReviews returns the reviews of a room.
+func ListRoomReviews(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	_, reviews, err := service.GetRoomReviews(id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if reviews == nil {
+		reviews = []models.Review{}
+	}
+	writeJSON(w, http.StatusOK, reviews)
+}
+
+// QuoteRoom prices a stay in a room. The quote's total is what
+// POST /api/v1/bookings expects as quoted_total. With ?display_currency=,
+// or for a customer who chose a display currency, the quote also carries
+// the total converted to it. ?promo_code= takes the code's discount off; the
+// code's limits are checked for the logged-in customer, if any.
+func QuoteRoom(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	checkin, checkout, ok := stayDates(w, r)
+	if !ok {
+		return
+	}
+	if err := service.ValidateStayDates(id, checkin, checkout); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	quote, err := service.QuoteStayWithPromo(r.Context(), id, checkin, checkout, r.URL.Query().Get("promo_code"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	display := strings.ToUpper(r.URL.Query().Get("display_currency"))
+	if display == "" {
+		display = service.DisplayCurrency(r.Context())
+	}
+	if quote.Display, err = service.ConvertForDisplay(quote.Total, display); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, quote)
+}
+
+// GetCancellationPolicy returns the cancellation policy of a room.
+func GetCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	policy, err := service.GetRoomCancellationPolicy(id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, policy)
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"net/http"
+
+	"hotelm/models"
+	"hotelm/repository"
+	"hotelm/service"
+	"hotelm/session"
+)
+
+// ticketRequest is the body of POST /api/v1/tickets.
+type ticketRequest struct {
+	Category  string `json:"category"`
+	Priority  string `json:"priority"` // defaults to "normal"
+	Subject   string `json:"subject"`
+	Body      string `json:"body"`
+	BookingID int    `json:"booking_id"`
+	PaymentID int    `json:"payment_id"`
+}
+
+// ticketResponse is a ticket together with its replies and status history.
+type ticketResponse struct {
+	*models.SupportTicket
+	Replies []models.TicketReply `json:"replies"`
+	Events  []models.TicketEvent `json:"events"`
+}
+
+// ListTickets returns the tickets opened by the logged-in customer or
+// vendor, or for an admin every ticket matching the status, priority and
+// category query parameters.
+func ListTickets(w http.ResponseWriter, r *http.Request) {
+	var tickets []models.SupportTicket
+	var err error
+	if p := session.FromContext(r.Context()); p != nil && p.Role == session.RoleAdmin {
+		q := r.URL.Query()
+		tickets, err = service.ListTickets(r.Context(), repository.TicketFilter{
+			Status:   q.Get("status"),
+			Priority: q.Get("priority"),
+			Category: q.Get("category"),
+		})
+	} else {
+		tickets, err = service.GetMyTickets(r.Context())
+	}
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if tickets == nil {
+		tickets = []models.SupportTicket{}
+	}
+	writeJSON(w, http.StatusOK, tickets)
+}
+
+// CreateTicket opens a support ticket.
+func CreateTicket(w http.ResponseWriter, r *http.Request) {
+	var req ticketRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	id, err := service.OpenTicket(r.Context(), service.NewTicket{
+		Category:  req.Category,
+		Priority:  req.Priority,
+		Subject:   req.Subject,
+		Body:      req.Body,
+		BookingID: req.BookingID,
+		PaymentID: req.PaymentID,
+	})
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeTicket(w, r, id, http.StatusCreated)
+}
+
+// GetTicket returns a ticket with its replies and history.
+func GetTicket(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	writeTicket(w, r, id, http.StatusOK)
+}
+
+// writeTicket writes a ticket with its replies and history.
+func writeTicket(w http.ResponseWriter, r *http.Request, id, status int) {
+	ticket, replies, events, err := service.GetTicket(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if replies == nil {
+		replies = []models.TicketReply{}
+	}
+	if events == nil {
+		events = []models.TicketEvent{}
+	}
+	writeJSON(w, status, ticketResponse{SupportTicket: ticket, Replies: replies, Events: events})
+}
+
+// CreateTicketReply adds a reply to a ticket.
+func CreateTicketReply(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req messageRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	replyID, err := service.ReplyToTicket(r.Context(), id, req.Body)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]int{"reply_id": replyID})
+}
+
+// SetTicketStatus moves a ticket to the status in the body,
+// {"status": "closed"}.
+func SetTicketStatus(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Status string `json:"status"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := service.SetTicketStatus(r.Context(), id, req.Status); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeTicket(w, r, id, http.StatusOK)
+}
+
+// TriageTicket sets the category and priority of a ticket.
+func TriageTicket(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Category string `json:"category"`
+		Priority string `json:"priority"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := service.TriageTicket(r.Context(), id, req.Category, req.Priority); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeTicket(w, r, id, http.StatusOK)
+}
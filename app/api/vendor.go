@@ -0,0 +1,179 @@
+package api
+
+import (
+	"net/http"
+
+	"hotelm/models"
+	"hotelm/money"
+	"hotelm/service"
+)
+
+// roomRequest is the body of POST and PUT /api/v1/vendor/rooms. The rating is
+// derived from reviews and cannot be set. A price given as a bare amount is
+// in the default currency. Amenities are picked from GET /api/v1/amenities.
+// A room is placed in one of the vendor's properties; it may be left out
+// when the vendor has only one, and on update to keep the room where it is.
+type roomRequest struct {
+	PropertyID   int         `json:"property_id"`
+	Name         string      `json:"name"`
+	Description  string      `json:"description"`
+	Location     string      `json:"location"`
+	Availability *bool       `json:"availability"`
+	Price        money.Money `json:"price"`
+	RoomType     string      `json:"room_type"`
+	AmenityIDs   []int       `json:"amenity_ids"`
+}
+
+// room converts the request to a room, listing it unless told otherwise.
+func (req roomRequest) room() models.Room {
+	available := true
+	if req.Availability != nil {
+		available = *req.Availability
+	}
+	amenities := make([]models.Amenity, len(req.AmenityIDs))
+	for i, id := range req.AmenityIDs {
+		amenities[i] = models.Amenity{AmenityID: id}
+	}
+	return models.Room{
+		PropertyID:   req.PropertyID,
+		Name:         req.Name,
+		Description:  req.Description,
+		Location:     req.Location,
+		Availability: available,
+		Price:        req.Price,
+		RoomType:     req.RoomType,
+		Amenities:    amenities,
+	}
+}
+
+// ListVendorRooms returns the logged-in vendor's rooms, only those of one
+// property with ?property_id=.
+func ListVendorRooms(w http.ResponseWriter, r *http.Request) {
+	propertyID, ok := queryPropertyID(w, r)
+	if !ok {
+		return
+	}
+	rooms, err := service.GetVendorRooms(r.Context(), propertyID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if rooms == nil {
+		rooms = []models.Room{}
+	}
+	writeJSON(w, http.StatusOK, rooms)
+}
+
+// CreateVendorRoom adds a room for the logged-in vendor.
+func CreateVendorRoom(w http.ResponseWriter, r *http.Request) {
+	var req roomRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	id, err := service.CreateRoomForVendor(r.Context(), req.room())
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	room, err := service.GetRoomByIDForVendor(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, room)
+}
+
+// GetVendorRoom returns a room of the logged-in vendor.
+func GetVendorRoom(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	room, err := service.GetRoomByIDForVendor(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, room)
+}
+
+// UpdateVendorRoom replaces the details of a room of the logged-in vendor.
+func UpdateVendorRoom(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req roomRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	room := req.room()
+	room.RoomID = id
+	if err := service.UpdateRoomForVendor(r.Context(), room); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	updated, err := service.GetRoomByIDForVendor(r.Context(), id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// DeleteVendorRoom deletes a room of the logged-in vendor.
+func DeleteVendorRoom(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if err := service.DeleteRoomForVendor(r.Context(), id); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListVendorPayments returns the payments for the logged-in vendor's rooms.
+func ListVendorPayments(w http.ResponseWriter, r *http.Request) {
+	payments, err := service.GetVendorPayments(r.Context())
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if payments == nil {
+		payments = []service.VendorPayment{}
+	}
+	writeJSON(w, http.StatusOK, payments)
+}
+
+// ListVendorBookings returns the bookings of the logged-in vendor's rooms.
+func ListVendorBookings(w http.ResponseWriter, r *http.Request) {
+	bookings, err := service.GetVendorBookings(r.Context())
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if bookings == nil {
+		bookings = []models.Booking{}
+	}
+	writeJSON(w, http.StatusOK, bookings)
+}
+
+// SetCancellationPolicy sets the cancellation policy of a room of the
+// logged-in vendor. The body is a models.CancellationPolicy.
+func SetCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var policy models.CancellationPolicy
+	if !decodeJSON(w, r, &policy) {
+		return
+	}
+	if err := service.SetRoomCancellationPolicy(r.Context(), id, policy); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, policy)
+}
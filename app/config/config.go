@@ -0,0 +1,425 @@
+// Package config loads the application settings. Each setting can come from
+// a config file, an environment variable or a command-line flag; later
+// sources override earlier ones:
+//
+//	defaults < config file < environment < flags
+//
+// The config file holds KEY=VALUE lines using the environment variable names,
+// e.g. HOTELM_DB_HOST=db.internal. Blank lines and lines starting with # are
+// ignored. Its path is given by --config or HOTELM_CONFIG.
+package config
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds every setting of the application.
+type Config struct {
+	DBHost            string
+	DBPort            int
+	DBUser            string
+	DBPassword        string
+	DBName            string
+	DBSSLMode         string
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+
+	ListenAddr        string
+	TemplateDir       string
+	SessionSecret     string
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+
+	PaymentGateway string
+	// ExchangeRatesFile is a JSON file of exchange rates loaded at startup
+	// and on request from the admin console. Empty means rates are only
+	// maintained by admins.
+	ExchangeRatesFile string
+
+	// BlobStore selects where uploaded photos are kept: "local" files under
+	// BlobDir, or "s3" objects in an S3-compatible bucket.
+	BlobStore   string
+	BlobDir     string
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PathStyle bool
+}
+
+// Default returns the settings used when nothing else is configured. They
+// match the local development database.
+func Default() Config {
+	return Config{
+		DBHost:            "localhost",
+		DBPort:            5434,
+		DBUser:            "postgres",
+		DBName:            "mydb",
+		DBSSLMode:         "disable",
+		DBMaxOpenConns:    20,
+		DBMaxIdleConns:    5,
+		DBConnMaxLifetime: 30 * time.Minute,
+
+		ListenAddr:        ":8080",
+		TemplateDir:       "templates",
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		ShutdownTimeout:   15 * time.Second,
+
+		PaymentGateway: "fake",
+
+		BlobStore: "local",
+		BlobDir:   "uploads",
+		S3Region:  "us-east-1",
+	}
+}
+
+// setting describes one configurable value.
+type setting struct {
+	flag   string   // flag name, e.g. "db-host"
+	env    []string // environment variables, the first is the canonical name
+	usage  string
+	secret bool
+	value  func(c *Config) flag.Value
+}
+
+// settings lists every setting. The environment variable names double as the
+// config file keys.
+var settings = []setting{
+	{flag: "db-host", env: []string{"HOTELM_DB_HOST"}, usage: "database host",
+		value: func(c *Config) flag.Value { return (*stringValue)(&c.DBHost) }},
+	{flag: "db-port", env: []string{"HOTELM_DB_PORT"}, usage: "database port",
+		value: func(c *Config) flag.Value { return (*intValue)(&c.DBPort) }},
+	{flag: "db-user", env: []string{"HOTELM_DB_USER"}, usage: "database user",
+		value: func(c *Config) flag.Value { return (*stringValue)(&c.DBUser) }},
+	{flag: "db-password", env: []string{"HOTELM_DB_PASSWORD"}, usage: "database password", secret: true,
+		value: func(c *Config) flag.Value { return (*stringValue)(&c.DBPassword) }},
+	{flag: "db-name", env: []string{"HOTELM_DB_NAME"}, usage: "database name",
+		value: func(c *Config) flag.Value { return (*stringValue)(&c.DBName) }},
+	{flag: "db-sslmode", env: []string{"HOTELM_DB_SSLMODE"}, usage: "database sslmode (disable, require, verify-ca, verify-full)",
+		value: func(c *Config) flag.Value { return (*stringValue)(&c.DBSSLMode) }},
+	{flag: "db-max-open-conns", env: []string{"HOTELM_DB_MAX_OPEN_CONNS"}, usage: "maximum open database connections",
+		value: func(c *Config) flag.Value { return (*intValue)(&c.DBMaxOpenConns) }},
+	{flag: "db-max-idle-conns", env: []string{"HOTELM_DB_MAX_IDLE_CONNS"}, usage: "maximum idle database connections",
+		value: func(c *Config) flag.Value { return (*intValue)(&c.DBMaxIdleConns) }},
+	{flag: "db-conn-max-lifetime", env: []string{"HOTELM_DB_CONN_MAX_LIFETIME"}, usage: "maximum lifetime of a database connection",
+		value: func(c *Config) flag.Value { return (*durationValue)(&c.DBConnMaxLifetime) }},
+
+	{flag: "listen-addr", env: []string{"HOTELM_LISTEN_ADDR"}, usage: "HTTP listen address",
+		value: func(c *Config) flag.Value { return (*stringValue)(&c.ListenAddr) }},
+	{flag: "template-dir", env: []string{"HOTELM_TEMPLATE_DIR"}, usage: "directory holding the HTML templates",
+		value: func(c *Config) flag.Value { return (*stringValue)(&c.TemplateDir) }},
+	// SESSION_SECRET is the name used before this package existed.
+	{flag: "session-secret", env: []string{"HOTELM_SESSION_SECRET", "SESSION_SECRET"}, usage: "key that signs session cookies", secret: true,
+		value: func(c *Config) flag.Value { return (*stringValue)(&c.SessionSecret) }},
+	{flag: "read-header-timeout", env: []string{"HOTELM_READ_HEADER_TIMEOUT"}, usage: "time allowed to read request headers",
+		value: func(c *Config) flag.Value { return (*durationValue)(&c.ReadHeaderTimeout) }},
+	{flag: "read-timeout", env: []string{"HOTELM_READ_TIMEOUT"}, usage: "time allowed to read a whole request",
+		value: func(c *Config) flag.Value { return (*durationValue)(&c.ReadTimeout) }},
+	{flag: "write-timeout", env: []string{"HOTELM_WRITE_TIMEOUT"}, usage: "time allowed to write a response",
+		value: func(c *Config) flag.Value { return (*durationValue)(&c.WriteTimeout) }},
+	{flag: "idle-timeout", env: []string{"HOTELM_IDLE_TIMEOUT"}, usage: "how long idle keep-alive connections stay open",
+		value: func(c *Config) flag.Value { return (*durationValue)(&c.IdleTimeout) }},
+	{flag: "shutdown-timeout", env: []string{"HOTELM_SHUTDOWN_TIMEOUT"}, usage: "time allowed for in-flight requests on shutdown",
+		value: func(c *Config) flag.Value { return (*durationValue)(&c.ShutdownTimeout) }},
+
+	{flag: "payment-gateway", env: []string{"HOTELM_PAYMENT_GATEWAY"}, usage: "payment provider (fake)",
+		value: func(c *Config) flag.Value { return (*stringValue)(&c.PaymentGateway) }},
+	{flag: "exchange-rates-file", env: []string{"HOTELM_EXCHANGE_RATES_FILE"}, usage: "JSON file of exchange rates to load at startup",
+		value: func(c *Config) flag.Value { return (*stringValue)(&c.ExchangeRatesFile) }},
+
+	{flag: "blob-store", env: []string{"HOTELM_BLOB_STORE"}, usage: "where uploaded photos are kept (local, s3)",
+		value: func(c *Config) flag.Value { return (*stringValue)(&c.BlobStore) }},
+	{flag: "blob-dir", env: []string{"HOTELM_BLOB_DIR"}, usage: "directory of the local blob store",
+		value: func(c *Config) flag.Value { return (*stringValue)(&c.BlobDir) }},
+	{flag: "s3-endpoint", env: []string{"HOTELM_S3_ENDPOINT"}, usage: "base URL of the S3-compatible service",
+		value: func(c *Config) flag.Value { return (*stringValue)(&c.S3Endpoint) }},
+	{flag: "s3-region", env: []string{"HOTELM_S3_REGION"}, usage: "region requests to the S3 service are signed for",
+		value: func(c *Config) flag.Value { return (*stringValue)(&c.S3Region) }},
+	{flag: "s3-bucket", env: []string{"HOTELM_S3_BUCKET"}, usage: "bucket uploaded photos are kept in",
+		value: func(c *Config) flag.Value { return (*stringValue)(&c.S3Bucket) }},
+	{flag: "s3-access-key", env: []string{"HOTELM_S3_ACCESS_KEY"}, usage: "access key ID for the S3 service",
+		value: func(c *Config) flag.Value { return (*stringValue)(&c.S3AccessKey) }},
+	{flag: "s3-secret-key", env: []string{"HOTELM_S3_SECRET_KEY"}, usage: "secret access key for the S3 service", secret: true,
+		value: func(c *Config) flag.Value { return (*stringValue)(&c.S3SecretKey) }},
+	{flag: "s3-path-style", env: []string{"HOTELM_S3_PATH_STYLE"}, usage: "put the bucket in the URL path, as local S3 stand-ins need",
+		value: func(c *Config) flag.Value { return (*boolValue)(&c.S3PathStyle) }},
+}
+
+// Options are the command-line options that are not settings.
+type Options struct {
+	PrintConfig bool     // --print-config: print the settings and exit
+	Args        []string // arguments left after the flags, e.g. a subcommand
+}
+
+// Load builds the configuration from the defaults, the config file, the
+// environment and the command-line arguments (without the program name).
+func Load(args []string) (*Config, *Options, error) {
+	cfg := Default()
+	opts := &Options{}
+
+	// Flags are parsed first to find --config, but applied last.
+	fs := flag.NewFlagSet("hotelm", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("HOTELM_CONFIG"), "path of a KEY=VALUE config file")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the configuration with secrets redacted and exit")
+	for _, s := range settings {
+		usage := s.usage + " (env " + s.env[0] + ")"
+		// Switches can be given without a value, e.g. --s3-path-style.
+		if _, ok := s.value(&cfg).(*boolValue); ok {
+			fs.Bool(s.flag, false, usage)
+			continue
+		}
+		fs.String(s.flag, "", usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	opts.Args = fs.Args()
+
+	if *configFile != "" {
+		if err := cfg.loadFile(*configFile); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, s := range settings {
+		for i := len(s.env) - 1; i >= 0; i-- {
+			if v, ok := os.LookupEnv(s.env[i]); ok {
+				if err := s.value(&cfg).Set(v); err != nil {
+					return nil, nil, fmt.Errorf("invalid %s: %v", s.env[i], err)
+				}
+			}
+		}
+	}
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name && err == nil {
+				if setErr := s.value(&cfg).Set(f.Value.String()); setErr != nil {
+					err = fmt.Errorf("invalid --%s: %v", s.flag, setErr)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return &cfg, opts, nil
+}
+
+// loadFile applies the KEY=VALUE lines of a config file.
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %v", err)
+	}
+	defer f.Close()
+
+	byKey := map[string]setting{}
+	for _, s := range settings {
+		for _, env := range s.env {
+			byKey[env] = s
+		}
+	}
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return fmt.Errorf("%s:%d: expected KEY=VALUE", path, line)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		s, ok := byKey[key]
+		if !ok {
+			return fmt.Errorf("%s:%d: unknown setting %s", path, line, key)
+		}
+		if err := s.value(c).Set(value); err != nil {
+			return fmt.Errorf("%s:%d: invalid %s: %v", path, line, key, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	return nil
+}
+
+// Validate checks that the settings are usable.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.DBHost == "" {
+		errs = append(errs, errors.New("db-host is required"))
+	}
+	if c.DBPort < 1 || c.DBPort > 65535 {
+		errs = append(errs, fmt.Errorf("db-port %d is out of range", c.DBPort))
+	}
+	if c.DBUser == "" {
+		errs = append(errs, errors.New("db-user is required"))
+	}
+	if c.DBName == "" {
+		errs = append(errs, errors.New("db-name is required"))
+	}
+	switch c.DBSSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		errs = append(errs, fmt.Errorf("db-sslmode %q is not a valid sslmode", c.DBSSLMode))
+	}
+	if c.DBMaxOpenConns < 1 {
+		errs = append(errs, errors.New("db-max-open-conns must be at least 1"))
+	}
+	if c.DBMaxIdleConns < 0 || c.DBMaxIdleConns > c.DBMaxOpenConns {
+		errs = append(errs, errors.New("db-max-idle-conns must be between 0 and db-max-open-conns"))
+	}
+	if c.ListenAddr == "" {
+		errs = append(errs, errors.New("listen-addr is required"))
+	}
+	if c.TemplateDir == "" {
+		errs = append(errs, errors.New("template-dir is required"))
+	}
+	if c.SessionSecret != "" && len(c.SessionSecret) < 32 {
+		errs = append(errs, errors.New("session-secret must be at least 32 characters"))
+	}
+	if c.PaymentGateway == "" {
+		errs = append(errs, errors.New("payment-gateway is required"))
+	}
+	switch c.BlobStore {
+	case "local":
+		if c.BlobDir == "" {
+			errs = append(errs, errors.New("blob-dir is required for the local blob store"))
+		}
+	case "s3":
+		if c.S3Endpoint == "" || c.S3Bucket == "" {
+			errs = append(errs, errors.New("s3-endpoint and s3-bucket are required for the s3 blob store"))
+		}
+		if c.S3AccessKey == "" || c.S3SecretKey == "" {
+			errs = append(errs, errors.New("s3-access-key and s3-secret-key are required for the s3 blob store"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("blob-store %q is not local or s3", c.BlobStore))
+	}
+	durations := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"db-conn-max-lifetime", c.DBConnMaxLifetime},
+		{"read-header-timeout", c.ReadHeaderTimeout},
+		{"read-timeout", c.ReadTimeout},
+		{"write-timeout", c.WriteTimeout},
+		{"idle-timeout", c.IdleTimeout},
+		{"shutdown-timeout", c.ShutdownTimeout},
+	}
+	for _, d := range durations {
+		if d.d < 0 {
+			errs = append(errs, fmt.Errorf("%s cannot be negative", d.name))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// DSN returns the lib/pq connection string for the database settings.
+func (c *Config) DSN() string {
+	parts := []string{
+		"host=" + quoteDSN(c.DBHost),
+		"port=" + strconv.Itoa(c.DBPort),
+		"user=" + quoteDSN(c.DBUser),
+		"dbname=" + quoteDSN(c.DBName),
+		"sslmode=" + quoteDSN(c.DBSSLMode),
+	}
+	if c.DBPassword != "" {
+		parts = append(parts, "password="+quoteDSN(c.DBPassword))
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteDSN quotes a connection string value if it is empty or contains
+// spaces, quotes or backslashes.
+func quoteDSN(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
+
+// Print writes every setting as KEY=VALUE, the config file format, with
+// secrets redacted.
+func (c *Config) Print(w io.Writer) {
+	for _, s := range settings {
+		v := s.value(c).String()
+		if s.secret && v != "" {
+			v = "[redacted]"
+		}
+		fmt.Fprintf(w, "%s=%s\n", s.env[0], v)
+	}
+}
+
+// stringValue, intValue, boolValue and durationValue adapt Config fields to
+// flag.Value.
+type stringValue string
+
+func (v *stringValue) Set(s string) error { *v = stringValue(s); return nil }
+func (v *stringValue) String() string     { return string(*v) }
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("%q is not a whole number", s)
+	}
+	*v = intValue(n)
+	return nil
+}
+func (v *intValue) String() string { return strconv.Itoa(int(*v)) }
+
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("%q is not true or false", s)
+	}
+	*v = boolValue(b)
+	return nil
+}
+func (v *boolValue) String() string { return strconv.FormatBool(bool(*v)) }
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("%q is not a duration such as 30s or 5m", s)
+	}
+	*v = durationValue(d)
+	return nil
+}
+func (v *durationValue) String() string { return time.Duration(*v).String() }
@@ -0,0 +1,279 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// clearEnv unsets every setting's environment variable for the rest of the
+// test, so the tests do not depend on the environment they run in.
+func clearEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("HOTELM_CONFIG", "")
+	for _, s := range settings {
+		for _, env := range s.env {
+			t.Setenv(env, "") // restores the variable after the test
+			os.Unsetenv(env)
+		}
+	}
+}
+
+// writeFile writes a config file and returns its path.
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hotelm.conf")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string            // config file content, none if empty
+		fileEnv bool              // the file is given by HOTELM_CONFIG, not --config
+		env     map[string]string // environment variables
+		args    []string
+		want    string // DBHost
+	}{
+		{name: "default", want: "localhost"},
+		{name: "file", file: "HOTELM_DB_HOST=file", want: "file"},
+		{name: "env over default", env: map[string]string{"HOTELM_DB_HOST": "env"}, want: "env"},
+		{name: "env over file", file: "HOTELM_DB_HOST=file", env: map[string]string{"HOTELM_DB_HOST": "env"}, want: "env"},
+		{name: "flag over env and file", file: "HOTELM_DB_HOST=file", env: map[string]string{"HOTELM_DB_HOST": "env"},
+			args: []string{"--db-host", "flag"}, want: "flag"},
+		{name: "flag over file", file: "HOTELM_DB_HOST=file", args: []string{"--db-host=flag"}, want: "flag"},
+		{name: "config file from the environment", file: "HOTELM_DB_HOST=file", fileEnv: true, want: "file"},
+		{name: "quoted value and comments", file: "# database\n\nHOTELM_DB_HOST = \"db.internal\"\n", want: "db.internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			args := tt.args
+			if tt.file != "" {
+				path := writeFile(t, tt.file)
+				if tt.fileEnv {
+					t.Setenv("HOTELM_CONFIG", path)
+				} else {
+					args = append([]string{"--config", path}, args...)
+				}
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			cfg, _, err := Load(args)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.DBHost != tt.want {
+				t.Errorf("DBHost = %q, want %q", cfg.DBHost, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTypes(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("HOTELM_DB_PORT", "6543")
+	t.Setenv("HOTELM_READ_TIMEOUT", "1m")
+	cfg, opts, err := Load([]string{"--print-config", "--db-max-open-conns", "40", "migrate", "up"})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.DBPort != 6543 || cfg.DBMaxOpenConns != 40 || cfg.ReadTimeout.String() != "1m0s" {
+		t.Errorf("DBPort %d, DBMaxOpenConns %d, ReadTimeout %s", cfg.DBPort, cfg.DBMaxOpenConns, cfg.ReadTimeout)
+	}
+	if !opts.PrintConfig || strings.Join(opts.Args, " ") != "migrate up" {
+		t.Errorf("options %+v", opts)
+	}
+}
+
+func TestLoadSessionSecretName(t *testing.T) {
+	old, canonical := strings.Repeat("o", 32), strings.Repeat("c", 32)
+	clearEnv(t)
+	t.Setenv("SESSION_SECRET", old)
+	if cfg, _, err := Load(nil); err != nil || cfg.SessionSecret != old {
+		t.Errorf("SESSION_SECRET alone: %v, want it used", err)
+	}
+	t.Setenv("HOTELM_SESSION_SECRET", canonical)
+	if cfg, _, err := Load(nil); err != nil || cfg.SessionSecret != canonical {
+		t.Errorf("both names: %v, want HOTELM_SESSION_SECRET used", err)
+	}
+}
+
+func TestLoadPathStyle(t *testing.T) {
+	tests := []struct {
+		env  string
+		args []string
+		want bool
+	}{
+		{"", nil, false},
+		{"", []string{"--s3-path-style"}, true},
+		{"", []string{"--s3-path-style=true"}, true},
+		{"true", nil, true},
+		{"true", []string{"--s3-path-style=false"}, false},
+		{"false", []string{"--s3-path-style"}, true},
+		{"1", nil, true},
+	}
+	for _, tt := range tests {
+		clearEnv(t)
+		if tt.env != "" {
+			t.Setenv("HOTELM_S3_PATH_STYLE", tt.env)
+		}
+		// A switch without a value must not take the next argument.
+		cfg, opts, err := Load(append(tt.args, "serve"))
+		if err != nil {
+			t.Errorf("env %q, args %q: %v", tt.env, tt.args, err)
+			continue
+		}
+		if cfg.S3PathStyle != tt.want || len(opts.Args) != 1 || opts.Args[0] != "serve" {
+			t.Errorf("env %q, args %q: S3PathStyle %v, arguments %q, want %v and [serve]", tt.env, tt.args, cfg.S3PathStyle, opts.Args, tt.want)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{name: "bad env int", env: map[string]string{"HOTELM_DB_PORT": "abc"}, want: "invalid HOTELM_DB_PORT"},
+		{name: "bad env bool", env: map[string]string{"HOTELM_S3_PATH_STYLE": "yes please"}, want: "invalid HOTELM_S3_PATH_STYLE"},
+		{name: "bad flag duration", args: []string{"--read-timeout", "soon"}, want: "invalid --read-timeout"},
+		{name: "bad flag bool", args: []string{"--s3-path-style=maybe"}, want: "s3-path-style"},
+		{name: "unknown flag", args: []string{"--no-such-flag"}, want: "no-such-flag"},
+		{name: "unknown file key", file: "HOTELM_DB_HOST=a\nDB_HOST=b", want: ":2: unknown setting DB_HOST"},
+		{name: "file line without =", file: "HOTELM_DB_HOST", want: ":1: expected KEY=VALUE"},
+		{name: "bad file value", file: "HOTELM_DB_PORT=x", want: ":1: invalid HOTELM_DB_PORT"},
+		{name: "missing file", args: []string{"--config", "/no/such/file"}, want: "failed to open config file"},
+		{name: "invalid result", args: []string{"--db-port", "0"}, want: "db-port 0 is out of range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"--config", writeFile(t, tt.file)}, args...)
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			if _, _, err := Load(args); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load: %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s3 := func(c *Config) {
+		c.BlobStore = "s3"
+		c.S3Endpoint, c.S3Bucket = "https://s3.example.com", "photos"
+		c.S3AccessKey, c.S3SecretKey = "key", "secret"
+	}
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   string // part of the error, none if empty
+	}{
+		{"defaults", func(c *Config) {}, ""},
+		{"session secret of 32 characters", func(c *Config) { c.SessionSecret = strings.Repeat("x", 32) }, ""},
+		{"session secret of 31 characters", func(c *Config) { c.SessionSecret = strings.Repeat("x", 31) }, "session-secret must be at least 32 characters"},
+		{"s3", s3, ""},
+		{"s3 without endpoint", func(c *Config) { s3(c); c.S3Endpoint = "" }, "s3-endpoint and s3-bucket are required"},
+		{"s3 without bucket", func(c *Config) { s3(c); c.S3Bucket = "" }, "s3-endpoint and s3-bucket are required"},
+		{"s3 without access key", func(c *Config) { s3(c); c.S3AccessKey = "" }, "s3-access-key and s3-secret-key are required"},
+		{"s3 without secret key", func(c *Config) { s3(c); c.S3SecretKey = "" }, "s3-access-key and s3-secret-key are required"},
+		{"local ignores s3 fields", func(c *Config) { c.S3Endpoint = "" }, ""},
+		{"local without dir", func(c *Config) { c.BlobDir = "" }, "blob-dir is required"},
+		{"unknown blob store", func(c *Config) { c.BlobStore = "ftp" }, `blob-store "ftp" is not local or s3`},
+		{"no db host", func(c *Config) { c.DBHost = "" }, "db-host is required"},
+		{"db port too large", func(c *Config) { c.DBPort = 70000 }, "db-port 70000 is out of range"},
+		{"bad sslmode", func(c *Config) { c.DBSSLMode = "on" }, `db-sslmode "on"`},
+		{"more idle than open conns", func(c *Config) { c.DBMaxIdleConns = 50 }, "db-max-idle-conns"},
+		{"negative timeout", func(c *Config) { c.ReadTimeout = -1 }, "read-timeout cannot be negative"},
+	}
+	for _, tt := range tests {
+		c := Default()
+		tt.change(&c)
+		err := c.Validate()
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: %v, want an error containing %q", tt.name, err, tt.want)
+		}
+	}
+
+	// Every problem is reported at once.
+	c := Default()
+	c.DBHost, c.BlobStore = "", "ftp"
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "db-host") || !strings.Contains(err.Error(), "blob-store") {
+		t.Errorf("two problems: %v, want both reported", err)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	c := Default()
+	c.DBPassword = "hunter2"
+	c.SessionSecret = strings.Repeat("s", 32)
+	c.S3PathStyle = true
+	var out strings.Builder
+	c.Print(&out)
+
+	lines := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		key, value, _ := strings.Cut(line, "=")
+		lines[key] = value
+	}
+	if len(lines) != len(settings) {
+		t.Errorf("printed %d settings, want %d", len(lines), len(settings))
+	}
+	for key, want := range map[string]string{
+		"HOTELM_DB_PASSWORD":    "[redacted]",
+		"HOTELM_SESSION_SECRET": "[redacted]",
+		"HOTELM_S3_SECRET_KEY":  "", // an unset secret is shown as unset
+		"HOTELM_DB_HOST":        "localhost",
+		"HOTELM_DB_PORT":        "5434",
+		"HOTELM_READ_TIMEOUT":   "15s",
+		"HOTELM_S3_PATH_STYLE":  "true",
+	} {
+		if got, ok := lines[key]; !ok || got != want {
+			t.Errorf("%s=%q, want %q", key, got, want)
+		}
+	}
+	if strings.Contains(out.String(), "hunter2") || strings.Contains(out.String(), c.SessionSecret) {
+		t.Errorf("a secret was printed:\n%s", out.String())
+	}
+
+	// The output is a config file giving the same settings.
+	clearEnv(t)
+	cfg, _, err := Load([]string{"--config", writeFile(t, strings.ReplaceAll(out.String(), "[redacted]", ""))})
+	if err != nil {
+		t.Fatalf("Load of the printed settings: %v", err)
+	}
+	c.DBPassword, c.SessionSecret = "", ""
+	if *cfg != c {
+		t.Errorf("printed settings load as %+v, want %+v", *cfg, c)
+	}
+}
+
+func TestDSN(t *testing.T) {
+	c := Default()
+	if got, want := c.DSN(), "host=localhost port=5434 user=postgres dbname=mydb sslmode=disable"; got != want {
+		t.Errorf("DSN = %q, want %q", got, want)
+	}
+	c.DBPassword = `it's a \secret`
+	if got, want := c.DSN(), `host=localhost port=5434 user=postgres dbname=mydb sslmode=disable password='it\'s a \\secret'`; got != want {
+		t.Errorf("DSN = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,205 @@
+// Package dbtest provides a scripted database for tests of code that runs
+// its queries through database/sql. No server is involved: every query is
+// answered by a function of the test, which sees the SQL and its arguments.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Result is the answer to a query: the rows it returns, or for a statement
+// without rows the number of rows it affected, or an error.
+type Result struct {
+	Columns      []string
+	Rows         [][]driver.Value
+	RowsAffected int64
+	Err          error
+}
+
+// Rows returns a result with one row per values, under the given columns.
+func Rows(columns []string, values ...[]driver.Value) Result {
+	return Result{Columns: columns, Rows: values}
+}
+
+// Affected returns the result of a statement that changed n rows.
+func Affected(n int64) Result {
+	return Result{RowsAffected: n}
+}
+
+// Fail returns a result failing with err.
+func Fail(err error) Result {
+	return Result{Err: err}
+}
+
+// Handler answers the queries of a test.
+type Handler func(query string, args []driver.Value) Result
+
+// Statement is a query that was run, with whether it ran in a transaction.
+type Statement struct {
+	Query string
+	Args  []driver.Value
+	InTx  bool
+}
+
+// DB records what happened on a scripted database.
+type DB struct {
+	handler Handler
+
+	mu         sync.Mutex
+	statements []Statement
+	inTx       bool
+	commits    int
+	rollbacks  int
+}
+
+// Open returns a database answering queries with h, and its record.
+func Open(h Handler) (*sql.DB, *DB) {
+	d := &DB{handler: h}
+	return sql.OpenDB(connector{d}), d
+}
+
+// Statements returns the queries run so far.
+func (d *DB) Statements() []Statement {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Statement(nil), d.statements...)
+}
+
+// Ran reports whether a query containing substr was run.
+func (d *DB) Ran(substr string) bool {
+	for _, s := range d.Statements() {
+		if strings.Contains(s.Query, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Commits returns the number of committed transactions.
+func (d *DB) Commits() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.commits
+}
+
+// Rollbacks returns the number of rolled back transactions.
+func (d *DB) Rollbacks() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.rollbacks
+}
+
+func (d *DB) run(query string, named []driver.NamedValue) Result {
+	args := make([]driver.Value, len(named))
+	for i, v := range named {
+		args[i] = v.Value
+	}
+	d.mu.Lock()
+	d.statements = append(d.statements, Statement{Query: query, Args: args, InTx: d.inTx})
+	d.mu.Unlock()
+	return d.handler(query, args)
+}
+
+type connector struct{ db *DB }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return &conn{db: c.db}, nil }
+func (c connector) Driver() driver.Driver                        { return drv{} }
+
+type drv struct{}
+
+func (drv) Open(string) (driver.Conn, error) {
+	return nil, errors.New("dbtest: use dbtest.Open")
+}
+
+type conn struct{ db *DB }
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) { return &stmt{c: c, query: query}, nil }
+func (c *conn) Close() error                              { return nil }
+
+func (c *conn) Begin() (driver.Tx, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.inTx = true
+	return tx{c.db}, nil
+}
+
+func (c *conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	res := c.db.run(query, args)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return &rows{columns: res.Columns, values: res.Rows}, nil
+}
+
+func (c *conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	res := c.db.run(query, args)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return driver.RowsAffected(res.RowsAffected), nil
+}
+
+type stmt struct {
+	c     *conn
+	query string
+}
+
+func (s *stmt) Close() error  { return nil }
+func (s *stmt) NumInput() int { return -1 }
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.c.ExecContext(context.Background(), s.query, named(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.c.QueryContext(context.Background(), s.query, named(args))
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	nv := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		nv[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return nv
+}
+
+type tx struct{ db *DB }
+
+func (t tx) Commit() error {
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+	t.db.inTx = false
+	t.db.commits++
+	return nil
+}
+
+func (t tx) Rollback() error {
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+	t.db.inTx = false
+	t.db.rollbacks++
+	return nil
+}
+
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *rows) Columns() []string { return r.columns }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
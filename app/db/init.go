@@ -4,20 +4,32 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"time"
 
 	_ "github.com/lib/pq" // PostgreSQL driver
 )
 
 var DB *sql.DB
 
-func Connect() {
-	connStr := "host=localhost port=5434 user=postgres dbname=mydb sslmode=disable"
+// PoolOptions sizes the connection pool.
+type PoolOptions struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// Connect opens the database described by the lib/pq connection string dsn
+// and checks that it is reachable.
+func Connect(dsn string, pool PoolOptions) {
 	var err error
 
-	DB, err = sql.Open("postgres", connStr)
+	DB, err = sql.Open("postgres", dsn)
 	if err != nil {
 		log.Fatalf("Error connecting to the database: %v", err)
 	}
+	DB.SetMaxOpenConns(pool.MaxOpenConns)
+	DB.SetMaxIdleConns(pool.MaxIdleConns)
+	DB.SetConnMaxLifetime(pool.ConnMaxLifetime)
 
 	err = DB.Ping()
 	if err != nil {
@@ -0,0 +1,259 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrations live in db/migrations as NNNN_name.up.sql and NNNN_name.down.sql
+// and are compiled into the binary. Applied versions are recorded in the
+// schema_migrations table.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the advisory lock key that serializes migration runs.
+const migrationLockID = 727601
+
+// Migration is one numbered schema change.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState is a migration and when it was applied, if it was.
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// LoadMigrations returns the embedded migrations ordered by version.
+func LoadMigrations() ([]Migration, error) {
+	return loadMigrations(migrationFiles)
+}
+
+// loadMigrations returns the migrations in the migrations directory of fsys
+// ordered by version.
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %v", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		file := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(file, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(file, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s: name must end in .up.sql or .down.sql", file)
+		}
+		base := strings.TrimSuffix(file, "."+direction+".sql")
+		prefix, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s: name must look like 0001_name.%s.sql", file, direction)
+		}
+
+		body, err := fs.ReadFile(fsys, path.Join("migrations", file))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %v", file, err)
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// ensureMigrationsTable creates the schema_migrations table if needed.
+func ensureMigrationsTable() error {
+	_, err := DB.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version     INT PRIMARY KEY,
+		name        VARCHAR(255) NOT NULL,
+		applied_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+	return nil
+}
+
+// appliedMigrations returns when each applied version was applied.
+func appliedMigrations(q Querier) (map[int]time.Time, error) {
+	rows, err := q.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %v", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("error scanning schema_migrations: %v", err)
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// MigrationStatus lists every known migration and whether it is applied.
+func MigrationStatus() ([]MigrationState, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(DB)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		state := MigrationState{Migration: m}
+		if at, ok := applied[m.Version]; ok {
+			state.AppliedAt = &at
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// runMigration applies or reverts one migration in its own transaction. The
+// advisory lock keeps two processes from migrating at the same time; the
+// state is re-read under the lock so a migration is never run twice.
+func runMigration(m Migration, up bool) (bool, error) {
+	ran := false
+	err := WithTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+			return fmt.Errorf("failed to lock schema_migrations: %v", err)
+		}
+		applied, err := appliedMigrations(tx)
+		if err != nil {
+			return err
+		}
+		if _, done := applied[m.Version]; done == up {
+			return nil
+		}
+
+		if up {
+			if _, err := tx.Exec(m.Up); err != nil {
+				return fmt.Errorf("migration %04d_%s failed: %v", m.Version, m.Name, err)
+			}
+			_, err = tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+		} else {
+			if _, err := tx.Exec(m.Down); err != nil {
+				return fmt.Errorf("reverting migration %04d_%s failed: %v", m.Version, m.Name, err)
+			}
+			_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to record migration %04d_%s: %v", m.Version, m.Name, err)
+		}
+		ran = true
+		return nil
+	})
+	return ran, err
+}
+
+// MigrateUp applies every pending migration in order and returns the ones it
+// applied.
+func MigrateUp() ([]Migration, error) {
+	states, err := MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, s := range states {
+		if s.AppliedAt != nil {
+			continue
+		}
+		ran, err := runMigration(s.Migration, true)
+		if err != nil {
+			return done, err
+		}
+		if ran {
+			done = append(done, s.Migration)
+		}
+	}
+	return done, nil
+}
+
+// MigrateDown reverts the latest steps applied migrations, newest first, and
+// returns the ones it reverted.
+func MigrateDown(steps int) ([]Migration, error) {
+	states, err := MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for i := len(states) - 1; i >= 0 && len(done) < steps; i-- {
+		if states[i].AppliedAt == nil {
+			continue
+		}
+		ran, err := runMigration(states[i].Migration, false)
+		if err != nil {
+			return done, err
+		}
+		if ran {
+			done = append(done, states[i].Migration)
+		}
+	}
+	return done, nil
+}
+
+// CheckSchema returns an error if the database is missing any migration, so
+// the server refuses to start against an outdated schema.
+func CheckSchema() error {
+	states, err := MigrationStatus()
+	if err != nil {
+		return err
+	}
+	var pending []string
+	for _, s := range states {
+		if s.AppliedAt == nil {
+			pending = append(pending, fmt.Sprintf("%04d_%s", s.Version, s.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is behind, %d pending migration(s): %s; run the \"migrate up\" command",
+			len(pending), strings.Join(pending, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package db
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"hotelm/db/dbtest"
+)
+
+// TestEmbeddedMigrations checks the migrations compiled into the binary.
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatalf("LoadMigrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations are embedded")
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Fatalf("migration %04d_%s follows version %d; versions must run 1, 2, 3, ... without gaps", m.Version, m.Name, i)
+		}
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			t.Errorf("migration %04d_%s has an empty up or down file", m.Version, m.Name)
+		}
+	}
+
+	// Every file is one half of a pair.
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2*len(migrations) {
+		t.Errorf("%d migration files for %d migrations", len(entries), len(migrations))
+	}
+	for _, m := range migrations {
+		for _, direction := range []string{"up", "down"} {
+			file := fmt.Sprintf("migrations/%04d_%s.%s.sql", m.Version, m.Name, direction)
+			if _, err := migrationFiles.ReadFile(file); err != nil {
+				t.Errorf("%s: %v", file, err)
+			}
+		}
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	file := func(sql string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(sql)} }
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		want  string // part of the error, none if empty
+	}{
+		{"ordered by version", fstest.MapFS{
+			"migrations/0010_later.up.sql":   file("CREATE TABLE b ()"),
+			"migrations/0010_later.down.sql": file("DROP TABLE b"),
+			"migrations/0002_first.up.sql":   file("CREATE TABLE a ()"),
+			"migrations/0002_first.down.sql": file("DROP TABLE a"),
+		}, ""},
+		{"duplicate version", fstest.MapFS{
+			"migrations/0001_users.up.sql":    file("CREATE TABLE users ()"),
+			"migrations/0001_users.down.sql":  file("DROP TABLE users"),
+			"migrations/0001_rooms.up.sql":    file("CREATE TABLE rooms ()"),
+			"migrations/0001_rooms.down.sql":  file("DROP TABLE rooms"),
+			"migrations/0002_photos.up.sql":   file("CREATE TABLE photos ()"),
+			"migrations/0002_photos.down.sql": file("DROP TABLE photos"),
+		}, "migration 1 has two names"},
+		{"no down file", fstest.MapFS{
+			"migrations/0001_users.up.sql": file("CREATE TABLE users ()"),
+		}, "0001_users needs both an up and a down file"},
+		{"no up file", fstest.MapFS{
+			"migrations/0001_users.down.sql": file("DROP TABLE users"),
+		}, "0001_users needs both an up and a down file"},
+		{"empty up file", fstest.MapFS{
+			"migrations/0001_users.up.sql":   file(""),
+			"migrations/0001_users.down.sql": file("DROP TABLE users"),
+		}, "needs both an up and a down file"},
+		{"other file", fstest.MapFS{
+			"migrations/README.sql": file("-- notes"),
+		}, "must end in .up.sql or .down.sql"},
+		{"no version", fstest.MapFS{
+			"migrations/users.up.sql": file("CREATE TABLE users ()"),
+		}, "must look like 0001_name.up.sql"},
+		{"version 0", fstest.MapFS{
+			"migrations/0000_users.up.sql": file("CREATE TABLE users ()"),
+		}, "must look like 0001_name.up.sql"},
+	}
+	for _, tt := range tests {
+		migrations, err := loadMigrations(tt.files)
+		if tt.want != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("%s: %v, want an error containing %q", tt.name, err, tt.want)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(migrations) != 2 || migrations[0].Name != "first" || migrations[1].Version != 10 || migrations[1].Down != "DROP TABLE b" {
+			t.Errorf("%s: %+v", tt.name, migrations)
+		}
+	}
+}
+
+// useSchema makes DB a database on which the given migration versions are
+// applied, for the rest of the test.
+func useSchema(t *testing.T, versions ...int) {
+	t.Helper()
+	conn, _ := dbtest.Open(func(query string, args []driver.Value) dbtest.Result {
+		switch {
+		case strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS schema_migrations"):
+			return dbtest.Affected(0)
+		case strings.HasPrefix(query, "SELECT version, applied_at FROM schema_migrations"):
+			var rows [][]driver.Value
+			for _, v := range versions {
+				rows = append(rows, []driver.Value{int64(v), time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)})
+			}
+			return dbtest.Rows([]string{"version", "applied_at"}, rows...)
+		}
+		return dbtest.Fail(fmt.Errorf("unexpected query %q", query))
+	})
+	previous := DB
+	DB = conn
+	t.Cleanup(func() {
+		DB = previous
+		conn.Close()
+	})
+}
+
+func TestCheckSchema(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all []int
+	for _, m := range migrations {
+		all = append(all, m.Version)
+	}
+	latest := migrations[len(migrations)-1]
+	name := func(m Migration) string { return fmt.Sprintf("%04d_%s", m.Version, m.Name) }
+
+	useSchema(t, all...)
+	if err := CheckSchema(); err != nil {
+		t.Errorf("CheckSchema with every migration applied: %v", err)
+	}
+
+	useSchema(t, all[:len(all)-1]...)
+	err = CheckSchema()
+	if err == nil || !strings.Contains(err.Error(), "1 pending migration(s): "+name(latest)) {
+		t.Errorf("CheckSchema without %s: %v, want it reported pending", name(latest), err)
+	}
+
+	// A migration skipped in the middle counts as well.
+	useSchema(t, append(all[:1:1], all[2:]...)...)
+	if err := CheckSchema(); err == nil || !strings.Contains(err.Error(), name(migrations[1])) {
+		t.Errorf("CheckSchema without %s: %v, want it reported pending", name(migrations[1]), err)
+	}
+
+	useSchema(t)
+	if err := CheckSchema(); err == nil || !strings.Contains(err.Error(), fmt.Sprintf("%d pending", len(all))) {
+		t.Errorf("CheckSchema of an empty database: %v, want every migration pending", err)
+	}
+}
+
+func TestCheckSchemaDatabaseError(t *testing.T) {
+	conn, _ := dbtest.Open(func(query string, args []driver.Value) dbtest.Result {
+		return dbtest.Fail(errors.New("connection refused"))
+	})
+	previous := DB
+	DB = conn
+	defer func() {
+		DB = previous
+		conn.Close()
+	}()
+	if err := CheckSchema(); err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("CheckSchema without a database: %v, want the error", err)
+	}
+}
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS review;
+DROP TABLE IF EXISTS payment;
+DROP TABLE IF EXISTS booking;
+DROP TABLE IF EXISTS room;
+DROP TABLE IF EXISTS vendor;
+DROP TABLE IF EXISTS customer;
+DROP FUNCTION IF EXISTS reset_customer_seq();
+DROP FUNCTION IF EXISTS reset_vendor_seq();
@@ -1,19 +1,16 @@
--- Removed admin Table
--- Removed chat Table
--- Removed support Table
+-- Initial schema. Tables use IF NOT EXISTS so databases that were set up by
+-- hand before the migration runner existed can be brought under it.
 
--- Updated customer Table (No changes needed here)
 CREATE TABLE IF NOT EXISTS customer (
     customer_id    SERIAL PRIMARY KEY,
     name           VARCHAR(100) NOT NULL,
-    phone         VARCHAR(20),
-    email         VARCHAR(100) NOT NULL UNIQUE,
-    address       VARCHAR(255)
+    phone          VARCHAR(20),
+    email          VARCHAR(100) NOT NULL UNIQUE,
+    address        VARCHAR(255)
 );
 
--- Updated vendor Table (No changes needed here)
 CREATE TABLE IF NOT EXISTS vendor (
-    vendor_id       SERIAL PRIMARY KEY,
+    vendor_id      SERIAL PRIMARY KEY,
     name           VARCHAR(100) NOT NULL,
     email          VARCHAR(100) NOT NULL UNIQUE,
     phone          VARCHAR(20),
@@ -21,22 +18,20 @@ CREATE TABLE IF NOT EXISTS vendor (
     address        VARCHAR(255)
 );
 
--- Updated room Table (No changes needed here)
 CREATE TABLE IF NOT EXISTS room (
-    room_id       SERIAL PRIMARY KEY,
-    name          VARCHAR(255) NOT NULL,
-    description   TEXT,
-    location      VARCHAR(255),
-    availability  BOOLEAN DEFAULT TRUE,
-    price         NUMERIC(10,2) NOT NULL,
-    room_type     VARCHAR(50),
+    room_id        SERIAL PRIMARY KEY,
+    name           VARCHAR(255) NOT NULL,
+    description    TEXT,
+    location       VARCHAR(255),
+    availability   BOOLEAN DEFAULT TRUE,
+    price          NUMERIC(10,2) NOT NULL,
+    room_type      VARCHAR(50),
     average_rating NUMERIC(3,2) DEFAULT 0.0,
-    amenities     TEXT DEFAULT '',  -- Changed from TEXT[] to TEXT
-    vendor_id     INT NOT NULL,
+    amenities      TEXT DEFAULT '',  -- comma-separated, e.g. "WiFi,TV,Mini Bar"
+    vendor_id      INT NOT NULL,
     CONSTRAINT fk_room_vendor FOREIGN KEY (vendor_id) REFERENCES vendor(vendor_id) ON DELETE CASCADE
 );
 
--- Updated booking Table (No changes needed here)
 CREATE TABLE IF NOT EXISTS booking (
     booking_id     SERIAL PRIMARY KEY,
     booking_date   DATE NOT NULL DEFAULT CURRENT_DATE,
@@ -49,18 +44,16 @@ CREATE TABLE IF NOT EXISTS booking (
     CONSTRAINT fk_booking_customer FOREIGN KEY (customer_id) REFERENCES customer(customer_id) ON DELETE CASCADE
 );
 
--- Updated payment Table (No changes needed here)
 CREATE TABLE IF NOT EXISTS payment (
-    payment_id      SERIAL PRIMARY KEY,
-    payment_method  VARCHAR(50),
-    payment_status  VARCHAR(50) CHECK (payment_status IN ('Pending','Completed', 'Failed')),
+    payment_id       SERIAL PRIMARY KEY,
+    payment_method   VARCHAR(50),
+    payment_status   VARCHAR(50) CHECK (payment_status IN ('Pending','Completed', 'Failed')),
     transaction_date TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    amount         NUMERIC(10,2) NOT NULL,
-    booking_id     INT NOT NULL,
+    amount           NUMERIC(10,2) NOT NULL,
+    booking_id       INT NOT NULL,
     CONSTRAINT fk_payment_booking FOREIGN KEY (booking_id) REFERENCES booking(booking_id) ON DELETE CASCADE
 );
 
--- Updated review Table (No changes needed here)
 CREATE TABLE IF NOT EXISTS review (
     review_id    SERIAL PRIMARY KEY,
     comment      TEXT,
@@ -73,3 +66,34 @@ CREATE TABLE IF NOT EXISTS review (
     CONSTRAINT fk_review_customer FOREIGN KEY (customer_id) REFERENCES customer(customer_id) ON DELETE CASCADE,
     CONSTRAINT fk_review_room FOREIGN KEY (room_id) REFERENCES room(room_id) ON DELETE CASCADE
 );
+
+-- Restart the ID sequences once the customer or vendor table is emptied.
+CREATE OR REPLACE FUNCTION reset_customer_seq() RETURNS trigger AS $$
+BEGIN
+    IF (SELECT COUNT(*) FROM customer) = 0 THEN
+        EXECUTE 'ALTER SEQUENCE customer_customer_id_seq RESTART WITH 1';
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS reset_customer_seq_trigger ON customer;
+CREATE TRIGGER reset_customer_seq_trigger
+AFTER DELETE ON customer
+FOR EACH STATEMENT
+EXECUTE FUNCTION reset_customer_seq();
+
+CREATE OR REPLACE FUNCTION reset_vendor_seq() RETURNS trigger AS $$
+BEGIN
+    IF (SELECT COUNT(*) FROM vendor) = 0 THEN
+        EXECUTE 'ALTER SEQUENCE vendor_vendor_id_seq RESTART WITH 1';
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS reset_vendor_seq_trigger ON vendor;
+CREATE TRIGGER reset_vendor_seq_trigger
+AFTER DELETE ON vendor
+FOR EACH STATEMENT
+EXECUTE FUNCTION reset_vendor_seq();
@@ -0,0 +1,8 @@
+-- Server-side HTTP sessions; the browser only holds a signed session ID.
+CREATE TABLE IF NOT EXISTS http_session (
+    session_id  VARCHAR(64) PRIMARY KEY,
+    data        BYTEA NOT NULL,
+    expires_at  TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_http_session_expires_at ON http_session (expires_at);
@@ -0,0 +1,2 @@
+ALTER TABLE customer DROP COLUMN IF EXISTS password_hash;
+ALTER TABLE vendor DROP COLUMN IF EXISTS password_hash;
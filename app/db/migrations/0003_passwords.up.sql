@@ -0,0 +1,4 @@
+-- Password authentication. The column is nullable so accounts created before
+-- passwords existed can set one on their first login.
+ALTER TABLE customer ADD COLUMN IF NOT EXISTS password_hash VARCHAR(255);
+ALTER TABLE vendor ADD COLUMN IF NOT EXISTS password_hash VARCHAR(255);
@@ -0,0 +1,2 @@
+ALTER TABLE booking DROP CONSTRAINT IF EXISTS excl_booking_room_dates;
+ALTER TABLE booking DROP CONSTRAINT IF EXISTS chk_booking_dates;
@@ -0,0 +1,16 @@
+-- Date-range availability. Bookings are half-open ranges [checkin, checkout),
+-- so a checkout and the next checkin can fall on the same day. The exclusion
+-- constraint stops two bookings of the same room from overlapping.
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+ALTER TABLE booking DROP CONSTRAINT IF EXISTS chk_booking_dates;
+ALTER TABLE booking ADD CONSTRAINT chk_booking_dates CHECK (checkout_date > checkin_date);
+
+ALTER TABLE booking DROP CONSTRAINT IF EXISTS excl_booking_room_dates;
+ALTER TABLE booking ADD CONSTRAINT excl_booking_room_dates
+    EXCLUDE USING gist (room_id WITH =, daterange(checkin_date, checkout_date) WITH &&);
+
+-- room.availability now only means "listed for sale" by the vendor. Rooms that
+-- were switched off by a booking under the old scheme are listed again.
+UPDATE room SET availability = TRUE
+WHERE availability = FALSE AND room_id IN (SELECT room_id FROM booking);
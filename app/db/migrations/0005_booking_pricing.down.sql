@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS pricing_fee;
+DROP TABLE IF EXISTS booking_line_item;
+ALTER TABLE booking DROP COLUMN IF EXISTS total_amount;
+ALTER TABLE booking DROP COLUMN IF EXISTS nightly_rate;
+ALTER TABLE booking DROP COLUMN IF EXISTS nights;
@@ -0,0 +1,36 @@
+-- Per-night pricing. The price of a booking is stored with it so later room
+-- price changes do not rewrite history.
+ALTER TABLE booking ADD COLUMN IF NOT EXISTS nights INT NOT NULL DEFAULT 0;
+ALTER TABLE booking ADD COLUMN IF NOT EXISTS nightly_rate NUMERIC(10,2) NOT NULL DEFAULT 0;
+ALTER TABLE booking ADD COLUMN IF NOT EXISTS total_amount NUMERIC(10,2) NOT NULL DEFAULT 0;
+
+-- Existing bookings were charged the room price once, whatever their length.
+UPDATE booking b SET
+    nights = b.checkout_date - b.checkin_date,
+    nightly_rate = r.price,
+    total_amount = COALESCE((SELECT SUM(p.amount) FROM payment p WHERE p.booking_id = b.booking_id), 0)
+FROM room r
+WHERE r.room_id = b.room_id AND b.nights = 0;
+
+-- Itemized price of each booking (room charge, taxes, fees).
+CREATE TABLE IF NOT EXISTS booking_line_item (
+    line_item_id  SERIAL PRIMARY KEY,
+    booking_id    INT NOT NULL,
+    position      INT NOT NULL,
+    kind          VARCHAR(20) NOT NULL CHECK (kind IN ('room', 'tax', 'fee')),
+    description   VARCHAR(255) NOT NULL,
+    amount        NUMERIC(10,2) NOT NULL,
+    CONSTRAINT fk_line_item_booking FOREIGN KEY (booking_id) REFERENCES booking(booking_id) ON DELETE CASCADE
+);
+
+-- Taxes and fees added to every booking. Percent applies to the room
+-- subtotal; flat_amount is charged per night or once per stay.
+CREATE TABLE IF NOT EXISTS pricing_fee (
+    fee_id       SERIAL PRIMARY KEY,
+    name         VARCHAR(100) NOT NULL,
+    kind         VARCHAR(20) NOT NULL CHECK (kind IN ('tax', 'fee')),
+    percent      NUMERIC(5,2) NOT NULL DEFAULT 0,
+    flat_amount  NUMERIC(10,2) NOT NULL DEFAULT 0,
+    per_night    BOOLEAN NOT NULL DEFAULT FALSE,
+    active       BOOLEAN NOT NULL DEFAULT TRUE
+);
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS refresh_room_rating_trigger ON review;
+DROP FUNCTION IF EXISTS refresh_room_rating();
+DROP INDEX IF EXISTS uq_review_booking;
@@ -0,0 +1,28 @@
+-- Reviews. A booking can be reviewed once, and room.average_rating is
+-- computed from reviews by the refresh_room_rating trigger.
+CREATE UNIQUE INDEX IF NOT EXISTS uq_review_booking ON review (booking_id);
+
+CREATE OR REPLACE FUNCTION refresh_room_rating() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE room SET average_rating = COALESCE(
+            (SELECT ROUND(AVG(rating), 2) FROM review WHERE room_id = OLD.room_id), 0)
+        WHERE room_id = OLD.room_id;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        UPDATE room SET average_rating = COALESCE(
+            (SELECT ROUND(AVG(rating), 2) FROM review WHERE room_id = NEW.room_id), 0)
+        WHERE room_id = NEW.room_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS refresh_room_rating_trigger ON review;
+CREATE TRIGGER refresh_room_rating_trigger
+AFTER INSERT OR UPDATE OR DELETE ON review
+FOR EACH ROW
+EXECUTE FUNCTION refresh_room_rating();
+
+UPDATE room r SET average_rating = COALESCE(
+    (SELECT ROUND(AVG(rating), 2) FROM review WHERE room_id = r.room_id), 0);
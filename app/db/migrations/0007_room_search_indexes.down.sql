@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_room_average_rating;
+DROP INDEX IF EXISTS idx_room_price;
@@ -0,0 +1,3 @@
+-- Room search sorts by price and rating.
+CREATE INDEX IF NOT EXISTS idx_room_price ON room (price);
+CREATE INDEX IF NOT EXISTS idx_room_average_rating ON room (average_rating);
@@ -0,0 +1,34 @@
+DROP TABLE IF EXISTS audit_log;
+
+DELETE FROM payment WHERE payment_status = 'Refunded';
+UPDATE booking SET payment_status = 'Paid' WHERE payment_status = 'Refunded';
+ALTER TABLE booking DROP CONSTRAINT IF EXISTS booking_payment_status_check;
+ALTER TABLE booking ADD CONSTRAINT booking_payment_status_check
+    CHECK (payment_status IN ('Pending', 'Paid', 'Failed'));
+ALTER TABLE payment DROP CONSTRAINT IF EXISTS payment_payment_status_check;
+ALTER TABLE payment ADD CONSTRAINT payment_payment_status_check
+    CHECK (payment_status IN ('Pending', 'Completed', 'Failed'));
+
+CREATE OR REPLACE FUNCTION refresh_room_rating() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE room SET average_rating = COALESCE(
+            (SELECT ROUND(AVG(rating), 2) FROM review WHERE room_id = OLD.room_id), 0)
+        WHERE room_id = OLD.room_id;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        UPDATE room SET average_rating = COALESCE(
+            (SELECT ROUND(AVG(rating), 2) FROM review WHERE room_id = NEW.room_id), 0)
+        WHERE room_id = NEW.room_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE review DROP COLUMN IF EXISTS hidden_at;
+UPDATE room r SET average_rating = COALESCE(
+    (SELECT ROUND(AVG(rating), 2) FROM review WHERE room_id = r.room_id), 0);
+
+ALTER TABLE vendor DROP COLUMN IF EXISTS suspended_at;
+ALTER TABLE customer DROP COLUMN IF EXISTS suspended_at;
+DROP TABLE IF EXISTS admin;
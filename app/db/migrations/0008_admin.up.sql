@@ -0,0 +1,54 @@
+-- Platform administrators. Admins are created with the create-admin command
+-- and always have a password.
+CREATE TABLE IF NOT EXISTS admin (
+    admin_id       SERIAL PRIMARY KEY,
+    name           VARCHAR(100) NOT NULL,
+    email          VARCHAR(100) NOT NULL UNIQUE,
+    password_hash  VARCHAR(255) NOT NULL,
+    created_at     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Suspended accounts cannot log in and lose their current sessions.
+ALTER TABLE customer ADD COLUMN IF NOT EXISTS suspended_at TIMESTAMP;
+ALTER TABLE vendor ADD COLUMN IF NOT EXISTS suspended_at TIMESTAMP;
+
+-- Moderated reviews are hidden from rooms and left out of the rating.
+ALTER TABLE review ADD COLUMN IF NOT EXISTS hidden_at TIMESTAMP;
+
+CREATE OR REPLACE FUNCTION refresh_room_rating() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE room SET average_rating = COALESCE(
+            (SELECT ROUND(AVG(rating), 2) FROM review WHERE room_id = OLD.room_id AND hidden_at IS NULL), 0)
+        WHERE room_id = OLD.room_id;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        UPDATE room SET average_rating = COALESCE(
+            (SELECT ROUND(AVG(rating), 2) FROM review WHERE room_id = NEW.room_id AND hidden_at IS NULL), 0)
+        WHERE room_id = NEW.room_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Refunds are recorded as payments with a negative amount and the status
+-- 'Refunded'; a booking whose payments net to zero is marked 'Refunded'.
+ALTER TABLE payment DROP CONSTRAINT IF EXISTS payment_payment_status_check;
+ALTER TABLE payment ADD CONSTRAINT payment_payment_status_check
+    CHECK (payment_status IN ('Pending', 'Completed', 'Failed', 'Refunded'));
+ALTER TABLE booking DROP CONSTRAINT IF EXISTS booking_payment_status_check;
+ALTER TABLE booking ADD CONSTRAINT booking_payment_status_check
+    CHECK (payment_status IN ('Pending', 'Paid', 'Failed', 'Refunded'));
+
+-- Audit trail of admin actions.
+CREATE TABLE IF NOT EXISTS audit_log (
+    audit_id     SERIAL PRIMARY KEY,
+    admin_id     INT REFERENCES admin(admin_id) ON DELETE SET NULL,
+    action       VARCHAR(50) NOT NULL,
+    target_type  VARCHAR(50) NOT NULL,
+    target_id    INT NOT NULL,
+    details      TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log (created_at);
@@ -0,0 +1,31 @@
+-- Conversations between a customer and the vendor of a room, optionally about
+-- one of the customer's bookings. Each side remembers the last message it has
+-- read, which gives the unread counts.
+CREATE TABLE IF NOT EXISTS message_thread (
+    thread_id              SERIAL PRIMARY KEY,
+    customer_id            INT NOT NULL,
+    vendor_id              INT NOT NULL,
+    booking_id             INT,
+    subject                VARCHAR(200) NOT NULL,
+    created_at             TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_message_at        TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    customer_last_read_id  INT NOT NULL DEFAULT 0,
+    vendor_last_read_id    INT NOT NULL DEFAULT 0,
+    CONSTRAINT fk_thread_customer FOREIGN KEY (customer_id) REFERENCES customer(customer_id) ON DELETE CASCADE,
+    CONSTRAINT fk_thread_vendor FOREIGN KEY (vendor_id) REFERENCES vendor(vendor_id) ON DELETE CASCADE,
+    CONSTRAINT fk_thread_booking FOREIGN KEY (booking_id) REFERENCES booking(booking_id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_thread_customer ON message_thread (customer_id, last_message_at);
+CREATE INDEX IF NOT EXISTS idx_message_thread_vendor ON message_thread (vendor_id, last_message_at);
+
+CREATE TABLE IF NOT EXISTS message (
+    message_id   SERIAL PRIMARY KEY,
+    thread_id    INT NOT NULL,
+    sender_role  VARCHAR(20) NOT NULL CHECK (sender_role IN ('customer', 'vendor')),
+    body         TEXT NOT NULL,
+    created_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_message_thread FOREIGN KEY (thread_id) REFERENCES message_thread(thread_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_thread_id ON message (thread_id, message_id);
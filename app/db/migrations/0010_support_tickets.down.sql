@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS ticket_event;
+DROP TABLE IF EXISTS ticket_reply;
+DROP TABLE IF EXISTS support_ticket;
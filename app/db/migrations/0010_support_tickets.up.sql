@@ -0,0 +1,54 @@
+-- Support tickets opened by a customer or vendor, optionally about one of
+-- their bookings or payments.
+CREATE TABLE IF NOT EXISTS support_ticket (
+    ticket_id    SERIAL PRIMARY KEY,
+    opener_role  VARCHAR(20) NOT NULL CHECK (opener_role IN ('customer', 'vendor')),
+    customer_id  INT,
+    vendor_id    INT,
+    booking_id   INT,
+    payment_id   INT,
+    category     VARCHAR(20) NOT NULL CHECK (category IN ('booking', 'payment', 'account', 'room', 'other')),
+    priority     VARCHAR(20) NOT NULL DEFAULT 'normal' CHECK (priority IN ('low', 'normal', 'high', 'urgent')),
+    status       VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'pending', 'resolved', 'closed')),
+    subject      VARCHAR(200) NOT NULL,
+    created_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT chk_ticket_opener CHECK (
+        (opener_role = 'customer' AND customer_id IS NOT NULL AND vendor_id IS NULL) OR
+        (opener_role = 'vendor' AND vendor_id IS NOT NULL AND customer_id IS NULL)),
+    CONSTRAINT fk_ticket_customer FOREIGN KEY (customer_id) REFERENCES customer(customer_id) ON DELETE CASCADE,
+    CONSTRAINT fk_ticket_vendor FOREIGN KEY (vendor_id) REFERENCES vendor(vendor_id) ON DELETE CASCADE,
+    CONSTRAINT fk_ticket_booking FOREIGN KEY (booking_id) REFERENCES booking(booking_id) ON DELETE SET NULL,
+    CONSTRAINT fk_ticket_payment FOREIGN KEY (payment_id) REFERENCES payment(payment_id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_support_ticket_customer ON support_ticket (customer_id);
+CREATE INDEX IF NOT EXISTS idx_support_ticket_vendor ON support_ticket (vendor_id);
+CREATE INDEX IF NOT EXISTS idx_support_ticket_status ON support_ticket (status, priority);
+
+-- Replies on a ticket, the first of which is the opener's description.
+CREATE TABLE IF NOT EXISTS ticket_reply (
+    reply_id     SERIAL PRIMARY KEY,
+    ticket_id    INT NOT NULL,
+    author_role  VARCHAR(20) NOT NULL CHECK (author_role IN ('customer', 'vendor', 'admin')),
+    admin_id     INT,
+    body         TEXT NOT NULL,
+    created_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_reply_ticket FOREIGN KEY (ticket_id) REFERENCES support_ticket(ticket_id) ON DELETE CASCADE,
+    CONSTRAINT fk_reply_admin FOREIGN KEY (admin_id) REFERENCES admin(admin_id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_ticket_reply_ticket ON ticket_reply (ticket_id, reply_id);
+
+-- Every status change of a ticket, including its opening, for SLA reporting.
+CREATE TABLE IF NOT EXISTS ticket_event (
+    event_id     SERIAL PRIMARY KEY,
+    ticket_id    INT NOT NULL,
+    from_status  VARCHAR(20),
+    to_status    VARCHAR(20) NOT NULL,
+    actor_role   VARCHAR(20) NOT NULL CHECK (actor_role IN ('customer', 'vendor', 'admin')),
+    created_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_event_ticket FOREIGN KEY (ticket_id) REFERENCES support_ticket(ticket_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_ticket_event_ticket ON ticket_event (ticket_id, event_id);
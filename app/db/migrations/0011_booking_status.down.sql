@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS booking_status_event;
+
+-- Before statuses existed a cancellation deleted the booking, and the
+-- exclusion constraint cannot be restored while inactive bookings overlap.
+DELETE FROM booking WHERE status IN ('cancelled', 'no_show');
+ALTER TABLE booking DROP CONSTRAINT IF EXISTS excl_booking_room_dates;
+ALTER TABLE booking ADD CONSTRAINT excl_booking_room_dates
+    EXCLUDE USING gist (room_id WITH =, daterange(checkin_date, checkout_date) WITH &&);
+
+ALTER TABLE booking DROP CONSTRAINT IF EXISTS chk_booking_status;
+ALTER TABLE booking DROP COLUMN IF EXISTS status;
@@ -0,0 +1,37 @@
+-- Booking lifecycle. A booking is confirmed when made, then checked in and
+-- checked out by the vendor, or ends as cancelled or no-show. Cancelled
+-- bookings are kept so their payments and reviews stay linked.
+ALTER TABLE booking ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'confirmed';
+ALTER TABLE booking DROP CONSTRAINT IF EXISTS chk_booking_status;
+ALTER TABLE booking ADD CONSTRAINT chk_booking_status
+    CHECK (status IN ('confirmed', 'checked_in', 'checked_out', 'cancelled', 'no_show'));
+
+-- Stays that ended before statuses existed count as checked out.
+UPDATE booking SET status = 'checked_out' WHERE status = 'confirmed' AND checkout_date <= CURRENT_DATE;
+
+-- Cancelled and no-show bookings no longer hold the room.
+ALTER TABLE booking DROP CONSTRAINT IF EXISTS excl_booking_room_dates;
+ALTER TABLE booking ADD CONSTRAINT excl_booking_room_dates
+    EXCLUDE USING gist (room_id WITH =, daterange(checkin_date, checkout_date) WITH &&)
+    WHERE (status NOT IN ('cancelled', 'no_show'));
+
+-- Every status change of a booking, with who made it. actor_id is the
+-- customer, vendor or admin ID for the actor_role; 'system' changes have none.
+CREATE TABLE IF NOT EXISTS booking_status_event (
+    event_id     SERIAL PRIMARY KEY,
+    booking_id   INT NOT NULL,
+    from_status  VARCHAR(20),
+    to_status    VARCHAR(20) NOT NULL,
+    actor_role   VARCHAR(20) NOT NULL CHECK (actor_role IN ('customer', 'vendor', 'admin', 'system')),
+    actor_id     INT,
+    reason       TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_status_event_booking FOREIGN KEY (booking_id) REFERENCES booking(booking_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_booking_status_event_booking ON booking_status_event (booking_id, event_id);
+
+INSERT INTO booking_status_event (booking_id, to_status, actor_role, reason)
+SELECT b.booking_id, b.status, 'system', 'status introduced'
+FROM booking b
+WHERE NOT EXISTS (SELECT 1 FROM booking_status_event e WHERE e.booking_id = b.booking_id);
@@ -0,0 +1,5 @@
+ALTER TABLE booking DROP COLUMN IF EXISTS non_refundable;
+ALTER TABLE booking DROP COLUMN IF EXISTS cancel_penalty_percent;
+ALTER TABLE booking DROP COLUMN IF EXISTS cancel_free_days;
+
+DROP TABLE IF EXISTS room_cancellation_policy;
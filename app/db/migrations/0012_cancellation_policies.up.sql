@@ -0,0 +1,18 @@
+-- Cancellation policy of each room. A customer cancelling at least free_days
+-- before check-in gets a full refund; a later cancellation loses
+-- penalty_percent of what was paid. Non-refundable rooms refund nothing.
+-- Rooms without a policy are refundable in full until check-in.
+CREATE TABLE IF NOT EXISTS room_cancellation_policy (
+    room_id          INT PRIMARY KEY,
+    free_days        INT NOT NULL DEFAULT 0 CHECK (free_days >= 0),
+    penalty_percent  NUMERIC(5,2) NOT NULL DEFAULT 0 CHECK (penalty_percent BETWEEN 0 AND 100),
+    non_refundable   BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_cancellation_policy_room FOREIGN KEY (room_id) REFERENCES room(room_id) ON DELETE CASCADE
+);
+
+-- The policy in force when a booking is made is stored with it, so later
+-- policy changes do not affect existing bookings.
+ALTER TABLE booking ADD COLUMN IF NOT EXISTS cancel_free_days INT NOT NULL DEFAULT 0;
+ALTER TABLE booking ADD COLUMN IF NOT EXISTS cancel_penalty_percent NUMERIC(5,2) NOT NULL DEFAULT 0;
+ALTER TABLE booking ADD COLUMN IF NOT EXISTS non_refundable BOOLEAN NOT NULL DEFAULT FALSE;
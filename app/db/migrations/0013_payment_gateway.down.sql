@@ -0,0 +1,11 @@
+UPDATE payment SET payment_status = 'Failed' WHERE payment_status = 'Voided';
+UPDATE booking SET payment_status = 'Failed' WHERE payment_status = 'Voided';
+ALTER TABLE payment DROP CONSTRAINT IF EXISTS payment_payment_status_check;
+ALTER TABLE payment ADD CONSTRAINT payment_payment_status_check
+    CHECK (payment_status IN ('Pending', 'Completed', 'Failed', 'Refunded'));
+ALTER TABLE booking DROP CONSTRAINT IF EXISTS booking_payment_status_check;
+ALTER TABLE booking ADD CONSTRAINT booking_payment_status_check
+    CHECK (payment_status IN ('Pending', 'Paid', 'Failed', 'Refunded'));
+
+ALTER TABLE payment DROP COLUMN IF EXISTS gateway_ref;
+ALTER TABLE payment DROP COLUMN IF EXISTS gateway;
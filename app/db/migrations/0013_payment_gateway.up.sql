@@ -0,0 +1,13 @@
+-- Payments go through a payment gateway. gateway names the provider and
+-- gateway_ref identifies the charge or refund there; both are empty for
+-- payments recorded before gateways existed.
+ALTER TABLE payment ADD COLUMN IF NOT EXISTS gateway VARCHAR(30) NOT NULL DEFAULT '';
+ALTER TABLE payment ADD COLUMN IF NOT EXISTS gateway_ref VARCHAR(100) NOT NULL DEFAULT '';
+
+-- An authorization released without a charge is 'Voided'.
+ALTER TABLE payment DROP CONSTRAINT IF EXISTS payment_payment_status_check;
+ALTER TABLE payment ADD CONSTRAINT payment_payment_status_check
+    CHECK (payment_status IN ('Pending', 'Completed', 'Failed', 'Refunded', 'Voided'));
+ALTER TABLE booking DROP CONSTRAINT IF EXISTS booking_payment_status_check;
+ALTER TABLE booking ADD CONSTRAINT booking_payment_status_check
+    CHECK (payment_status IN ('Pending', 'Paid', 'Failed', 'Refunded', 'Voided'));
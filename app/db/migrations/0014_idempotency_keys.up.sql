@@ -0,0 +1,17 @@
+-- Requests sent with an Idempotency-Key header or form token. A retry with
+-- the same key gets the stored response instead of running again. owner is
+-- the role and ID of the user, e.g. 'customer:12', so keys never collide
+-- between users. response_status is NULL while the first request runs.
+CREATE TABLE IF NOT EXISTS idempotency_key (
+    owner              VARCHAR(50) NOT NULL,
+    idem_key           VARCHAR(255) NOT NULL,
+    fingerprint        CHAR(64) NOT NULL,
+    response_status    INT,
+    response_type      VARCHAR(100) NOT NULL DEFAULT '',
+    response_location  TEXT NOT NULL DEFAULT '',
+    response_body      BYTEA,
+    created_at         TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (owner, idem_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_key_created_at ON idempotency_key (created_at);
@@ -0,0 +1,4 @@
+ALTER TABLE pricing_fee DROP COLUMN IF EXISTS currency;
+ALTER TABLE payment DROP COLUMN IF EXISTS currency;
+ALTER TABLE booking DROP COLUMN IF EXISTS currency;
+ALTER TABLE room DROP COLUMN IF EXISTS currency;
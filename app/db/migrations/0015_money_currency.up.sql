@@ -0,0 +1,14 @@
+-- Amounts carry an ISO 4217 currency. A room is priced in its currency and a
+-- booking, its line items and its payments are in the currency of the room
+-- when it was booked. Everything recorded so far was in US dollars.
+ALTER TABLE room ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD'
+    CHECK (currency ~ '^[A-Z]{3}$');
+ALTER TABLE booking ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD'
+    CHECK (currency ~ '^[A-Z]{3}$');
+ALTER TABLE payment ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD'
+    CHECK (currency ~ '^[A-Z]{3}$');
+
+-- Flat fees are charged in their own currency, and only on rooms priced in
+-- it; percentages apply to every room.
+ALTER TABLE pricing_fee ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD'
+    CHECK (currency ~ '^[A-Z]{3}$');
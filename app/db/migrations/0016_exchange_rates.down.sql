@@ -0,0 +1,5 @@
+ALTER TABLE booking DROP COLUMN IF EXISTS display_rate;
+ALTER TABLE booking DROP COLUMN IF EXISTS display_currency;
+ALTER TABLE customer DROP COLUMN IF EXISTS display_currency;
+DROP FUNCTION IF EXISTS exchange_rate_of(TEXT);
+DROP TABLE IF EXISTS exchange_rate;
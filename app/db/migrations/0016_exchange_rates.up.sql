@@ -0,0 +1,28 @@
+-- Exchange rates against the default currency (USD): how many units of the
+-- currency one US dollar buys. Admins edit them or load them from a file.
+CREATE TABLE IF NOT EXISTS exchange_rate (
+    currency    CHAR(3) PRIMARY KEY CHECK (currency ~ '^[A-Z]{3}$'),
+    rate        NUMERIC(20,10) NOT NULL CHECK (rate > 0),
+    source      VARCHAR(10) NOT NULL CHECK (source IN ('admin', 'file')),
+    updated_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- exchange_rate_of returns how many units of a currency one US dollar buys,
+-- or NULL if the currency has no rate. Room searches compare prices with it.
+CREATE OR REPLACE FUNCTION exchange_rate_of(code TEXT) RETURNS NUMERIC AS $$
+    SELECT CASE WHEN code = 'USD' THEN 1
+        ELSE (SELECT rate FROM exchange_rate WHERE currency = code) END
+$$ LANGUAGE sql STABLE;
+
+-- The currency a customer wants prices shown in; NULL shows them in the
+-- room's currency.
+ALTER TABLE customer ADD COLUMN IF NOT EXISTS display_currency CHAR(3)
+    CHECK (display_currency ~ '^[A-Z]{3}$');
+
+-- The currency the customer saw a booking's price in and the rate used at
+-- the time, in units of display_currency per unit of the booking's
+-- currency. Charges are still made in the booking's currency.
+ALTER TABLE booking ADD COLUMN IF NOT EXISTS display_currency CHAR(3)
+    CHECK (display_currency ~ '^[A-Z]{3}$');
+ALTER TABLE booking ADD COLUMN IF NOT EXISTS display_rate NUMERIC(20,10)
+    CHECK (display_rate > 0);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS rate_plan_weekday;
+DROP TABLE IF EXISTS rate_plan;
@@ -0,0 +1,32 @@
+-- Rate plans price the nights of a room from start_date to end_date, both
+-- included, instead of the room's own price. Where plans overlap, the one
+-- with the shorter date range applies, so a holiday plan can sit inside a
+-- season. Plans in another currency than the room's are ignored.
+CREATE TABLE IF NOT EXISTS rate_plan (
+    rate_plan_id  SERIAL PRIMARY KEY,
+    room_id       INT NOT NULL,
+    name          VARCHAR(100) NOT NULL,
+    start_date    DATE NOT NULL,
+    end_date      DATE NOT NULL,
+    price         NUMERIC(10,2) NOT NULL CHECK (price > 0),
+    currency      CHAR(3) NOT NULL DEFAULT 'USD' CHECK (currency ~ '^[A-Z]{3}$'),
+    -- Stays using the plan for any night must be at least min_stay and at
+    -- most max_stay nights long; 0 is no limit.
+    min_stay      INT NOT NULL DEFAULT 0 CHECK (min_stay >= 0),
+    max_stay      INT NOT NULL DEFAULT 0 CHECK (max_stay >= 0),
+    created_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT rate_plan_dates CHECK (end_date >= start_date),
+    CONSTRAINT fk_rate_plan_room FOREIGN KEY (room_id) REFERENCES room(room_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_rate_plan_room_dates ON rate_plan (room_id, start_date, end_date);
+
+-- Day-of-week prices override the plan's price on that day, 0 for Sunday to
+-- 6 for Saturday, e.g. a weekend uplift.
+CREATE TABLE IF NOT EXISTS rate_plan_weekday (
+    rate_plan_id  INT NOT NULL,
+    weekday       SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    price         NUMERIC(10,2) NOT NULL CHECK (price > 0),
+    PRIMARY KEY (rate_plan_id, weekday),
+    CONSTRAINT fk_rate_plan_weekday_plan FOREIGN KEY (rate_plan_id) REFERENCES rate_plan(rate_plan_id) ON DELETE CASCADE
+);
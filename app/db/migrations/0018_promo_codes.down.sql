@@ -0,0 +1,7 @@
+DELETE FROM booking_line_item WHERE kind = 'discount';
+ALTER TABLE booking_line_item DROP CONSTRAINT IF EXISTS booking_line_item_kind_check;
+ALTER TABLE booking_line_item ADD CONSTRAINT booking_line_item_kind_check
+    CHECK (kind IN ('room', 'tax', 'fee'));
+
+DROP TABLE IF EXISTS promo_redemption;
+DROP TABLE IF EXISTS promo_code;
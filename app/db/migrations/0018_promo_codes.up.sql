@@ -0,0 +1,51 @@
+-- Promo codes customers enter at checkout. A vendor's codes apply to their
+-- own rooms; codes without a vendor are platform-wide and managed by
+-- admins. A code takes either a percentage or a fixed amount off the room
+-- charge, in which case it only applies to rooms priced in its currency.
+CREATE TABLE IF NOT EXISTS promo_code (
+    promo_code_id          SERIAL PRIMARY KEY,
+    code                   VARCHAR(40) NOT NULL CHECK (code ~ '^[A-Z0-9_-]+$'),
+    vendor_id              INT,
+    description            VARCHAR(255) NOT NULL DEFAULT '',
+    percent                NUMERIC(5,2) CHECK (percent > 0 AND percent <= 100),
+    amount                 NUMERIC(10,2) CHECK (amount > 0),
+    currency               CHAR(3) CHECK (currency ~ '^[A-Z]{3}$'),
+    -- The code can be redeemed on bookings made from valid_from to
+    -- valid_until, both included; NULL is open-ended.
+    valid_from             DATE,
+    valid_until            DATE,
+    -- Caps on redemptions by bookings that are not cancelled; 0 is no cap.
+    max_uses               INT NOT NULL DEFAULT 0 CHECK (max_uses >= 0),
+    max_uses_per_customer  INT NOT NULL DEFAULT 0 CHECK (max_uses_per_customer >= 0),
+    min_nights             INT NOT NULL DEFAULT 0 CHECK (min_nights >= 0),
+    -- Restrict the code to one room or to rooms of one type.
+    room_id                INT,
+    room_type              VARCHAR(50) NOT NULL DEFAULT '',
+    active                 BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at             TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT promo_code_discount CHECK ((percent IS NULL) <> (amount IS NULL) AND (amount IS NULL) = (currency IS NULL)),
+    CONSTRAINT promo_code_validity CHECK (valid_until IS NULL OR valid_from IS NULL OR valid_until >= valid_from),
+    CONSTRAINT fk_promo_code_vendor FOREIGN KEY (vendor_id) REFERENCES vendor(vendor_id) ON DELETE CASCADE,
+    CONSTRAINT fk_promo_code_room FOREIGN KEY (room_id) REFERENCES room(room_id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_promo_code_code ON promo_code (code);
+
+-- Each booking redeems at most one code. The discount is in the booking's
+-- currency and is also a negative 'discount' line item of the booking.
+CREATE TABLE IF NOT EXISTS promo_redemption (
+    redemption_id  SERIAL PRIMARY KEY,
+    promo_code_id  INT NOT NULL,
+    booking_id     INT NOT NULL UNIQUE,
+    customer_id    INT NOT NULL,
+    discount       NUMERIC(10,2) NOT NULL CHECK (discount > 0),
+    redeemed_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_redemption_promo_code FOREIGN KEY (promo_code_id) REFERENCES promo_code(promo_code_id) ON DELETE CASCADE,
+    CONSTRAINT fk_redemption_booking FOREIGN KEY (booking_id) REFERENCES booking(booking_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_promo_redemption_code ON promo_redemption (promo_code_id, customer_id);
+
+ALTER TABLE booking_line_item DROP CONSTRAINT IF EXISTS booking_line_item_kind_check;
+ALTER TABLE booking_line_item ADD CONSTRAINT booking_line_item_kind_check
+    CHECK (kind IN ('room', 'discount', 'tax', 'fee'));
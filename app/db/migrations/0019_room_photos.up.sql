@@ -0,0 +1,21 @@
+-- Photos of rooms. The image and its thumbnail are kept in the blob store
+-- under storage_key and thumbnail_key; rows only describe them. Photos are
+-- shown in position order, and a room has at most one cover photo, shown
+-- in room listings.
+CREATE TABLE IF NOT EXISTS room_photo (
+    photo_id       SERIAL PRIMARY KEY,
+    room_id        INT NOT NULL,
+    storage_key    VARCHAR(255) NOT NULL UNIQUE,
+    thumbnail_key  VARCHAR(255) NOT NULL UNIQUE,
+    content_type   VARCHAR(50) NOT NULL,
+    size_bytes     INT NOT NULL CHECK (size_bytes > 0),
+    width          INT NOT NULL CHECK (width > 0),
+    height         INT NOT NULL CHECK (height > 0),
+    position       INT NOT NULL DEFAULT 0,
+    is_cover       BOOLEAN NOT NULL DEFAULT FALSE,
+    uploaded_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_room_photo_room FOREIGN KEY (room_id) REFERENCES room(room_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_room_photo_room ON room_photo (room_id, position);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_room_photo_cover ON room_photo (room_id) WHERE is_cover;
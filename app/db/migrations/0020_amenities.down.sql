@@ -0,0 +1,15 @@
+ALTER TABLE room ADD COLUMN IF NOT EXISTS amenities TEXT DEFAULT '';
+
+DO $$
+BEGIN
+    IF to_regclass('room_amenity') IS NOT NULL THEN
+        UPDATE room SET amenities = COALESCE((
+            SELECT string_agg(a.name, ',' ORDER BY a.name)
+            FROM room_amenity ra JOIN amenity a ON a.amenity_id = ra.amenity_id
+            WHERE ra.room_id = room.room_id
+        ), '');
+    END IF;
+END $$;
+
+DROP TABLE IF EXISTS room_amenity;
+DROP TABLE IF EXISTS amenity;
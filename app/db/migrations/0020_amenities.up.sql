@@ -0,0 +1,54 @@
+-- A catalog of the amenities rooms offer, replacing the free-text
+-- room.amenities list. slug is the name folded to lower-case letters and
+-- digits, so "WiFi", "wi-fi" and "WiFi " are the same amenity.
+CREATE TABLE IF NOT EXISTS amenity (
+    amenity_id  SERIAL PRIMARY KEY,
+    name        VARCHAR(100) NOT NULL CHECK (TRIM(name) <> ''),
+    slug        VARCHAR(100) NOT NULL CHECK (slug <> ''),
+    created_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_amenity_slug ON amenity (slug);
+
+CREATE TABLE IF NOT EXISTS room_amenity (
+    room_id     INT NOT NULL,
+    amenity_id  INT NOT NULL,
+    PRIMARY KEY (room_id, amenity_id),
+    CONSTRAINT fk_room_amenity_room FOREIGN KEY (room_id) REFERENCES room(room_id) ON DELETE CASCADE,
+    CONSTRAINT fk_room_amenity_amenity FOREIGN KEY (amenity_id) REFERENCES amenity(amenity_id) ON DELETE CASCADE
+);
+
+-- Searches look up the rooms offering an amenity.
+CREATE INDEX IF NOT EXISTS idx_room_amenity_amenity ON room_amenity (amenity_id, room_id);
+
+INSERT INTO amenity (name, slug) VALUES
+    ('WiFi', 'wifi'),
+    ('TV', 'tv'),
+    ('Air Conditioning', 'airconditioning'),
+    ('Mini Bar', 'minibar'),
+    ('Parking', 'parking'),
+    ('Breakfast', 'breakfast'),
+    ('Swimming Pool', 'swimmingpool'),
+    ('Gym', 'gym')
+ON CONFLICT (slug) DO NOTHING;
+
+-- Move the comma-separated lists into the catalog. An amenity not in it yet
+-- is named by its most common spelling.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'room' AND column_name = 'amenities') THEN
+        CREATE TEMPORARY TABLE listed_amenity ON COMMIT DROP AS
+            SELECT room_id, TRIM(a) AS name, regexp_replace(LOWER(a), '[^[:alnum:]]+', '', 'g') AS slug
+            FROM room, unnest(string_to_array(COALESCE(amenities, ''), ',')) AS a;
+
+        INSERT INTO amenity (name, slug)
+            SELECT mode() WITHIN GROUP (ORDER BY name), slug FROM listed_amenity
+            WHERE slug <> '' GROUP BY slug
+            ON CONFLICT (slug) DO NOTHING;
+        INSERT INTO room_amenity (room_id, amenity_id)
+            SELECT DISTINCT l.room_id, a.amenity_id FROM listed_amenity l JOIN amenity a ON a.slug = l.slug
+            ON CONFLICT DO NOTHING;
+
+        ALTER TABLE room DROP COLUMN amenities;
+    END IF;
+END $$;
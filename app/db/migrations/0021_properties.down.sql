@@ -0,0 +1,5 @@
+ALTER TABLE room DROP CONSTRAINT IF EXISTS fk_room_property;
+DROP INDEX IF EXISTS idx_room_property;
+ALTER TABLE room DROP COLUMN IF EXISTS property_id;
+
+DROP TABLE IF EXISTS property;
@@ -0,0 +1,41 @@
+-- A vendor runs one or more properties, such as hotels, and each room
+-- belongs to one of them. Check-in and check-out times are local to the
+-- property's timezone, an IANA name such as 'Europe/Paris'.
+CREATE TABLE IF NOT EXISTS property (
+    property_id    SERIAL PRIMARY KEY,
+    vendor_id      INT NOT NULL,
+    name           VARCHAR(255) NOT NULL CHECK (TRIM(name) <> ''),
+    address        VARCHAR(255) NOT NULL DEFAULT '',
+    latitude       NUMERIC(9,6) CHECK (latitude BETWEEN -90 AND 90),
+    longitude      NUMERIC(9,6) CHECK (longitude BETWEEN -180 AND 180),
+    timezone       VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    checkin_time   TIME NOT NULL DEFAULT '15:00',
+    checkout_time  TIME NOT NULL DEFAULT '11:00',
+    policies       TEXT NOT NULL DEFAULT '',
+    phone          VARCHAR(20) NOT NULL DEFAULT '',
+    email          VARCHAR(100) NOT NULL DEFAULT '',
+    created_at     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT property_coordinates CHECK ((latitude IS NULL) = (longitude IS NULL)),
+    -- Lets rooms reference the property together with its vendor.
+    CONSTRAINT property_vendor_key UNIQUE (property_id, vendor_id),
+    CONSTRAINT fk_property_vendor FOREIGN KEY (vendor_id) REFERENCES vendor(vendor_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_property_vendor ON property (vendor_id);
+
+-- Each vendor's hotel becomes their first property.
+INSERT INTO property (vendor_id, name, address, phone, email)
+SELECT v.vendor_id, COALESCE(NULLIF(TRIM(v.hotel_name), ''), v.name), COALESCE(v.address, ''), COALESCE(v.phone, ''), v.email
+FROM vendor v
+WHERE NOT EXISTS (SELECT 1 FROM property p WHERE p.vendor_id = v.vendor_id);
+
+-- Rooms belong to a property of their own vendor. A property with rooms
+-- cannot be deleted; deleting the vendor removes both.
+ALTER TABLE room ADD COLUMN IF NOT EXISTS property_id INT;
+UPDATE room SET property_id = (SELECT MIN(p.property_id) FROM property p WHERE p.vendor_id = room.vendor_id)
+WHERE property_id IS NULL;
+ALTER TABLE room ALTER COLUMN property_id SET NOT NULL;
+ALTER TABLE room DROP CONSTRAINT IF EXISTS fk_room_property;
+ALTER TABLE room ADD CONSTRAINT fk_room_property FOREIGN KEY (property_id, vendor_id) REFERENCES property(property_id, vendor_id);
+
+CREATE INDEX IF NOT EXISTS idx_room_property ON room (property_id);
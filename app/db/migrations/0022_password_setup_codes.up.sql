@@ -0,0 +1,11 @@
+-- One-time codes an admin issues so that an account created before
+-- passwords existed can set its first password. Only the SHA-256 hash of a
+-- code is stored, and issuing a new code replaces the previous one.
+CREATE TABLE IF NOT EXISTS password_setup_code (
+    role           VARCHAR(20) NOT NULL CHECK (role IN ('customer', 'vendor')),
+    account_id     INT NOT NULL,
+    code_hash      CHAR(64) NOT NULL,
+    expires_at     TIMESTAMP NOT NULL,
+    created_at     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (role, account_id)
+);
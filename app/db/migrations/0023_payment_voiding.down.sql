@@ -0,0 +1,4 @@
+UPDATE payment SET payment_status = 'Voided' WHERE payment_status = 'Voiding';
+ALTER TABLE payment DROP CONSTRAINT IF EXISTS payment_payment_status_check;
+ALTER TABLE payment ADD CONSTRAINT payment_payment_status_check
+    CHECK (payment_status IN ('Pending', 'Completed', 'Failed', 'Refunded', 'Voided'));
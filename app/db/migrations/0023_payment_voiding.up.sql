@@ -0,0 +1,6 @@
+-- A charge released by a cancellation is 'Voiding' from the moment the
+-- booking is cancelled until the gateway has confirmed the void; a payment
+-- left 'Voiding' is retried.
+ALTER TABLE payment DROP CONSTRAINT IF EXISTS payment_payment_status_check;
+ALTER TABLE payment ADD CONSTRAINT payment_payment_status_check
+    CHECK (payment_status IN ('Pending', 'Completed', 'Failed', 'Refunded', 'Voiding', 'Voided'));
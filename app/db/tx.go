@@ -0,0 +1,41 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Querier is implemented by both *sql.DB and *sql.Tx. Repository functions
+// accept a Querier so the same code can run on its own or as part of a
+// transaction.
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// WithTx runs fn inside a transaction. The transaction is committed if fn
+// returns nil and rolled back if fn returns an error or panics.
+func WithTx(fn func(tx *sql.Tx) error) (err error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,491 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"hotelm/money"
+	"hotelm/service"
+	"hotelm/session"
+)
+
+// Page templates, loaded by LoadTemplates.
+var (
+	adminDashboardTmpl *template.Template
+	adminCustomersTmpl *template.Template
+	adminVendorsTmpl   *template.Template
+	adminBookingsTmpl  *template.Template
+	adminPaymentsTmpl  *template.Template
+	adminReviewsTmpl   *template.Template
+	adminAuditTmpl     *template.Template
+	adminRatesTmpl     *template.Template
+	adminAmenitiesTmpl *template.Template
+)
+
+// adminActionError reports a failed admin action. Rejected input is a 400,
+// anything else a 500.
+func adminActionError(w http.ResponseWriter, action string, err error) {
+	var invalid *service.ValidationError
+	if errors.As(err, &invalid) {
+		http.Error(w, action+": "+invalid.Message, http.StatusBadRequest)
+		return
+	}
+	http.Error(w, action+": "+err.Error(), http.StatusInternalServerError)
+}
+
+// formID parses a positive integer id from a form field.
+func formID(r *http.Request, field string) (int, bool) {
+	id, err := strconv.Atoi(r.FormValue(field))
+	return id, err == nil && id > 0
+}
+
+// formMoney parses an amount from a form field in the currency given by
+// currencyField, or in the default currency if that is empty.
+func formMoney(r *http.Request, field, currencyField string) (money.Money, error) {
+	currency := strings.ToUpper(strings.TrimSpace(r.FormValue(currencyField)))
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+	return money.Parse(r.FormValue(field), currency)
+}
+
+// AdminDashboardHandler renders the admin console's start page.
+func AdminDashboardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := adminDashboardTmpl.Execute(w, nil); err != nil {
+		http.Error(w, "Error rendering admin dashboard", http.StatusInternalServerError)
+	}
+}
+
+// AdminCustomersHandler lists the customers, filtered by the "q" search term.
+func AdminCustomersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	renderAdminCustomers(w, r, "", "")
+}
+
+// renderAdminCustomers renders the customer list filtered by the "q" search
+// term, with a password setup code just issued for email if there is one.
+func renderAdminCustomers(w http.ResponseWriter, r *http.Request, email, setupCode string) {
+	search := r.URL.Query().Get("q")
+	customers, err := service.ListCustomers(r.Context(), search)
+	if err != nil {
+		http.Error(w, "Error retrieving customers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := map[string]interface{}{
+		"Customers":      customers,
+		"Search":         search,
+		"SetupEmail":     email,
+		"SetupCode":      setupCode,
+		"SetupCodeHours": service.PasswordSetupCodeHours,
+	}
+	if err := adminCustomersTmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering customers", http.StatusInternalServerError)
+	}
+}
+
+// AdminCustomerSetupCodeHandler issues a password setup code for a customer
+// without a password and shows it once on the customer list.
+func AdminCustomerSetupCodeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	id, ok := formID(r, "customer_id")
+	if !ok {
+		http.Error(w, "Invalid customer ID", http.StatusBadRequest)
+		return
+	}
+	email, code, err := service.IssuePasswordSetupCode(r.Context(), session.RoleCustomer, id)
+	if err != nil {
+		adminActionError(w, "Error issuing setup code", err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	renderAdminCustomers(w, r, email, code)
+}
+
+// AdminSuspendCustomerHandler suspends a customer, or lifts the suspension
+// when "suspended" is "false".
+func AdminSuspendCustomerHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	id, ok := formID(r, "customer_id")
+	if !ok {
+		http.Error(w, "Invalid customer ID", http.StatusBadRequest)
+		return
+	}
+	suspended := r.FormValue("suspended") != "false"
+	if err := service.SuspendCustomer(r.Context(), id, suspended); err != nil {
+		adminActionError(w, "Error updating customer", err)
+		return
+	}
+	http.Redirect(w, r, "/admin/customers", http.StatusSeeOther)
+}
+
+// AdminDeleteCustomerHandler deletes a customer and everything they own.
+func AdminDeleteCustomerHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	id, ok := formID(r, "customer_id")
+	if !ok {
+		http.Error(w, "Invalid customer ID", http.StatusBadRequest)
+		return
+	}
+	if err := service.DeleteCustomerAsAdmin(r.Context(), id); err != nil {
+		adminActionError(w, "Error deleting customer", err)
+		return
+	}
+	http.Redirect(w, r, "/admin/customers", http.StatusSeeOther)
+}
+
+// AdminVendorsHandler lists the vendors, filtered by the "q" search term.
+func AdminVendorsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	renderAdminVendors(w, r, "", "")
+}
+
+// renderAdminVendors renders the vendor list filtered by the "q" search
+// term, with a password setup code just issued for email if there is one.
+func renderAdminVendors(w http.ResponseWriter, r *http.Request, email, setupCode string) {
+	search := r.URL.Query().Get("q")
+	vendors, err := service.ListVendors(r.Context(), search)
+	if err != nil {
+		http.Error(w, "Error retrieving vendors: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := map[string]interface{}{
+		"Vendors":        vendors,
+		"Search":         search,
+		"SetupEmail":     email,
+		"SetupCode":      setupCode,
+		"SetupCodeHours": service.PasswordSetupCodeHours,
+	}
+	if err := adminVendorsTmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering vendors", http.StatusInternalServerError)
+	}
+}
+
+// AdminVendorSetupCodeHandler issues a password setup code for a vendor
+// without a password and shows it once on the vendor list.
+func AdminVendorSetupCodeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	id, ok := formID(r, "vendor_id")
+	if !ok {
+		http.Error(w, "Invalid vendor ID", http.StatusBadRequest)
+		return
+	}
+	email, code, err := service.IssuePasswordSetupCode(r.Context(), session.RoleVendor, id)
+	if err != nil {
+		adminActionError(w, "Error issuing setup code", err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	renderAdminVendors(w, r, email, code)
+}
+
+// AdminSuspendVendorHandler suspends a vendor, or lifts the suspension when
+// "suspended" is "false".
+func AdminSuspendVendorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	id, ok := formID(r, "vendor_id")
+	if !ok {
+		http.Error(w, "Invalid vendor ID", http.StatusBadRequest)
+		return
+	}
+	suspended := r.FormValue("suspended") != "false"
+	if err := service.SuspendVendor(r.Context(), id, suspended); err != nil {
+		adminActionError(w, "Error updating vendor", err)
+		return
+	}
+	http.Redirect(w, r, "/admin/vendors", http.StatusSeeOther)
+}
+
+// AdminDeleteVendorHandler deletes a vendor and their rooms.
+func AdminDeleteVendorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	id, ok := formID(r, "vendor_id")
+	if !ok {
+		http.Error(w, "Invalid vendor ID", http.StatusBadRequest)
+		return
+	}
+	if err := service.DeleteVendorAsAdmin(r.Context(), id); err != nil {
+		adminActionError(w, "Error deleting vendor", err)
+		return
+	}
+	http.Redirect(w, r, "/admin/vendors", http.StatusSeeOther)
+}
+
+// renderAdminBookings renders the bookings page, with an error from a failed
+// refund if there was one.
+func renderAdminBookings(w http.ResponseWriter, r *http.Request, errMsg string) {
+	bookings, err := service.ListAllBookings(r.Context())
+	if err != nil {
+		http.Error(w, "Error retrieving bookings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := map[string]interface{}{"Bookings": bookingStatusRows(bookings, session.RoleAdmin), "Error": errMsg}
+	if err := adminBookingsTmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering bookings", http.StatusInternalServerError)
+	}
+}
+
+// AdminBookingsHandler lists every booking, with status and refund forms for
+// each.
+func AdminBookingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	renderAdminBookings(w, r, "")
+}
+
+// AdminRefundHandler refunds an amount paid for a booking.
+func AdminRefundHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	id, ok := formID(r, "booking_id")
+	if !ok {
+		http.Error(w, "Invalid booking ID", http.StatusBadRequest)
+		return
+	}
+	amount, err := formMoney(r, "amount", "currency")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		renderAdminBookings(w, r, "Invalid refund amount.")
+		return
+	}
+
+	_, err = service.RefundBooking(r.Context(), id, amount, r.FormValue("reason"))
+	var invalid *service.ValidationError
+	if errors.As(err, &invalid) {
+		w.WriteHeader(http.StatusBadRequest)
+		renderAdminBookings(w, r, "Refund failed: "+invalid.Message)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error refunding booking: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/payments", http.StatusSeeOther)
+}
+
+// AdminPaymentsHandler lists every payment, refunds included.
+func AdminPaymentsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	payments, err := service.ListAllPayments(r.Context())
+	if err != nil {
+		http.Error(w, "Error retrieving payments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := adminPaymentsTmpl.Execute(w, payments); err != nil {
+		http.Error(w, "Error rendering payments", http.StatusInternalServerError)
+	}
+}
+
+// AdminReviewsHandler lists every review for moderation.
+func AdminReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	reviews, err := service.ListAllReviews(r.Context())
+	if err != nil {
+		http.Error(w, "Error retrieving reviews: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := adminReviewsTmpl.Execute(w, reviews); err != nil {
+		http.Error(w, "Error rendering reviews", http.StatusInternalServerError)
+	}
+}
+
+// AdminHideReviewHandler hides a review, or shows it again when "hidden" is
+// "false".
+func AdminHideReviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	id, ok := formID(r, "review_id")
+	if !ok {
+		http.Error(w, "Invalid review ID", http.StatusBadRequest)
+		return
+	}
+	hidden := r.FormValue("hidden") != "false"
+	if err := service.SetReviewHidden(r.Context(), id, hidden); err != nil {
+		adminActionError(w, "Error moderating review", err)
+		return
+	}
+	http.Redirect(w, r, "/admin/reviews", http.StatusSeeOther)
+}
+
+// AdminAuditHandler shows the most recent admin actions.
+func AdminAuditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	entries, err := service.GetAuditLog(r.Context(), service.DefaultAuditLogSize)
+	if err != nil {
+		http.Error(w, "Error retrieving audit log: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := adminAuditTmpl.Execute(w, entries); err != nil {
+		http.Error(w, "Error rendering audit log", http.StatusInternalServerError)
+	}
+}
+
+// renderAdminExchangeRates renders the exchange rates page, with an error
+// from a failed change if there was one.
+func renderAdminExchangeRates(w http.ResponseWriter, r *http.Request, errMsg string) {
+	rates, err := service.GetExchangeRates()
+	if err != nil {
+		http.Error(w, "Error retrieving exchange rates: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := map[string]interface{}{
+		"Rates":           rates,
+		"Currencies":      money.Currencies(),
+		"DefaultCurrency": money.DefaultCurrency,
+		"RatesFile":       service.ExchangeRatesFile(),
+		"Error":           errMsg,
+	}
+	if err := adminRatesTmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering exchange rates", http.StatusInternalServerError)
+	}
+}
+
+// AdminExchangeRatesHandler lists the exchange rates prices are converted
+// with, with forms to change them.
+func AdminExchangeRatesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	renderAdminExchangeRates(w, r, "")
+}
+
+// AdminSetExchangeRateHandler sets the rate of a currency.
+func AdminSetExchangeRateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	err := service.SetExchangeRate(r.Context(), r.FormValue("currency"), r.FormValue("rate"))
+	var invalid *service.ValidationError
+	if errors.As(err, &invalid) {
+		w.WriteHeader(http.StatusBadRequest)
+		renderAdminExchangeRates(w, r, "Rate not saved: "+invalid.Message)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error saving exchange rate: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/exchange-rates", http.StatusSeeOther)
+}
+
+// AdminDeleteExchangeRateHandler removes the rate of a currency.
+func AdminDeleteExchangeRateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	if err := service.DeleteExchangeRate(r.Context(), r.FormValue("currency")); err != nil {
+		adminActionError(w, "Error deleting exchange rate", err)
+		return
+	}
+	http.Redirect(w, r, "/admin/exchange-rates", http.StatusSeeOther)
+}
+
+// AdminReloadExchangeRatesHandler loads the configured exchange rates file
+// again.
+func AdminReloadExchangeRatesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_, err := service.ReloadExchangeRates(r.Context())
+	var invalid *service.ValidationError
+	if errors.As(err, &invalid) {
+		w.WriteHeader(http.StatusBadRequest)
+		renderAdminExchangeRates(w, r, "Rates not loaded: "+invalid.Message)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		renderAdminExchangeRates(w, r, "Rates not loaded: "+err.Error())
+		return
+	}
+	http.Redirect(w, r, "/admin/exchange-rates", http.StatusSeeOther)
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"hotelm/models"
+	"hotelm/repository"
+	"hotelm/service"
+)
+
+// formAmenities reads the amenities ticked in a room form's "amenity_id"
+// checkboxes. It reports false if a value is not an amenity ID.
+func formAmenities(r *http.Request) ([]models.Amenity, bool) {
+	var amenities []models.Amenity
+	for _, v := range r.Form["amenity_id"] {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 1 {
+			return nil, false
+		}
+		amenities = append(amenities, models.Amenity{AmenityID: id})
+	}
+	return amenities, true
+}
+
+// amenityOption is an amenity of a checkbox picker and whether it is ticked.
+type amenityOption struct {
+	models.Amenity
+	Checked bool
+}
+
+// amenityOptions returns the amenity catalog as a picker with the amenities
+// whose IDs are among values ticked.
+func amenityOptions(values []string) ([]amenityOption, error) {
+	catalog, err := service.GetAmenities()
+	if err != nil {
+		return nil, err
+	}
+	ticked := map[string]bool{}
+	for _, v := range values {
+		ticked[v] = true
+	}
+	options := make([]amenityOption, len(catalog))
+	for i, a := range catalog {
+		options[i] = amenityOption{a, ticked[strconv.Itoa(a.AmenityID)]}
+	}
+	return options, nil
+}
+
+// errNoAmenity is returned for a form whose amenity ID is missing or
+// malformed, which names no amenity.
+var errNoAmenity = fmt.Errorf("amenity %w", repository.ErrNotFound)
+
+// renderAdminAmenities renders the amenity catalog, with an error from a
+// failed change if there was one.
+func renderAdminAmenities(w http.ResponseWriter, r *http.Request, errMsg string) {
+	amenities, err := service.GetAmenities()
+	if err != nil {
+		http.Error(w, "Error retrieving amenities: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := map[string]interface{}{
+		"Amenities": amenities,
+		"Error":     errMsg,
+	}
+	if err := adminAmenitiesTmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering amenities", http.StatusInternalServerError)
+	}
+}
+
+// AdminAmenitiesHandler lists the amenity catalog rooms pick from, with
+// forms to change it.
+func AdminAmenitiesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	renderAdminAmenities(w, r, "")
+}
+
+// amenityChange handles a form that changes the catalog, showing the
+// catalog again with the reason if the change is rejected.
+func amenityChange(w http.ResponseWriter, r *http.Request, action string, change func() error) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	err := change()
+	var invalid *service.ValidationError
+	if errors.As(err, &invalid) {
+		w.WriteHeader(http.StatusBadRequest)
+		renderAdminAmenities(w, r, action+": "+invalid.Message)
+		return
+	}
+	if err != nil {
+		bookingError(w, r, action, err)
+		return
+	}
+	http.Redirect(w, r, "/admin/amenities", http.StatusSeeOther)
+}
+
+// AdminCreateAmenityHandler adds the amenity given as "name" to the catalog.
+func AdminCreateAmenityHandler(w http.ResponseWriter, r *http.Request) {
+	amenityChange(w, r, "Amenity not added", func() error {
+		_, err := service.CreateAmenity(r.Context(), r.FormValue("name"))
+		return err
+	})
+}
+
+// AdminRenameAmenityHandler renames the amenity given as "amenity_id" to
+// "name".
+func AdminRenameAmenityHandler(w http.ResponseWriter, r *http.Request) {
+	amenityChange(w, r, "Amenity not renamed", func() error {
+		id, ok := formID(r, "amenity_id")
+		if !ok {
+			return errNoAmenity
+		}
+		return service.RenameAmenity(r.Context(), id, r.FormValue("name"))
+	})
+}
+
+// AdminDeleteAmenityHandler removes the amenity given as "amenity_id" from
+// the catalog and from the rooms offering it.
+func AdminDeleteAmenityHandler(w http.ResponseWriter, r *http.Request) {
+	amenityChange(w, r, "Amenity not deleted", func() error {
+		id, ok := formID(r, "amenity_id")
+		if !ok {
+			return errNoAmenity
+		}
+		return service.DeleteAmenity(r.Context(), id)
+	})
+}
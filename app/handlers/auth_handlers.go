@@ -1,17 +1,21 @@
 package handlers
 
 import (
+	"errors"
 	"html/template"
 	"net/http"
-	"strconv"
+	"net/url"
+	"strings"
 
 	"hotelm/service"
 	"hotelm/session"
 )
 
 // loginTemplate is the HTML template for the login page.
-// Ensure that the file "templates/login.html" exists and contains the proper form.
-var loginTemplate = template.Must(template.ParseFiles("templates/login.html"))
+var loginTemplate *template.Template
+
+// setPasswordTemplate is shown to accounts that have no password yet.
+var setPasswordTemplate *template.Template
 
 // LoginPageHandler serves the login page.
 func LoginPageHandler(w http.ResponseWriter, r *http.Request) {
@@ -19,8 +23,10 @@ func LoginPageHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	// Render the login page template.
-	if err := loginTemplate.Execute(w, nil); err != nil {
+	// Render the login page template. "next" is the page to return to after
+	// logging in, set when a protected page redirected here.
+	data := map[string]string{"Next": r.URL.Query().Get("next")}
+	if err := loginTemplate.Execute(w, data); err != nil {
 		http.Error(w, "Error rendering template", http.StatusInternalServerError)
 	}
 }
@@ -39,34 +45,125 @@ func LoginPostHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Retrieve form values.
-	role := r.FormValue("role") // Expected values: "vendor" or "customer"
-	idStr := r.FormValue("id")
-	name := r.FormValue("name")
+	role := r.FormValue("role") // Expected values: "vendor", "customer" or "admin"
+	email := r.FormValue("email")
+	password := r.FormValue("password")
+	next := r.FormValue("next")
 
-	// Convert id from string to integer.
-	id, err := strconv.Atoi(idStr)
+	// Authenticate based on role.
+	var err error
+	if role == "customer" {
+		err = service.LoginCustomer(w, r, email, password)
+	} else if role == "vendor" {
+		err = service.LoginVendor(w, r, email, password)
+	} else if role == "admin" {
+		err = service.LoginAdmin(w, r, email, password)
+	} else {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, service.ErrPasswordNotSet) {
+		// Accounts created before passwords existed log in with their setup
+		// code once, then must set a password.
+		q := url.Values{"role": {role}, "email": {email}}
+		http.Redirect(w, r, "/login/set-password?"+q.Encode(), http.StatusSeeOther)
+		return
+	}
 	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		// On authentication failure, show the login form again with the error.
+		w.WriteHeader(http.StatusUnauthorized)
+		loginTemplate.Execute(w, map[string]string{"Error": "Login failed: " + err.Error(), "Email": email, "Role": role, "Next": next})
 		return
 	}
 
-	// Authenticate based on role.
+	// On success, go back to the page that asked for the login, or to the
+	// appropriate dashboard.
+	if target, ok := loginRedirect(next, role); ok {
+		http.Redirect(w, r, target, http.StatusSeeOther)
+	} else if role == "customer" {
+		http.Redirect(w, r, "/customer", http.StatusSeeOther)
+	} else if role == "admin" {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, "/vendor", http.StatusSeeOther)
+	}
+}
+
+// loginRedirect validates the "next" target of a login. Only local paths in
+// the logged-in role's own section are accepted, so the parameter cannot be
+// used to send users to another site.
+func loginRedirect(next, role string) (string, bool) {
+	u, err := url.Parse(next)
+	if err != nil || next == "" || u.IsAbs() || u.Host != "" || strings.HasPrefix(next, "//") || strings.Contains(next, "\\") {
+		return "", false
+	}
+	section := "/" + role
+	if u.Path != section && !strings.HasPrefix(u.Path, section+"/") {
+		return "", false
+	}
+	return u.RequestURI(), true
+}
+
+// SetPasswordPageHandler renders the form used by existing accounts to set
+// their first password.
+func SetPasswordPageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data := map[string]string{
+		"Role":  r.URL.Query().Get("role"),
+		"Email": r.URL.Query().Get("email"),
+	}
+	if err := setPasswordTemplate.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+	}
+}
+
+// SetPasswordPostHandler verifies the setup code of an account, stores its
+// new password and logs the user in.
+func SetPasswordPostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	role := r.FormValue("role")
+	email := r.FormValue("email")
+	code := r.FormValue("code")
+	password := r.FormValue("password")
+	confirm := r.FormValue("confirm_password")
+
+	data := map[string]string{"Role": role, "Email": email}
+	renderError := func(msg string) {
+		data["Error"] = msg
+		setPasswordTemplate.Execute(w, data)
+	}
+
+	if password != confirm {
+		renderError("Passwords do not match.")
+		return
+	}
+
+	var err error
 	if role == "customer" {
-		err = service.LoginCustomer(id, name)
+		err = service.SetInitialCustomerPassword(w, r, email, code, password)
 	} else if role == "vendor" {
-		err = service.LoginVendor(id, name)
+		err = service.SetInitialVendorPassword(w, r, email, code, password)
 	} else {
 		http.Error(w, "Invalid role", http.StatusBadRequest)
 		return
 	}
-
 	if err != nil {
-		// On authentication failure, return an error.
-		http.Error(w, "Login failed: "+err.Error(), http.StatusUnauthorized)
+		renderError("Could not set password: " + err.Error())
 		return
 	}
 
-	// On success, redirect to the appropriate dashboard.
 	if role == "customer" {
 		http.Redirect(w, r, "/customer", http.StatusSeeOther)
 	} else {
@@ -76,6 +173,9 @@ func LoginPostHandler(w http.ResponseWriter, r *http.Request) {
 
 // LogoutHandler clears the current user session and redirects to the login page.
 func LogoutHandler(w http.ResponseWriter, r *http.Request) {
-	session.ClearCurrentUser()
+	if err := session.ClearCurrentUser(w, r); err != nil {
+		http.Error(w, "Error ending session", http.StatusInternalServerError)
+		return
+	}
 	http.Redirect(w, r, "/login", http.StatusSeeOther)
 }
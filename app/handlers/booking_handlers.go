@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+
+	"hotelm/models"
+	"hotelm/repository"
+	"hotelm/service"
+	"hotelm/session"
+)
+
+// Page templates, loaded by LoadTemplates.
+var (
+	vendorBookingsTmpl *template.Template
+	bookingHistoryTmpl *template.Template
+)
+
+// bookingError reports a failed booking action: a rejected change as a bad
+// request, a booking of someone else as forbidden.
+func bookingError(w http.ResponseWriter, r *http.Request, action string, err error) {
+	var invalid *service.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		http.Error(w, action+": "+invalid.Message, http.StatusBadRequest)
+	case errors.Is(err, repository.ErrNotFound):
+		http.NotFound(w, r)
+	case errors.Is(err, service.ErrForbidden):
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	default:
+		http.Error(w, action+": "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// bookingStatusRow is a booking with the statuses the logged-in user can
+// move it to.
+type bookingStatusRow struct {
+	models.Booking
+	Transitions []string
+}
+
+// bookingStatusRows pairs each booking with the transitions open to role.
+func bookingStatusRows(bookings []models.Booking, role string) []bookingStatusRow {
+	rows := make([]bookingStatusRow, 0, len(bookings))
+	for _, b := range bookings {
+		rows = append(rows, bookingStatusRow{Booking: b, Transitions: service.BookingTransitions(b.Status, role)})
+	}
+	return rows
+}
+
+// VendorBookingsHandler lists the bookings of the vendor's rooms with
+// check-in, check-out and no-show actions.
+func VendorBookingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	bookings, err := service.GetVendorBookings(r.Context())
+	if err != nil {
+		http.Error(w, "Error retrieving vendor bookings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := vendorBookingsTmpl.Execute(w, bookingStatusRows(bookings, session.RoleVendor)); err != nil {
+		http.Error(w, "Error rendering vendor bookings", http.StatusInternalServerError)
+	}
+}
+
+// BookingStatusHandler moves a booking to the status in the form, for a
+// vendor or an admin, and returns to their bookings page.
+func BookingStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	id, ok := formID(r, "booking_id")
+	if !ok {
+		http.Error(w, "Invalid booking ID", http.StatusBadRequest)
+		return
+	}
+	if err := service.SetBookingStatus(r.Context(), id, r.FormValue("status"), r.FormValue("reason")); err != nil {
+		bookingError(w, r, "Error updating booking", err)
+		return
+	}
+	http.Redirect(w, r, sectionURL(r, "/bookings"), http.StatusSeeOther)
+}
+
+// BookingHistoryHandler shows the status changes of a booking and who made
+// them.
+func BookingHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, ok := formID(r, "booking_id")
+	if !ok {
+		http.Error(w, "Invalid booking ID", http.StatusBadRequest)
+		return
+	}
+	events, err := service.GetBookingHistory(r.Context(), id)
+	if err != nil {
+		bookingError(w, r, "Error retrieving booking history", err)
+		return
+	}
+	data := map[string]interface{}{
+		"BookingID": id,
+		"Events":    events,
+		"Back":      sectionURL(r, "/bookings"),
+	}
+	if err := bookingHistoryTmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering booking history", http.StatusInternalServerError)
+	}
+}
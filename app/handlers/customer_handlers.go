@@ -1,21 +1,25 @@
 package handlers
 
 import (
+	"errors"
 	"html/template"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 	"hotelm/repository"
 	"hotelm/models"
+	"hotelm/money"
 	"hotelm/service"
 )
 
-// Parse templates once at startup.
+// Page templates, loaded by LoadTemplates.
 var (
-	customerDashboardTmpl = template.Must(template.ParseFiles("templates/customer_dashboard.html"))
-	availableRoomsTmpl    = template.Must(template.ParseFiles("templates/available_rooms.html"))
-	bookingFormTmpl       = template.Must(template.ParseFiles("templates/booking_form.html"))
-	myBookingsTmpl        = template.Must(template.ParseFiles("templates/my_bookings.html"))
+	customerDashboardTmpl *template.Template
+	availableRoomsTmpl    *template.Template
+	bookingFormTmpl       *template.Template
+	myBookingsTmpl        *template.Template
 )
 
 // CustomerDashboardHandler renders the customer dashboard with options.
@@ -25,28 +29,125 @@ func CustomerDashboardHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	unread, err := service.CountMyUnreadMessages(r.Context())
+	if err != nil {
+		http.Error(w, "Error counting messages: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	// Render the customer dashboard page.
-	if err := customerDashboardTmpl.Execute(w, nil); err != nil {
+	data := map[string]interface{}{"UnreadMessages": unread}
+	if err := customerDashboardTmpl.Execute(w, data); err != nil {
 		http.Error(w, "Error rendering customer dashboard", http.StatusInternalServerError)
 		return
 	}
 }
 
-// AvailableRoomsHandler retrieves available rooms and renders the list.
+// dateLayout is the format used for dates in forms and query strings.
+const dateLayout = "2006-01-02"
+
+// pageURL returns the rooms page URL for the given query with a different
+// offset, so paging keeps the current filters.
+func pageURL(query url.Values, offset int) string {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("offset", strconv.Itoa(offset))
+	return "/customer/rooms?" + q.Encode()
+}
+
+// AvailableRoomsHandler searches the rooms that are free for the requested
+// stay and match the filters in the query string, and renders one page.
 func AvailableRoomsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	rooms, err := service.GetAvailableRooms()
+	query := r.URL.Query()
+	filter, err := service.ParseRoomSearch(query)
+	if err != nil {
+		http.Error(w, "Invalid search: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := service.SearchRooms(filter)
 	if err != nil {
-		http.Error(w, "Error retrieving available rooms: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Error retrieving available rooms: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Render the available rooms template, passing the rooms slice.
-	if err := availableRoomsTmpl.Execute(w, rooms); err != nil {
+	// Show each price in the customer's display currency as well, when it
+	// has an exchange rate.
+	type roomRow struct {
+		models.Room
+		Display *money.Money
+	}
+	displayCurrency := service.DisplayCurrency(r.Context())
+	rates, err := service.GetRates()
+	if err != nil {
+		http.Error(w, "Error retrieving exchange rates: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rows := make([]roomRow, 0, len(result.Rooms))
+	for _, room := range result.Rooms {
+		row := roomRow{Room: room}
+		if displayCurrency != "" && displayCurrency != room.Price.Currency {
+			if converted, _, ok := rates.Convert(room.Price, displayCurrency); ok {
+				row.Display = &converted
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	amenities, err := amenityOptions(query["amenity_id"])
+	if err != nil {
+		http.Error(w, "Error retrieving amenities: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var property *models.Property
+	if filter.PropertyID != 0 {
+		if property, err = service.GetProperty(filter.PropertyID); err != nil {
+			bookingError(w, r, "Error retrieving property", err)
+			return
+		}
+	}
+
+	data := struct {
+		Property        *models.Property // the search is limited to, if any
+		Rooms           []roomRow
+		Query           url.Values
+		Amenities       []amenityOption
+		CheckinDate     string
+		CheckoutDate    string
+		Currencies      []string
+		Currency        string // of the price bounds
+		DisplayCurrency string
+		PageURL         string
+		PrevURL         string
+		NextURL         string
+	}{
+		Property:        property,
+		Rooms:           rows,
+		Query:           query,
+		Amenities:       amenities,
+		CheckinDate:     filter.CheckinDate.Format(dateLayout),
+		CheckoutDate:    filter.CheckoutDate.Format(dateLayout),
+		Currencies:      money.Currencies(),
+		Currency:        filter.MinPrice.Currency,
+		DisplayCurrency: displayCurrency,
+		PageURL:         r.URL.RequestURI(),
+	}
+	if result.Offset > 0 {
+		data.PrevURL = pageURL(query, max(result.Offset-result.Limit, 0))
+	}
+	if result.HasMore {
+		data.NextURL = pageURL(query, result.Offset+result.Limit)
+	}
+
+	// Render the available rooms template with the rooms and the current search.
+	if err := availableRoomsTmpl.Execute(w, data); err != nil {
 		http.Error(w, "Error rendering available rooms", http.StatusInternalServerError)
 		return
 	}
@@ -72,11 +173,73 @@ func NewBookingPageHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Pass the room ID to the booking form template.
+	// Pass the room ID and any dates chosen on the rooms page to the form.
 	data := struct {
-		RoomID int
+		RoomID       int
+		Property     *models.Property
+		Photos       []models.RoomPhoto
+		CheckinDate  string
+		CheckoutDate string
+		PromoCode    string
+		Quote        *service.Quote
+		Policy       string
+		Error        string
+		PromoError   string
+		// IdempotencyKey is sent back with the booking so a double submit
+		// books and charges once.
+		IdempotencyKey string
 	}{
-		RoomID: roomID,
+		RoomID:         roomID,
+		CheckinDate:    r.URL.Query().Get("checkin_date"),
+		CheckoutDate:   r.URL.Query().Get("checkout_date"),
+		PromoCode:      r.URL.Query().Get("promo_code"),
+		IdempotencyKey: newFormToken(),
+	}
+
+	// Show the cancellation policy the booking will be made under.
+	policy, err := service.GetRoomCancellationPolicy(roomID)
+	if err != nil {
+		http.Error(w, "Error retrieving room: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Policy = service.DescribeCancellationPolicy(policy)
+	if data.Property, err = service.GetRoomProperty(roomID); err != nil {
+		bookingError(w, r, "Error retrieving room", err)
+		return
+	}
+	if data.Photos, err = service.GetRoomPhotos(roomID); err != nil {
+		http.Error(w, "Error retrieving room photos: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Once both dates are chosen, show the price of the stay so the customer
+	// can review it before confirming.
+	if data.CheckinDate != "" && data.CheckoutDate != "" {
+		checkin, err1 := time.Parse(dateLayout, data.CheckinDate)
+		checkout, err2 := time.Parse(dateLayout, data.CheckoutDate)
+		if err1 != nil || err2 != nil {
+			data.Error = "Invalid stay dates."
+		} else if err := service.ValidateStayDates(roomID, checkin, checkout); err != nil {
+			data.Error = err.Error()
+		} else if data.Quote, err = service.QuoteStayWithPromo(r.Context(), roomID, checkin, checkout, data.PromoCode); err != nil {
+			// If the promo code is what was rejected, price the stay without
+			// it and say why next to the code.
+			var invalid *service.ValidationError
+			if data.PromoCode != "" && errors.As(err, &invalid) {
+				if data.Quote, err = service.QuoteStay(roomID, checkin, checkout); err == nil {
+					data.PromoError = invalid.Message
+				}
+			}
+			if err != nil {
+				data.Error = "Could not price this stay: " + err.Error()
+			}
+		}
+		if data.Quote != nil {
+			if data.Quote.Display, err = service.ConvertForDisplay(data.Quote.Total, service.DisplayCurrency(r.Context())); err != nil {
+				http.Error(w, "Error converting price: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
 	}
 
 	if err := bookingFormTmpl.Execute(w, data); err != nil {
@@ -102,6 +265,12 @@ func CreateBookingHandler(w http.ResponseWriter, r *http.Request) {
     checkinStr := r.FormValue("checkin_date")
     checkoutStr := r.FormValue("checkout_date")
     paymentMethod := r.FormValue("payment_method")
+    promoCode := r.FormValue("promo_code")
+    quotedTotal, err := formMoney(r, "quoted_total", "quoted_currency")
+    if err != nil {
+        http.Error(w, "Missing price quote, please review the booking first", http.StatusBadRequest)
+        return
+    }
 
     roomID, err := strconv.Atoi(roomIDStr)
     if err != nil {
@@ -110,12 +279,12 @@ func CreateBookingHandler(w http.ResponseWriter, r *http.Request) {
     }
 
     // Expect dates in YYYY-MM-DD format.
-    checkinDate, err := time.Parse("2006-01-02", checkinStr)
+    checkinDate, err := time.Parse(dateLayout, checkinStr)
     if err != nil {
         http.Error(w, "Invalid check-in date", http.StatusBadRequest)
         return
     }
-    checkoutDate, err := time.Parse("2006-01-02", checkoutStr)
+    checkoutDate, err := time.Parse(dateLayout, checkoutStr)
     if err != nil {
         http.Error(w, "Invalid check-out date", http.StatusBadRequest)
         return
@@ -125,37 +294,22 @@ func CreateBookingHandler(w http.ResponseWriter, r *http.Request) {
         BookingDate:   time.Now(),
         CheckinDate:   checkinDate,
         CheckoutDate:  checkoutDate,
-        PaymentStatus: "Pending", // Will be updated when payment is created.
         RoomID:        roomID,
         // CustomerID will be set in the service layer.
     }
 
-    // Create the booking using the service layer and capture the bookingID.
-    bookingID, err := service.CreateBookingForCustomer(booking)
-    if err != nil {
-        http.Error(w, "Error creating booking: "+err.Error(), http.StatusInternalServerError)
+    // Create the booking and its payment using the service layer.
+    _, err = service.CreateBookingForCustomer(r.Context(), booking, paymentMethod, quotedTotal, promoCode)
+    if errors.Is(err, repository.ErrRoomUnavailable) || errors.Is(err, service.ErrQuoteChanged) {
+        http.Error(w, "Error creating booking: "+err.Error(), http.StatusConflict)
         return
     }
-
-    // Retrieve the room details to obtain the price.
-    room, err := repository.GetRoomByID(roomID)
-    if err != nil {
-        http.Error(w, "Error retrieving room details: "+err.Error(), http.StatusInternalServerError)
+    if errors.Is(err, service.ErrPaymentDeclined) {
+        http.Error(w, "Error creating booking: "+err.Error(), http.StatusPaymentRequired)
         return
     }
-
-    // Create a payment record with the specified payment method and room's price.
-    payment := models.Payment{
-        PaymentMethod:   paymentMethod,
-        PaymentStatus:   "Completed",
-        TransactionDate: time.Now(),
-        Amount:          room.Price,
-        BookingID:       bookingID, // Use the returned bookingID.
-    }
-
-    _, err = repository.CreatePayment(payment)
     if err != nil {
-        http.Error(w, "Error creating payment: "+err.Error(), http.StatusInternalServerError)
+        bookingError(w, r, "Error creating booking", err)
         return
     }
 
@@ -171,22 +325,113 @@ func MyBookingsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	bookings, err := service.GetMyBookings()
+	bookings, err := service.GetMyBookings(r.Context())
 	if err != nil {
 		http.Error(w, "Error retrieving bookings: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	reviewed, err := service.GetReviewedBookingIDs(r.Context())
+	if err != nil {
+		http.Error(w, "Error retrieving reviews: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Completed stays that have not been reviewed yet get a review link;
+	// stays that have not started can be cancelled, with the refund the
+	// customer would get today.
+	type bookingRow struct {
+		models.Booking
+		CanReview bool
+		Refund    *service.CancellationQuote
+		Policy    string
+	}
+	rows := make([]bookingRow, 0, len(bookings))
+	for _, b := range bookings {
+		row := bookingRow{
+			Booking:   b,
+			CanReview: service.IsBookingCompleted(b) && !reviewed[b.BookingID],
+			Policy:    service.DescribeCancellationPolicy(b.CancellationPolicy),
+		}
+		if service.CanCancelBooking(b) {
+			if row.Refund, err = service.QuoteCancellation(r.Context(), b.BookingID); err != nil {
+				http.Error(w, "Error pricing cancellation: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		rows = append(rows, row)
+	}
 
-	// Render the my bookings template, passing the bookings slice.
-	if err := myBookingsTmpl.Execute(w, bookings); err != nil {
+	// Render the my bookings template, passing the booking rows.
+	if err := myBookingsTmpl.Execute(w, rows); err != nil {
 		http.Error(w, "Error rendering my bookings", http.StatusInternalServerError)
 		return
 	}
 }
 
-// DeleteBookingHandler processes the deletion of a booking.
-// The booking ID should be passed as a form value.
-func DeleteBookingHandler(w http.ResponseWriter, r *http.Request) {
+// DisplayCurrencyHandler sets the currency the logged-in customer wants
+// prices shown in, then returns to the page given as "next".
+func DisplayCurrencyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	err := service.SetDisplayCurrency(r.Context(), r.FormValue("display_currency"))
+	var invalid *service.ValidationError
+	if errors.As(err, &invalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error setting display currency: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Only return to pages of this site.
+	next := r.FormValue("next")
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		next = "/customer/rooms"
+	}
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// CompletePaymentHandler completes the pending payment of a booking once the
+// customer has confirmed it with their bank. The booking ID is passed as a
+// form value.
+func CompletePaymentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	bookingID, ok := formID(r, "booking_id")
+	if !ok {
+		http.Error(w, "Invalid booking ID", http.StatusBadRequest)
+		return
+	}
+
+	err := service.CompleteBookingPayment(r.Context(), bookingID)
+	if errors.Is(err, service.ErrPaymentDeclined) {
+		http.Error(w, "Payment failed, the booking was cancelled: "+err.Error(), http.StatusPaymentRequired)
+		return
+	}
+	if err != nil {
+		bookingError(w, r, "Error completing payment", err)
+		return
+	}
+	http.Redirect(w, r, "/customer/bookings", http.StatusSeeOther)
+}
+
+// CancelBookingHandler cancels a booking of the logged-in customer. The
+// booking ID and an optional reason are passed as form values.
+func CancelBookingHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
@@ -204,8 +449,8 @@ func DeleteBookingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := service.DeleteBookingForCustomer(bookingID); err != nil {
-		http.Error(w, "Error deleting booking: "+err.Error(), http.StatusInternalServerError)
+	if err := service.CancelBookingForCustomer(r.Context(), bookingID, r.FormValue("reason")); err != nil {
+		bookingError(w, r, "Error cancelling booking", err)
 		return
 	}
 
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"hotelm/repository"
+	"hotelm/service"
+	"hotelm/session"
+)
+
+// Page templates, loaded by LoadTemplates.
+var (
+	messagesTmpl      *template.Template
+	messageThreadTmpl *template.Template
+)
+
+// sectionURL returns path within the logged-in user's section, e.g.
+// "/customer/messages" for "/messages". Pages shared by customers, vendors
+// and admins link within the section they were reached from.
+func sectionURL(r *http.Request, path string) string {
+	role := ""
+	if p := session.FromContext(r.Context()); p != nil {
+		role = p.Role
+	}
+	return "/" + role + path
+}
+
+// messagesBase returns the messages section of the logged-in user's role.
+func messagesBase(r *http.Request) string {
+	return sectionURL(r, "/messages")
+}
+
+// renderMessages renders the thread list with the new thread form, prefilled
+// from the room_id and booking_id form values.
+func renderMessages(w http.ResponseWriter, r *http.Request, errMsg string) {
+	threads, err := service.GetMyThreads(r.Context())
+	if err != nil {
+		http.Error(w, "Error retrieving messages: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := map[string]interface{}{
+		"Threads":   threads,
+		"Base":      messagesBase(r),
+		"Role":      session.FromContext(r.Context()).Role,
+		"RoomID":    r.FormValue("room_id"),
+		"BookingID": r.FormValue("booking_id"),
+		"Subject":   r.FormValue("subject"),
+		"Body":      r.FormValue("body"),
+		"Error":     errMsg,
+	}
+	if err := messagesTmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering messages", http.StatusInternalServerError)
+	}
+}
+
+// MessagesHandler lists the user's message threads.
+func MessagesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	renderMessages(w, r, "")
+}
+
+// NewThreadHandler starts a message thread about a room or booking.
+func NewThreadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	// Either ID may be left empty.
+	roomID, _ := strconv.Atoi(r.FormValue("room_id"))
+	bookingID, _ := strconv.Atoi(r.FormValue("booking_id"))
+	id, err := service.StartThread(r.Context(), service.NewThread{
+		RoomID:    roomID,
+		BookingID: bookingID,
+		Subject:   r.FormValue("subject"),
+		Body:      r.FormValue("body"),
+	})
+	var invalid *service.ValidationError
+	if errors.As(err, &invalid) {
+		w.WriteHeader(http.StatusBadRequest)
+		renderMessages(w, r, invalid.Message)
+		return
+	}
+	if errors.Is(err, service.ErrForbidden) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error starting thread: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, messagesBase(r)+"/thread?id="+strconv.Itoa(id), http.StatusSeeOther)
+}
+
+// ThreadHandler shows a thread (GET) and posts a reply to it (POST).
+func ThreadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid thread ID", http.StatusBadRequest)
+		return
+	}
+
+	errMsg := ""
+	if r.Method == http.MethodPost {
+		_, err := service.PostMessage(r.Context(), id, r.FormValue("body"))
+		var invalid *service.ValidationError
+		switch {
+		case err == nil:
+			http.Redirect(w, r, messagesBase(r)+"/thread?id="+strconv.Itoa(id), http.StatusSeeOther)
+			return
+		case errors.Is(err, repository.ErrNotFound):
+			http.NotFound(w, r)
+			return
+		case errors.As(err, &invalid):
+			w.WriteHeader(http.StatusBadRequest)
+			errMsg = invalid.Message
+		case errors.Is(err, service.ErrForbidden):
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		default:
+			http.Error(w, "Error posting message: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	thread, messages, err := service.GetThread(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if errors.Is(err, service.ErrForbidden) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error retrieving thread: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := map[string]interface{}{
+		"Thread":   thread,
+		"Messages": messages,
+		"Base":     messagesBase(r),
+		"Role":     session.FromContext(r.Context()).Role,
+		"Error":    errMsg,
+	}
+	if err := messageThreadTmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering thread", http.StatusInternalServerError)
+	}
+}
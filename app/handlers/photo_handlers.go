@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"hotelm/imaging"
+	"hotelm/models"
+	"hotelm/repository"
+	"hotelm/service"
+)
+
+// maxUploadBytes bounds the body of a form with photos: the photos one
+// form may send, at the largest size, and the other fields.
+const maxUploadBytes = service.MaxPhotosPerUpload*service.MaxPhotoBytes + 1<<20
+
+// formPhotos parses a multipart form and reads the files uploaded in its
+// "photos" field. It returns a message if the form or a file is rejected.
+func formPhotos(w http.ResponseWriter, r *http.Request) ([][]byte, string) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, "The upload is too large."
+		}
+		return nil, "Error parsing form."
+	}
+	files := r.MultipartForm.File["photos"]
+	if len(files) > service.MaxPhotosPerUpload {
+		return nil, "Upload at most " + strconv.Itoa(service.MaxPhotosPerUpload) + " photos at a time."
+	}
+	var photos [][]byte
+	for _, fh := range files {
+		if fh.Size == 0 {
+			continue // the file input was left empty
+		}
+		if fh.Size > service.MaxPhotoBytes {
+			return nil, fh.Filename + " is larger than " + strconv.Itoa(service.MaxPhotoBytes>>20) + " MB."
+		}
+		data, errMsg := readFormFile(fh)
+		if errMsg != "" {
+			return nil, errMsg
+		}
+		photos = append(photos, data)
+	}
+	return photos, ""
+}
+
+// readFormFile reads an uploaded photo. Its header is checked first, so an
+// image too large to decode is rejected before the file is loaded. It
+// returns a message if the file is rejected.
+func readFormFile(fh *multipart.FileHeader) ([]byte, string) {
+	f, err := fh.Open()
+	if err != nil {
+		return nil, "Error reading " + fh.Filename + "."
+	}
+	defer f.Close()
+	_, err = imaging.InspectReader(f)
+	if errors.Is(err, imaging.ErrUnsupported) {
+		return nil, fh.Filename + " is not a JPEG, PNG or GIF image."
+	}
+	if err != nil {
+		return nil, fh.Filename + ": " + err.Error() + "."
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, "Error reading " + fh.Filename + "."
+	}
+	data, err := io.ReadAll(io.LimitReader(f, service.MaxPhotoBytes))
+	if err != nil {
+		return nil, "Error reading " + fh.Filename + "."
+	}
+	return data, ""
+}
+
+// editRoomURL returns the edit page of a room, where its photos are managed.
+func editRoomURL(roomID int) string {
+	return "/vendor/rooms/edit?room_id=" + strconv.Itoa(roomID)
+}
+
+// PhotoHandler serves a room photo or thumbnail by its storage key, the
+// path after models.PhotoPath. Keys are never reused, so responses can be
+// cached for good.
+func PhotoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, models.PhotoPath)
+	obj, err := service.OpenPhoto(r.Context(), key)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error retrieving photo: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer obj.Body.Close()
+
+	w.Header().Set("Content-Type", obj.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	if obj.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	io.Copy(w, obj.Body)
+}
+
+// UploadRoomPhotosHandler adds the photos uploaded in the multipart field
+// "photos" to the vendor's room given as "room_id".
+func UploadRoomPhotosHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	photos, errMsg := formPhotos(w, r)
+	roomID, ok := formID(r, "room_id")
+	if !ok {
+		http.Error(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	if errMsg == "" && len(photos) == 0 {
+		errMsg = "Choose one or more photos to upload."
+	}
+	if errMsg != "" {
+		renderEditRoom(w, r, roomID, errMsg)
+		return
+	}
+
+	for _, photo := range photos {
+		_, err := service.AddRoomPhotoForVendor(r.Context(), roomID, photo)
+		var invalid *service.ValidationError
+		if errors.As(err, &invalid) {
+			renderEditRoom(w, r, roomID, invalid.Message)
+			return
+		}
+		if err != nil {
+			bookingError(w, r, "Error saving photo", err)
+			return
+		}
+	}
+	http.Redirect(w, r, editRoomURL(roomID)+"#photos", http.StatusSeeOther)
+}
+
+// photoAction handles a form that changes the photo given as "photo_id",
+// then returns to the photos of its room.
+func photoAction(w http.ResponseWriter, r *http.Request, action string, change func(photoID int) (int, error)) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	photoID, ok := formID(r, "photo_id")
+	if !ok {
+		http.Error(w, "Invalid photo ID", http.StatusBadRequest)
+		return
+	}
+	roomID, err := change(photoID)
+	if err != nil {
+		bookingError(w, r, action, err)
+		return
+	}
+	http.Redirect(w, r, editRoomURL(roomID)+"#photos", http.StatusSeeOther)
+}
+
+// DeleteRoomPhotoHandler deletes the photo given as "photo_id".
+func DeleteRoomPhotoHandler(w http.ResponseWriter, r *http.Request) {
+	photoAction(w, r, "Error deleting photo", func(photoID int) (int, error) {
+		return service.DeleteRoomPhotoForVendor(r.Context(), photoID)
+	})
+}
+
+// CoverPhotoHandler makes the photo given as "photo_id" its room's cover.
+func CoverPhotoHandler(w http.ResponseWriter, r *http.Request) {
+	photoAction(w, r, "Error setting cover photo", func(photoID int) (int, error) {
+		return service.SetCoverPhotoForVendor(r.Context(), photoID)
+	})
+}
+
+// MoveRoomPhotoHandler moves the photo given as "photo_id" one place
+// earlier or later in its room's photos, as "direction" is "up" or "down".
+func MoveRoomPhotoHandler(w http.ResponseWriter, r *http.Request) {
+	photoAction(w, r, "Error moving photo", func(photoID int) (int, error) {
+		offset := 1
+		if r.FormValue("direction") == "up" {
+			offset = -1
+		}
+		return service.MoveRoomPhotoForVendor(r.Context(), photoID, offset)
+	})
+}
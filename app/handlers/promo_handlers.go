@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"hotelm/models"
+	"hotelm/repository"
+	"hotelm/service"
+	"hotelm/session"
+)
+
+// promoCodesTmpl is the promo code page shared by vendors and admins,
+// loaded by LoadTemplates.
+var promoCodesTmpl *template.Template
+
+// promoCodeRow is a promo code with its discount in words.
+type promoCodeRow struct {
+	models.PromoCode
+	Discount string
+}
+
+// formOptionalInt parses an optional whole number from a form field, 0 if
+// it is empty.
+func formOptionalInt(r *http.Request, field string) (int, bool) {
+	value := strings.TrimSpace(r.FormValue(field))
+	if value == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(value)
+	return n, err == nil
+}
+
+// formOptionalDate parses an optional date from a form field, nil if it is
+// empty.
+func formOptionalDate(r *http.Request, field string) (*time.Time, bool) {
+	value := strings.TrimSpace(r.FormValue(field))
+	if value == "" {
+		return nil, true
+	}
+	t, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return nil, false
+	}
+	return &t, true
+}
+
+// parsePromoCodeForm reads a new promo code from the form. It returns a
+// message if the form is not a promo code.
+func parsePromoCodeForm(r *http.Request) (models.PromoCode, string) {
+	promo := models.PromoCode{
+		Code:        r.FormValue("code"),
+		Description: r.FormValue("description"),
+		RoomType:    r.FormValue("room_type"),
+	}
+	if r.FormValue("kind") == "amount" {
+		amount, err := formMoney(r, "value", "currency")
+		if err != nil {
+			return promo, "Invalid discount amount."
+		}
+		promo.Amount = &amount
+	} else {
+		percent, err := strconv.ParseFloat(strings.TrimSpace(r.FormValue("value")), 64)
+		if err != nil {
+			return promo, "Invalid discount percentage."
+		}
+		promo.Percent = percent
+	}
+
+	var ok bool
+	if promo.ValidFrom, ok = formOptionalDate(r, "valid_from"); !ok {
+		return promo, "Invalid start date."
+	}
+	if promo.ValidUntil, ok = formOptionalDate(r, "valid_until"); !ok {
+		return promo, "Invalid end date."
+	}
+	if promo.MaxUses, ok = formOptionalInt(r, "max_uses"); !ok {
+		return promo, "Invalid maximum uses."
+	}
+	if promo.MaxUsesPerCustomer, ok = formOptionalInt(r, "max_uses_per_customer"); !ok {
+		return promo, "Invalid maximum uses per customer."
+	}
+	if promo.MinNights, ok = formOptionalInt(r, "min_nights"); !ok {
+		return promo, "Invalid minimum nights."
+	}
+	if roomID, ok := formOptionalInt(r, "room_id"); !ok {
+		return promo, "Invalid room ID."
+	} else if roomID != 0 {
+		promo.RoomID = &roomID
+	}
+	return promo, ""
+}
+
+// renderPromoCodes renders the promo code list with the form to create one.
+// Vendors get their own codes; admins get every code and create
+// platform-wide ones.
+func renderPromoCodes(w http.ResponseWriter, r *http.Request, errMsg string) {
+	role := session.FromContext(r.Context()).Role
+	var codes []models.PromoCode
+	var err error
+	if role == session.RoleAdmin {
+		codes, err = service.ListAllPromoCodes(r.Context())
+	} else {
+		codes, err = service.GetVendorPromoCodes(r.Context())
+	}
+	if err != nil {
+		http.Error(w, "Error retrieving promo codes: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rows := make([]promoCodeRow, len(codes))
+	for i, promo := range codes {
+		rows[i] = promoCodeRow{promo, service.DescribePromoCode(promo)}
+	}
+
+	data := map[string]interface{}{
+		"Base":       sectionURL(r, "/promo-codes"),
+		"Role":       role,
+		"PromoCodes": rows,
+		"Form":       r.PostForm,
+		"Error":      errMsg,
+	}
+	if err := promoCodesTmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering promo codes", http.StatusInternalServerError)
+	}
+}
+
+// PromoCodesHandler lists promo codes.
+func PromoCodesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	renderPromoCodes(w, r, "")
+}
+
+// NewPromoCodeHandler creates a promo code: for the vendor's rooms, or for
+// every room when an admin creates it.
+func NewPromoCodeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	promo, errMsg := parsePromoCodeForm(r)
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		renderPromoCodes(w, r, errMsg)
+		return
+	}
+
+	var err error
+	if session.FromContext(r.Context()).Role == session.RoleAdmin {
+		_, err = service.CreatePlatformPromoCode(r.Context(), promo)
+	} else {
+		_, err = service.CreatePromoCodeForVendor(r.Context(), promo)
+	}
+	var invalid *service.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		w.WriteHeader(http.StatusBadRequest)
+		renderPromoCodes(w, r, invalid.Message)
+		return
+	case errors.Is(err, repository.ErrNotFound):
+		// The only thing looked up is the room the code is restricted to.
+		w.WriteHeader(http.StatusBadRequest)
+		renderPromoCodes(w, r, "There is no room "+r.FormValue("room_id")+".")
+		return
+	case err != nil:
+		bookingError(w, r, "Error creating promo code", err)
+		return
+	}
+	http.Redirect(w, r, sectionURL(r, "/promo-codes"), http.StatusSeeOther)
+}
+
+// PromoCodeActiveHandler enables or disables the promo code given as
+// "promo_code_id"; "active" is "true" to enable it.
+func PromoCodeActiveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	id, ok := formID(r, "promo_code_id")
+	if !ok {
+		http.Error(w, "Invalid promo code ID", http.StatusBadRequest)
+		return
+	}
+	active := r.FormValue("active") == "true"
+
+	var err error
+	if session.FromContext(r.Context()).Role == session.RoleAdmin {
+		err = service.SetPromoCodeActive(r.Context(), id, active)
+	} else {
+		err = service.SetPromoCodeActiveForVendor(r.Context(), id, active)
+	}
+	if err != nil {
+		bookingError(w, r, "Error updating promo code", err)
+		return
+	}
+	http.Redirect(w, r, sectionURL(r, "/promo-codes"), http.StatusSeeOther)
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"hotelm/models"
+	"hotelm/service"
+)
+
+// Page templates, loaded by LoadTemplates.
+var (
+	vendorPropertiesTmpl *template.Template
+	propertyFormTmpl     *template.Template
+	propertiesTmpl       *template.Template
+)
+
+// formOptionalFloat parses an optional number from a form field, nil if it
+// is empty.
+func formOptionalFloat(r *http.Request, field string) (*float64, bool) {
+	value := strings.TrimSpace(r.FormValue(field))
+	if value == "" {
+		return nil, true
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, false
+	}
+	return &f, true
+}
+
+// parsePropertyForm reads a property from the property form, with a message
+// for the vendor if a field cannot be parsed.
+func parsePropertyForm(r *http.Request) (models.Property, string) {
+	p := models.Property{
+		Name:         r.FormValue("name"),
+		Address:      r.FormValue("address"),
+		Timezone:     r.FormValue("timezone"),
+		CheckinTime:  r.FormValue("checkin_time"),
+		CheckoutTime: r.FormValue("checkout_time"),
+		Policies:     r.FormValue("policies"),
+		Phone:        r.FormValue("phone"),
+		Email:        r.FormValue("email"),
+	}
+	var ok bool
+	if p.Latitude, ok = formOptionalFloat(r, "latitude"); !ok {
+		return p, "Latitude must be a number."
+	}
+	if p.Longitude, ok = formOptionalFloat(r, "longitude"); !ok {
+		return p, "Longitude must be a number."
+	}
+	return p, ""
+}
+
+// renderVendorProperties renders the vendor's properties, with an error
+// from a rejected deletion if there was one.
+func renderVendorProperties(w http.ResponseWriter, r *http.Request, errMsg string) {
+	properties, err := service.GetVendorProperties(r.Context())
+	if err != nil {
+		http.Error(w, "Error retrieving properties: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := map[string]interface{}{
+		"Properties": properties,
+		"Error":      errMsg,
+	}
+	if err := vendorPropertiesTmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering properties", http.StatusInternalServerError)
+	}
+}
+
+// renderPropertyForm renders the form to add a property, or to edit it if
+// it has an ID.
+func renderPropertyForm(w http.ResponseWriter, p models.Property, errMsg string) {
+	if p.PropertyID == 0 && p.Timezone == "" {
+		p.Timezone = service.DefaultTimezone
+		p.CheckinTime, p.CheckoutTime = service.DefaultCheckinTime, service.DefaultCheckoutTime
+	}
+	data := map[string]interface{}{
+		"Property": p,
+		"Error":    errMsg,
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	if err := propertyFormTmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering property form", http.StatusInternalServerError)
+	}
+}
+
+// VendorPropertiesHandler lists the properties of the logged-in vendor.
+func VendorPropertiesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	renderVendorProperties(w, r, "")
+}
+
+// NewPropertyHandler shows the form to add a property on GET and creates
+// the property on POST.
+func NewPropertyHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		renderPropertyForm(w, models.Property{}, "")
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	p, errMsg := parsePropertyForm(r)
+	if errMsg != "" {
+		renderPropertyForm(w, p, errMsg)
+		return
+	}
+	_, err := service.CreatePropertyForVendor(r.Context(), p)
+	var invalid *service.ValidationError
+	if errors.As(err, &invalid) {
+		renderPropertyForm(w, p, invalid.Message)
+		return
+	}
+	if err != nil {
+		bookingError(w, r, "Error creating property", err)
+		return
+	}
+	http.Redirect(w, r, "/vendor/properties", http.StatusSeeOther)
+}
+
+// EditPropertyHandler shows the form to edit the property given as
+// "property_id" on GET and saves it on POST.
+func EditPropertyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	id, ok := formID(r, "property_id")
+	if !ok {
+		http.Error(w, "Invalid property ID", http.StatusBadRequest)
+		return
+	}
+	if r.Method == http.MethodGet {
+		p, err := service.GetPropertyForVendor(r.Context(), id)
+		if err != nil {
+			bookingError(w, r, "Error retrieving property", err)
+			return
+		}
+		renderPropertyForm(w, *p, "")
+		return
+	}
+
+	p, errMsg := parsePropertyForm(r)
+	p.PropertyID = id
+	if errMsg != "" {
+		renderPropertyForm(w, p, errMsg)
+		return
+	}
+	err := service.UpdatePropertyForVendor(r.Context(), p)
+	var invalid *service.ValidationError
+	if errors.As(err, &invalid) {
+		renderPropertyForm(w, p, invalid.Message)
+		return
+	}
+	if err != nil {
+		bookingError(w, r, "Error updating property", err)
+		return
+	}
+	http.Redirect(w, r, "/vendor/properties", http.StatusSeeOther)
+}
+
+// DeletePropertyHandler deletes the property given as "property_id". A
+// property that still has rooms is kept and the list shows why.
+func DeletePropertyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	id, ok := formID(r, "property_id")
+	if !ok {
+		http.Error(w, "Invalid property ID", http.StatusBadRequest)
+		return
+	}
+	err := service.DeletePropertyForVendor(r.Context(), id)
+	var invalid *service.ValidationError
+	if errors.As(err, &invalid) {
+		w.WriteHeader(http.StatusBadRequest)
+		renderVendorProperties(w, r, invalid.Message)
+		return
+	}
+	if err != nil {
+		bookingError(w, r, "Error deleting property", err)
+		return
+	}
+	http.Redirect(w, r, "/vendor/properties", http.StatusSeeOther)
+}
+
+// PropertiesHandler lists the properties customers can book rooms at, each
+// linking to its available rooms.
+func PropertiesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	properties, err := service.GetListedProperties()
+	if err != nil {
+		http.Error(w, "Error retrieving properties: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := propertiesTmpl.Execute(w, properties); err != nil {
+		http.Error(w, "Error rendering properties", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"hotelm/models"
+	"hotelm/money"
+	"hotelm/service"
+)
+
+// vendorRatesTmpl is the rate calendar page, loaded by LoadTemplates.
+var vendorRatesTmpl *template.Template
+
+// monthLayout is the format of months in the rate calendar's query string.
+const monthLayout = "2006-01"
+
+// weekdayPrice is a day-of-week price field of the rate plan form.
+type weekdayPrice struct {
+	Field string // form field, "weekday_0" for Sunday
+	Day   string
+	Price string
+}
+
+// ratePlanForm holds the values of the rate plan form, so a rejected plan
+// is shown again as entered.
+type ratePlanForm struct {
+	RatePlanID int
+	Name       string
+	StartDate  string
+	EndDate    string
+	Price      string
+	Weekdays   []weekdayPrice
+	MinStay    string
+	MaxStay    string
+}
+
+// newRatePlanForm returns the form for a plan, or an empty form if plan is nil.
+func newRatePlanForm(plan *models.RatePlan) ratePlanForm {
+	var form ratePlanForm
+	if plan != nil {
+		form = ratePlanForm{
+			RatePlanID: plan.RatePlanID,
+			Name:       plan.Name,
+			StartDate:  plan.StartDate.Format(dateLayout),
+			EndDate:    plan.EndDate.Format(dateLayout),
+			Price:      plan.Price.Decimal(),
+			MinStay:    strconv.Itoa(plan.MinStay),
+			MaxStay:    strconv.Itoa(plan.MaxStay),
+		}
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		field := weekdayPrice{Field: "weekday_" + strconv.Itoa(int(day)), Day: day.String()[:3]}
+		if plan != nil {
+			if price, ok := plan.WeekdayPrices[day]; ok {
+				field.Price = price.Decimal()
+			}
+		}
+		form.Weekdays = append(form.Weekdays, field)
+	}
+	return form
+}
+
+// parseRatePlanForm reads a rate plan in the given currency from the form.
+// It returns the form values as entered too, and a message if they are not
+// a plan.
+func parseRatePlanForm(r *http.Request, currency string) (models.RatePlan, ratePlanForm, string) {
+	form := newRatePlanForm(nil)
+	form.RatePlanID, _ = strconv.Atoi(r.FormValue("rate_plan_id"))
+	form.Name = r.FormValue("name")
+	form.StartDate = r.FormValue("start_date")
+	form.EndDate = r.FormValue("end_date")
+	form.Price = r.FormValue("price")
+	form.MinStay = r.FormValue("min_stay")
+	form.MaxStay = r.FormValue("max_stay")
+	for i := range form.Weekdays {
+		form.Weekdays[i].Price = strings.TrimSpace(r.FormValue(form.Weekdays[i].Field))
+	}
+
+	plan := models.RatePlan{RatePlanID: form.RatePlanID, Name: form.Name}
+	var err error
+	if plan.StartDate, err = time.Parse(dateLayout, form.StartDate); err != nil {
+		return plan, form, "Invalid start date."
+	}
+	if plan.EndDate, err = time.Parse(dateLayout, form.EndDate); err != nil {
+		return plan, form, "Invalid end date."
+	}
+	if plan.Price, err = money.Parse(form.Price, currency); err != nil {
+		return plan, form, "Invalid price."
+	}
+	for day, field := range form.Weekdays {
+		if field.Price == "" {
+			continue
+		}
+		price, err := money.Parse(field.Price, currency)
+		if err != nil {
+			return plan, form, "Invalid " + time.Weekday(day).String() + " price."
+		}
+		if plan.WeekdayPrices == nil {
+			plan.WeekdayPrices = map[time.Weekday]money.Money{}
+		}
+		plan.WeekdayPrices[time.Weekday(day)] = price
+	}
+	if plan.MinStay, err = strconv.Atoi(strings.TrimSpace(form.MinStay)); form.MinStay != "" && err != nil {
+		return plan, form, "Invalid minimum stay."
+	}
+	if plan.MaxStay, err = strconv.Atoi(strings.TrimSpace(form.MaxStay)); form.MaxStay != "" && err != nil {
+		return plan, form, "Invalid maximum stay."
+	}
+	return plan, form, ""
+}
+
+// renderRateCalendar renders a month of a room's rates with the rate plan
+// form, and an error from a rejected plan if there was one.
+func renderRateCalendar(w http.ResponseWriter, r *http.Request, roomID int, month time.Time, form ratePlanForm, errMsg string) {
+	calendar, err := service.GetRateCalendarForVendor(r.Context(), roomID, month)
+	if err != nil {
+		bookingError(w, r, "Error retrieving rates", err)
+		return
+	}
+	data := struct {
+		*service.RateCalendar
+		MonthValue string
+		PrevMonth  string
+		NextMonth  string
+		Form       ratePlanForm
+		Error      string
+	}{
+		RateCalendar: calendar,
+		MonthValue:   calendar.Month.Format(monthLayout),
+		PrevMonth:    calendar.Month.AddDate(0, -1, 0).Format(monthLayout),
+		NextMonth:    calendar.Month.AddDate(0, 1, 0).Format(monthLayout),
+		Form:         form,
+		Error:        errMsg,
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	if err := vendorRatesTmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering rate calendar", http.StatusInternalServerError)
+	}
+}
+
+// formMonth parses the "month" field, the current month if it is empty or
+// invalid.
+func formMonth(r *http.Request) time.Time {
+	month, err := time.Parse(monthLayout, r.FormValue("month"))
+	if err != nil {
+		return time.Now()
+	}
+	return month
+}
+
+// RateCalendarHandler shows a month of nightly prices of a vendor's room
+// with its rate plans. The room is given as "room_id" and the month as
+// "month" (YYYY-MM); "rate_plan_id" opens a plan for editing.
+func RateCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	roomID, ok := formID(r, "room_id")
+	if !ok {
+		http.Error(w, "Invalid room_id", http.StatusBadRequest)
+		return
+	}
+
+	form := newRatePlanForm(nil)
+	if planID, ok := formID(r, "rate_plan_id"); ok {
+		plan, err := service.GetRatePlanForVendor(r.Context(), planID)
+		if err != nil {
+			bookingError(w, r, "Error retrieving rate plan", err)
+			return
+		}
+		if plan.RoomID != roomID {
+			http.NotFound(w, r)
+			return
+		}
+		form = newRatePlanForm(plan)
+	}
+	renderRateCalendar(w, r, roomID, formMonth(r), form, "")
+}
+
+// SaveRatePlanHandler creates a rate plan for a vendor's room, or updates
+// the plan given as "rate_plan_id", from the rate calendar's form.
+func SaveRatePlanHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	roomID, ok := formID(r, "room_id")
+	if !ok {
+		http.Error(w, "Invalid room_id", http.StatusBadRequest)
+		return
+	}
+	room, err := service.GetRoomByIDForVendor(r.Context(), roomID)
+	if err != nil {
+		bookingError(w, r, "Error retrieving room", err)
+		return
+	}
+
+	month := formMonth(r)
+	plan, form, errMsg := parseRatePlanForm(r, room.Price.Currency)
+	if errMsg != "" {
+		renderRateCalendar(w, r, roomID, month, form, errMsg)
+		return
+	}
+	if plan.RatePlanID == 0 {
+		_, err = service.CreateRatePlanForVendor(r.Context(), roomID, plan)
+	} else {
+		err = service.UpdateRatePlanForVendor(r.Context(), plan)
+	}
+	var invalid *service.ValidationError
+	if errors.As(err, &invalid) {
+		renderRateCalendar(w, r, roomID, month, form, invalid.Message)
+		return
+	}
+	if err != nil {
+		bookingError(w, r, "Error saving rate plan", err)
+		return
+	}
+	http.Redirect(w, r, "/vendor/rooms/rates?room_id="+strconv.Itoa(roomID)+"&month="+plan.StartDate.Format(monthLayout), http.StatusSeeOther)
+}
+
+// DeleteRatePlanHandler deletes the rate plan given as "rate_plan_id".
+func DeleteRatePlanHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	planID, ok := formID(r, "rate_plan_id")
+	if !ok {
+		http.Error(w, "Invalid rate plan ID", http.StatusBadRequest)
+		return
+	}
+	roomID, err := service.DeleteRatePlanForVendor(r.Context(), planID)
+	if err != nil {
+		bookingError(w, r, "Error deleting rate plan", err)
+		return
+	}
+	http.Redirect(w, r, "/vendor/rooms/rates?room_id="+strconv.Itoa(roomID)+"&month="+formMonth(r).Format(monthLayout), http.StatusSeeOther)
+}
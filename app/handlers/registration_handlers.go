@@ -6,14 +6,14 @@ import (
 	"strconv"
 
 	"hotelm/models"
-	"hotelm/repository"
+	"hotelm/service"
 )
 
 // Parse templates for registration.
 var (
-	customerRegTmpl  = template.Must(template.ParseFiles("templates/registration_customer.html"))
-	vendorRegTmpl    = template.Must(template.ParseFiles("templates/registration_vendor.html"))
-	regSuccessTmpl   = template.Must(template.ParseFiles("templates/registration_success.html"))
+	customerRegTmpl *template.Template
+	vendorRegTmpl   *template.Template
+	regSuccessTmpl  *template.Template
 )
 
 // RegistrationCustomerPageHandler renders the customer registration form.
@@ -44,27 +44,33 @@ func RegistrationCustomerPostHandler(w http.ResponseWriter, r *http.Request) {
 	phone := r.FormValue("phone")
 	email := r.FormValue("email")
 	address := r.FormValue("address")
+	password := r.FormValue("password")
+	confirm := r.FormValue("confirm_password")
 
-	if name == "" || phone == "" || email == "" || address == "" {
+	if name == "" || phone == "" || email == "" || address == "" || password == "" {
 		customerRegTmpl.Execute(w, map[string]string{"Error": "All fields are required."})
 		return
 	}
+	if password != confirm {
+		customerRegTmpl.Execute(w, map[string]string{"Error": "Passwords do not match."})
+		return
+	}
 
-	// Create the customer using the repository.
-	customerID, err := repository.CreateCustomer(models.Customer{
+	// Create the customer using the service layer, which hashes the password.
+	customerID, err := service.RegisterCustomer(models.Customer{
 		Name:    name,
 		Phone:   phone,
 		Email:   email,
 		Address: address,
-	})
+	}, password)
 	if err != nil {
-		// Friendly message for duplicate email or other errors.
+		// Friendly message for an invalid password, duplicate email or other errors.
 		customerRegTmpl.Execute(w, map[string]string{"Error": "Registration failed: " + err.Error()})
 		return
 	}
 
 	// Render success page with the new user ID.
-	regSuccessTmpl.Execute(w, map[string]string{"UserID": strconv.Itoa(customerID)})
+	regSuccessTmpl.Execute(w, map[string]string{"UserID": strconv.Itoa(customerID), "Email": email})
 }
 
 // RegistrationVendorPageHandler renders the vendor registration form.
@@ -94,25 +100,31 @@ func RegistrationVendorPostHandler(w http.ResponseWriter, r *http.Request) {
 	phone := r.FormValue("phone")
 	hotelName := r.FormValue("hotel_name")
 	address := r.FormValue("address")
+	password := r.FormValue("password")
+	confirm := r.FormValue("confirm_password")
 
-	if name == "" || email == "" || phone == "" || hotelName == "" || address == "" {
+	if name == "" || email == "" || phone == "" || hotelName == "" || address == "" || password == "" {
 		vendorRegTmpl.Execute(w, map[string]string{"Error": "All fields are required."})
 		return
 	}
+	if password != confirm {
+		vendorRegTmpl.Execute(w, map[string]string{"Error": "Passwords do not match."})
+		return
+	}
 
-	// Create the vendor using the repository.
-	vendorID, err := repository.CreateVendor(models.Vendor{
+	// Create the vendor using the service layer, which hashes the password.
+	vendorID, err := service.RegisterVendor(models.Vendor{
 		Name:      name,
 		Email:     email,
 		Phone:     phone,
 		HotelName: hotelName,
 		Address:   address,
-	})
+	}, password)
 	if err != nil {
 		vendorRegTmpl.Execute(w, map[string]string{"Error": "Registration failed: " + err.Error()})
 		return
 	}
 
 	// Render success page with the new vendor ID.
-	regSuccessTmpl.Execute(w, map[string]string{"UserID": strconv.Itoa(vendorID)})
+	regSuccessTmpl.Execute(w, map[string]string{"UserID": strconv.Itoa(vendorID), "Email": email})
 }
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"hotelm/models"
+	"hotelm/service"
+)
+
+// Page templates, loaded by LoadTemplates.
+var (
+	reviewFormTmpl  *template.Template
+	roomReviewsTmpl *template.Template
+)
+
+// NewReviewPageHandler renders the form for reviewing a booking.
+// The booking ID is expected as a query parameter "booking_id".
+func NewReviewPageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	bookingID, err := strconv.Atoi(r.URL.Query().Get("booking_id"))
+	if err != nil {
+		http.Error(w, "Invalid booking_id", http.StatusBadRequest)
+		return
+	}
+	if err := reviewFormTmpl.Execute(w, map[string]interface{}{"BookingID": bookingID}); err != nil {
+		http.Error(w, "Error rendering review form", http.StatusInternalServerError)
+	}
+}
+
+// CreateReviewHandler processes the review form submission.
+func CreateReviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	bookingID, err := strconv.Atoi(r.FormValue("booking_id"))
+	if err != nil {
+		http.Error(w, "Invalid booking ID", http.StatusBadRequest)
+		return
+	}
+	comment := r.FormValue("comment")
+	rating, err := strconv.Atoi(r.FormValue("rating"))
+	if err != nil || rating < 1 || rating > 5 {
+		reviewFormTmpl.Execute(w, map[string]interface{}{"BookingID": bookingID, "Comment": comment, "Error": "Please choose a rating from 1 to 5."})
+		return
+	}
+
+	if _, err := service.CreateReviewForCustomer(r.Context(), bookingID, rating, comment); err != nil {
+		reviewFormTmpl.Execute(w, map[string]interface{}{"BookingID": bookingID, "Comment": comment, "Error": "Could not post review: " + err.Error()})
+		return
+	}
+
+	// On success, redirect back to the My Bookings page.
+	http.Redirect(w, r, "/customer/bookings", http.StatusSeeOther)
+}
+
+// RoomReviewsHandler shows a room's rating and reviews.
+// The room ID is expected as a query parameter "room_id".
+func RoomReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	roomID, err := strconv.Atoi(r.URL.Query().Get("room_id"))
+	if err != nil {
+		http.Error(w, "Invalid room_id", http.StatusBadRequest)
+		return
+	}
+
+	room, reviews, err := service.GetRoomReviews(roomID)
+	if err != nil {
+		http.Error(w, "Error retrieving reviews: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Room    *models.Room
+		Reviews []models.Review
+	}{
+		Room:    room,
+		Reviews: reviews,
+	}
+	if err := roomReviewsTmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering room reviews", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"path/filepath"
+)
+
+// pageTemplates lists every page template and its file in the template
+// directory.
+var pageTemplates = []struct {
+	tmpl **template.Template
+	file string
+}{
+	{&loginTemplate, "login.html"},
+	{&setPasswordTemplate, "set_password.html"},
+	{&customerDashboardTmpl, "customer_dashboard.html"},
+	{&availableRoomsTmpl, "available_rooms.html"},
+	{&propertiesTmpl, "properties.html"},
+	{&bookingFormTmpl, "booking_form.html"},
+	{&myBookingsTmpl, "my_bookings.html"},
+	{&customerRegTmpl, "registration_customer.html"},
+	{&vendorRegTmpl, "registration_vendor.html"},
+	{&regSuccessTmpl, "registration_success.html"},
+	{&reviewFormTmpl, "review_form.html"},
+	{&roomReviewsTmpl, "room_reviews.html"},
+	{&vendorDashboardTmpl, "vendor_dashboard.html"},
+	{&vendorPropertiesTmpl, "vendor_properties.html"},
+	{&propertyFormTmpl, "property_form.html"},
+	{&vendorRoomsTmpl, "vendor_rooms.html"},
+	{&newRoomTmpl, "new_room.html"},
+	{&editRoomTmpl, "edit_room.html"},
+	{&vendorRatesTmpl, "vendor_rates.html"},
+	{&vendorPaymentsTmpl, "vendor_payments.html"},
+	{&promoCodesTmpl, "promo_codes.html"},
+	{&vendorBookingsTmpl, "vendor_bookings.html"},
+	{&bookingHistoryTmpl, "booking_history.html"},
+	{&messagesTmpl, "messages.html"},
+	{&messageThreadTmpl, "message_thread.html"},
+	{&ticketsTmpl, "tickets.html"},
+	{&ticketTmpl, "ticket.html"},
+	{&adminDashboardTmpl, "admin_dashboard.html"},
+	{&adminCustomersTmpl, "admin_customers.html"},
+	{&adminVendorsTmpl, "admin_vendors.html"},
+	{&adminBookingsTmpl, "admin_bookings.html"},
+	{&adminPaymentsTmpl, "admin_payments.html"},
+	{&adminReviewsTmpl, "admin_reviews.html"},
+	{&adminAuditTmpl, "admin_audit.html"},
+	{&adminRatesTmpl, "admin_exchange_rates.html"},
+	{&adminAmenitiesTmpl, "admin_amenities.html"},
+}
+
+// LoadTemplates parses the page templates from dir. It must be called before
+// the handlers serve requests.
+func LoadTemplates(dir string) error {
+	for _, p := range pageTemplates {
+		t, err := template.ParseFiles(filepath.Join(dir, p.file))
+		if err != nil {
+			return fmt.Errorf("failed to load template %s: %v", p.file, err)
+		}
+		*p.tmpl = t
+	}
+	return nil
+}
+
+// newFormToken returns a random token for a hidden form field, such as the
+// idempotency key of a form that must not be submitted twice.
+func newFormToken() string {
+	b := make([]byte, 16)
+	rand.Read(b) // never fails on supported platforms
+	return hex.EncodeToString(b)
+}
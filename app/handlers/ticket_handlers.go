@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"hotelm/repository"
+	"hotelm/service"
+	"hotelm/session"
+)
+
+// Page templates, loaded by LoadTemplates.
+var (
+	ticketsTmpl *template.Template
+	ticketTmpl  *template.Template
+)
+
+// ticketError reports a failed ticket action. Rejected input is shown on the
+// ticket page by the caller; this handles the rest.
+func ticketError(w http.ResponseWriter, r *http.Request, action string, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		http.NotFound(w, r)
+	case errors.Is(err, service.ErrForbidden):
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	default:
+		http.Error(w, action+": "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// renderTickets renders the ticket list. Admins get every ticket matching the
+// status, priority and category filters; customers and vendors get their own
+// tickets and the form to open one.
+func renderTickets(w http.ResponseWriter, r *http.Request, errMsg string) {
+	role := session.FromContext(r.Context()).Role
+	filter := repository.TicketFilter{
+		Status:   r.URL.Query().Get("status"),
+		Priority: r.URL.Query().Get("priority"),
+		Category: r.URL.Query().Get("category"),
+	}
+
+	var err error
+	data := map[string]interface{}{
+		"Base":       sectionURL(r, "/tickets"),
+		"Role":       role,
+		"Filter":     filter,
+		"Statuses":   service.TicketStatuses,
+		"Categories": service.TicketCategories,
+		"Priorities": service.TicketPriorities,
+		"Form":       r.PostForm,
+		"BookingID":  r.FormValue("booking_id"),
+		"PaymentID":  r.FormValue("payment_id"),
+		"Error":      errMsg,
+	}
+	if role == session.RoleAdmin {
+		data["Tickets"], err = service.ListTickets(r.Context(), filter)
+	} else {
+		data["Tickets"], err = service.GetMyTickets(r.Context())
+	}
+	if err != nil {
+		http.Error(w, "Error retrieving tickets: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := ticketsTmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering tickets", http.StatusInternalServerError)
+	}
+}
+
+// TicketsHandler lists support tickets.
+func TicketsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	renderTickets(w, r, "")
+}
+
+// NewTicketHandler opens a support ticket.
+func NewTicketHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	// The booking and payment are optional.
+	bookingID, _ := strconv.Atoi(r.FormValue("booking_id"))
+	paymentID, _ := strconv.Atoi(r.FormValue("payment_id"))
+	id, err := service.OpenTicket(r.Context(), service.NewTicket{
+		Category:  r.FormValue("category"),
+		Priority:  r.FormValue("priority"),
+		Subject:   r.FormValue("subject"),
+		Body:      r.FormValue("body"),
+		BookingID: bookingID,
+		PaymentID: paymentID,
+	})
+	var invalid *service.ValidationError
+	if errors.As(err, &invalid) {
+		w.WriteHeader(http.StatusBadRequest)
+		renderTickets(w, r, invalid.Message)
+		return
+	}
+	if err != nil {
+		ticketError(w, r, "Error opening ticket", err)
+		return
+	}
+	http.Redirect(w, r, sectionURL(r, "/tickets/view?id="+strconv.Itoa(id)), http.StatusSeeOther)
+}
+
+// TicketHandler shows a ticket (GET) and posts a reply to it (POST).
+func TicketHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid ticket ID", http.StatusBadRequest)
+		return
+	}
+
+	errMsg := ""
+	if r.Method == http.MethodPost {
+		_, err := service.ReplyToTicket(r.Context(), id, r.FormValue("body"))
+		var invalid *service.ValidationError
+		if err == nil {
+			http.Redirect(w, r, sectionURL(r, "/tickets/view?id="+strconv.Itoa(id)), http.StatusSeeOther)
+			return
+		}
+		if !errors.As(err, &invalid) {
+			ticketError(w, r, "Error replying to ticket", err)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		errMsg = invalid.Message
+	}
+	renderTicket(w, r, id, errMsg)
+}
+
+// renderTicket renders a ticket with its replies, history and the actions
+// available to the user.
+func renderTicket(w http.ResponseWriter, r *http.Request, id int, errMsg string) {
+	ticket, replies, events, err := service.GetTicket(r.Context(), id)
+	if err != nil {
+		ticketError(w, r, "Error retrieving ticket", err)
+		return
+	}
+	data := map[string]interface{}{
+		"Ticket":      ticket,
+		"Replies":     replies,
+		"Events":      events,
+		"Base":        sectionURL(r, "/tickets"),
+		"Role":        session.FromContext(r.Context()).Role,
+		"Transitions": service.TicketTransitions(ticket.Status),
+		"Categories":  service.TicketCategories,
+		"Priorities":  service.TicketPriorities,
+		"Error":       errMsg,
+	}
+	if err := ticketTmpl.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering ticket", http.StatusInternalServerError)
+	}
+}
+
+// TicketStatusHandler moves a ticket to the posted status.
+func TicketStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	id, ok := formID(r, "id")
+	if !ok {
+		http.Error(w, "Invalid ticket ID", http.StatusBadRequest)
+		return
+	}
+	err := service.SetTicketStatus(r.Context(), id, r.FormValue("status"))
+	var invalid *service.ValidationError
+	if errors.As(err, &invalid) {
+		w.WriteHeader(http.StatusBadRequest)
+		renderTicket(w, r, id, invalid.Message)
+		return
+	}
+	if err != nil {
+		ticketError(w, r, "Error updating ticket", err)
+		return
+	}
+	http.Redirect(w, r, sectionURL(r, "/tickets/view?id="+strconv.Itoa(id)), http.StatusSeeOther)
+}
+
+// TicketTriageHandler sets the category and priority of a ticket.
+func TicketTriageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	id, ok := formID(r, "id")
+	if !ok {
+		http.Error(w, "Invalid ticket ID", http.StatusBadRequest)
+		return
+	}
+	err := service.TriageTicket(r.Context(), id, r.FormValue("category"), r.FormValue("priority"))
+	var invalid *service.ValidationError
+	if errors.As(err, &invalid) {
+		w.WriteHeader(http.StatusBadRequest)
+		renderTicket(w, r, id, invalid.Message)
+		return
+	}
+	if err != nil {
+		ticketError(w, r, "Error triaging ticket", err)
+		return
+	}
+	http.Redirect(w, r, sectionURL(r, "/tickets/view?id="+strconv.Itoa(id)), http.StatusSeeOther)
+}
@@ -1,58 +1,115 @@
 package handlers
 
 import (
+	"errors"
 	"html/template"
 	"net/http"
 	"strconv"
 	"hotelm/models"
+	"hotelm/money"
 	"hotelm/service"
 )
 
-// Parse templates once at startup.
-// Ensure these template files exist in the "templates" directory.
+// Page templates, loaded by LoadTemplates.
 var (
-	vendorDashboardTmpl = template.Must(template.ParseFiles("templates/vendor_dashboard.html"))
-	vendorRoomsTmpl     = template.Must(template.ParseFiles("templates/vendor_rooms.html"))
-	newRoomTmpl         = template.Must(template.ParseFiles("templates/new_room.html"))
-	editRoomTmpl        = template.Must(template.ParseFiles("templates/edit_room.html"))
-	vendorPaymentsTmpl  = template.Must(template.ParseFiles("templates/vendor_payments.html"))
+	vendorDashboardTmpl *template.Template
+	vendorRoomsTmpl     *template.Template
+	newRoomTmpl         *template.Template
+	editRoomTmpl        *template.Template
+	vendorPaymentsTmpl  *template.Template
 )
 
+// roomPropertyID reads the optional "property_id" a vendor picked for a
+// room or to filter their rooms by, 0 if none.
+func roomPropertyID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, ok := formOptionalInt(r, "property_id")
+	if !ok || id < 0 {
+		http.Error(w, "Invalid property ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
 // VendorDashboardHandler renders the vendor dashboard page.
 func VendorDashboardHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	if err := vendorDashboardTmpl.Execute(w, nil); err != nil {
+	unread, err := service.CountMyUnreadMessages(r.Context())
+	if err != nil {
+		http.Error(w, "Error counting messages: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := map[string]interface{}{"UnreadMessages": unread}
+	if err := vendorDashboardTmpl.Execute(w, data); err != nil {
 		http.Error(w, "Error rendering vendor dashboard", http.StatusInternalServerError)
 	}
 }
 
-// VendorRoomsHandler displays the list of rooms for the logged-in vendor.
+// VendorRoomsHandler displays the list of rooms for the logged-in vendor,
+// only those of the property given as "property_id" if there is one.
 func VendorRoomsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	rooms, err := service.GetVendorRooms()
+	propertyID, ok := roomPropertyID(w, r)
+	if !ok {
+		return
+	}
+	rooms, err := service.GetVendorRooms(r.Context(), propertyID)
+	if err != nil {
+		bookingError(w, r, "Error retrieving vendor rooms", err)
+		return
+	}
+	properties, err := service.GetVendorProperties(r.Context())
 	if err != nil {
-		http.Error(w, "Error retrieving vendor rooms: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Error retrieving properties: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if err := vendorRoomsTmpl.Execute(w, rooms); err != nil {
+	data := struct {
+		Rooms      []models.Room
+		Properties []models.Property
+		PropertyID int
+	}{rooms, properties, propertyID}
+	if err := vendorRoomsTmpl.Execute(w, data); err != nil {
 		http.Error(w, "Error rendering vendor rooms", http.StatusInternalServerError)
 		return
 	}
 }
 
-// NewRoomPageHandler renders the form to create a new room.
+// NewRoomPageHandler renders the form to create a new room, in the property
+// given as "property_id" if there is one.
 func NewRoomPageHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	if err := newRoomTmpl.Execute(w, nil); err != nil {
+	propertyID, ok := roomPropertyID(w, r)
+	if !ok {
+		return
+	}
+	properties, err := service.GetVendorProperties(r.Context())
+	if err != nil {
+		http.Error(w, "Error retrieving properties: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	amenities, err := service.GetAmenities()
+	if err != nil {
+		http.Error(w, "Error retrieving amenities: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		Properties      []models.Property
+		PropertyID      int
+		Currencies      []string
+		DefaultCurrency string
+		Amenities       []models.Amenity
+		MaxPhotoMB      int
+		MaxPhotos       int
+	}{properties, propertyID, money.Currencies(), money.DefaultCurrency, amenities, service.MaxPhotoBytes >> 20, service.MaxPhotosPerUpload}
+	if err := newRoomTmpl.Execute(w, data); err != nil {
 		http.Error(w, "Error rendering new room page", http.StatusInternalServerError)
 		return
 	}
@@ -64,34 +121,45 @@ func CreateRoomHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Error parsing form", http.StatusBadRequest)
+	// The form is multipart, with the room's first photos.
+	photos, errMsg := formPhotos(w, r)
+	if errMsg != "" {
+		http.Error(w, "Error creating room: "+errMsg, http.StatusBadRequest)
 		return
 	}
+	for _, photo := range photos {
+		var invalid *service.ValidationError
+		if err := service.CheckRoomPhoto(photo); errors.As(err, &invalid) {
+			http.Error(w, "Error creating room: "+invalid.Message, http.StatusBadRequest)
+			return
+		}
+	}
 
 	// Extract form values.
 	name := r.FormValue("name")
 	description := r.FormValue("description")
 	location := r.FormValue("location")
 	availabilityStr := r.FormValue("availability") // expect "true" or "false"
-	priceStr := r.FormValue("price")
 	roomType := r.FormValue("room_type")
-	averageRatingStr := r.FormValue("average_rating")
-	amenities := r.FormValue("amenities") // simple comma-separated string
+	propertyID, ok := roomPropertyID(w, r)
+	if !ok {
+		return
+	}
+	amenities, ok := formAmenities(r)
+	if !ok {
+		http.Error(w, "Invalid amenity", http.StatusBadRequest)
+		return
+	}
 
-	price, err := strconv.ParseFloat(priceStr, 64)
+	price, err := formMoney(r, "price", "currency")
 	if err != nil {
-		http.Error(w, "Invalid price", http.StatusBadRequest)
+		http.Error(w, "Invalid price: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 	avail, err := strconv.ParseBool(availabilityStr)
 	if err != nil {
 		avail = true // default to true if parsing fails
 	}
-	averageRating, err := strconv.ParseFloat(averageRatingStr, 64)
-	if err != nil {
-		averageRating = 0.0
-	}
 
 	room := models.Room{
 		Name:          name,
@@ -100,17 +168,31 @@ func CreateRoomHandler(w http.ResponseWriter, r *http.Request) {
 		Availability:  avail,
 		Price:         price,
 		RoomType:      roomType,
-		AverageRating: averageRating,
+		PropertyID:    propertyID,
 		Amenities:     amenities,
 		// VendorID will be set in the service layer.
 	}
 
-	_, err = service.CreateRoomForVendor(room)
+	roomID, err := service.CreateRoomForVendor(r.Context(), room)
+	var invalid *service.ValidationError
+	if errors.As(err, &invalid) {
+		http.Error(w, "Error creating room: "+invalid.Message, http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Error creating room: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// The photos were checked above, so only storing them can fail now; the
+	// room is kept and the error shown where photos are managed.
+	for _, photo := range photos {
+		if _, err := service.AddRoomPhotoForVendor(r.Context(), roomID, photo); err != nil {
+			renderEditRoom(w, r, roomID, "The room was created, but a photo could not be saved: "+err.Error())
+			return
+		}
+	}
+
 	// On success, redirect to the vendor rooms list.
 	http.Redirect(w, r, "/vendor/rooms", http.StatusSeeOther)
 }
@@ -133,13 +215,54 @@ func EditRoomPageHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	renderEditRoom(w, r, roomID, "")
+}
+
+// renderEditRoom renders the form to edit a room with its photos, and an
+// error from a rejected photo upload if there was one.
+func renderEditRoom(w http.ResponseWriter, r *http.Request, roomID int, photoError string) {
 	// Retrieve the room details, ensuring the logged-in vendor owns it.
-	room, err := service.GetRoomByIDForVendor(roomID)
+	room, err := service.GetRoomByIDForVendor(r.Context(), roomID)
 	if err != nil {
 		http.Error(w, "Error retrieving room: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if err := editRoomTmpl.Execute(w, room); err != nil {
+	policy, err := service.GetRoomCancellationPolicy(roomID)
+	if err != nil {
+		http.Error(w, "Error retrieving cancellation policy: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	photos, err := service.GetRoomPhotos(roomID)
+	if err != nil {
+		http.Error(w, "Error retrieving room photos: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	catalog, err := service.GetAmenities()
+	if err != nil {
+		http.Error(w, "Error retrieving amenities: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	properties, err := service.GetVendorProperties(r.Context())
+	if err != nil {
+		http.Error(w, "Error retrieving properties: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		*models.Room
+		Properties    []models.Property
+		Policy        models.CancellationPolicy
+		Currencies    []string
+		Catalog       []models.Amenity
+		Photos        []models.RoomPhoto
+		MaxRoomPhotos int
+		MaxPhotoMB    int
+		MaxPhotos     int
+		PhotoError    string
+	}{room, properties, policy, money.Currencies(), catalog, photos, service.MaxRoomPhotos, service.MaxPhotoBytes >> 20, service.MaxPhotosPerUpload, photoError}
+	if photoError != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	if err := editRoomTmpl.Execute(w, data); err != nil {
 		http.Error(w, "Error rendering edit room page", http.StatusInternalServerError)
 		return
 	}
@@ -161,29 +284,31 @@ func UpdateRoomHandler(w http.ResponseWriter, r *http.Request) {
 	description := r.FormValue("description")
 	location := r.FormValue("location")
 	availabilityStr := r.FormValue("availability")
-	priceStr := r.FormValue("price")
 	roomType := r.FormValue("room_type")
-	averageRatingStr := r.FormValue("average_rating")
-	amenities := r.FormValue("amenities")
+	propertyID, ok := roomPropertyID(w, r)
+	if !ok {
+		return
+	}
+	amenities, ok := formAmenities(r)
+	if !ok {
+		http.Error(w, "Invalid amenity", http.StatusBadRequest)
+		return
+	}
 
 	roomID, err := strconv.Atoi(roomIDStr)
 	if err != nil {
 		http.Error(w, "Invalid room ID", http.StatusBadRequest)
 		return
 	}
-	price, err := strconv.ParseFloat(priceStr, 64)
+	price, err := formMoney(r, "price", "currency")
 	if err != nil {
-		http.Error(w, "Invalid price", http.StatusBadRequest)
+		http.Error(w, "Invalid price: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 	avail, err := strconv.ParseBool(availabilityStr)
 	if err != nil {
 		avail = true
 	}
-	averageRating, err := strconv.ParseFloat(averageRatingStr, 64)
-	if err != nil {
-		averageRating = 0.0
-	}
 
 	room := models.Room{
 		RoomID:        roomID,
@@ -193,12 +318,17 @@ func UpdateRoomHandler(w http.ResponseWriter, r *http.Request) {
 		Availability:  avail,
 		Price:         price,
 		RoomType:      roomType,
-		AverageRating: averageRating,
+		PropertyID:    propertyID,
 		Amenities:     amenities,
 		// VendorID will be set in the service layer.
 	}
 
-	err = service.UpdateRoomForVendor(room)
+	err = service.UpdateRoomForVendor(r.Context(), room)
+	var invalid *service.ValidationError
+	if errors.As(err, &invalid) {
+		http.Error(w, "Error updating room: "+invalid.Message, http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Error updating room: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -225,7 +355,7 @@ func DeleteRoomHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid room ID", http.StatusBadRequest)
 		return
 	}
-	err = service.DeleteRoomForVendor(roomID)
+	err = service.DeleteRoomForVendor(r.Context(), roomID)
 	if err != nil {
 		http.Error(w, "Error deleting room: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -240,13 +370,56 @@ func VendorPaymentsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	payments, err := service.GetVendorPayments()
+	payments, err := service.GetVendorPayments(r.Context())
 	if err != nil {
 		http.Error(w, "Error retrieving vendor payments: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if err := vendorPaymentsTmpl.Execute(w, payments); err != nil {
+	data := struct {
+		Payments []service.VendorPayment
+		Totals   []service.RevenueTotal
+	}{payments, service.RevenueTotals(payments)}
+	if err := vendorPaymentsTmpl.Execute(w, data); err != nil {
 		http.Error(w, "Error rendering vendor payments", http.StatusInternalServerError)
 		return
 	}
 }
+
+// RoomPolicyHandler sets the cancellation policy of a vendor's room from the
+// edit room form.
+func RoomPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+	roomID, err := strconv.Atoi(r.FormValue("room_id"))
+	if err != nil {
+		http.Error(w, "Invalid room ID", http.StatusBadRequest)
+		return
+	}
+	freeDays, err := strconv.Atoi(r.FormValue("free_days"))
+	if err != nil {
+		http.Error(w, "Invalid number of free cancellation days", http.StatusBadRequest)
+		return
+	}
+	penalty, err := strconv.ParseFloat(r.FormValue("penalty_percent"), 64)
+	if err != nil {
+		http.Error(w, "Invalid penalty", http.StatusBadRequest)
+		return
+	}
+
+	policy := models.CancellationPolicy{
+		FreeDays:       freeDays,
+		PenaltyPercent: penalty,
+		NonRefundable:  r.FormValue("non_refundable") == "true",
+	}
+	if err := service.SetRoomCancellationPolicy(r.Context(), roomID, policy); err != nil {
+		adminActionError(w, "Error saving cancellation policy", err)
+		return
+	}
+	http.Redirect(w, r, "/vendor/rooms/edit?room_id="+strconv.Itoa(roomID), http.StatusSeeOther)
+}
@@ -0,0 +1,159 @@
+// Package imaging checks uploaded images and makes thumbnails of them with
+// the standard library decoders. JPEG, PNG and GIF images are supported.
+package imaging
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+)
+
+// MaxPixels bounds the size of images that are decoded, so a small file
+// cannot expand to an image that exhausts memory. 24 megapixels is a
+// 6000x4000 camera photo, about 100 MB once decoded.
+const MaxPixels = 24_000_000
+
+// ErrUnsupported is returned for data that is not a JPEG, PNG or GIF image.
+var ErrUnsupported = errors.New("not a JPEG, PNG or GIF image")
+
+// formats maps the content types of supported images to their file
+// extension.
+var formats = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// Info describes an image.
+type Info struct {
+	ContentType string
+	Ext         string // file extension, e.g. ".jpg"
+	Width       int
+	Height      int
+}
+
+// Inspect checks that data is a supported image of at most MaxPixels and
+// returns its type and dimensions. The type is sniffed from the data, not
+// taken from a file name or header.
+func Inspect(data []byte) (Info, error) {
+	return InspectReader(bytes.NewReader(data))
+}
+
+// InspectReader is Inspect for an image read from r. Only the header of the
+// image is read, so the size of an upload can be checked before it is
+// loaded.
+func InspectReader(r io.Reader) (Info, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(512) // as much as DetectContentType considers
+	contentType := http.DetectContentType(head)
+	ext, ok := formats[contentType]
+	if !ok {
+		return Info{}, ErrUnsupported
+	}
+	var cfg image.Config
+	var err error
+	switch contentType {
+	case "image/jpeg":
+		cfg, err = jpeg.DecodeConfig(br)
+	case "image/png":
+		cfg, err = png.DecodeConfig(br)
+	case "image/gif":
+		cfg, err = gif.DecodeConfig(br)
+	}
+	if err != nil {
+		return Info{}, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	if cfg.Width < 1 || cfg.Height < 1 {
+		return Info{}, fmt.Errorf("%w: empty image", ErrUnsupported)
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > MaxPixels {
+		return Info{}, fmt.Errorf("image is %dx%d pixels, more than %d megapixels", cfg.Width, cfg.Height, MaxPixels/1_000_000)
+	}
+	return Info{ContentType: contentType, Ext: ext, Width: cfg.Width, Height: cfg.Height}, nil
+}
+
+// Thumbnail returns a JPEG of the image in data scaled down to fit within
+// maxWidth by maxHeight, keeping its proportions. Smaller images are not
+// enlarged. Transparent areas become white. The image is checked with
+// Inspect before it is decoded.
+func Thumbnail(data []byte, maxWidth, maxHeight int) ([]byte, error) {
+	if _, err := Inspect(data); err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	b := src.Bounds()
+	width, height := fit(b.Dx(), b.Dy(), maxWidth, maxHeight)
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, scale(src, width, height), &jpeg.Options{Quality: 85}); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %v", err)
+	}
+	return out.Bytes(), nil
+}
+
+// fit returns the size of a width by height image scaled down to fit
+// within maxWidth by maxHeight.
+func fit(width, height, maxWidth, maxHeight int) (int, int) {
+	if width <= maxWidth && height <= maxHeight {
+		return width, height
+	}
+	// Scale by the tighter bound; width*maxHeight > height*maxWidth means
+	// the width is.
+	if width*maxHeight > height*maxWidth {
+		return maxWidth, max(1, (height*maxWidth+width/2)/width)
+	}
+	return max(1, (width*maxHeight+height/2)/height), maxHeight
+}
+
+// scale shrinks src to width by height, averaging the source pixels that
+// fall on each thumbnail pixel, on a white background.
+func scale(src image.Image, width, height int) *image.RGBA {
+	b := src.Bounds()
+	srcWidth, srcHeight := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	// sums holds the premultiplied red, green, blue and alpha totals and
+	// the pixel count of each column of the thumbnail row being built.
+	sums := make([][5]uint64, width)
+	for dy := 0; dy < height; dy++ {
+		clear(sums)
+		y0, y1 := dy*srcHeight/height, (dy+1)*srcHeight/height
+		for y := y0; y < max(y1, y0+1); y++ {
+			for x := 0; x < srcWidth; x++ {
+				r, g, bl, a := src.At(b.Min.X+x, b.Min.Y+y).RGBA()
+				s := &sums[x*width/srcWidth]
+				s[0] += uint64(r)
+				s[1] += uint64(g)
+				s[2] += uint64(bl)
+				s[3] += uint64(a)
+				s[4]++
+			}
+		}
+		for dx, s := range sums {
+			if s[4] == 0 {
+				continue
+			}
+			// Premultiplied colour over white adds the uncovered share of
+			// white to each channel.
+			white := 0xffff - s[3]/s[4]
+			dst.SetRGBA(dx, dy, color.RGBA{
+				R: uint8((s[0]/s[4] + white) >> 8),
+				G: uint8((s[1]/s[4] + white) >> 8),
+				B: uint8((s[2]/s[4] + white) >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return dst
+}
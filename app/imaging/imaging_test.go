@@ -0,0 +1,172 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// testImage returns a width by height gradient.
+func testImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x), uint8(y), 0x80, 0xff})
+		}
+	}
+	return img
+}
+
+// encode returns img in the format of the given content type.
+func encode(t *testing.T, contentType string, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var err error
+	switch contentType {
+	case "image/jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "image/png":
+		err = png.Encode(&buf, img)
+	case "image/gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withSize returns the encoded image data with its header changed to claim
+// width by height pixels; the pixel data is left as it was.
+func withSize(t *testing.T, contentType string, data []byte, width, height int) []byte {
+	t.Helper()
+	data = bytes.Clone(data)
+	switch contentType {
+	case "image/jpeg":
+		// The frame header follows the SOF0 marker, its length and the
+		// sample precision.
+		i := bytes.Index(data, []byte{0xff, 0xc0})
+		if i < 0 {
+			t.Fatal("no SOF0 marker")
+		}
+		binary.BigEndian.PutUint16(data[i+5:], uint16(height))
+		binary.BigEndian.PutUint16(data[i+7:], uint16(width))
+	case "image/png":
+		// IHDR is the first chunk: its length at 8, type at 12, data at 16
+		// and checksum at 29.
+		binary.BigEndian.PutUint32(data[16:], uint32(width))
+		binary.BigEndian.PutUint32(data[20:], uint32(height))
+		binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	case "image/gif":
+		binary.LittleEndian.PutUint16(data[6:], uint16(width))
+		binary.LittleEndian.PutUint16(data[8:], uint16(height))
+	}
+	return data
+}
+
+var contentTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+func TestInspect(t *testing.T) {
+	exts := map[string]string{"image/jpeg": ".jpg", "image/png": ".png", "image/gif": ".gif"}
+	for _, contentType := range contentTypes {
+		data := encode(t, contentType, testImage(64, 48))
+		info, err := Inspect(data)
+		want := Info{ContentType: contentType, Ext: exts[contentType], Width: 64, Height: 48}
+		if err != nil || info != want {
+			t.Errorf("Inspect(%s) = %+v, %v, want %+v", contentType, info, err, want)
+		}
+		if info, err := InspectReader(bytes.NewReader(data)); err != nil || info != want {
+			t.Errorf("InspectReader(%s) = %+v, %v, want %+v", contentType, info, err, want)
+		}
+	}
+}
+
+func TestInspectUnsupported(t *testing.T) {
+	pngData := encode(t, "image/png", testImage(64, 48))
+	tests := map[string][]byte{
+		"empty":           nil,
+		"text":            []byte("hello, world"),
+		"BMP":             append([]byte("BM"), make([]byte, 64)...),
+		"truncated JPEG":  encode(t, "image/jpeg", testImage(64, 48))[:40],
+		"truncated PNG":   pngData[:20],
+		"truncated GIF":   encode(t, "image/gif", testImage(64, 48))[:8],
+		"PNG of 0 pixels": withSize(t, "image/png", pngData, 0, 48),
+	}
+	for name, data := range tests {
+		if info, err := Inspect(data); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Inspect(%s) = %+v, %v, want ErrUnsupported", name, info, err)
+		}
+	}
+}
+
+func TestInspectTooManyPixels(t *testing.T) {
+	for _, contentType := range contentTypes {
+		data := withSize(t, contentType, encode(t, contentType, testImage(8, 8)), 60000, 60000)
+		_, err := Inspect(data)
+		if err == nil || errors.Is(err, ErrUnsupported) || !strings.Contains(err.Error(), "60000x60000") {
+			t.Errorf("Inspect of a 60000x60000 %s: %v, want it too large", contentType, err)
+		}
+		// Thumbnail checks the size before decoding anything.
+		if _, err := Thumbnail(data, 480, 360); err == nil || !strings.Contains(err.Error(), "megapixels") {
+			t.Errorf("Thumbnail of a 60000x60000 %s: %v, want it too large", contentType, err)
+		}
+	}
+
+	// The limit itself is allowed; the check is on the product, in 64 bits.
+	data := encode(t, "image/png", testImage(8, 8))
+	if _, err := Inspect(withSize(t, "image/png", data, MaxPixels/4000, 4000)); err != nil {
+		t.Errorf("Inspect of an image of MaxPixels: %v", err)
+	}
+	if _, err := Inspect(withSize(t, "image/png", data, 1<<31-1, 1<<31-1)); err == nil {
+		t.Error("Inspect of a 2147483647x2147483647 PNG succeeded")
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	for _, contentType := range contentTypes {
+		thumb, err := Thumbnail(encode(t, contentType, testImage(200, 100)), 48, 36)
+		if err != nil {
+			t.Fatalf("Thumbnail(%s): %v", contentType, err)
+		}
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(thumb))
+		if err != nil {
+			t.Fatalf("thumbnail of %s is not a JPEG: %v", contentType, err)
+		}
+		if cfg.Width != 48 || cfg.Height != 24 {
+			t.Errorf("thumbnail of %s is %dx%d, want 48x24", contentType, cfg.Width, cfg.Height)
+		}
+	}
+
+	// A header may pass while the pixels are cut off.
+	data := encode(t, "image/png", testImage(200, 100))
+	if _, err := Thumbnail(data[:len(data)/2], 48, 36); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Thumbnail of a truncated PNG: %v, want ErrUnsupported", err)
+	}
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		width, height, wantWidth, wantHeight int
+	}{
+		{480, 360, 480, 360},
+		{100, 50, 100, 50}, // smaller images are not enlarged
+		{960, 720, 480, 360},
+		{1000, 100, 480, 48},
+		{100, 1000, 36, 360},
+		{6000, 4000, 480, 320},
+		{10000, 1, 480, 1}, // at least one pixel
+	}
+	for _, tt := range tests {
+		if w, h := fit(tt.width, tt.height, 480, 360); w != tt.wantWidth || h != tt.wantHeight {
+			t.Errorf("fit(%d, %d) = %dx%d, want %dx%d", tt.width, tt.height, w, h, tt.wantWidth, tt.wantHeight)
+		}
+	}
+}
@@ -1,22 +1,261 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	_ "time/tzdata" // property timezones resolve without a system zoneinfo
 
+	"hotelm/config"
 	"hotelm/db"
+	"hotelm/handlers"
+	"hotelm/models"
+	"hotelm/payment"
 	"hotelm/routes"
+	"hotelm/service"
+	"hotelm/session"
+	"hotelm/storage"
 )
 
+const usage = `Usage:
+  hotelm [flags]                      start the web server
+  hotelm [flags] migrate up           apply all pending migrations
+  hotelm [flags] migrate down [N]     revert the last N migrations (default 1)
+  hotelm [flags] migrate status       list migrations and whether they are applied
+  hotelm [flags] create-admin --email EMAIL --name NAME
+                                      create an administrator; the password is read
+                                      from HOTELM_ADMIN_PASSWORD or the first line of stdin
+  hotelm --print-config               print the configuration and exit
+
+Run "hotelm --help" for the list of flags.
+`
+
+// errUsage is returned for a command line that does not match the usage.
+var errUsage = errors.New("invalid command line")
+
 func main() {
-	db.Connect()
+	cfg, opts, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if opts.PrintConfig {
+		cfg.Print(os.Stdout)
+		return
+	}
+	args := opts.Args
+	if len(args) > 0 && args[0] != "migrate" && args[0] != "create-admin" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	db.Connect(cfg.DSN(), db.PoolOptions{
+		MaxOpenConns:    cfg.DBMaxOpenConns,
+		MaxIdleConns:    cfg.DBMaxIdleConns,
+		ConnMaxLifetime: cfg.DBConnMaxLifetime,
+	})
 	defer db.Close()
 
+	if len(args) > 0 {
+		run := runMigrate
+		if args[0] == "create-admin" {
+			run = runCreateAdmin
+		}
+		err := run(args[1:])
+		if errors.Is(err, errUsage) {
+			fmt.Fprint(os.Stderr, usage)
+			db.Close()
+			os.Exit(2)
+		}
+		if err != nil {
+			db.Close()
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Refuse to serve against a schema this binary does not expect.
+	if err := db.CheckSchema(); err != nil {
+		db.Close()
+		log.Fatal(err)
+	}
+
+	if err := handlers.LoadTemplates(cfg.TemplateDir); err != nil {
+		db.Close()
+		log.Fatal(err)
+	}
+
+	// Every payment flow charges through the configured gateway.
+	gateway, err := payment.New(cfg.PaymentGateway)
+	if err != nil {
+		db.Close()
+		log.Fatal(err)
+	}
+	service.SetPaymentGateway(gateway)
+	// A booking whose payment the customer never confirms must not hold its
+	// dates forever.
+	go service.ExpirePendingPaymentsEvery(context.Background(), time.Minute)
+
+	// Prices are converted with the stored exchange rates, refreshed from
+	// the rates file if one is configured.
+	if cfg.ExchangeRatesFile != "" {
+		service.SetExchangeRatesFile(cfg.ExchangeRatesFile)
+		loaded, err := service.LoadExchangeRatesFile()
+		if err != nil {
+			db.Close()
+			log.Fatal(err)
+		}
+		log.Printf("Loaded exchange rates for %s from %s", strings.Join(loaded, ", "), cfg.ExchangeRatesFile)
+	}
+
+	// Room photos are kept in the configured blob store.
+	store, err := storage.New(storage.Options{
+		Backend: cfg.BlobStore,
+		Dir:     cfg.BlobDir,
+		S3: storage.S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PathStyle: cfg.S3PathStyle,
+		},
+	})
+	if err != nil {
+		db.Close()
+		log.Fatal(err)
+	}
+	service.SetBlobStore(store)
+
+	// Sessions are stored in the database and their cookie is signed with
+	// the session secret.
+	session.Init(cfg.SessionSecret)
+
 	// Setup routes
 	routes.SetupRoutes()
 
 	// Start the server
-	fmt.Println("Server is running on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	server := &http.Server{
+		Addr:              cfg.ListenAddr,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	if err := serve(server, cfg.ShutdownTimeout); err != nil {
+		db.Close()
+		log.Fatal(err)
+	}
+}
+
+// serve runs the server until it receives SIGINT or SIGTERM, then lets
+// in-flight requests finish for up to shutdownTimeout.
+func serve(server *http.Server, shutdownTimeout time.Duration) error {
+	errc := make(chan error, 1)
+	go func() {
+		fmt.Printf("Server is running on %s\n", server.Addr)
+		errc <- server.ListenAndServe()
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-errc:
+		return err
+	case <-stop:
+	}
+
+	fmt.Println("Shutting down...")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return server.Shutdown(ctx)
+}
+
+// runMigrate runs the "migrate" subcommand.
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := db.MigrateUp()
+		for _, m := range applied {
+			fmt.Printf("applied  %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("migrate down: invalid number of steps %q", args[1])
+			}
+			steps = n
+		}
+		reverted, err := db.MigrateDown(steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+
+	case "status":
+		states, err := db.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, s := range states {
+			status := "pending"
+			if s.AppliedAt != nil {
+				status = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, status)
+		}
+		return nil
+	}
+
+	return errUsage
+}
+
+// runCreateAdmin runs the "create-admin" subcommand.
+func runCreateAdmin(args []string) error {
+	fs := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	email := fs.String("email", "", "email address the admin logs in with")
+	name := fs.String("name", "", "display name of the admin")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 || *email == "" || *name == "" {
+		return errUsage
+	}
+
+	password, ok := os.LookupEnv("HOTELM_ADMIN_PASSWORD")
+	if !ok {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("create-admin: reading password: %v", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	id, err := service.CreateAdmin(models.Admin{Name: *name, Email: *email}, password)
+	if err != nil {
+		return fmt.Errorf("create-admin: %w", err)
+	}
+	fmt.Printf("created admin %d <%s>\n", id, *email)
+	return nil
 }
@@ -1,62 +1,411 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"hotelm/money"
+)
 
 type Customer struct {
-	CustomerID int    
-	Name       string 
-	Phone      string 
-	Email      string 
-	Address    string 
+	CustomerID int    `json:"customer_id"`
+	Name       string `json:"name"`
+	Phone      string `json:"phone"`
+	Email      string `json:"email"`
+	Address    string `json:"address"`
+	// PasswordHash is the bcrypt hash of the customer's password. It is empty
+	// for accounts created before passwords were introduced.
+	PasswordHash string `json:"-"`
+	// SuspendedAt is set while an admin has suspended the account.
+	SuspendedAt *time.Time `json:"suspended_at,omitempty"`
+	// DisplayCurrency is the currency the customer wants prices shown in.
+	// Empty shows them in each room's currency.
+	DisplayCurrency string `json:"display_currency,omitempty"`
 }
 
 type Vendor struct {
-	VendorID   int    
-	Name       string 
-	Email      string 
-	Phone      string 
-	HotelName  string 
-	Address    string 
+	VendorID  int    `json:"vendor_id"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+	HotelName string `json:"hotel_name"`
+	Address   string `json:"address"`
+	// PasswordHash is the bcrypt hash of the vendor's password. It is empty
+	// for accounts created before passwords were introduced.
+	PasswordHash string `json:"-"`
+	// SuspendedAt is set while an admin has suspended the account.
+	SuspendedAt *time.Time `json:"suspended_at,omitempty"`
+}
+
+// Admin is a platform administrator.
+type Admin struct {
+	AdminID      int       `json:"admin_id"`
+	Name         string    `json:"name"`
+	Email        string    `json:"email"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
 }
 
 type Room struct {
-	RoomID        int      
-	Name          string   
-	Description   string   
-	Location      string   
-	Availability  bool     
-	Price         float64  
-	RoomType      string   
-	AverageRating float64  
-	Amenities     string   // Now a single string, e.g., "WiFi,TV,Mini Bar"
-	VendorID      int      
+	RoomID        int         `json:"room_id"`
+	Name          string      `json:"name"`
+	Description   string      `json:"description"`
+	Location      string      `json:"location"`
+	Availability  bool        `json:"availability"`
+	Price         money.Money `json:"price"` // per night, in the room's currency
+	RoomType      string      `json:"room_type"`
+	AverageRating float64     `json:"average_rating"`
+	Amenities     []Amenity   `json:"amenities"` // ordered by name
+	VendorID      int         `json:"vendor_id"`
+	PropertyID    int         `json:"property_id"`
+	PropertyName  string      `json:"property_name"`
+	// CoverPhoto is the URL of the thumbnail of the room's cover photo, or
+	// "" if the room has no photos.
+	CoverPhoto string `json:"cover_photo,omitempty"`
+}
+
+// AmenityNames returns the names of the room's amenities, comma-separated.
+func (r Room) AmenityNames() string {
+	names := make([]string, len(r.Amenities))
+	for i, a := range r.Amenities {
+		names[i] = a.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// HasAmenity reports whether the room offers the amenity with the given ID.
+func (r Room) HasAmenity(id int) bool {
+	for _, a := range r.Amenities {
+		if a.AmenityID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Property is a hotel or other site run by a vendor, which its rooms
+// belong to. The check-in and check-out times, "15:04", are local to
+// Timezone, an IANA name such as "Europe/Paris".
+type Property struct {
+	PropertyID   int       `json:"property_id"`
+	VendorID     int       `json:"vendor_id"`
+	Name         string    `json:"name"`
+	Address      string    `json:"address"`
+	Latitude     *float64  `json:"latitude"` // both or neither are set
+	Longitude    *float64  `json:"longitude"`
+	Timezone     string    `json:"timezone"`
+	CheckinTime  string    `json:"checkin_time"`
+	CheckoutTime string    `json:"checkout_time"`
+	Policies     string    `json:"policies"`
+	Phone        string    `json:"phone"`
+	Email        string    `json:"email"`
+	CreatedAt    time.Time `json:"created_at"`
+	// Rooms is the number of rooms of the property; ListedRooms counts
+	// those that are available for booking.
+	Rooms       int `json:"rooms"`
+	ListedRooms int `json:"listed_rooms"`
+}
+
+// Amenity is an entry of the catalog of amenities rooms can offer. Its
+// Slug identifies it regardless of spelling; see AmenitySlug.
+type Amenity struct {
+	AmenityID int    `json:"amenity_id"`
+	Name      string `json:"name"`
+	Slug      string `json:"slug"`
+	// Rooms is the number of rooms offering the amenity. It is only set
+	// when the catalog is listed.
+	Rooms int `json:"rooms,omitempty"`
+}
+
+// AmenitySlug folds an amenity name to its lower-case letters and digits,
+// so that "WiFi", "wi-fi" and "WiFi " have the same slug, "wifi".
+func AmenitySlug(name string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(name) {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// PhotoPath is the URL path photos are served under, followed by their
+// storage key.
+const PhotoPath = "/photos/"
+
+// PhotoURL returns the URL of the photo or thumbnail stored under key.
+func PhotoURL(key string) string {
+	return PhotoPath + key
+}
+
+// RoomPhoto is a photo of a room. The image and its thumbnail are kept in
+// the blob store; URL and ThumbnailURL serve them.
+type RoomPhoto struct {
+	PhotoID      int       `json:"photo_id"`
+	RoomID       int       `json:"room_id"`
+	Key          string    `json:"-"`
+	ThumbnailKey string    `json:"-"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+	ContentType  string    `json:"content_type"`
+	Size         int       `json:"size"` // bytes
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	Position     int       `json:"position"`
+	IsCover      bool      `json:"is_cover"`
+	UploadedAt   time.Time `json:"uploaded_at"`
 }
 
 type Booking struct {
-	BookingID     int       
-	BookingDate   time.Time 
-	CheckinDate   time.Time 
-	CheckoutDate  time.Time 
-	PaymentStatus string    
-	RoomID        int       
-	CustomerID    int       
+	BookingID     int       `json:"booking_id"`
+	BookingDate   time.Time `json:"booking_date"`
+	CheckinDate   time.Time `json:"checkin_date"`
+	CheckoutDate  time.Time `json:"checkout_date"`
+	PaymentStatus string    `json:"payment_status"`
+	// Status is the stage of the stay: "confirmed", "checked_in",
+	// "checked_out", "cancelled" or "no_show".
+	Status     string `json:"status"`
+	RoomID     int    `json:"room_id"`
+	CustomerID int    `json:"customer_id"`
+	// The price is fixed when the booking is made, so later room price
+	// changes do not affect existing bookings. Both amounts are in the
+	// currency of the room when it was booked.
+	Nights      int         `json:"nights"`
+	NightlyRate money.Money `json:"nightly_rate"`
+	TotalAmount money.Money `json:"total_amount"`
+	// CancellationPolicy is the room's policy when the booking was made.
+	CancellationPolicy CancellationPolicy `json:"cancellation_policy"`
+	// DisplayCurrency is the currency the customer saw the price in and
+	// DisplayRate the exchange rate used then, in units of DisplayCurrency
+	// per unit of the booking's currency. Both are empty when the price was
+	// shown in the booking's currency, which is what was charged.
+	DisplayCurrency string     `json:"display_currency,omitempty"`
+	DisplayRate     money.Rate `json:"display_rate,omitempty"`
+	// Timezone is the time zone of the room's property, which the dates
+	// of the stay are in.
+	Timezone string `json:"timezone"`
+}
+
+// DisplayTotal returns the total as the customer saw it when booking, or
+// the total itself if it was shown in the booking's currency.
+func (b Booking) DisplayTotal() money.Money {
+	if b.DisplayCurrency == "" || b.DisplayRate.IsZero() {
+		return b.TotalAmount
+	}
+	return b.TotalAmount.Convert(b.DisplayCurrency, b.DisplayRate)
+}
+
+// CancellationPolicy decides the refund when a customer cancels. Cancelling
+// at least FreeDays before check-in is free; a later cancellation loses
+// PenaltyPercent of what was paid. A non-refundable booking refunds nothing.
+type CancellationPolicy struct {
+	FreeDays       int     `json:"free_days"`
+	PenaltyPercent float64 `json:"penalty_percent"`
+	NonRefundable  bool    `json:"non_refundable"`
+}
+
+// BookingStatusEvent records a status change of a booking and who made it.
+// FromStatus is empty for a booking's first status.
+type BookingStatusEvent struct {
+	EventID    int       `json:"event_id"`
+	BookingID  int       `json:"booking_id"`
+	FromStatus string    `json:"from_status,omitempty"`
+	ToStatus   string    `json:"to_status"`
+	ActorRole  string    `json:"actor_role"` // "customer", "vendor", "admin" or "system"
+	ActorID    int       `json:"actor_id,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// BookingLineItem is one line of a booking's itemized price: the room
+// charge, a tax or a fee.
+type BookingLineItem struct {
+	LineItemID  int         `json:"line_item_id"`
+	BookingID   int         `json:"booking_id"`
+	Kind        string      `json:"kind"` // "room", "discount", "tax" or "fee"
+	Description string      `json:"description"`
+	Amount      money.Money `json:"amount"`
+}
+
+// PricingFee is a tax or fee added to every booking. Percent is applied to
+// the room subtotal; FlatAmount is charged per night or once per stay, on
+// rooms priced in its currency.
+type PricingFee struct {
+	FeeID      int         `json:"fee_id"`
+	Name       string      `json:"name"`
+	Kind       string      `json:"kind"` // "tax" or "fee"
+	Percent    float64     `json:"percent"`
+	FlatAmount money.Money `json:"flat_amount"`
+	PerNight   bool        `json:"per_night"`
+	Active     bool        `json:"active"`
+}
+
+// RatePlan prices the nights of a room from StartDate to EndDate, both
+// included. A price in WeekdayPrices replaces Price on that day of the week.
+// MinStay and MaxStay limit the length of stays with a night in the plan;
+// 0 is no limit.
+type RatePlan struct {
+	RatePlanID    int                          `json:"rate_plan_id"`
+	RoomID        int                          `json:"room_id"`
+	Name          string                       `json:"name"`
+	StartDate     time.Time                    `json:"start_date"`
+	EndDate       time.Time                    `json:"end_date"`
+	Price         money.Money                  `json:"price"`
+	WeekdayPrices map[time.Weekday]money.Money `json:"weekday_prices,omitempty"` // 0 is Sunday
+	MinStay       int                          `json:"min_stay"`
+	MaxStay       int                          `json:"max_stay"`
+}
+
+// PromoCode is a discount customers enter at checkout. Codes with a VendorID
+// apply to that vendor's rooms; codes without one are platform-wide. A code
+// takes Percent or a fixed Amount off the room charge, never both.
+type PromoCode struct {
+	PromoCodeID int          `json:"promo_code_id"`
+	Code        string       `json:"code"`
+	VendorID    *int         `json:"vendor_id,omitempty"`
+	Description string       `json:"description"`
+	Percent     float64      `json:"percent,omitempty"`
+	Amount      *money.Money `json:"amount,omitempty"`
+	// ValidFrom and ValidUntil bound the days bookings can redeem the code,
+	// both included; nil is open-ended.
+	ValidFrom  *time.Time `json:"valid_from,omitempty"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+	// MaxUses and MaxUsesPerCustomer cap the redemptions by bookings that
+	// are not cancelled; 0 is no cap.
+	MaxUses            int       `json:"max_uses"`
+	MaxUsesPerCustomer int       `json:"max_uses_per_customer"`
+	MinNights          int       `json:"min_nights"`
+	RoomID             *int      `json:"room_id,omitempty"`
+	RoomType           string    `json:"room_type,omitempty"`
+	Active             bool      `json:"active"`
+	Uses               int       `json:"uses"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+// PromoRedemption records a promo code used by a booking.
+type PromoRedemption struct {
+	RedemptionID int         `json:"redemption_id"`
+	PromoCodeID  int         `json:"promo_code_id"`
+	BookingID    int         `json:"booking_id"`
+	CustomerID   int         `json:"customer_id"`
+	Discount     money.Money `json:"discount"`
+	RedeemedAt   time.Time   `json:"redeemed_at"`
+}
+
+// ExchangeRate is the number of units of Currency that one unit of
+// money.DefaultCurrency buys.
+type ExchangeRate struct {
+	Currency  string     `json:"currency"`
+	Rate      money.Rate `json:"rate"`
+	Source    string     `json:"source"` // "admin" or "file"
+	UpdatedAt time.Time  `json:"updated_at"`
 }
 
 type Payment struct {
-	PaymentID      int       
-	PaymentMethod  string    
-	PaymentStatus  string    
-	TransactionDate time.Time 
-	Amount         float64   
-	BookingID      int       
+	PaymentID       int         `json:"payment_id"`
+	PaymentMethod   string      `json:"payment_method"`
+	PaymentStatus   string      `json:"payment_status"`
+	TransactionDate time.Time   `json:"transaction_date"`
+	Amount          money.Money `json:"amount"`
+	BookingID       int         `json:"booking_id"`
+	// Gateway and GatewayRef identify the charge or refund at the payment
+	// provider. Both are empty for payments made before gateways existed.
+	Gateway    string `json:"gateway,omitempty"`
+	GatewayRef string `json:"gateway_ref,omitempty"`
 }
 
 type Review struct {
-	ReviewID   int       
-	Comment    string    
-	Rating     int       
-	ReviewDate time.Time 
-	BookingID  int       
-	CustomerID int       
-	RoomID     int       
+	ReviewID   int       `json:"review_id"`
+	Comment    string    `json:"comment"`
+	Rating     int       `json:"rating"`
+	ReviewDate time.Time `json:"review_date"`
+	BookingID  int       `json:"booking_id"`
+	CustomerID int       `json:"customer_id"`
+	RoomID     int       `json:"room_id"`
+	// HiddenAt is set when an admin has hidden the review.
+	HiddenAt *time.Time `json:"hidden_at,omitempty"`
+}
+
+// AuditEntry records an action taken by an admin.
+type AuditEntry struct {
+	AuditID    int       `json:"audit_id"`
+	AdminID    int       `json:"admin_id"`
+	Action     string    `json:"action"`      // e.g. "suspend", "refund"
+	TargetType string    `json:"target_type"` // e.g. "customer", "booking"
+	TargetID   int       `json:"target_id"`
+	Details    string    `json:"details"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// IdempotencyRecord is a request made with an idempotency key and, once it
+// has finished, its response. ResponseStatus is 0 while the request runs.
+type IdempotencyRecord struct {
+	Owner            string
+	Key              string
+	Fingerprint      string
+	ResponseStatus   int
+	ResponseType     string
+	ResponseLocation string
+	ResponseBody     []byte
+	CreatedAt        time.Time
+}
+
+// MessageThread is a conversation between a customer and the vendor of a
+// room, optionally about one of the customer's bookings.
+type MessageThread struct {
+	ThreadID      int       `json:"thread_id"`
+	CustomerID    int       `json:"customer_id"`
+	VendorID      int       `json:"vendor_id"`
+	BookingID     *int      `json:"booking_id,omitempty"`
+	Subject       string    `json:"subject"`
+	CreatedAt     time.Time `json:"created_at"`
+	LastMessageAt time.Time `json:"last_message_at"`
+	// Unread is the number of messages the viewing participant has not read.
+	Unread int `json:"unread"`
+}
+
+// Message is one message in a thread.
+type Message struct {
+	MessageID  int       `json:"message_id"`
+	ThreadID   int       `json:"thread_id"`
+	SenderRole string    `json:"sender_role"` // "customer" or "vendor"
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// SupportTicket is a support request opened by a customer or vendor.
+type SupportTicket struct {
+	TicketID   int       `json:"ticket_id"`
+	OpenerRole string    `json:"opener_role"` // "customer" or "vendor"
+	CustomerID *int      `json:"customer_id,omitempty"`
+	VendorID   *int      `json:"vendor_id,omitempty"`
+	BookingID  *int      `json:"booking_id,omitempty"`
+	PaymentID  *int      `json:"payment_id,omitempty"`
+	Category   string    `json:"category"` // "booking", "payment", "account", "room" or "other"
+	Priority   string    `json:"priority"` // "low", "normal", "high" or "urgent"
+	Status     string    `json:"status"`   // "open", "pending", "resolved" or "closed"
+	Subject    string    `json:"subject"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// TicketReply is a message on a support ticket.
+type TicketReply struct {
+	ReplyID    int       `json:"reply_id"`
+	TicketID   int       `json:"ticket_id"`
+	AuthorRole string    `json:"author_role"` // "customer", "vendor" or "admin"
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TicketEvent records a status change of a support ticket. FromStatus is
+// empty for the event that opened the ticket.
+type TicketEvent struct {
+	EventID    int       `json:"event_id"`
+	TicketID   int       `json:"ticket_id"`
+	FromStatus string    `json:"from_status,omitempty"`
+	ToStatus   string    `json:"to_status"`
+	ActorRole  string    `json:"actor_role"`
+	CreatedAt  time.Time `json:"created_at"`
 }
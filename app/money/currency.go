@@ -0,0 +1,68 @@
+package money
+
+import "sort"
+
+// DefaultCurrency is the currency of amounts stored before currencies were
+// recorded, and of prices entered without one.
+const DefaultCurrency = "USD"
+
+// Currency describes how amounts of an ISO 4217 currency are rounded and
+// written.
+type Currency struct {
+	Code string
+	// Digits is the number of minor unit digits: 2 for cents, 0 for
+	// currencies such as the yen that have none in use.
+	Digits int
+	// Symbol is written before the amount.
+	Symbol string
+}
+
+// currencies lists the supported currencies. Amounts are stored with two
+// decimals, so currencies with three minor unit digits are not supported.
+var currencies = map[string]Currency{
+	"AUD": {Code: "AUD", Digits: 2, Symbol: "A$"},
+	"CAD": {Code: "CAD", Digits: 2, Symbol: "CA$"},
+	"CHF": {Code: "CHF", Digits: 2, Symbol: "CHF "},
+	"EUR": {Code: "EUR", Digits: 2, Symbol: "€"},
+	"GBP": {Code: "GBP", Digits: 2, Symbol: "£"},
+	"INR": {Code: "INR", Digits: 2, Symbol: "₹"},
+	"JPY": {Code: "JPY", Digits: 0, Symbol: "¥"},
+	"KRW": {Code: "KRW", Digits: 0, Symbol: "₩"},
+	"USD": {Code: "USD", Digits: 2, Symbol: "$"},
+}
+
+// LookupCurrency returns the currency with the given code.
+func LookupCurrency(code string) (Currency, bool) {
+	c, ok := currencies[code]
+	return c, ok
+}
+
+// Currencies returns the supported currency codes in alphabetical order.
+func Currencies() []string {
+	codes := make([]string, 0, len(currencies))
+	for code := range currencies {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// currencyOf returns the currency with the given code. An unknown code is
+// treated as a two-digit currency written with its code.
+func currencyOf(code string) Currency {
+	if c, ok := currencies[code]; ok {
+		return c
+	}
+	if code == "" {
+		return Currency{Digits: 2}
+	}
+	return Currency{Code: code, Digits: 2, Symbol: code + " "}
+}
+
+// step is the smallest amount of the currency in hundredths.
+func (c Currency) step() int64 {
+	if c.Digits == 0 {
+		return scale
+	}
+	return 1
+}
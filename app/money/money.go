@@ -0,0 +1,332 @@
+// Package money holds amounts of money exactly, together with their currency.
+package money
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// scale is the number of hundredths in a unit of currency. Amounts are kept
+// and stored with two decimals, as in the NUMERIC(10,2) columns.
+const scale = 100
+
+// maxIntegerDigits bounds the whole part of a parsed amount so that
+// arithmetic on it cannot overflow.
+const maxIntegerDigits = 13
+
+// ErrInvalidAmount is wrapped by errors returned for an amount that cannot
+// be parsed.
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// Money is an exact amount of a currency. The zero value is zero with no
+// currency yet, which adds to an amount of any currency.
+type Money struct {
+	// Cents is the amount in hundredths of the currency's main unit. Amounts
+	// of currencies without minor units are whole multiples of 100 once
+	// rounded.
+	Cents int64
+	// Currency is the ISO 4217 code, e.g. "USD".
+	Currency string
+}
+
+// New returns the amount of currency given in hundredths.
+func New(cents int64, currency string) Money {
+	return Money{Cents: cents, Currency: currency}
+}
+
+// Zero returns no money in the given currency.
+func Zero(currency string) Money {
+	return Money{Currency: currency}
+}
+
+// Parse reads a decimal amount such as "1234.5" in the given currency. It
+// accepts no more decimals than the currency uses.
+func Parse(s, currency string) (Money, error) {
+	c, ok := LookupCurrency(currency)
+	if !ok {
+		return Money{}, fmt.Errorf("unsupported currency %q", currency)
+	}
+	cents, err := parseCents(s, c.Digits)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Cents: cents, Currency: currency}, nil
+}
+
+// parseCents reads a decimal amount with at most digits significant
+// decimals and returns it in hundredths.
+func parseCents(s string, digits int) (int64, error) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	if neg || strings.HasPrefix(s, "+") {
+		// One sign at most: "-+5" is not an amount.
+		s = s[1:]
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" || len(whole) > maxIntegerDigits || !isDigits(whole) || !isDigits(frac) {
+		return 0, fmt.Errorf("%w %q", ErrInvalidAmount, s)
+	}
+	if significant := strings.TrimRight(frac, "0"); len(significant) > digits {
+		return 0, fmt.Errorf("%w %q: at most %d decimal places are allowed", ErrInvalidAmount, s, digits)
+	}
+	frac = (strings.TrimRight(frac, "0") + "00")[:2]
+
+	units, _ := strconv.ParseInt(whole, 10, 64)
+	hundredths, _ := strconv.ParseInt(frac, 10, 64)
+	cents := units*scale + hundredths
+	if neg {
+		cents = -cents
+	}
+	return cents, nil
+}
+
+// isDigits reports whether s holds only ASCII digits.
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// divRound divides a by b, rounding halves away from zero.
+func divRound(a, b int64) int64 {
+	q, r := a/b, a%b
+	if r < 0 {
+		r = -r
+	}
+	if 2*r >= b {
+		if a < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+	return q
+}
+
+// currencyWith returns the currency of an operation on m and o. They must
+// share a currency unless one has none yet.
+func (m Money) currencyWith(o Money) string {
+	switch {
+	case m.Currency == "":
+		return o.Currency
+	case o.Currency == "" || o.Currency == m.Currency:
+		return m.Currency
+	}
+	panic(fmt.Sprintf("money: cannot combine %s and %s", m.Currency, o.Currency))
+}
+
+// SameCurrency reports whether m and o can be added or compared.
+func (m Money) SameCurrency(o Money) bool {
+	return m.Currency == "" || o.Currency == "" || m.Currency == o.Currency
+}
+
+// Add returns m + o. It panics if the currencies differ; amounts
+// taken from a request must be checked with SameCurrency first.
+func (m Money) Add(o Money) Money {
+	return Money{Cents: m.Cents + o.Cents, Currency: m.currencyWith(o)}
+}
+
+// Sub returns m - o. It panics if the currencies differ; amounts
+// taken from a request must be checked with SameCurrency first.
+func (m Money) Sub(o Money) Money {
+	return Money{Cents: m.Cents - o.Cents, Currency: m.currencyWith(o)}
+}
+
+// Neg returns -m.
+func (m Money) Neg() Money {
+	return Money{Cents: -m.Cents, Currency: m.Currency}
+}
+
+// Mul returns m times n.
+func (m Money) Mul(n int) Money {
+	return Money{Cents: m.Cents * int64(n), Currency: m.Currency}
+}
+
+// Div returns m divided by n, rounded to the currency's minor unit, halves
+// away from zero.
+func (m Money) Div(n int) Money {
+	return Money{Cents: divRound(m.Cents, int64(n)), Currency: m.Currency}.Round()
+}
+
+// Percent returns percent of m, rounded to the currency's minor unit.
+// Percentages are exact to two decimals, as stored.
+func (m Money) Percent(percent float64) Money {
+	basisPoints := int64(math.Round(percent * 100))
+	return Money{Cents: divRound(m.Cents*basisPoints, 100*scale), Currency: m.Currency}.Round()
+}
+
+// Round rounds m to the currency's minor unit, halves away from zero.
+func (m Money) Round() Money {
+	step := currencyOf(m.Currency).step()
+	return Money{Cents: divRound(m.Cents, step) * step, Currency: m.Currency}
+}
+
+// Cmp compares m and o, returning -1, 0 or +1. It panics if the currencies
+// differ; amounts taken from a request must be checked with SameCurrency
+// first.
+func (m Money) Cmp(o Money) int {
+	m.currencyWith(o)
+	switch {
+	case m.Cents < o.Cents:
+		return -1
+	case m.Cents > o.Cents:
+		return 1
+	}
+	return 0
+}
+
+// IsZero reports whether m is zero.
+func (m Money) IsZero() bool {
+	return m.Cents == 0
+}
+
+// IsPositive reports whether m is more than zero.
+func (m Money) IsPositive() bool {
+	return m.Cents > 0
+}
+
+// IsNegative reports whether m is less than zero.
+func (m Money) IsNegative() bool {
+	return m.Cents < 0
+}
+
+// WithDefault returns m in currency if m has no currency yet.
+func (m Money) WithDefault(currency string) Money {
+	if m.Currency == "" {
+		m.Currency = currency
+	}
+	return m
+}
+
+// decimal writes m with the given number of decimals, without grouping.
+func (m Money) decimal(digits int) string {
+	sign := ""
+	cents := m.Cents
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	if digits == 0 {
+		return sign + strconv.FormatInt(cents/scale, 10)
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/scale, cents%scale)
+}
+
+// Decimal returns m as a plain decimal with the currency's number of
+// decimals, e.g. "1234.50", as used in forms and JSON.
+func (m Money) Decimal() string {
+	c := currencyOf(m.Currency)
+	if m.Cents%c.step() != 0 {
+		return m.decimal(2)
+	}
+	return m.decimal(c.Digits)
+}
+
+// String formats m for display in its currency, e.g. "$1,234.50" or "¥1,250".
+func (m Money) String() string {
+	c := currencyOf(m.Currency)
+	s := m.Round().decimal(c.Digits)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	var grouped strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(r)
+	}
+	if hasFrac {
+		grouped.WriteString("." + frac)
+	}
+	return sign + c.Symbol + grouped.String()
+}
+
+// Value stores the amount in a NUMERIC column. The currency is stored in a
+// column of its own.
+func (m Money) Value() (driver.Value, error) {
+	return m.decimal(2), nil
+}
+
+// Scan reads the amount from a NUMERIC column, leaving the currency as is.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		m.Cents = 0
+	case int64:
+		m.Cents = v * scale
+	case float64:
+		m.Cents = int64(math.Round(v * scale))
+	case []byte:
+		return m.scanDecimal(string(v))
+	case string:
+		return m.scanDecimal(v)
+	default:
+		return fmt.Errorf("money: cannot scan %T", src)
+	}
+	return nil
+}
+
+func (m *Money) scanDecimal(s string) error {
+	cents, err := parseCents(s, 2)
+	if err != nil {
+		return fmt.Errorf("money: %w", err)
+	}
+	m.Cents = cents
+	return nil
+}
+
+// jsonMoney is the JSON form of an amount.
+type jsonMoney struct {
+	Amount   json.RawMessage `json:"amount"`
+	Currency string          `json:"currency"`
+}
+
+// MarshalJSON writes m as {"amount": "1234.50", "currency": "USD"}. The
+// amount is a string so that clients do not read it as a float.
+func (m Money) MarshalJSON() ([]byte, error) {
+	amount, _ := json.Marshal(m.Decimal())
+	return json.Marshal(jsonMoney{Amount: amount, Currency: m.Currency})
+}
+
+// UnmarshalJSON reads an amount written by MarshalJSON. The amount may also
+// be a JSON number, and a bare amount without a currency is accepted too;
+// it is left without a currency for the caller to fill in.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	v := jsonMoney{Amount: data}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		v = jsonMoney{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+	}
+	amount := strings.Trim(string(bytes.TrimSpace(v.Amount)), `"`)
+	if amount == "" || amount == "null" {
+		*m = Money{Currency: v.Currency}
+		return nil
+	}
+	digits := 2
+	if v.Currency != "" {
+		c, ok := LookupCurrency(v.Currency)
+		if !ok {
+			return fmt.Errorf("unsupported currency %q", v.Currency)
+		}
+		digits = c.Digits
+	}
+	cents, err := parseCents(amount, digits)
+	if err != nil {
+		return err
+	}
+	*m = Money{Cents: cents, Currency: v.Currency}
+	return nil
+}
@@ -0,0 +1,210 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseCents(t *testing.T) {
+	tests := []struct {
+		in     string
+		digits int
+		want   int64
+		ok     bool
+	}{
+		{"0", 2, 0, true},
+		{"5", 2, 500, true},
+		{"5.", 2, 500, true},
+		{"5.5", 2, 550, true},
+		{"5.05", 2, 505, true},
+		{"5.050", 2, 505, true}, // trailing zeros are not significant
+		{" 12.34 ", 2, 1234, true},
+		{"+5", 2, 500, true},
+		{"-5.25", 2, -525, true},
+		{"1234567890123", 2, 123456789012300, true},
+		{"1250", 0, 125000, true},
+		{"1250.00", 0, 125000, true},
+		{"1250.5", 0, 0, false}, // no decimals in use
+		{"5.255", 2, 0, false},
+		{"", 2, 0, false},
+		{"-", 2, 0, false},
+		{".5", 2, 0, false},
+		{"-+5", 2, 0, false},
+		{"+-5", 2, 0, false},
+		{"--5", 2, 0, false},
+		{"5-", 2, 0, false},
+		{"1e3", 2, 0, false},
+		{"1,000", 2, 0, false},
+		{"5.5.5", 2, 0, false},
+		{"12345678901234", 2, 0, false}, // too many whole digits
+	}
+	for _, tt := range tests {
+		got, err := parseCents(tt.in, tt.digits)
+		if !tt.ok {
+			if !errors.Is(err, ErrInvalidAmount) {
+				t.Errorf("parseCents(%q, %d) = %d, %v, want ErrInvalidAmount", tt.in, tt.digits, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseCents(%q, %d) = %d, %v, want %d", tt.in, tt.digits, got, err, tt.want)
+		}
+	}
+}
+
+func TestDivRound(t *testing.T) {
+	tests := []struct {
+		a, b, want int64
+	}{
+		{10, 5, 2},
+		{10, 4, 3}, // 2.5 rounds away from zero
+		{-10, 4, -3},
+		{9, 4, 2}, // 2.25
+		{-9, 4, -2},
+		{11, 4, 3}, // 2.75
+		{-11, 4, -3},
+		{1, 3, 0},
+		{2, 3, 1},
+		{-2, 3, -1},
+		{0, 7, 0},
+	}
+	for _, tt := range tests {
+		if got := divRound(tt.a, tt.b); got != tt.want {
+			t.Errorf("divRound(%d, %d) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		m       Money
+		percent float64
+		want    Money
+	}{
+		{New(10000, "USD"), 15, New(1500, "USD")},
+		{New(10000, "USD"), 12.5, New(1250, "USD")},
+		{New(999, "USD"), 50, New(500, "USD")}, // 4.995 rounds up
+		{New(333, "USD"), 10, New(33, "USD")},
+		{New(-999, "USD"), 50, New(-500, "USD")},
+		{New(10000, "USD"), 0, New(0, "USD")},
+		{New(10000, "USD"), 100, New(10000, "USD")},
+		{New(10000, "USD"), 7.125, New(713, "USD")}, // percentages are kept to two decimals
+		{New(125000, "JPY"), 10, New(12500, "JPY")},
+		{New(125000, "JPY"), 3, New(3800, "JPY")}, // ¥37.5 rounds to ¥38
+	}
+	for _, tt := range tests {
+		if got := tt.m.Percent(tt.percent); got != tt.want {
+			t.Errorf("%v.Percent(%g) = %v, want %v", tt.m, tt.percent, got, tt.want)
+		}
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		m, want Money
+	}{
+		{New(1234, "USD"), New(1234, "USD")},
+		{New(12345, "JPY"), New(12300, "JPY")},
+		{New(12350, "JPY"), New(12400, "JPY")},
+		{New(-12350, "JPY"), New(-12400, "JPY")},
+		{New(49, "KRW"), New(0, "KRW")},
+		{New(1234, "XXX"), New(1234, "XXX")}, // unknown currencies keep two decimals
+	}
+	for _, tt := range tests {
+		if got := tt.m.Round(); got != tt.want {
+			t.Errorf("%#v.Round() = %#v, want %#v", tt.m, got, tt.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{New(0, "USD"), "$0.00"},
+		{New(5, "USD"), "$0.05"},
+		{New(99999, "USD"), "$999.99"},
+		{New(100000, "USD"), "$1,000.00"},
+		{New(123456789, "USD"), "$1,234,567.89"},
+		{New(-123456, "EUR"), "-€1,234.56"},
+		{New(125000, "JPY"), "¥1,250"},
+		{New(12345678900, "KRW"), "₩123,456,789"},
+		{New(100050, "CHF"), "CHF 1,000.50"},
+		{New(1500, "XXX"), "XXX 15.00"},
+		{New(1500, ""), "15.00"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("%#v.String() = %q, want %q", tt.m, got, tt.want)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	for _, m := range []Money{New(123450, "USD"), New(-5, "EUR"), New(125000, "JPY"), New(0, "GBP")} {
+		data, err := json.Marshal(m)
+		if err != nil {
+			t.Fatalf("Marshal(%#v): %v", m, err)
+		}
+		var got Money
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", data, err)
+		}
+		if got != m {
+			t.Errorf("round trip of %#v through %s = %#v", m, data, got)
+		}
+	}
+
+	data, _ := json.Marshal(New(123450, "USD"))
+	if want := `{"amount":"1234.50","currency":"USD"}`; string(data) != want {
+		t.Errorf("Marshal = %s, want %s", data, want)
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+		ok   bool
+	}{
+		{`{"amount": 12.5, "currency": "USD"}`, New(1250, "USD"), true},
+		{`"12.50"`, New(1250, ""), true},
+		{`12`, New(1200, ""), true},
+		{`null`, Money{}, true},
+		{`{"currency": "EUR"}`, Zero("EUR"), true},
+		{`{"amount": "1250.5", "currency": "JPY"}`, Money{}, false},
+		{`{"amount": "1", "currency": "XXX"}`, Money{}, false},
+		{`{"amount": "-+1", "currency": "USD"}`, Money{}, false},
+	}
+	for _, tt := range tests {
+		var got Money
+		err := json.Unmarshal([]byte(tt.in), &got)
+		if !tt.ok {
+			if err == nil {
+				t.Errorf("Unmarshal(%s) = %#v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Unmarshal(%s) = %#v, %v, want %#v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestCurrencyMismatch(t *testing.T) {
+	usd, eur := New(100, "USD"), New(100, "EUR")
+	if usd.SameCurrency(eur) {
+		t.Error("USD and EUR reported as the same currency")
+	}
+	if !usd.SameCurrency(New(5, "")) {
+		t.Error("an amount without a currency should combine with any")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("Add of USD and EUR did not panic")
+		}
+	}()
+	usd.Add(eur)
+}
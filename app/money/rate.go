@@ -0,0 +1,173 @@
+package money
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// rateDigits is the number of decimals rates are kept with, as in the
+// NUMERIC(20,10) columns.
+const rateDigits = 10
+
+// Rate is an exact exchange rate: how many units of one currency buy one
+// unit of another. The zero value is no rate.
+type Rate struct {
+	r *big.Rat
+}
+
+// ParseRate reads a positive decimal rate such as "0.9234".
+func ParseRate(s string) (Rate, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok || r.Sign() <= 0 || strings.ContainsAny(s, "/eE") {
+		return Rate{}, fmt.Errorf("invalid exchange rate %q", s)
+	}
+	return newRate(r), nil
+}
+
+// newRate returns r rounded to rateDigits decimals.
+func newRate(r *big.Rat) Rate {
+	rounded, _ := new(big.Rat).SetString(r.FloatString(rateDigits))
+	return Rate{r: rounded}
+}
+
+// one is the rate between a currency and itself.
+var one = Rate{r: big.NewRat(1, 1)}
+
+// IsZero reports whether r is no rate.
+func (r Rate) IsZero() bool {
+	return r.r == nil
+}
+
+// Div returns r / o, the rate between the currencies r and o are quoted in
+// when both are against the same currency.
+func (r Rate) Div(o Rate) Rate {
+	return newRate(new(big.Rat).Quo(r.r, o.r))
+}
+
+// String writes r as a decimal without trailing zeros, e.g. "0.92".
+func (r Rate) String() string {
+	if r.r == nil {
+		return ""
+	}
+	s := r.r.FloatString(rateDigits)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// Value stores r in a NUMERIC column; no rate is NULL.
+func (r Rate) Value() (driver.Value, error) {
+	if r.r == nil {
+		return nil, nil
+	}
+	return r.r.FloatString(rateDigits), nil
+}
+
+// Scan reads r from a NUMERIC column.
+func (r *Rate) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*r = Rate{}
+		return nil
+	case []byte:
+		return r.scanDecimal(string(v))
+	case string:
+		return r.scanDecimal(v)
+	case float64:
+		return r.scanDecimal(fmt.Sprint(v))
+	case int64:
+		return r.scanDecimal(fmt.Sprint(v))
+	}
+	return fmt.Errorf("money: cannot scan %T into a rate", src)
+}
+
+func (r *Rate) scanDecimal(s string) error {
+	rate, err := ParseRate(s)
+	if err != nil {
+		return fmt.Errorf("money: %w", err)
+	}
+	*r = rate
+	return nil
+}
+
+// MarshalJSON writes r as a decimal string, or null for no rate.
+func (r Rate) MarshalJSON() ([]byte, error) {
+	if r.r == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(r.String())
+}
+
+// UnmarshalJSON reads a rate written as a string or a number.
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(bytes.TrimSpace(data)), `"`)
+	if s == "null" || s == "" {
+		*r = Rate{}
+		return nil
+	}
+	rate, err := ParseRate(s)
+	if err != nil {
+		return err
+	}
+	*r = rate
+	return nil
+}
+
+// Convert returns m in currency to at rate r, the number of units of to one
+// unit of m's currency buys, rounded to the minor unit of to.
+func (m Money) Convert(to string, r Rate) Money {
+	step := big.NewInt(currencyOf(to).step())
+	amount := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Cents), r.r)
+	amount.Quo(amount, new(big.Rat).SetInt(step))
+
+	// Round to a whole number of steps, halves away from zero.
+	q, rem := new(big.Int).QuoRem(amount.Num(), amount.Denom(), new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(amount.Denom()) >= 0 {
+		q.Add(q, big.NewInt(int64(amount.Sign())))
+	}
+	return Money{Cents: q.Mul(q, step).Int64(), Currency: to}
+}
+
+// Rates holds exchange rates against DefaultCurrency: how many units of
+// each currency one unit of DefaultCurrency buys. DefaultCurrency itself
+// need not be listed.
+type Rates map[string]Rate
+
+// against returns the rate of currency against DefaultCurrency.
+func (rs Rates) against(currency string) (Rate, bool) {
+	if currency == DefaultCurrency {
+		return one, true
+	}
+	r, ok := rs[currency]
+	return r, ok && !r.IsZero()
+}
+
+// Rate returns the number of units of to one unit of from buys, crossing
+// through DefaultCurrency. It reports false if either currency has no rate.
+func (rs Rates) Rate(from, to string) (Rate, bool) {
+	if from == to {
+		return one, true
+	}
+	rf, ok := rs.against(from)
+	if !ok {
+		return Rate{}, false
+	}
+	rt, ok := rs.against(to)
+	if !ok {
+		return Rate{}, false
+	}
+	return rt.Div(rf), true
+}
+
+// Convert returns m in currency to and the rate used. It reports false if
+// either currency has no rate.
+func (rs Rates) Convert(m Money, to string) (Money, Rate, bool) {
+	r, ok := rs.Rate(m.Currency, to)
+	if !ok {
+		return Money{}, Rate{}, false
+	}
+	return m.Convert(to, r), r, true
+}
@@ -0,0 +1,101 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"hotelm/money"
+)
+
+// Fake is an in-process gateway for development and tests. It charges
+// nothing and its answers depend only on the payment method, like the test
+// cards of real providers:
+//
+//	a method containing "decline"   is declined
+//	a method containing "timeout"   fails with ErrTimeout
+//	a method containing "3ds-fail"  is pending, then declined on capture
+//	a method containing "3ds"       is pending, then captured on capture
+//	any other method                is authorized and captured
+//
+// The outcome of a pending charge is kept in its reference, so a Fake holds
+// no state besides the counter that numbers references. NewFake starts the
+// counter from the clock, so references stay unique across restarts too.
+type Fake struct {
+	seq atomic.Int64
+}
+
+// NewFake returns a fake gateway.
+func NewFake() *Fake {
+	f := &Fake{}
+	f.seq.Store(time.Now().UnixNano())
+	return f
+}
+
+// Name returns "fake".
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+// Authorize holds the charge, or simulates a decline, a timeout or a 3DS
+// challenge according to the payment method.
+func (f *Fake) Authorize(ctx context.Context, charge Charge) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	if !charge.Amount.IsPositive() {
+		return Result{Status: StatusDeclined, Message: "invalid amount"}, nil
+	}
+	method := strings.ToLower(charge.Method)
+	ref := fmt.Sprintf("fake_%d", f.seq.Add(1))
+	switch {
+	case strings.Contains(method, "timeout"):
+		return Result{}, ErrTimeout
+	case strings.Contains(method, "decline"):
+		return Result{Reference: ref, Status: StatusDeclined, Message: "card declined"}, nil
+	case strings.Contains(method, "3ds-fail"):
+		return Result{Reference: ref + "_3ds_fail", Status: StatusPending, Message: "authentication required"}, nil
+	case strings.Contains(method, "3ds"):
+		return Result{Reference: ref + "_3ds", Status: StatusPending, Message: "authentication required"}, nil
+	}
+	return Result{Reference: ref, Status: StatusAuthorized}, nil
+}
+
+// Capture takes an authorized charge. A pending charge is captured or
+// declined as its payment method asked for.
+func (f *Fake) Capture(ctx context.Context, reference string, amount money.Money) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	if !strings.HasPrefix(reference, "fake_") {
+		return Result{}, fmt.Errorf("fake gateway: unknown reference %q", reference)
+	}
+	if strings.HasSuffix(reference, "_3ds_fail") {
+		return Result{Reference: reference, Status: StatusDeclined, Message: "authentication failed"}, nil
+	}
+	return Result{Reference: reference, Status: StatusCaptured}, nil
+}
+
+// Refund returns an amount of a captured charge under a new reference.
+func (f *Fake) Refund(ctx context.Context, reference string, amount money.Money) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	if !strings.HasPrefix(reference, "fake_") {
+		return Result{}, fmt.Errorf("fake gateway: unknown reference %q", reference)
+	}
+	return Result{Reference: fmt.Sprintf("fake_refund_%d", f.seq.Add(1)), Status: StatusRefunded}, nil
+}
+
+// Void releases an authorization.
+func (f *Fake) Void(ctx context.Context, reference string) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	if !strings.HasPrefix(reference, "fake_") {
+		return Result{}, fmt.Errorf("fake gateway: unknown reference %q", reference)
+	}
+	return Result{Reference: reference, Status: StatusVoided}, nil
+}
@@ -0,0 +1,70 @@
+// Package payment defines the interface to payment providers. Payment flows
+// authorize and capture charges through a Gateway and record the status it
+// returns; nothing is marked as paid without a gateway result.
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"hotelm/money"
+)
+
+// Status is the state of a charge at the gateway.
+type Status string
+
+// Charge states.
+const (
+	StatusAuthorized Status = "authorized" // funds are held, not yet taken
+	StatusPending    Status = "pending"    // waiting on the customer, e.g. a 3DS challenge
+	StatusCaptured   Status = "captured"   // funds are taken
+	StatusDeclined   Status = "declined"   // the provider refused the charge
+	StatusRefunded   Status = "refunded"   // funds were returned
+	StatusVoided     Status = "voided"     // the hold was released without a charge
+)
+
+// ErrTimeout is returned when the provider did not answer in time. The
+// outcome of the operation is unknown.
+var ErrTimeout = errors.New("payment gateway timed out")
+
+// Charge describes an amount to authorize.
+type Charge struct {
+	Amount      money.Money // charged in its currency
+	Method      string      // payment method or token as given by the customer
+	Description string
+}
+
+// Result is the outcome of a gateway operation. Reference identifies the
+// charge at the provider and is passed back to capture, refund or void it.
+type Result struct {
+	Reference string
+	Status    Status
+	Message   string // reason for a decline or a pending state
+}
+
+// Gateway is a payment provider. Operations return an error only when the
+// provider could not be reached or did not answer; a refused charge is a
+// result with StatusDeclined.
+type Gateway interface {
+	// Name identifies the provider in stored payments.
+	Name() string
+	// Authorize holds the amount of a charge.
+	Authorize(ctx context.Context, charge Charge) (Result, error)
+	// Capture takes an authorized amount, or completes a pending charge
+	// once the customer has confirmed it.
+	Capture(ctx context.Context, reference string, amount money.Money) (Result, error)
+	// Refund returns part or all of a captured amount.
+	Refund(ctx context.Context, reference string, amount money.Money) (Result, error)
+	// Void releases an authorization that was not captured.
+	Void(ctx context.Context, reference string) (Result, error)
+}
+
+// New returns the gateway with the given name.
+func New(name string) (Gateway, error) {
+	switch name {
+	case "fake":
+		return NewFake(), nil
+	}
+	return nil, fmt.Errorf("unknown payment gateway %q", name)
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"hotelm/db"
+	"hotelm/models"
+)
+
+// adminColumns lists the admin columns in the order scanAdmin reads them.
+const adminColumns = `admin_id, name, email, password_hash, created_at`
+
+// scanAdmin reads a row selected with adminColumns.
+func scanAdmin(row rowScanner) (*models.Admin, error) {
+	var admin models.Admin
+	if err := row.Scan(&admin.AdminID, &admin.Name, &admin.Email, &admin.PasswordHash, &admin.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &admin, nil
+}
+
+// CreateAdmin inserts a new administrator
+func CreateAdmin(q db.Querier, admin models.Admin) (int, error) {
+	query := `INSERT INTO admin (name, email, password_hash) VALUES ($1, $2, $3) RETURNING admin_id`
+	var id int
+	if err := q.QueryRow(query, admin.Name, admin.Email, admin.PasswordHash).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to create admin: %v", err)
+	}
+	return id, nil
+}
+
+// GetAdminByID retrieves an administrator by id
+func GetAdminByID(q db.Querier, adminID int) (*models.Admin, error) {
+	query := `SELECT ` + adminColumns + ` FROM admin WHERE admin_id = $1`
+	admin, err := scanAdmin(q.QueryRow(query, adminID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("admin %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("error retrieving admin: %v", err)
+	}
+	return admin, nil
+}
+
+// GetAdminByEmail retrieves an administrator by email, ignoring case
+func GetAdminByEmail(q db.Querier, email string) (*models.Admin, error) {
+	query := `SELECT ` + adminColumns + ` FROM admin WHERE LOWER(email) = LOWER($1)`
+	admin, err := scanAdmin(q.QueryRow(query, email))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("admin %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("error retrieving admin: %v", err)
+	}
+	return admin, nil
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"hotelm/db"
+	"hotelm/models"
+)
+
+// ErrDuplicateAmenity is returned when an amenity is created or renamed with
+// a name whose slug another amenity already has.
+var ErrDuplicateAmenity = errors.New("amenity already exists")
+
+// amenityColumns lists the amenity columns in the order scanAmenity reads
+// them, ending with the number of rooms offering the amenity.
+const amenityColumns = `amenity_id, name, slug,
+	(SELECT COUNT(*) FROM room_amenity WHERE room_amenity.amenity_id = amenity.amenity_id)`
+
+// scanAmenity reads a row selected with amenityColumns.
+func scanAmenity(row rowScanner) (*models.Amenity, error) {
+	var a models.Amenity
+	if err := row.Scan(&a.AmenityID, &a.Name, &a.Slug, &a.Rooms); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// GetAmenities retrieves the amenity catalog, by name
+func GetAmenities(q db.Querier) ([]models.Amenity, error) {
+	query := `SELECT ` + amenityColumns + ` FROM amenity ORDER BY name, amenity_id`
+	rows, err := q.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve amenities: %v", err)
+	}
+	defer rows.Close()
+
+	var amenities []models.Amenity
+	for rows.Next() {
+		a, err := scanAmenity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning amenity: %v", err)
+		}
+		amenities = append(amenities, *a)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading amenities: %v", err)
+	}
+	return amenities, nil
+}
+
+// GetAmenityByID retrieves an amenity by id
+func GetAmenityByID(q db.Querier, amenityID int) (*models.Amenity, error) {
+	query := `SELECT ` + amenityColumns + ` FROM amenity WHERE amenity_id = $1`
+	a, err := scanAmenity(q.QueryRow(query, amenityID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("amenity %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("error retrieving amenity: %v", err)
+	}
+	return a, nil
+}
+
+// CreateAmenity adds an amenity to the catalog
+func CreateAmenity(q db.Querier, a models.Amenity) (int, error) {
+	query := `INSERT INTO amenity (name, slug) VALUES ($1, $2) RETURNING amenity_id`
+	var id int
+	if err := q.QueryRow(query, a.Name, a.Slug).Scan(&id); err != nil {
+		if isUniqueViolation(err) {
+			return 0, ErrDuplicateAmenity
+		}
+		return 0, fmt.Errorf("failed to create amenity: %v", err)
+	}
+	return id, nil
+}
+
+// UpdateAmenity renames an amenity
+func UpdateAmenity(q db.Querier, a models.Amenity) error {
+	query := `UPDATE amenity SET name = $1, slug = $2 WHERE amenity_id = $3`
+	result, err := q.Exec(query, a.Name, a.Slug, a.AmenityID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrDuplicateAmenity
+		}
+		return fmt.Errorf("failed to update amenity: %v", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("amenity %w", ErrNotFound)
+	}
+	return nil
+}
+
+// DeleteAmenity removes an amenity from the catalog and from the rooms
+// offering it
+func DeleteAmenity(q db.Querier, amenityID int) error {
+	query := `DELETE FROM amenity WHERE amenity_id = $1`
+	result, err := q.Exec(query, amenityID)
+	if err != nil {
+		return fmt.Errorf("failed to delete amenity: %v", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("amenity %w", ErrNotFound)
+	}
+	return nil
+}
+
+// SetRoomAmenities replaces the amenities a room offers
+func SetRoomAmenities(q db.Querier, roomID int, amenityIDs []int) error {
+	ids := make([]int64, len(amenityIDs))
+	for i, id := range amenityIDs {
+		ids[i] = int64(id)
+	}
+	query := `DELETE FROM room_amenity WHERE room_id = $1 AND NOT amenity_id = ANY($2::int[])`
+	if _, err := q.Exec(query, roomID, pq.Array(ids)); err != nil {
+		return fmt.Errorf("failed to update room amenities: %v", err)
+	}
+	query = `INSERT INTO room_amenity (room_id, amenity_id) SELECT $1, unnest($2::int[]) ON CONFLICT DO NOTHING`
+	if _, err := q.Exec(query, roomID, pq.Array(ids)); err != nil {
+		return fmt.Errorf("failed to update room amenities: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"fmt"
+
+	"hotelm/db"
+	"hotelm/models"
+)
+
+// CreateAuditEntry records an admin action
+func CreateAuditEntry(q db.Querier, entry models.AuditEntry) error {
+	query := `INSERT INTO audit_log (admin_id, action, target_type, target_id, details) VALUES ($1, $2, $3, $4, $5)`
+	if _, err := q.Exec(query, entry.AdminID, entry.Action, entry.TargetType, entry.TargetID, entry.Details); err != nil {
+		return fmt.Errorf("failed to record audit entry: %v", err)
+	}
+	return nil
+}
+
+// GetAuditEntries retrieves the most recent admin actions, newest first
+func GetAuditEntries(q db.Querier, limit int) ([]models.AuditEntry, error) {
+	query := `SELECT audit_id, COALESCE(admin_id, 0), action, target_type, target_id, details, created_at
+		FROM audit_log ORDER BY created_at DESC, audit_id DESC LIMIT $1`
+	rows, err := q.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve audit log: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var entry models.AuditEntry
+		if err := rows.Scan(&entry.AuditID, &entry.AdminID, &entry.Action, &entry.TargetType, &entry.TargetID, &entry.Details, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning audit entry: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading audit log: %v", err)
+	}
+	return entries, nil
+}
@@ -4,69 +4,184 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+
+	"github.com/lib/pq"
+
 	"hotelm/db"
 	"hotelm/models"
 )
 
+// ErrRoomUnavailable is returned when a booking overlaps an existing booking
+// for the same room. The database enforces this with an exclusion constraint.
+var ErrRoomUnavailable = errors.New("room is not available for the selected dates")
+
+// exclusionViolation is the PostgreSQL error code for a violated exclusion constraint.
+const exclusionViolation = "23P01"
+
+// bookingColumns lists the booking columns in the order scanBooking reads them,
+// followed by the timezone of the room's property.
+const bookingColumns = `booking_id, booking_date, checkin_date, checkout_date, payment_status, status, room_id, customer_id, nights, nightly_rate, total_amount, currency, cancel_free_days, cancel_penalty_percent, non_refundable, COALESCE(display_currency, ''), display_rate,
+	(SELECT p.timezone FROM room r JOIN property p ON p.property_id = r.property_id WHERE r.room_id = booking.room_id)`
+
+// scanBooking reads a row selected with bookingColumns.
+func scanBooking(row rowScanner) (*models.Booking, error) {
+	var booking models.Booking
+	var currency string
+	err := row.Scan(&booking.BookingID, &booking.BookingDate, &booking.CheckinDate, &booking.CheckoutDate, &booking.PaymentStatus, &booking.Status, &booking.RoomID, &booking.CustomerID, &booking.Nights, &booking.NightlyRate, &booking.TotalAmount, &currency,
+		&booking.CancellationPolicy.FreeDays, &booking.CancellationPolicy.PenaltyPercent, &booking.CancellationPolicy.NonRefundable,
+		&booking.DisplayCurrency, &booking.DisplayRate, &booking.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	booking.NightlyRate.Currency = currency
+	booking.TotalAmount.Currency = currency
+	return &booking, nil
+}
+
 // CreateBooking inserts a new booking into the database
-func CreateBooking(booking models.Booking) (int, error) {
-	query := `INSERT INTO booking (booking_date, checkin_date, checkout_date, payment_status, room_id, customer_id) 
-		VALUES ($1, $2, $3, $4, $5, $6) RETURNING booking_id`
+func CreateBooking(q db.Querier, booking models.Booking) (int, error) {
+	query := `INSERT INTO booking (booking_date, checkin_date, checkout_date, payment_status, status, room_id, customer_id, nights, nightly_rate, total_amount, currency,
+			cancel_free_days, cancel_penalty_percent, non_refundable, display_currency, display_rate) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, NULLIF($15, ''), $16) RETURNING booking_id`
 	var id int
-	err := db.DB.QueryRow(query, booking.BookingDate, booking.CheckinDate, booking.CheckoutDate, booking.PaymentStatus, booking.RoomID, booking.CustomerID).Scan(&id)
+	policy := booking.CancellationPolicy
+	err := q.QueryRow(query, booking.BookingDate, booking.CheckinDate, booking.CheckoutDate, booking.PaymentStatus, booking.Status, booking.RoomID, booking.CustomerID, booking.Nights, booking.NightlyRate, booking.TotalAmount, booking.TotalAmount.Currency,
+		policy.FreeDays, policy.PenaltyPercent, policy.NonRefundable, booking.DisplayCurrency, booking.DisplayRate).Scan(&id)
 	if err != nil {
+		if isExclusionViolation(err) {
+			return 0, ErrRoomUnavailable
+		}
 		return 0, fmt.Errorf("failed to create booking: %v", err)
 	}
 	return id, nil
 }
 
 // GetBookingByID retrieves a booking by ID
-func GetBookingByID(bookingID int) (*models.Booking, error) {
-	query := `SELECT booking_id, booking_date, checkin_date, checkout_date, payment_status, room_id, customer_id FROM booking WHERE booking_id = $1`
-	var booking models.Booking
+func GetBookingByID(q db.Querier, bookingID int) (*models.Booking, error) {
+	query := `SELECT ` + bookingColumns + ` FROM booking WHERE booking_id = $1`
+	booking, err := scanBooking(q.QueryRow(query, bookingID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("booking %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("error retrieving booking: %v", err)
+	}
+	return booking, nil
+}
 
-	err := db.DB.QueryRow(query, bookingID).Scan(&booking.BookingID, &booking.BookingDate, &booking.CheckinDate, &booking.CheckoutDate, &booking.PaymentStatus, &booking.RoomID, &booking.CustomerID)
+// GetBookingByIDForUpdate retrieves a booking by ID and locks it until the
+// surrounding transaction ends
+func GetBookingByIDForUpdate(q db.Querier, bookingID int) (*models.Booking, error) {
+	query := `SELECT ` + bookingColumns + ` FROM booking WHERE booking_id = $1 FOR UPDATE`
+	booking, err := scanBooking(q.QueryRow(query, bookingID))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("booking not found")
+			return nil, fmt.Errorf("booking %w", ErrNotFound)
 		}
 		return nil, fmt.Errorf("error retrieving booking: %v", err)
 	}
-	return &booking, nil
+	return booking, nil
+}
+
+// UpdateBookingPaymentStatus sets the payment status of a booking
+func UpdateBookingPaymentStatus(q db.Querier, bookingID int, status string) error {
+	query := `UPDATE booking SET payment_status = $1 WHERE booking_id = $2`
+	result, err := q.Exec(query, status, bookingID)
+	if err != nil {
+		return fmt.Errorf("failed to update booking payment status: %v", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("booking %w", ErrNotFound)
+	}
+	return nil
+}
+
+// UpdateBookingStatus sets the lifecycle status of a booking
+func UpdateBookingStatus(q db.Querier, bookingID int, status string) error {
+	query := `UPDATE booking SET status = $1 WHERE booking_id = $2`
+	result, err := q.Exec(query, status, bookingID)
+	if err != nil {
+		return fmt.Errorf("failed to update booking status: %v", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("booking %w", ErrNotFound)
+	}
+	return nil
 }
 
-// UpdateBooking updates an existing booking
-func UpdateBooking(booking models.Booking) error {
+// CreateBookingStatusEvent records a status change of a booking
+func CreateBookingStatusEvent(q db.Querier, event models.BookingStatusEvent) error {
+	query := `INSERT INTO booking_status_event (booking_id, from_status, to_status, actor_role, actor_id, reason)
+		VALUES ($1, NULLIF($2, ''), $3, $4, NULLIF($5, 0), $6)`
+	if _, err := q.Exec(query, event.BookingID, event.FromStatus, event.ToStatus, event.ActorRole, event.ActorID, event.Reason); err != nil {
+		return fmt.Errorf("failed to record booking status change: %v", err)
+	}
+	return nil
+}
+
+// GetBookingStatusEvents retrieves the status history of a booking, oldest first
+func GetBookingStatusEvents(q db.Querier, bookingID int) ([]models.BookingStatusEvent, error) {
+	query := `SELECT event_id, booking_id, COALESCE(from_status, ''), to_status, actor_role, COALESCE(actor_id, 0), reason, created_at
+		FROM booking_status_event WHERE booking_id = $1 ORDER BY event_id`
+	rows, err := q.Query(query, bookingID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve booking history: %v", err)
+	}
+	defer rows.Close()
+
+	var events []models.BookingStatusEvent
+	for rows.Next() {
+		var e models.BookingStatusEvent
+		if err := rows.Scan(&e.EventID, &e.BookingID, &e.FromStatus, &e.ToStatus, &e.ActorRole, &e.ActorID, &e.Reason, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning booking status event: %v", err)
+		}
+		events = append(events, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading booking history: %v", err)
+	}
+	return events, nil
+}
+
+// UpdateBooking updates an existing booking. The stored price of a booking is
+// fixed when it is created and is not changed here.
+func UpdateBooking(q db.Querier, booking models.Booking) error {
 	query := `UPDATE booking SET booking_date = $1, checkin_date = $2, checkout_date = $3, payment_status = $4, room_id = $5, customer_id = $6 WHERE booking_id = $7`
-	result, err := db.DB.Exec(query, booking.BookingDate, booking.CheckinDate, booking.CheckoutDate, booking.PaymentStatus, booking.RoomID, booking.CustomerID, booking.BookingID)
+	result, err := q.Exec(query, booking.BookingDate, booking.CheckinDate, booking.CheckoutDate, booking.PaymentStatus, booking.RoomID, booking.CustomerID, booking.BookingID)
 	if err != nil {
+		if isExclusionViolation(err) {
+			return ErrRoomUnavailable
+		}
 		return fmt.Errorf("failed to update booking: %v", err)
 	}
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
-		return fmt.Errorf("booking not found")
+		return fmt.Errorf("booking %w", ErrNotFound)
 	}
 	return nil
 }
 
 // DeleteBooking removes a booking by ID
-func DeleteBooking(bookingID int) error {
+func DeleteBooking(q db.Querier, bookingID int) error {
 	query := `DELETE FROM booking WHERE booking_id = $1`
-	result, err := db.DB.Exec(query, bookingID)
+	result, err := q.Exec(query, bookingID)
 	if err != nil {
 		return fmt.Errorf("failed to delete booking: %v", err)
 	}
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
-		return fmt.Errorf("booking not found")
+		return fmt.Errorf("booking %w", ErrNotFound)
 	}
 	return nil
 }
 
 // GetBookingsByCustomerID retrieves all bookings made by a specific customer
-func GetBookingsByCustomerID(customerID int) ([]models.Booking, error) {
-	query := `SELECT booking_id, booking_date, checkin_date, checkout_date, payment_status, room_id, customer_id FROM booking WHERE customer_id = $1`
-	rows, err := db.DB.Query(query, customerID)
+func GetBookingsByCustomerID(q db.Querier, customerID int) ([]models.Booking, error) {
+	query := `SELECT ` + bookingColumns + ` FROM booking WHERE customer_id = $1`
+	rows, err := q.Query(query, customerID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve bookings: %v", err)
 	}
@@ -74,15 +189,111 @@ func GetBookingsByCustomerID(customerID int) ([]models.Booking, error) {
 
 	var bookings []models.Booking
 	for rows.Next() {
-		var booking models.Booking
-		if err := rows.Scan(&booking.BookingID, &booking.BookingDate, &booking.CheckinDate, &booking.CheckoutDate, &booking.PaymentStatus, &booking.RoomID, &booking.CustomerID); err != nil {
+		booking, err := scanBooking(rows)
+		if err != nil {
 			return nil, fmt.Errorf("error scanning booking: %v", err)
 		}
-		bookings = append(bookings, booking)
+		bookings = append(bookings, *booking)
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, fmt.Errorf("error reading bookings: %v", err)
 	}
 	return bookings, nil
-}
\ No newline at end of file
+}
+
+// GetBookingsByVendorID retrieves the bookings of a vendor's rooms, by
+// check-in date
+func GetBookingsByVendorID(q db.Querier, vendorID int) ([]models.Booking, error) {
+	query := `SELECT ` + bookingColumns + ` FROM booking
+		WHERE room_id IN (SELECT room_id FROM room WHERE vendor_id = $1)
+		ORDER BY checkin_date, booking_id`
+	rows, err := q.Query(query, vendorID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve bookings: %v", err)
+	}
+	defer rows.Close()
+
+	var bookings []models.Booking
+	for rows.Next() {
+		booking, err := scanBooking(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning booking: %v", err)
+		}
+		bookings = append(bookings, *booking)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading bookings: %v", err)
+	}
+	return bookings, nil
+}
+
+// GetAllBookings retrieves every booking, newest first
+func GetAllBookings(q db.Querier) ([]models.Booking, error) {
+	query := `SELECT ` + bookingColumns + ` FROM booking ORDER BY booking_date DESC, booking_id DESC`
+	rows, err := q.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve bookings: %v", err)
+	}
+	defer rows.Close()
+
+	var bookings []models.Booking
+	for rows.Next() {
+		booking, err := scanBooking(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning booking: %v", err)
+		}
+		bookings = append(bookings, *booking)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading bookings: %v", err)
+	}
+	return bookings, nil
+}
+
+// CreateBookingLineItems stores the itemized price of a booking. The amounts
+// are in the booking's currency.
+func CreateBookingLineItems(q db.Querier, bookingID int, items []models.BookingLineItem) error {
+	query := `INSERT INTO booking_line_item (booking_id, position, kind, description, amount) VALUES ($1, $2, $3, $4, $5)`
+	for i, item := range items {
+		if _, err := q.Exec(query, bookingID, i, item.Kind, item.Description, item.Amount); err != nil {
+			return fmt.Errorf("failed to create booking line item: %v", err)
+		}
+	}
+	return nil
+}
+
+// GetBookingLineItems retrieves the itemized price of a booking
+func GetBookingLineItems(q db.Querier, bookingID int) ([]models.BookingLineItem, error) {
+	query := `SELECT li.line_item_id, li.booking_id, li.kind, li.description, li.amount, b.currency
+		FROM booking_line_item li
+		JOIN booking b ON b.booking_id = li.booking_id
+		WHERE li.booking_id = $1 ORDER BY li.position`
+	rows, err := q.Query(query, bookingID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve booking line items: %v", err)
+	}
+	defer rows.Close()
+
+	var items []models.BookingLineItem
+	for rows.Next() {
+		var item models.BookingLineItem
+		if err := rows.Scan(&item.LineItemID, &item.BookingID, &item.Kind, &item.Description, &item.Amount, &item.Amount.Currency); err != nil {
+			return nil, fmt.Errorf("error scanning booking line item: %v", err)
+		}
+		items = append(items, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading booking line items: %v", err)
+	}
+	return items, nil
+}
+
+// isExclusionViolation reports whether err is a PostgreSQL exclusion constraint violation
+func isExclusionViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == exclusionViolation
+}
@@ -9,11 +9,23 @@ import (
 	
 )
 
+// customerColumns lists the customer columns in the order scanCustomer reads them.
+const customerColumns = `customer_id, name, COALESCE(phone, ''), email, COALESCE(address, ''), COALESCE(password_hash, ''), suspended_at, COALESCE(display_currency, '')`
+
+// scanCustomer reads a row selected with customerColumns.
+func scanCustomer(row rowScanner) (*models.Customer, error) {
+	var customer models.Customer
+	if err := row.Scan(&customer.CustomerID, &customer.Name, &customer.Phone, &customer.Email, &customer.Address, &customer.PasswordHash, &customer.SuspendedAt, &customer.DisplayCurrency); err != nil {
+		return nil, err
+	}
+	return &customer, nil
+}
+
 // CreateCustomer inserts a new customer into the database
-func CreateCustomer(customer models.Customer) (int, error) {
-	query := `INSERT INTO customer (name, phone, email, address) VALUES ($1, $2, $3, $4) RETURNING customer_id`
+func CreateCustomer(q db.Querier, customer models.Customer) (int, error) {
+	query := `INSERT INTO customer (name, phone, email, address, password_hash) VALUES ($1, $2, $3, $4, NULLIF($5, '')) RETURNING customer_id`
 	var id int
-	err := db.DB.QueryRow(query, customer.Name, customer.Phone, customer.Email, customer.Address).Scan(&id)
+	err := q.QueryRow(query, customer.Name, customer.Phone, customer.Email, customer.Address, customer.PasswordHash).Scan(&id)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create customer: %v", err)
 	}
@@ -21,52 +33,94 @@ func CreateCustomer(customer models.Customer) (int, error) {
 }
 
 // GetCustomerByID retrieves a customer by id
-func GetCustomerByID(customerID int) (*models.Customer, error) {
-	query := `SELECT customer_id, name, phone, email, address FROM customer WHERE customer_id = $1`
-	var customer models.Customer
+func GetCustomerByID(q db.Querier, customerID int) (*models.Customer, error) {
+	query := `SELECT ` + customerColumns + ` FROM customer WHERE customer_id = $1`
+	customer, err := scanCustomer(q.QueryRow(query, customerID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("customer %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("error retrieving customer: %v", err)
+	}
+	return customer, nil
+}
 
-	err := db.DB.QueryRow(query, customerID).Scan(&customer.CustomerID, &customer.Name, &customer.Phone, &customer.Email, &customer.Address)
+// GetCustomerByEmail retrieves a customer by email, ignoring case
+func GetCustomerByEmail(q db.Querier, email string) (*models.Customer, error) {
+	query := `SELECT ` + customerColumns + ` FROM customer WHERE LOWER(email) = LOWER($1)`
+	customer, err := scanCustomer(q.QueryRow(query, email))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("customer not found")
+			return nil, fmt.Errorf("customer %w", ErrNotFound)
 		}
 		return nil, fmt.Errorf("error retrieving customer: %v", err)
 	}
-	return &customer, nil
+	return customer, nil
+}
+
+// SetCustomerPassword stores the first password hash of a customer. It reports
+// ErrNotFound if there is no such customer without a password, so that two
+// requests cannot both set it.
+func SetCustomerPassword(q db.Querier, customerID int, passwordHash string) error {
+	query := `UPDATE customer SET password_hash = $1 WHERE customer_id = $2 AND password_hash IS NULL`
+	result, err := q.Exec(query, passwordHash, customerID)
+	if err != nil {
+		return fmt.Errorf("failed to set customer password: %v", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("customer without a password %w", ErrNotFound)
+	}
+	return nil
+}
+
+// SetCustomerDisplayCurrency stores the currency a customer wants prices
+// shown in; an empty currency shows them in each room's currency
+func SetCustomerDisplayCurrency(q db.Querier, customerID int, currency string) error {
+	query := `UPDATE customer SET display_currency = NULLIF($1, '') WHERE customer_id = $2`
+	result, err := q.Exec(query, currency, customerID)
+	if err != nil {
+		return fmt.Errorf("failed to set display currency: %v", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("customer %w", ErrNotFound)
+	}
+	return nil
 }
 
 // UpdateCustomer updates an existing customer
-func UpdateCustomer(customer models.Customer) error {
+func UpdateCustomer(q db.Querier, customer models.Customer) error {
 	query := `UPDATE customer SET name = $1, phone = $2, email = $3, address = $4 WHERE customer_id = $5`
-	result, err := db.DB.Exec(query, customer.Name, customer.Phone, customer.Email, customer.Address, customer.CustomerID)
+	result, err := q.Exec(query, customer.Name, customer.Phone, customer.Email, customer.Address, customer.CustomerID)
 	if err != nil {
 		return fmt.Errorf("failed to update customer: %v", err)
 	}
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
-		return fmt.Errorf("customer not found")
+		return fmt.Errorf("customer %w", ErrNotFound)
 	}
 	return nil
 }
 
 // DeleteCustomer removes a customer by id
-func DeleteCustomer(customerID int) error {
+func DeleteCustomer(q db.Querier, customerID int) error {
 	query := `DELETE FROM customer WHERE customer_id = $1`
-	result, err := db.DB.Exec(query, customerID)
+	result, err := q.Exec(query, customerID)
 	if err != nil {
 		return fmt.Errorf("failed to delete customer: %v", err)
 	}
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
-		return fmt.Errorf("customer not found")
+		return fmt.Errorf("customer %w", ErrNotFound)
 	}
 	return nil
 }
 
 // GetAllCustomers retrieves all customers
-func GetAllCustomers() ([]models.Customer, error) {
-	query := `SELECT customer_id, name, phone, email, address FROM customer`
-	rows, err := db.DB.Query(query)
+func GetAllCustomers(q db.Querier) ([]models.Customer, error) {
+	query := `SELECT ` + customerColumns + ` FROM customer ORDER BY customer_id`
+	rows, err := q.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve customers: %v", err)
 	}
@@ -74,11 +128,11 @@ func GetAllCustomers() ([]models.Customer, error) {
 
 	var customers []models.Customer
 	for rows.Next() {
-		var customer models.Customer
-		if err := rows.Scan(&customer.CustomerID, &customer.Name, &customer.Phone, &customer.Email, &customer.Address); err != nil {
+		customer, err := scanCustomer(rows)
+		if err != nil {
 			return nil, fmt.Errorf("error scanning customer: %v", err)
 		}
-		customers = append(customers, customer)
+		customers = append(customers, *customer)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -86,3 +140,43 @@ func GetAllCustomers() ([]models.Customer, error) {
 	}
 	return customers, nil
 }
+
+// SearchCustomers retrieves the customers whose name or email contains term, ignoring case
+func SearchCustomers(q db.Querier, term string) ([]models.Customer, error) {
+	query := `SELECT ` + customerColumns + ` FROM customer
+		WHERE name ILIKE ('%' || $1 || '%') OR email ILIKE ('%' || $1 || '%')
+		ORDER BY customer_id`
+	rows, err := q.Query(query, term)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search customers: %v", err)
+	}
+	defer rows.Close()
+
+	var customers []models.Customer
+	for rows.Next() {
+		customer, err := scanCustomer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning customer: %v", err)
+		}
+		customers = append(customers, *customer)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading customers: %v", err)
+	}
+	return customers, nil
+}
+
+// SetCustomerSuspended suspends a customer, or lifts the suspension
+func SetCustomerSuspended(q db.Querier, customerID int, suspended bool) error {
+	query := `UPDATE customer SET suspended_at = CASE WHEN $1 THEN COALESCE(suspended_at, CURRENT_TIMESTAMP) END WHERE customer_id = $2`
+	result, err := q.Exec(query, suspended, customerID)
+	if err != nil {
+		return fmt.Errorf("failed to update customer suspension: %v", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("customer %w", ErrNotFound)
+	}
+	return nil
+}
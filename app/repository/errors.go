@@ -0,0 +1,7 @@
+package repository
+
+import "errors"
+
+// ErrNotFound is wrapped by the "not found" errors returned by this package,
+// so callers can test for a missing row with errors.Is.
+var ErrNotFound = errors.New("not found")
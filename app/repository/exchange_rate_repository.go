@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"fmt"
+
+	"hotelm/db"
+	"hotelm/models"
+)
+
+// GetExchangeRates retrieves every exchange rate, by currency
+func GetExchangeRates(q db.Querier) ([]models.ExchangeRate, error) {
+	query := `SELECT currency, rate, source, updated_at FROM exchange_rate ORDER BY currency`
+	rows, err := q.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve exchange rates: %v", err)
+	}
+	defer rows.Close()
+
+	var rates []models.ExchangeRate
+	for rows.Next() {
+		var rate models.ExchangeRate
+		if err := rows.Scan(&rate.Currency, &rate.Rate, &rate.Source, &rate.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning exchange rate: %v", err)
+		}
+		rates = append(rates, rate)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading exchange rates: %v", err)
+	}
+	return rates, nil
+}
+
+// SetExchangeRate creates or replaces the exchange rate of a currency
+func SetExchangeRate(q db.Querier, rate models.ExchangeRate) error {
+	query := `INSERT INTO exchange_rate (currency, rate, source) VALUES ($1, $2, $3)
+		ON CONFLICT (currency) DO UPDATE SET rate = EXCLUDED.rate, source = EXCLUDED.source, updated_at = CURRENT_TIMESTAMP`
+	if _, err := q.Exec(query, rate.Currency, rate.Rate, rate.Source); err != nil {
+		return fmt.Errorf("failed to save exchange rate: %v", err)
+	}
+	return nil
+}
+
+// DeleteExchangeRate removes the exchange rate of a currency
+func DeleteExchangeRate(q db.Querier, currency string) error {
+	query := `DELETE FROM exchange_rate WHERE currency = $1`
+	result, err := q.Exec(query, currency)
+	if err != nil {
+		return fmt.Errorf("failed to delete exchange rate: %v", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("exchange rate %w", ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"hotelm/db"
+	"hotelm/models"
+)
+
+// ClaimIdempotencyKey records a new request under its key. It reports false
+// if the owner already used the key.
+func ClaimIdempotencyKey(q db.Querier, owner, key, fingerprint string) (bool, error) {
+	query := `INSERT INTO idempotency_key (owner, idem_key, fingerprint) VALUES ($1, $2, $3)
+		ON CONFLICT (owner, idem_key) DO NOTHING`
+	result, err := q.Exec(query, owner, key, fingerprint)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim idempotency key: %v", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected == 1, nil
+}
+
+// GetIdempotencyKey retrieves the request recorded under a key
+func GetIdempotencyKey(q db.Querier, owner, key string) (*models.IdempotencyRecord, error) {
+	query := `SELECT owner, idem_key, fingerprint, COALESCE(response_status, 0), response_type, response_location,
+			COALESCE(response_body, ''::bytea), created_at
+		FROM idempotency_key WHERE owner = $1 AND idem_key = $2`
+	var rec models.IdempotencyRecord
+	err := q.QueryRow(query, owner, key).Scan(&rec.Owner, &rec.Key, &rec.Fingerprint, &rec.ResponseStatus,
+		&rec.ResponseType, &rec.ResponseLocation, &rec.ResponseBody, &rec.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("idempotency key %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("error retrieving idempotency key: %v", err)
+	}
+	return &rec, nil
+}
+
+// SaveIdempotentResponse stores the response of the request recorded under a key
+func SaveIdempotentResponse(q db.Querier, rec models.IdempotencyRecord) error {
+	query := `UPDATE idempotency_key SET response_status = $1, response_type = $2, response_location = $3, response_body = $4
+		WHERE owner = $5 AND idem_key = $6`
+	if _, err := q.Exec(query, rec.ResponseStatus, rec.ResponseType, rec.ResponseLocation, rec.ResponseBody, rec.Owner, rec.Key); err != nil {
+		return fmt.Errorf("failed to save idempotent response: %v", err)
+	}
+	return nil
+}
+
+// DeleteIdempotencyKey forgets a key so the request can be sent again
+func DeleteIdempotencyKey(q db.Querier, owner, key string) error {
+	if _, err := q.Exec(`DELETE FROM idempotency_key WHERE owner = $1 AND idem_key = $2`, owner, key); err != nil {
+		return fmt.Errorf("failed to delete idempotency key: %v", err)
+	}
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys forgets the keys recorded before a time
+func DeleteExpiredIdempotencyKeys(q db.Querier, before time.Time) error {
+	if _, err := q.Exec(`DELETE FROM idempotency_key WHERE created_at < $1`, before); err != nil {
+		return fmt.Errorf("failed to delete expired idempotency keys: %v", err)
+	}
+	return nil
+}
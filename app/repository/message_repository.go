@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"hotelm/db"
+	"hotelm/models"
+)
+
+// Sides of a message thread, matching message.sender_role.
+const (
+	SideCustomer = "customer"
+	SideVendor   = "vendor"
+)
+
+// threadColumns lists the thread columns in the order scanThread reads them.
+// The unread count is selected separately by each query.
+const threadColumns = `t.thread_id, t.customer_id, t.vendor_id, t.booking_id, t.subject, t.created_at, t.last_message_at`
+
+// unreadColumn counts the messages of thread t sent by the other side after
+// the last one the given side has read.
+func unreadColumn(side string) string {
+	other := SideVendor
+	if side == SideVendor {
+		other = SideCustomer
+	}
+	return `(SELECT COUNT(*) FROM message m WHERE m.thread_id = t.thread_id
+		AND m.sender_role = '` + other + `' AND m.message_id > t.` + side + `_last_read_id)`
+}
+
+// scanThread reads a row selected with threadColumns followed by an unread
+// count.
+func scanThread(row rowScanner) (*models.MessageThread, error) {
+	var thread models.MessageThread
+	var bookingID sql.NullInt64
+	if err := row.Scan(&thread.ThreadID, &thread.CustomerID, &thread.VendorID, &bookingID, &thread.Subject, &thread.CreatedAt, &thread.LastMessageAt, &thread.Unread); err != nil {
+		return nil, err
+	}
+	thread.BookingID = intPtr(bookingID)
+	return &thread, nil
+}
+
+// CreateThread inserts a new message thread
+func CreateThread(q db.Querier, thread models.MessageThread) (int, error) {
+	query := `INSERT INTO message_thread (customer_id, vendor_id, booking_id, subject) VALUES ($1, $2, $3, $4) RETURNING thread_id`
+	var id int
+	if err := q.QueryRow(query, thread.CustomerID, thread.VendorID, thread.BookingID, thread.Subject).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to create thread: %v", err)
+	}
+	return id, nil
+}
+
+// GetThreadByID retrieves a thread with the number of messages unread by the
+// given side
+func GetThreadByID(q db.Querier, threadID int, side string) (*models.MessageThread, error) {
+	query := `SELECT ` + threadColumns + `, ` + unreadColumn(side) + ` FROM message_thread t WHERE t.thread_id = $1`
+	thread, err := scanThread(q.QueryRow(query, threadID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("thread %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("error retrieving thread: %v", err)
+	}
+	return thread, nil
+}
+
+// GetThreadsForParticipant retrieves the threads of a customer or vendor,
+// most recently active first
+func GetThreadsForParticipant(q db.Querier, side string, id int) ([]models.MessageThread, error) {
+	query := `SELECT ` + threadColumns + `, ` + unreadColumn(side) + ` FROM message_thread t
+		WHERE t.` + side + `_id = $1 ORDER BY t.last_message_at DESC, t.thread_id DESC`
+	return queryThreads(q, query, id)
+}
+
+// GetAllThreads retrieves every thread, most recently active first. Unread
+// counts are not computed.
+func GetAllThreads(q db.Querier) ([]models.MessageThread, error) {
+	query := `SELECT ` + threadColumns + `, 0 FROM message_thread t ORDER BY t.last_message_at DESC, t.thread_id DESC`
+	return queryThreads(q, query)
+}
+
+// queryThreads runs a thread query and scans the results.
+func queryThreads(q db.Querier, query string, args ...interface{}) ([]models.MessageThread, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve threads: %v", err)
+	}
+	defer rows.Close()
+
+	var threads []models.MessageThread
+	for rows.Next() {
+		thread, err := scanThread(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning thread: %v", err)
+		}
+		threads = append(threads, *thread)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading threads: %v", err)
+	}
+	return threads, nil
+}
+
+// CountUnreadMessages returns the number of messages a customer or vendor
+// has not read, over all their threads
+func CountUnreadMessages(q db.Querier, side string, id int) (int, error) {
+	query := `SELECT COALESCE(SUM(` + unreadColumn(side) + `), 0) FROM message_thread t WHERE t.` + side + `_id = $1`
+	var count int
+	if err := q.QueryRow(query, id).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count unread messages: %v", err)
+	}
+	return count, nil
+}
+
+// CreateMessage adds a message to a thread and marks the thread as active
+func CreateMessage(q db.Querier, message models.Message) (int, error) {
+	query := `INSERT INTO message (thread_id, sender_role, body) VALUES ($1, $2, $3) RETURNING message_id`
+	var id int
+	if err := q.QueryRow(query, message.ThreadID, message.SenderRole, message.Body).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to create message: %v", err)
+	}
+	// The sender has read their own message.
+	update := `UPDATE message_thread SET last_message_at = CURRENT_TIMESTAMP, ` + message.SenderRole + `_last_read_id = $1 WHERE thread_id = $2`
+	if _, err := q.Exec(update, id, message.ThreadID); err != nil {
+		return 0, fmt.Errorf("failed to update thread: %v", err)
+	}
+	return id, nil
+}
+
+// GetMessagesByThreadID retrieves the messages of a thread, oldest first
+func GetMessagesByThreadID(q db.Querier, threadID int) ([]models.Message, error) {
+	query := `SELECT message_id, thread_id, sender_role, body, created_at FROM message WHERE thread_id = $1 ORDER BY message_id`
+	rows, err := q.Query(query, threadID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve messages: %v", err)
+	}
+	defer rows.Close()
+
+	var messages []models.Message
+	for rows.Next() {
+		var message models.Message
+		if err := rows.Scan(&message.MessageID, &message.ThreadID, &message.SenderRole, &message.Body, &message.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning message: %v", err)
+		}
+		messages = append(messages, message)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading messages: %v", err)
+	}
+	return messages, nil
+}
+
+// MarkThreadRead records that a side has read a thread up to a message. The
+// read position never moves backwards.
+func MarkThreadRead(q db.Querier, threadID int, side string, messageID int) error {
+	query := `UPDATE message_thread SET ` + side + `_last_read_id = GREATEST(` + side + `_last_read_id, $1) WHERE thread_id = $2`
+	if _, err := q.Exec(query, messageID, threadID); err != nil {
+		return fmt.Errorf("failed to mark thread read: %v", err)
+	}
+	return nil
+}
@@ -6,14 +6,29 @@ import (
 	"fmt"
 	"hotelm/db"
 	"hotelm/models"
+	"hotelm/money"
+	"time"
 )
 
+// paymentColumns lists the payment columns in the order scanPayment reads them.
+const paymentColumns = `payment_id, payment_method, payment_status, transaction_date, amount, currency, booking_id, gateway, gateway_ref`
+
+// scanPayment reads a row selected with paymentColumns.
+func scanPayment(row rowScanner) (*models.Payment, error) {
+	var payment models.Payment
+	err := row.Scan(&payment.PaymentID, &payment.PaymentMethod, &payment.PaymentStatus, &payment.TransactionDate, &payment.Amount, &payment.Amount.Currency, &payment.BookingID, &payment.Gateway, &payment.GatewayRef)
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
 // CreatePayment inserts a new payment into the database
-func CreatePayment(payment models.Payment) (int, error) {
-	query := `INSERT INTO payment (payment_method, payment_status, transaction_date, amount, booking_id) 
-		VALUES ($1, $2, $3, $4, $5) RETURNING payment_id`
+func CreatePayment(q db.Querier, payment models.Payment) (int, error) {
+	query := `INSERT INTO payment (payment_method, payment_status, transaction_date, amount, currency, booking_id, gateway, gateway_ref) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING payment_id`
 	var id int
-	err := db.DB.QueryRow(query, payment.PaymentMethod, payment.PaymentStatus, payment.TransactionDate, payment.Amount, payment.BookingID).Scan(&id)
+	err := q.QueryRow(query, payment.PaymentMethod, payment.PaymentStatus, payment.TransactionDate, payment.Amount, payment.Amount.Currency, payment.BookingID, payment.Gateway, payment.GatewayRef).Scan(&id)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create payment: %v", err)
 	}
@@ -21,52 +36,127 @@ func CreatePayment(payment models.Payment) (int, error) {
 }
 
 // GetPaymentByID retrieves a payment by ID
-func GetPaymentByID(paymentID int) (*models.Payment, error) {
-	query := `SELECT payment_id, payment_method, payment_status, transaction_date, amount, booking_id FROM payment WHERE payment_id = $1`
-	var payment models.Payment
-
-	err := db.DB.QueryRow(query, paymentID).Scan(&payment.PaymentID, &payment.PaymentMethod, &payment.PaymentStatus, &payment.TransactionDate, &payment.Amount, &payment.BookingID)
+func GetPaymentByID(q db.Querier, paymentID int) (*models.Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payment WHERE payment_id = $1`
+	payment, err := scanPayment(q.QueryRow(query, paymentID))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("payment not found")
+			return nil, fmt.Errorf("payment %w", ErrNotFound)
 		}
 		return nil, fmt.Errorf("error retrieving payment: %v", err)
 	}
-	return &payment, nil
+	return payment, nil
 }
 
 // UpdatePayment updates an existing payment
-func UpdatePayment(payment models.Payment) error {
-	query := `UPDATE payment SET payment_method = $1, payment_status = $2, transaction_date = $3, amount = $4, booking_id = $5 WHERE payment_id = $6`
-	result, err := db.DB.Exec(query, payment.PaymentMethod, payment.PaymentStatus, payment.TransactionDate, payment.Amount, payment.BookingID, payment.PaymentID)
+func UpdatePayment(q db.Querier, payment models.Payment) error {
+	query := `UPDATE payment SET payment_method = $1, payment_status = $2, transaction_date = $3, amount = $4, currency = $5, booking_id = $6 WHERE payment_id = $7`
+	result, err := q.Exec(query, payment.PaymentMethod, payment.PaymentStatus, payment.TransactionDate, payment.Amount, payment.Amount.Currency, payment.BookingID, payment.PaymentID)
 	if err != nil {
 		return fmt.Errorf("failed to update payment: %v", err)
 	}
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
-		return fmt.Errorf("payment not found")
+		return fmt.Errorf("payment %w", ErrNotFound)
+	}
+	return nil
+}
+
+// UpdatePaymentStatus sets the status of a payment
+func UpdatePaymentStatus(q db.Querier, paymentID int, status string) error {
+	query := `UPDATE payment SET payment_status = $1 WHERE payment_id = $2`
+	result, err := q.Exec(query, status, paymentID)
+	if err != nil {
+		return fmt.Errorf("failed to update payment status: %v", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("payment %w", ErrNotFound)
+	}
+	return nil
+}
+
+// SettlePayment sets the status and gateway reference of a pending payment
+// once the gateway has answered
+func SettlePayment(q db.Querier, paymentID int, status, gatewayRef string) error {
+	query := `UPDATE payment SET payment_status = $1, gateway_ref = $2 WHERE payment_id = $3 AND payment_status = 'Pending'`
+	result, err := q.Exec(query, status, gatewayRef, paymentID)
+	if err != nil {
+		return fmt.Errorf("failed to settle payment: %v", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("pending payment %w", ErrNotFound)
+	}
+	return nil
+}
+
+// SettleVoid marks a payment being voided as 'Voided' once the gateway has
+// released its charge
+func SettleVoid(q db.Querier, paymentID int) error {
+	query := `UPDATE payment SET payment_status = 'Voided' WHERE payment_id = $1 AND payment_status = 'Voiding'`
+	result, err := q.Exec(query, paymentID)
+	if err != nil {
+		return fmt.Errorf("failed to settle void: %v", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("voiding payment %w", ErrNotFound)
 	}
 	return nil
 }
 
 // DeletePayment removes a payment by ID
-func DeletePayment(paymentID int) error {
+func DeletePayment(q db.Querier, paymentID int) error {
 	query := `DELETE FROM payment WHERE payment_id = $1`
-	result, err := db.DB.Exec(query, paymentID)
+	result, err := q.Exec(query, paymentID)
 	if err != nil {
 		return fmt.Errorf("failed to delete payment: %v", err)
 	}
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
-		return fmt.Errorf("payment not found")
+		return fmt.Errorf("payment %w", ErrNotFound)
+	}
+	return nil
+}
+
+// DeletePaymentsByBookingID removes all payments for a booking
+func DeletePaymentsByBookingID(q db.Querier, bookingID int) error {
+	query := `DELETE FROM payment WHERE booking_id = $1`
+	if _, err := q.Exec(query, bookingID); err != nil {
+		return fmt.Errorf("failed to delete payments: %v", err)
 	}
 	return nil
 }
 
 // GetPaymentsByBookingID retrieves all payments associated with a specific booking
-func GetPaymentsByBookingID(bookingID int) ([]models.Payment, error) {
-	query := `SELECT payment_id, payment_method, payment_status, transaction_date, amount, booking_id FROM payment WHERE booking_id = $1`
-	rows, err := db.DB.Query(query, bookingID)
+func GetPaymentsByBookingID(q db.Querier, bookingID int) ([]models.Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payment WHERE booking_id = $1 ORDER BY payment_id`
+	rows, err := q.Query(query, bookingID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve payments: %v", err)
+	}
+	defer rows.Close()
+
+	var payments []models.Payment
+	for rows.Next() {
+		payment, err := scanPayment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning payment: %v", err)
+		}
+		payments = append(payments, *payment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading payments: %v", err)
+	}
+	return payments, nil
+}
+
+// GetAllPayments retrieves every payment, newest first
+func GetAllPayments(q db.Querier) ([]models.Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payment ORDER BY transaction_date DESC, payment_id DESC`
+	rows, err := q.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve payments: %v", err)
 	}
@@ -74,15 +164,73 @@ func GetPaymentsByBookingID(bookingID int) ([]models.Payment, error) {
 
 	var payments []models.Payment
 	for rows.Next() {
-		var payment models.Payment
-		if err := rows.Scan(&payment.PaymentID, &payment.PaymentMethod, &payment.PaymentStatus, &payment.TransactionDate, &payment.Amount, &payment.BookingID); err != nil {
+		payment, err := scanPayment(rows)
+		if err != nil {
 			return nil, fmt.Errorf("error scanning payment: %v", err)
 		}
-		payments = append(payments, payment)
+		payments = append(payments, *payment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading payments: %v", err)
+	}
+	return payments, nil
+}
+
+// GetUnconfirmedChargesBefore retrieves the pending charges made before a
+// time that still hold the dates of a confirmed booking, oldest first
+func GetUnconfirmedChargesBefore(q db.Querier, before time.Time) ([]models.Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payment
+		WHERE payment_status = 'Pending' AND amount > 0 AND gateway_ref <> '' AND transaction_date < $1
+		AND booking_id IN (SELECT booking_id FROM booking WHERE status = 'confirmed')
+		ORDER BY transaction_date, payment_id`
+	return queryPayments(q, query, before)
+}
+
+// GetVoidingPaymentsBefore retrieves the payments made before a time whose
+// void has not been confirmed by the gateway, oldest first
+func GetVoidingPaymentsBefore(q db.Querier, before time.Time) ([]models.Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payment WHERE payment_status = 'Voiding' AND transaction_date < $1
+		ORDER BY transaction_date, payment_id`
+	return queryPayments(q, query, before)
+}
+
+// queryPayments runs a query selecting paymentColumns
+func queryPayments(q db.Querier, query string, args ...interface{}) ([]models.Payment, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve payments: %v", err)
 	}
+	defer rows.Close()
 
+	var payments []models.Payment
+	for rows.Next() {
+		payment, err := scanPayment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning payment: %v", err)
+		}
+		payments = append(payments, *payment)
+	}
 	if err = rows.Err(); err != nil {
 		return nil, fmt.Errorf("error reading payments: %v", err)
 	}
 	return payments, nil
 }
+
+// GetNetPaidForBooking returns the sum of the completed payments of a booking
+// less what has been refunded or is being refunded, in the booking's currency
+func GetNetPaidForBooking(q db.Querier, bookingID int) (money.Money, error) {
+	query := `SELECT COALESCE(SUM(p.amount), 0), b.currency
+		FROM booking b
+		LEFT JOIN payment p ON p.booking_id = b.booking_id AND (p.payment_status IN ('Completed', 'Refunded') OR (p.payment_status = 'Pending' AND p.amount < 0))
+		WHERE b.booking_id = $1
+		GROUP BY b.currency`
+	var net money.Money
+	if err := q.QueryRow(query, bookingID).Scan(&net, &net.Currency); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return net, fmt.Errorf("booking %w", ErrNotFound)
+		}
+		return net, fmt.Errorf("failed to total payments: %v", err)
+	}
+	return net, nil
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"hotelm/db"
+	"hotelm/models"
+)
+
+// roomPhotoColumns lists the room photo columns in the order scanRoomPhoto reads them.
+const roomPhotoColumns = `photo_id, room_id, storage_key, thumbnail_key, content_type, size_bytes, width, height, position, is_cover, uploaded_at`
+
+// scanRoomPhoto reads a row selected with roomPhotoColumns.
+func scanRoomPhoto(row rowScanner) (*models.RoomPhoto, error) {
+	var photo models.RoomPhoto
+	err := row.Scan(&photo.PhotoID, &photo.RoomID, &photo.Key, &photo.ThumbnailKey, &photo.ContentType, &photo.Size,
+		&photo.Width, &photo.Height, &photo.Position, &photo.IsCover, &photo.UploadedAt)
+	if err != nil {
+		return nil, err
+	}
+	photo.URL = models.PhotoURL(photo.Key)
+	photo.ThumbnailURL = models.PhotoURL(photo.ThumbnailKey)
+	return &photo, nil
+}
+
+// CreateRoomPhoto inserts a photo after the room's other photos. The first
+// photo of a room becomes its cover
+func CreateRoomPhoto(q db.Querier, photo models.RoomPhoto) (int, error) {
+	query := `INSERT INTO room_photo (room_id, storage_key, thumbnail_key, content_type, size_bytes, width, height, position, is_cover)
+		SELECT $1, $2, $3, $4, $5, $6, $7, COALESCE(MAX(position) + 1, 0), COUNT(*) = 0
+		FROM room_photo WHERE room_id = $1
+		RETURNING photo_id`
+	var id int
+	err := q.QueryRow(query, photo.RoomID, photo.Key, photo.ThumbnailKey, photo.ContentType, photo.Size, photo.Width, photo.Height).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create room photo: %v", err)
+	}
+	return id, nil
+}
+
+// GetRoomPhotoByID retrieves a room photo by ID
+func GetRoomPhotoByID(q db.Querier, photoID int) (*models.RoomPhoto, error) {
+	query := `SELECT ` + roomPhotoColumns + ` FROM room_photo WHERE photo_id = $1`
+	photo, err := scanRoomPhoto(q.QueryRow(query, photoID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("room photo %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("error retrieving room photo: %v", err)
+	}
+	return photo, nil
+}
+
+// GetRoomPhotos retrieves the photos of a room in display order
+func GetRoomPhotos(q db.Querier, roomID int) ([]models.RoomPhoto, error) {
+	query := `SELECT ` + roomPhotoColumns + ` FROM room_photo WHERE room_id = $1 ORDER BY position, photo_id`
+	rows, err := q.Query(query, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve room photos: %v", err)
+	}
+	defer rows.Close()
+
+	var photos []models.RoomPhoto
+	for rows.Next() {
+		photo, err := scanRoomPhoto(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning room photo: %v", err)
+		}
+		photos = append(photos, *photo)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading room photos: %v", err)
+	}
+	return photos, nil
+}
+
+// DeleteRoomPhoto removes a room photo by ID
+func DeleteRoomPhoto(q db.Querier, photoID int) error {
+	query := `DELETE FROM room_photo WHERE photo_id = $1`
+	result, err := q.Exec(query, photoID)
+	if err != nil {
+		return fmt.Errorf("failed to delete room photo: %v", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("room photo %w", ErrNotFound)
+	}
+	return nil
+}
+
+// SetRoomCoverPhoto makes a photo the cover of its room, in place of the
+// room's current cover
+func SetRoomCoverPhoto(q db.Querier, roomID, photoID int) error {
+	// A room has at most one cover at any moment, so the old cover is
+	// cleared first.
+	if _, err := q.Exec(`UPDATE room_photo SET is_cover = FALSE WHERE room_id = $1 AND is_cover`, roomID); err != nil {
+		return fmt.Errorf("failed to clear cover photo: %v", err)
+	}
+	result, err := q.Exec(`UPDATE room_photo SET is_cover = TRUE WHERE room_id = $1 AND photo_id = $2`, roomID, photoID)
+	if err != nil {
+		return fmt.Errorf("failed to set cover photo: %v", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("room photo %w", ErrNotFound)
+	}
+	return nil
+}
+
+// SetRoomPhotoOrder numbers the photos of a room in the order of photoIDs,
+// which must list each of them once
+func SetRoomPhotoOrder(q db.Querier, roomID int, photoIDs []int) error {
+	ids := make([]int64, len(photoIDs))
+	for i, id := range photoIDs {
+		ids[i] = int64(id)
+	}
+	query := `UPDATE room_photo SET position = array_position($2::int[], photo_id) - 1 WHERE room_id = $1`
+	if _, err := q.Exec(query, roomID, pq.Array(ids)); err != nil {
+		return fmt.Errorf("failed to order room photos: %v", err)
+	}
+	return nil
+}
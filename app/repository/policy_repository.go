@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"hotelm/db"
+	"hotelm/models"
+)
+
+// GetCancellationPolicy retrieves the cancellation policy of a room. A room
+// without a policy is refundable in full until check-in, the zero policy.
+func GetCancellationPolicy(q db.Querier, roomID int) (models.CancellationPolicy, error) {
+	query := `SELECT free_days, penalty_percent, non_refundable FROM room_cancellation_policy WHERE room_id = $1`
+	var policy models.CancellationPolicy
+	err := q.QueryRow(query, roomID).Scan(&policy.FreeDays, &policy.PenaltyPercent, &policy.NonRefundable)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return policy, fmt.Errorf("failed to retrieve cancellation policy: %v", err)
+	}
+	return policy, nil
+}
+
+// SetCancellationPolicy creates or replaces the cancellation policy of a room
+func SetCancellationPolicy(q db.Querier, roomID int, policy models.CancellationPolicy) error {
+	query := `INSERT INTO room_cancellation_policy (room_id, free_days, penalty_percent, non_refundable)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (room_id) DO UPDATE SET free_days = EXCLUDED.free_days, penalty_percent = EXCLUDED.penalty_percent,
+			non_refundable = EXCLUDED.non_refundable, updated_at = CURRENT_TIMESTAMP`
+	if _, err := q.Exec(query, roomID, policy.FreeDays, policy.PenaltyPercent, policy.NonRefundable); err != nil {
+		return fmt.Errorf("failed to save cancellation policy: %v", err)
+	}
+	return nil
+}
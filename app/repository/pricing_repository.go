@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"fmt"
+
+	"hotelm/db"
+	"hotelm/models"
+)
+
+// GetActivePricingFees retrieves the taxes and fees applied to new bookings
+func GetActivePricingFees(q db.Querier) ([]models.PricingFee, error) {
+	query := `SELECT fee_id, name, kind, percent, flat_amount, currency, per_night, active FROM pricing_fee WHERE active = TRUE ORDER BY kind DESC, fee_id`
+	rows, err := q.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve pricing fees: %v", err)
+	}
+	defer rows.Close()
+
+	var fees []models.PricingFee
+	for rows.Next() {
+		var fee models.PricingFee
+		if err := rows.Scan(&fee.FeeID, &fee.Name, &fee.Kind, &fee.Percent, &fee.FlatAmount, &fee.FlatAmount.Currency, &fee.PerNight, &fee.Active); err != nil {
+			return nil, fmt.Errorf("error scanning pricing fee: %v", err)
+		}
+		fees = append(fees, fee)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading pricing fees: %v", err)
+	}
+	return fees, nil
+}
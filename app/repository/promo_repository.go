@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"hotelm/db"
+	"hotelm/models"
+	"hotelm/money"
+)
+
+// ErrDuplicatePromoCode is returned when a promo code is created with a code
+// that is already taken.
+var ErrDuplicatePromoCode = errors.New("promo code already exists")
+
+// uniqueViolation is the PostgreSQL error code for a violated unique constraint.
+const uniqueViolation = "23505"
+
+// isUniqueViolation reports whether err is a PostgreSQL unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
+
+// promoUses counts the redemptions of a promo code by bookings that are not
+// cancelled.
+const promoUses = `(SELECT COUNT(*) FROM promo_redemption pr JOIN booking b ON b.booking_id = pr.booking_id
+	WHERE pr.promo_code_id = promo_code.promo_code_id AND b.status <> 'cancelled')`
+
+// promoCodeColumns lists the promo code columns in the order scanPromoCode reads them.
+const promoCodeColumns = `promo_code_id, code, vendor_id, description, COALESCE(percent, 0), amount, currency,
+	valid_from, valid_until, max_uses, max_uses_per_customer, min_nights, room_id, room_type, active, created_at, ` + promoUses
+
+// scanPromoCode reads a row selected with promoCodeColumns.
+func scanPromoCode(row rowScanner) (*models.PromoCode, error) {
+	var promo models.PromoCode
+	var vendorID, roomID sql.NullInt64
+	var amount money.Money
+	var currency sql.NullString
+	err := row.Scan(&promo.PromoCodeID, &promo.Code, &vendorID, &promo.Description, &promo.Percent, &amount, &currency,
+		&promo.ValidFrom, &promo.ValidUntil, &promo.MaxUses, &promo.MaxUsesPerCustomer, &promo.MinNights, &roomID, &promo.RoomType,
+		&promo.Active, &promo.CreatedAt, &promo.Uses)
+	if err != nil {
+		return nil, err
+	}
+	promo.VendorID = intPtr(vendorID)
+	promo.RoomID = intPtr(roomID)
+	if currency.Valid {
+		amount.Currency = currency.String
+		promo.Amount = &amount
+	}
+	return &promo, nil
+}
+
+// queryPromoCodes runs a query selecting promoCodeColumns
+func queryPromoCodes(q db.Querier, query string, args ...interface{}) ([]models.PromoCode, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve promo codes: %v", err)
+	}
+	defer rows.Close()
+
+	var promos []models.PromoCode
+	for rows.Next() {
+		promo, err := scanPromoCode(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning promo code: %v", err)
+		}
+		promos = append(promos, *promo)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading promo codes: %v", err)
+	}
+	return promos, nil
+}
+
+// GetPromoCodesByVendor retrieves the promo codes of a vendor, newest first
+func GetPromoCodesByVendor(q db.Querier, vendorID int) ([]models.PromoCode, error) {
+	query := `SELECT ` + promoCodeColumns + ` FROM promo_code WHERE vendor_id = $1 ORDER BY promo_code_id DESC`
+	return queryPromoCodes(q, query, vendorID)
+}
+
+// GetAllPromoCodes retrieves every promo code, platform-wide codes first, newest first
+func GetAllPromoCodes(q db.Querier) ([]models.PromoCode, error) {
+	query := `SELECT ` + promoCodeColumns + ` FROM promo_code ORDER BY vendor_id NULLS FIRST, promo_code_id DESC`
+	return queryPromoCodes(q, query)
+}
+
+// GetPromoCodeByID retrieves a promo code by id
+func GetPromoCodeByID(q db.Querier, promoCodeID int) (*models.PromoCode, error) {
+	query := `SELECT ` + promoCodeColumns + ` FROM promo_code WHERE promo_code_id = $1`
+	return getPromoCode(q, query, promoCodeID)
+}
+
+// GetPromoCodeByCode retrieves a promo code by its code
+func GetPromoCodeByCode(q db.Querier, code string) (*models.PromoCode, error) {
+	query := `SELECT ` + promoCodeColumns + ` FROM promo_code WHERE code = $1`
+	return getPromoCode(q, query, code)
+}
+
+// GetPromoCodeByCodeForUpdate retrieves a promo code by its code and locks
+// it until the surrounding transaction ends, so its usage caps are checked
+// one booking at a time
+func GetPromoCodeByCodeForUpdate(q db.Querier, code string) (*models.PromoCode, error) {
+	query := `SELECT ` + promoCodeColumns + ` FROM promo_code WHERE code = $1 FOR UPDATE`
+	return getPromoCode(q, query, code)
+}
+
+func getPromoCode(q db.Querier, query string, arg interface{}) (*models.PromoCode, error) {
+	promo, err := scanPromoCode(q.QueryRow(query, arg))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("promo code %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("error retrieving promo code: %v", err)
+	}
+	return promo, nil
+}
+
+// CreatePromoCode inserts a new promo code
+func CreatePromoCode(q db.Querier, promo models.PromoCode) (int, error) {
+	var percent sql.NullFloat64
+	var amount, currency interface{}
+	if promo.Amount != nil {
+		amount, currency = *promo.Amount, promo.Amount.Currency
+	} else {
+		percent = sql.NullFloat64{Float64: promo.Percent, Valid: true}
+	}
+	query := `INSERT INTO promo_code (code, vendor_id, description, percent, amount, currency, valid_from, valid_until,
+			max_uses, max_uses_per_customer, min_nights, room_id, room_type, active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) RETURNING promo_code_id`
+	var id int
+	err := q.QueryRow(query, promo.Code, promo.VendorID, promo.Description, percent, amount, currency, promo.ValidFrom, promo.ValidUntil,
+		promo.MaxUses, promo.MaxUsesPerCustomer, promo.MinNights, promo.RoomID, promo.RoomType, promo.Active).Scan(&id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, ErrDuplicatePromoCode
+		}
+		return 0, fmt.Errorf("failed to create promo code: %v", err)
+	}
+	return id, nil
+}
+
+// SetPromoCodeActive enables or disables a promo code
+func SetPromoCodeActive(q db.Querier, promoCodeID int, active bool) error {
+	query := `UPDATE promo_code SET active = $1 WHERE promo_code_id = $2`
+	result, err := q.Exec(query, active, promoCodeID)
+	if err != nil {
+		return fmt.Errorf("failed to update promo code: %v", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("promo code %w", ErrNotFound)
+	}
+	return nil
+}
+
+// CountPromoCodeUsesByCustomer counts the redemptions of a promo code by a
+// customer's bookings that are not cancelled
+func CountPromoCodeUsesByCustomer(q db.Querier, promoCodeID, customerID int) (int, error) {
+	query := `SELECT COUNT(*) FROM promo_redemption pr JOIN booking b ON b.booking_id = pr.booking_id
+		WHERE pr.promo_code_id = $1 AND pr.customer_id = $2 AND b.status <> 'cancelled'`
+	var n int
+	if err := q.QueryRow(query, promoCodeID, customerID).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count promo code uses: %v", err)
+	}
+	return n, nil
+}
+
+// CreatePromoRedemption records a promo code used by a booking
+func CreatePromoRedemption(q db.Querier, redemption models.PromoRedemption) (int, error) {
+	query := `INSERT INTO promo_redemption (promo_code_id, booking_id, customer_id, discount) VALUES ($1, $2, $3, $4) RETURNING redemption_id`
+	var id int
+	err := q.QueryRow(query, redemption.PromoCodeID, redemption.BookingID, redemption.CustomerID, redemption.Discount).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record promo code redemption: %v", err)
+	}
+	return id, nil
+}
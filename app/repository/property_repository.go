@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"hotelm/db"
+	"hotelm/models"
+)
+
+// propertyColumns lists the property columns in the order scanProperty
+// reads them, ending with the number of its rooms and of those listed.
+const propertyColumns = `property_id, vendor_id, name, address, latitude, longitude, timezone,
+	to_char(checkin_time, 'HH24:MI'), to_char(checkout_time, 'HH24:MI'), policies, phone, email, created_at,
+	(SELECT COUNT(*) FROM room WHERE room.property_id = property.property_id),
+	(SELECT COUNT(*) FROM room WHERE room.property_id = property.property_id AND room.availability)`
+
+// scanProperty reads a row selected with propertyColumns.
+func scanProperty(row rowScanner) (*models.Property, error) {
+	var p models.Property
+	var latitude, longitude sql.NullFloat64
+	err := row.Scan(&p.PropertyID, &p.VendorID, &p.Name, &p.Address, &latitude, &longitude, &p.Timezone,
+		&p.CheckinTime, &p.CheckoutTime, &p.Policies, &p.Phone, &p.Email, &p.CreatedAt, &p.Rooms, &p.ListedRooms)
+	if err != nil {
+		return nil, err
+	}
+	if latitude.Valid && longitude.Valid {
+		p.Latitude, p.Longitude = &latitude.Float64, &longitude.Float64
+	}
+	return &p, nil
+}
+
+// queryProperties runs a query selecting propertyColumns
+func queryProperties(q db.Querier, query string, args ...interface{}) ([]models.Property, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve properties: %v", err)
+	}
+	defer rows.Close()
+
+	var properties []models.Property
+	for rows.Next() {
+		p, err := scanProperty(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning property: %v", err)
+		}
+		properties = append(properties, *p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading properties: %v", err)
+	}
+	return properties, nil
+}
+
+// GetPropertiesByVendor retrieves the properties of a vendor, oldest first
+func GetPropertiesByVendor(q db.Querier, vendorID int) ([]models.Property, error) {
+	query := `SELECT ` + propertyColumns + ` FROM property WHERE vendor_id = $1 ORDER BY property_id`
+	return queryProperties(q, query, vendorID)
+}
+
+// GetListedProperties retrieves the properties with rooms available for
+// booking, by name
+func GetListedProperties(q db.Querier) ([]models.Property, error) {
+	query := `SELECT ` + propertyColumns + ` FROM property
+		WHERE EXISTS (SELECT 1 FROM room WHERE room.property_id = property.property_id AND room.availability)
+		ORDER BY name, property_id`
+	return queryProperties(q, query)
+}
+
+// GetRoomTimezone returns the timezone of the property of a room
+func GetRoomTimezone(q db.Querier, roomID int) (string, error) {
+	query := `SELECT p.timezone FROM room JOIN property p ON p.property_id = room.property_id WHERE room.room_id = $1`
+	var timezone string
+	if err := q.QueryRow(query, roomID).Scan(&timezone); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("room %w", ErrNotFound)
+		}
+		return "", fmt.Errorf("error retrieving room timezone: %v", err)
+	}
+	return timezone, nil
+}
+
+// GetPropertyByID retrieves a property by id
+func GetPropertyByID(q db.Querier, propertyID int) (*models.Property, error) {
+	query := `SELECT ` + propertyColumns + ` FROM property WHERE property_id = $1`
+	p, err := scanProperty(q.QueryRow(query, propertyID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("property %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("error retrieving property: %v", err)
+	}
+	return p, nil
+}
+
+// CreateProperty inserts a new property
+func CreateProperty(q db.Querier, p models.Property) (int, error) {
+	query := `INSERT INTO property (vendor_id, name, address, latitude, longitude, timezone, checkin_time, checkout_time, policies, phone, email)
+		VALUES ($1, $2, $3, $4, $5, $6, $7::time, $8::time, $9, $10, $11) RETURNING property_id`
+	var id int
+	err := q.QueryRow(query, p.VendorID, p.Name, p.Address, p.Latitude, p.Longitude, p.Timezone,
+		p.CheckinTime, p.CheckoutTime, p.Policies, p.Phone, p.Email).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create property: %v", err)
+	}
+	return id, nil
+}
+
+// UpdateProperty updates the details of a property; its vendor is not
+// changed
+func UpdateProperty(q db.Querier, p models.Property) error {
+	query := `UPDATE property SET name = $1, address = $2, latitude = $3, longitude = $4, timezone = $5,
+		checkin_time = $6::time, checkout_time = $7::time, policies = $8, phone = $9, email = $10
+		WHERE property_id = $11`
+	result, err := q.Exec(query, p.Name, p.Address, p.Latitude, p.Longitude, p.Timezone,
+		p.CheckinTime, p.CheckoutTime, p.Policies, p.Phone, p.Email, p.PropertyID)
+	if err != nil {
+		return fmt.Errorf("failed to update property: %v", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("property %w", ErrNotFound)
+	}
+	return nil
+}
+
+// DeleteProperty removes a property; it fails while the property has rooms
+func DeleteProperty(q db.Querier, propertyID int) error {
+	query := `DELETE FROM property WHERE property_id = $1`
+	result, err := q.Exec(query, propertyID)
+	if err != nil {
+		return fmt.Errorf("failed to delete property: %v", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("property %w", ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"hotelm/db"
+	"hotelm/models"
+	"hotelm/money"
+)
+
+// ratePlanColumns lists the rate plan columns in the order scanRatePlan reads them.
+const ratePlanColumns = `rate_plan_id, room_id, name, start_date, end_date, price, currency, min_stay, max_stay`
+
+// scanRatePlan reads a row selected with ratePlanColumns.
+func scanRatePlan(row rowScanner) (*models.RatePlan, error) {
+	var plan models.RatePlan
+	if err := row.Scan(&plan.RatePlanID, &plan.RoomID, &plan.Name, &plan.StartDate, &plan.EndDate, &plan.Price, &plan.Price.Currency, &plan.MinStay, &plan.MaxStay); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// queryRatePlans runs a query selecting ratePlanColumns and fills in the
+// weekday prices of the plans it returns
+func queryRatePlans(q db.Querier, query string, args ...interface{}) ([]models.RatePlan, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve rate plans: %v", err)
+	}
+	defer rows.Close()
+
+	var plans []models.RatePlan
+	for rows.Next() {
+		plan, err := scanRatePlan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning rate plan: %v", err)
+		}
+		plans = append(plans, *plan)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading rate plans: %v", err)
+	}
+	// A transaction runs one query at a time, so the weekday prices are read
+	// once the plans are.
+	rows.Close()
+	for i := range plans {
+		if plans[i].WeekdayPrices, err = getRatePlanWeekdays(q, plans[i].RatePlanID, plans[i].Price.Currency); err != nil {
+			return nil, err
+		}
+	}
+	return plans, nil
+}
+
+// getRatePlanWeekdays retrieves the day-of-week prices of a rate plan, nil if it has none
+func getRatePlanWeekdays(q db.Querier, ratePlanID int, currency string) (map[time.Weekday]money.Money, error) {
+	query := `SELECT weekday, price FROM rate_plan_weekday WHERE rate_plan_id = $1`
+	rows, err := q.Query(query, ratePlanID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve rate plan weekdays: %v", err)
+	}
+	defer rows.Close()
+
+	var prices map[time.Weekday]money.Money
+	for rows.Next() {
+		var weekday int
+		var price money.Money
+		if err := rows.Scan(&weekday, &price); err != nil {
+			return nil, fmt.Errorf("error scanning rate plan weekday: %v", err)
+		}
+		if prices == nil {
+			prices = map[time.Weekday]money.Money{}
+		}
+		price.Currency = currency
+		prices[time.Weekday(weekday)] = price
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading rate plan weekdays: %v", err)
+	}
+	return prices, nil
+}
+
+// setRatePlanWeekdays replaces the day-of-week prices of a rate plan
+func setRatePlanWeekdays(q db.Querier, plan models.RatePlan) error {
+	if _, err := q.Exec(`DELETE FROM rate_plan_weekday WHERE rate_plan_id = $1`, plan.RatePlanID); err != nil {
+		return fmt.Errorf("failed to update rate plan weekdays: %v", err)
+	}
+	for weekday, price := range plan.WeekdayPrices {
+		query := `INSERT INTO rate_plan_weekday (rate_plan_id, weekday, price) VALUES ($1, $2, $3)`
+		if _, err := q.Exec(query, plan.RatePlanID, int(weekday), price); err != nil {
+			return fmt.Errorf("failed to update rate plan weekdays: %v", err)
+		}
+	}
+	return nil
+}
+
+// GetRatePlansForRoom retrieves the rate plans of a room, by start date
+func GetRatePlansForRoom(q db.Querier, roomID int) ([]models.RatePlan, error) {
+	query := `SELECT ` + ratePlanColumns + ` FROM rate_plan WHERE room_id = $1 ORDER BY start_date, end_date, rate_plan_id`
+	return queryRatePlans(q, query, roomID)
+}
+
+// GetRatePlansForDates retrieves the rate plans of a room with a night from
+// first to last, both included
+func GetRatePlansForDates(q db.Querier, roomID int, first, last time.Time) ([]models.RatePlan, error) {
+	query := `SELECT ` + ratePlanColumns + ` FROM rate_plan
+		WHERE room_id = $1 AND start_date <= $3 AND end_date >= $2
+		ORDER BY start_date, end_date, rate_plan_id`
+	return queryRatePlans(q, query, roomID, first, last)
+}
+
+// GetRatePlanByID retrieves a rate plan by id
+func GetRatePlanByID(q db.Querier, ratePlanID int) (*models.RatePlan, error) {
+	query := `SELECT ` + ratePlanColumns + ` FROM rate_plan WHERE rate_plan_id = $1`
+	plan, err := scanRatePlan(q.QueryRow(query, ratePlanID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("rate plan %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("error retrieving rate plan: %v", err)
+	}
+	if plan.WeekdayPrices, err = getRatePlanWeekdays(q, plan.RatePlanID, plan.Price.Currency); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// CreateRatePlan inserts a new rate plan with its day-of-week prices
+func CreateRatePlan(q db.Querier, plan models.RatePlan) (int, error) {
+	query := `INSERT INTO rate_plan (room_id, name, start_date, end_date, price, currency, min_stay, max_stay)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING rate_plan_id`
+	err := q.QueryRow(query, plan.RoomID, plan.Name, plan.StartDate, plan.EndDate, plan.Price, plan.Price.Currency, plan.MinStay, plan.MaxStay).Scan(&plan.RatePlanID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create rate plan: %v", err)
+	}
+	if err := setRatePlanWeekdays(q, plan); err != nil {
+		return 0, err
+	}
+	return plan.RatePlanID, nil
+}
+
+// UpdateRatePlan updates a rate plan and replaces its day-of-week prices
+func UpdateRatePlan(q db.Querier, plan models.RatePlan) error {
+	query := `UPDATE rate_plan SET name = $1, start_date = $2, end_date = $3, price = $4, currency = $5, min_stay = $6, max_stay = $7
+		WHERE rate_plan_id = $8`
+	result, err := q.Exec(query, plan.Name, plan.StartDate, plan.EndDate, plan.Price, plan.Price.Currency, plan.MinStay, plan.MaxStay, plan.RatePlanID)
+	if err != nil {
+		return fmt.Errorf("failed to update rate plan: %v", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("rate plan %w", ErrNotFound)
+	}
+	return setRatePlanWeekdays(q, plan)
+}
+
+// DeleteRatePlan removes a rate plan by id
+func DeleteRatePlan(q db.Querier, ratePlanID int) error {
+	query := `DELETE FROM rate_plan WHERE rate_plan_id = $1`
+	result, err := q.Exec(query, ratePlanID)
+	if err != nil {
+		return fmt.Errorf("failed to delete rate plan: %v", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("rate plan %w", ErrNotFound)
+	}
+	return nil
+}
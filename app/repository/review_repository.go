@@ -4,13 +4,14 @@ import (
 	"hotelm/db"
 	"hotelm/models"
 	"errors"
+	"fmt"
 )
 
 // GetReviewByID retrieves a review by ID (CRUD: Read)
-func GetReviewByID(reviewID int) (*models.Review, error) {
+func GetReviewByID(q db.Querier, reviewID int) (*models.Review, error) {
 	var r models.Review
-	err := db.DB.QueryRow("SELECT review_id, comment, rating, review_date, booking_id, customer_id, room_id FROM review WHERE review_id = $1", reviewID).
-		Scan(&r.ReviewID, &r.Comment, &r.Rating, &r.ReviewDate, &r.BookingID, &r.CustomerID, &r.RoomID)
+	err := q.QueryRow("SELECT review_id, comment, rating, review_date, booking_id, customer_id, room_id, hidden_at FROM review WHERE review_id = $1", reviewID).
+		Scan(&r.ReviewID, &r.Comment, &r.Rating, &r.ReviewDate, &r.BookingID, &r.CustomerID, &r.RoomID, &r.HiddenAt)
 
 	if err != nil {
 		return nil, err
@@ -19,13 +20,13 @@ func GetReviewByID(reviewID int) (*models.Review, error) {
 }
 
 // CreateReview inserts a new review, ensuring rating is between 1 and 5
-func CreateReview(r models.Review) (int, error) {
+func CreateReview(q db.Querier, r models.Review) (int, error) {
 	if r.Rating < 1 || r.Rating > 5 {
 		return 0, errors.New("rating must be between 1 and 5")
 	}
 
 	var newID int
-	err := db.DB.QueryRow(
+	err := q.QueryRow(
 		"INSERT INTO review (comment, rating, review_date, booking_id, customer_id, room_id) VALUES ($1, $2, $3, $4, $5, $6) RETURNING review_id",
 		r.Comment, r.Rating, r.ReviewDate, r.BookingID, r.CustomerID, r.RoomID,
 	).Scan(&newID)
@@ -37,12 +38,12 @@ func CreateReview(r models.Review) (int, error) {
 }
 
 // UpdateReview modifies an existing review, ensuring rating is between 1 and 5
-func UpdateReview(r models.Review) error {
+func UpdateReview(q db.Querier, r models.Review) error {
 	if r.Rating < 1 || r.Rating > 5 {
 		return errors.New("rating must be between 1 and 5")
 	}
 
-	_, err := db.DB.Exec(
+	_, err := q.Exec(
 		"UPDATE review SET comment=$1, rating=$2, review_date=$3, booking_id=$4, customer_id=$5, room_id=$6 WHERE review_id=$7",
 		r.Comment, r.Rating, r.ReviewDate, r.BookingID, r.CustomerID, r.RoomID, r.ReviewID,
 	)
@@ -51,14 +52,14 @@ func UpdateReview(r models.Review) error {
 }
 
 // DeleteReview removes a review by ID (CRUD: Delete)
-func DeleteReview(reviewID int) error {
-	_, err := db.DB.Exec("DELETE FROM review WHERE review_id=$1", reviewID)
+func DeleteReview(q db.Querier, reviewID int) error {
+	_, err := q.Exec("DELETE FROM review WHERE review_id=$1", reviewID)
 	return err
 }
 
-// GetAllReviews retrieves all reviews.
-func GetAllReviews() ([]models.Review, error) {
-	rows, err := db.DB.Query("SELECT review_id, comment, rating, review_date, booking_id, customer_id, room_id FROM review")
+// GetAllReviews retrieves all reviews, hidden ones included, newest first.
+func GetAllReviews(q db.Querier) ([]models.Review, error) {
+	rows, err := q.Query("SELECT review_id, comment, rating, review_date, booking_id, customer_id, room_id, hidden_at FROM review ORDER BY review_date DESC, review_id DESC")
 	if err != nil {
 		return nil, err
 	}
@@ -67,10 +68,61 @@ func GetAllReviews() ([]models.Review, error) {
 	var reviews []models.Review
 	for rows.Next() {
 		var review models.Review
-		if err := rows.Scan(&review.ReviewID, &review.Comment, &review.Rating, &review.ReviewDate, &review.BookingID, &review.CustomerID, &review.RoomID); err != nil {
+		if err := rows.Scan(&review.ReviewID, &review.Comment, &review.Rating, &review.ReviewDate, &review.BookingID, &review.CustomerID, &review.RoomID, &review.HiddenAt); err != nil {
 			return nil, err
 		}
 		reviews = append(reviews, review)
 	}
 	return reviews, nil
 }
+
+// GetReviewsByRoomID retrieves the visible reviews of a room, newest first.
+func GetReviewsByRoomID(q db.Querier, roomID int) ([]models.Review, error) {
+	rows, err := q.Query("SELECT review_id, comment, rating, review_date, booking_id, customer_id, room_id, hidden_at FROM review WHERE room_id = $1 AND hidden_at IS NULL ORDER BY review_date DESC, review_id DESC", roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reviews []models.Review
+	for rows.Next() {
+		var review models.Review
+		if err := rows.Scan(&review.ReviewID, &review.Comment, &review.Rating, &review.ReviewDate, &review.BookingID, &review.CustomerID, &review.RoomID, &review.HiddenAt); err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+	return reviews, rows.Err()
+}
+
+// GetReviewsByCustomerID retrieves the reviews written by a customer.
+func GetReviewsByCustomerID(q db.Querier, customerID int) ([]models.Review, error) {
+	rows, err := q.Query("SELECT review_id, comment, rating, review_date, booking_id, customer_id, room_id, hidden_at FROM review WHERE customer_id = $1", customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reviews []models.Review
+	for rows.Next() {
+		var review models.Review
+		if err := rows.Scan(&review.ReviewID, &review.Comment, &review.Rating, &review.ReviewDate, &review.BookingID, &review.CustomerID, &review.RoomID, &review.HiddenAt); err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+	return reviews, rows.Err()
+}
+
+// SetReviewHidden hides a review from the room page and rating, or shows it again
+func SetReviewHidden(q db.Querier, reviewID int, hidden bool) error {
+	result, err := q.Exec("UPDATE review SET hidden_at = CASE WHEN $1 THEN COALESCE(hidden_at, CURRENT_TIMESTAMP) END WHERE review_id = $2", hidden, reviewID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("review %w", ErrNotFound)
+	}
+	return nil
+}
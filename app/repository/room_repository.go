@@ -2,18 +2,27 @@ package repository
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
 	"hotelm/db"
 	"hotelm/models"
+	"hotelm/money"
 )
 
-// CreateRoom inserts a new room into the database
-func CreateRoom(room models.Room) (int, error) {
-	query := `INSERT INTO room (name, description, location, availability, price, room_type, average_rating, amenities, vendor_id) 
+// CreateRoom inserts a new room into the database. The average rating is
+// maintained by the database from the room's reviews, and the amenities are
+// set with SetRoomAmenities.
+func CreateRoom(q db.Querier, room models.Room) (int, error) {
+	query := `INSERT INTO room (name, description, location, availability, price, currency, room_type, vendor_id, property_id) 
               VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING room_id`
 	var id int
-	err := db.DB.QueryRow(query, room.Name, room.Description, room.Location, room.Availability, room.Price, room.RoomType, room.AverageRating, room.Amenities, room.VendorID).Scan(&id)
+	err := q.QueryRow(query, room.Name, room.Description, room.Location, room.Availability, room.Price, room.Price.Currency, room.RoomType, room.VendorID, room.PropertyID).Scan(&id)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create room: %v", err)
 	}
@@ -21,77 +30,291 @@ func CreateRoom(room models.Room) (int, error) {
 }
 
 
-func GetRoomByID(roomID int) (*models.Room, error) {
-	query := `SELECT room_id, name, description, location, availability, price, room_type, average_rating, amenities, vendor_id FROM room WHERE room_id = $1`
+// roomColumns lists the room columns in the order scanRoom reads them,
+// followed by the name of the room's property, its amenities as a JSON
+// array and the thumbnail key of the cover photo, '' if there is none.
+const roomColumns = `room_id, name, description, location, availability, price, currency, room_type, average_rating, vendor_id, property_id,
+	(SELECT property.name FROM property WHERE property.property_id = room.property_id),
+	COALESCE((SELECT json_agg(json_build_object('amenity_id', a.amenity_id, 'name', a.name, 'slug', a.slug) ORDER BY a.name, a.amenity_id)
+		FROM room_amenity ra JOIN amenity a ON a.amenity_id = ra.amenity_id WHERE ra.room_id = room.room_id), '[]'),
+	COALESCE((SELECT thumbnail_key FROM room_photo WHERE room_photo.room_id = room.room_id AND is_cover), '')`
+
+// scanRoom reads a row selected with roomColumns.
+func scanRoom(row rowScanner) (*models.Room, error) {
 	var room models.Room
+	var amenities []byte
+	var coverKey string
+	err := row.Scan(&room.RoomID, &room.Name, &room.Description, &room.Location, &room.Availability, &room.Price, &room.Price.Currency, &room.RoomType, &room.AverageRating, &room.VendorID, &room.PropertyID, &room.PropertyName, &amenities, &coverKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(amenities, &room.Amenities); err != nil {
+		return nil, fmt.Errorf("invalid amenities of room %d: %v", room.RoomID, err)
+	}
+	if coverKey != "" {
+		room.CoverPhoto = models.PhotoURL(coverKey)
+	}
+	return &room, nil
+}
 
-	err := db.DB.QueryRow(query, roomID).Scan(
-		&room.RoomID,
-		&room.Name,
-		&room.Description,
-		&room.Location,
-		&room.Availability,
-		&room.Price,
-		&room.RoomType,
-		&room.AverageRating,
-		&room.Amenities,
-		&room.VendorID,
-	)
+func GetRoomByID(q db.Querier, roomID int) (*models.Room, error) {
+	query := `SELECT ` + roomColumns + ` FROM room WHERE room_id = $1`
+	room, err := scanRoom(q.QueryRow(query, roomID))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("room not found")
+			return nil, fmt.Errorf("room %w", ErrNotFound)
 		}
 		return nil, fmt.Errorf("error retrieving room: %v", err)
 	}
-	return &room, nil
+	return room, nil
 }
 
+// GetRoomByIDForUpdate retrieves a room by ID and locks it until the
+// surrounding transaction ends
+func GetRoomByIDForUpdate(q db.Querier, roomID int) (*models.Room, error) {
+	query := `SELECT ` + roomColumns + ` FROM room WHERE room_id = $1 FOR UPDATE`
+	room, err := scanRoom(q.QueryRow(query, roomID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("room %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("error retrieving room: %v", err)
+	}
+	return room, nil
+}
 
-// UpdateRoom updates an existing room
-func UpdateRoom(room models.Room) error {
-	query := `UPDATE room SET name = $1, description = $2, location = $3, availability = $4, price = $5, room_type = $6, average_rating = $7, amenities = $8, vendor_id = $9 WHERE room_id = $10`
-	result, err := db.DB.Exec(query, room.Name, room.Description, room.Location, room.Availability, room.Price, room.RoomType, room.AverageRating, room.Amenities, room.VendorID, room.RoomID)
+
+// UpdateRoom updates an existing room. The average rating is maintained by
+// the database from the room's reviews and the amenities are set with
+// SetRoomAmenities; neither is changed here.
+func UpdateRoom(q db.Querier, room models.Room) error {
+	query := `UPDATE room SET name = $1, description = $2, location = $3, availability = $4, price = $5, currency = $6, room_type = $7, vendor_id = $8, property_id = $9 WHERE room_id = $10`
+	result, err := q.Exec(query, room.Name, room.Description, room.Location, room.Availability, room.Price, room.Price.Currency, room.RoomType, room.VendorID, room.PropertyID, room.RoomID)
 	if err != nil {
 		return fmt.Errorf("failed to update room: %v", err)
 	}
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
-		return fmt.Errorf("room not found")
+		return fmt.Errorf("room %w", ErrNotFound)
 	}
 	return nil
 }
 
 
 // DeleteRoom removes a room by ID
-func DeleteRoom(roomID int) error {
+func DeleteRoom(q db.Querier, roomID int) error {
 	query := `DELETE FROM room WHERE room_id = $1`
-	result, err := db.DB.Exec(query, roomID)
+	result, err := q.Exec(query, roomID)
 	if err != nil {
 		return fmt.Errorf("failed to delete room: %v", err)
 	}
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
-		return fmt.Errorf("room not found")
+		return fmt.Errorf("room %w", ErrNotFound)
 	}
 	return nil
 }
 
-// GetAvailableRooms retrieves all available rooms
-func GetAvailableRooms() ([]models.Room, error) {
-	query := `SELECT room_id, name, description, location, availability, price, room_type, average_rating, amenities, vendor_id FROM room WHERE availability = TRUE`
-	rows, err := db.DB.Query(query)
+// GetRoomsByVendor retrieves the rooms of a vendor, only those of one of its
+// properties unless propertyID is 0
+func GetRoomsByVendor(q db.Querier, vendorID, propertyID int) ([]models.Room, error) {
+	query := `SELECT ` + roomColumns + ` FROM room WHERE vendor_id = $1 AND ($2 = 0 OR property_id = $2) ORDER BY room_id`
+	rows, err := q.Query(query, vendorID, propertyID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve available rooms: %v", err)
+		return nil, fmt.Errorf("error querying vendor rooms: %v", err)
 	}
 	defer rows.Close()
 
 	var rooms []models.Room
 	for rows.Next() {
-		var room models.Room
-		if err := rows.Scan(&room.RoomID, &room.Name, &room.Description, &room.Location, &room.Availability, &room.Price, &room.RoomType, &room.AverageRating, &room.Amenities, &room.VendorID); err != nil {
+		room, err := scanRoom(rows)
+		if err != nil {
 			return nil, fmt.Errorf("error scanning room: %v", err)
 		}
-		rooms = append(rooms, room)
+		rooms = append(rooms, *room)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading vendor rooms: %v", err)
+	}
+	return rooms, nil
+}
+
+// RoomFilter narrows a room search. Zero values mean "no constraint", except
+// for the stay dates, which are required.
+type RoomFilter struct {
+	CheckinDate  time.Time
+	CheckoutDate time.Time
+	PropertyID   int
+	Location     string   // case-insensitive substring match
+	RoomType     string   // case-insensitive exact match
+	MinPrice     money.Money // average nightly price for the stay; rooms in other currencies are converted, and left out without a rate
+	MaxPrice     money.Money
+	MinRating    float64
+	Amenities    []string // names of amenities that must all be offered, matched by slug
+	AmenityIDs   []int    // amenities that must all be offered
+	Sort         string   // one of the RoomSort* constants
+	Limit        int
+	Offset       int
+}
+
+// Sort orders accepted by SearchRooms.
+const (
+	RoomSortPriceAsc   = "price_asc"
+	RoomSortPriceDesc  = "price_desc"
+	RoomSortRatingDesc = "rating_desc"
+	RoomSortRatingAsc  = "rating_asc"
+)
+
+// stayNights is the nights of the stay from $1 to $2, as n.night.
+const stayNights = `generate_series($1::date, $2::date - 1, interval '1 day') AS n(night)`
+
+// nightPlan selects from the rate plan that prices night n.night of a room
+// the way quotes price it: the plan in the room's currency covering the
+// night with the shortest date range, the newest of those. w is the plan's
+// price for the day of the week, if it has one.
+const nightPlan = `FROM rate_plan rp
+			LEFT JOIN rate_plan_weekday w ON w.rate_plan_id = rp.rate_plan_id AND w.weekday = EXTRACT(DOW FROM n.night)
+			WHERE rp.room_id = room.room_id AND rp.currency::text = room.currency::text
+			AND n.night::date BETWEEN rp.start_date AND rp.end_date
+			ORDER BY rp.end_date - rp.start_date, rp.rate_plan_id DESC
+			LIMIT 1`
+
+// stayPrice is the average nightly price of a room for the stay from $1 to
+// $2, in the room's currency. Each night is priced by its nightPlan at its
+// price for the day of the week; nights without a plan are at the room's
+// own price.
+const stayPrice = `(SELECT AVG(COALESCE((SELECT COALESCE(w.price, rp.price) ` + nightPlan + `), room.price))
+		FROM ` + stayNights + `)`
+
+// stayAllowed is the condition that no plan pricing a night of the stay
+// from $1 to $2 requires a longer or shorter stay, as quotes check it.
+const stayAllowed = `NOT EXISTS (
+			SELECT 1 FROM ` + stayNights + `
+			CROSS JOIN LATERAL (SELECT rp.min_stay, rp.max_stay ` + nightPlan + `) stay_plan
+			WHERE stay_plan.min_stay > $2::date - $1::date
+			OR (stay_plan.max_stay > 0 AND stay_plan.max_stay < $2::date - $1::date)
+		)`
+
+// basePrice is the nightly price of a room for the stay in the default
+// currency, converted with the stored exchange rates. It is NULL if the
+// room's currency has no rate.
+const basePrice = "(" + stayPrice + " / exchange_rate_of(room.currency::text))"
+
+// roomSortOrders maps a sort option to its ORDER BY clause. Rooms are
+// ordered by their nightly price for the stay; prices in different
+// currencies are compared in the default currency. room_id breaks
+// ties so that pages are stable.
+var roomSortOrders = map[string]string{
+	"":                 "room_id",
+	RoomSortPriceAsc:   basePrice + " ASC NULLS LAST, room_id",
+	RoomSortPriceDesc:  basePrice + " DESC NULLS LAST, room_id",
+	RoomSortRatingDesc: "average_rating DESC, room_id",
+	RoomSortRatingAsc:  "average_rating ASC, room_id",
+}
+
+// IsValidRoomSort reports whether sort is an order SearchRooms accepts.
+func IsValidRoomSort(sort string) bool {
+	_, ok := roomSortOrders[sort]
+	return ok
+}
+
+// hasAllAmenities returns a condition that the room offers every amenity
+// whose column (of amenity a) is in the array given by list. Each listed
+// value must match an amenity of the room, so a value not in the catalog
+// matches no room.
+func hasAllAmenities(column, list string) string {
+	return `(SELECT COUNT(DISTINCT ` + column + `) FROM room_amenity ra JOIN amenity a ON a.amenity_id = ra.amenity_id
+			WHERE ra.room_id = room.room_id AND ` + column + ` = ANY(` + list + `))
+		= (SELECT COUNT(DISTINCT v) FROM unnest(` + list + `) AS v)`
+}
+
+// SearchRooms retrieves the rooms that are listed as available, have no
+// booking overlapping the stay [CheckinDate, CheckoutDate), accept its
+// length under their rate plans and match the filter, one page at a time.
+func SearchRooms(q db.Querier, filter RoomFilter) ([]models.Room, error) {
+	order, ok := roomSortOrders[filter.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown room sort order %q", filter.Sort)
+	}
+
+	args := []interface{}{filter.CheckinDate, filter.CheckoutDate}
+	where := []string{
+		"availability = TRUE",
+		`NOT EXISTS (
+			SELECT 1 FROM booking b
+			WHERE b.room_id = room.room_id
+			AND b.status NOT IN ('cancelled', 'no_show')
+			AND daterange(b.checkin_date, b.checkout_date) && daterange($1::date, $2::date)
+		)`,
+		stayAllowed,
+	}
+	// arg adds a query argument and returns its placeholder.
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.PropertyID != 0 {
+		where = append(where, "property_id = "+arg(filter.PropertyID))
+	}
+	if filter.Location != "" {
+		where = append(where, "location ILIKE ('%' || "+arg(filter.Location)+" || '%')")
+	}
+	if filter.RoomType != "" {
+		where = append(where, "LOWER(room_type) = LOWER("+arg(filter.RoomType)+")")
+	}
+	if filter.MinPrice.IsPositive() || filter.MaxPrice.IsPositive() {
+		// The nightly price for the stay in the currency of the bounds.
+		currency := arg(filter.MinPrice.WithDefault(filter.MaxPrice.Currency).Currency) + "::text"
+		price := "(CASE WHEN room.currency::text = " + currency + " THEN " + stayPrice + " ELSE " + basePrice + " * exchange_rate_of(" + currency + ") END)"
+		if filter.MinPrice.IsPositive() {
+			where = append(where, price+" >= "+arg(filter.MinPrice))
+		}
+		if filter.MaxPrice.IsPositive() {
+			where = append(where, price+" <= "+arg(filter.MaxPrice))
+		}
+	}
+	if filter.MinRating > 0 {
+		where = append(where, "average_rating >= "+arg(filter.MinRating))
+	}
+	if len(filter.Amenities) > 0 {
+		slugs := make([]string, len(filter.Amenities))
+		for i, a := range filter.Amenities {
+			slugs[i] = models.AmenitySlug(a)
+		}
+		where = append(where, hasAllAmenities("a.slug", arg(pq.Array(slugs))+"::text[]"))
+	}
+	if len(filter.AmenityIDs) > 0 {
+		ids := make([]int64, len(filter.AmenityIDs))
+		for i, id := range filter.AmenityIDs {
+			ids[i] = int64(id)
+		}
+		where = append(where, hasAllAmenities("a.amenity_id", arg(pq.Array(ids))+"::int[]"))
+	}
+
+	query := `SELECT ` + roomColumns + ` FROM room
+		WHERE ` + strings.Join(where, "\n\t\tAND ") + `
+		ORDER BY ` + order
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		query += " OFFSET " + arg(filter.Offset)
+	}
+
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search rooms: %v", err)
+	}
+	defer rows.Close()
+
+	var rooms []models.Room
+	for rows.Next() {
+		room, err := scanRoom(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning room: %v", err)
+		}
+		rooms = append(rooms, *room)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -99,3 +322,19 @@ func GetAvailableRooms() ([]models.Room, error) {
 	}
 	return rooms, nil
 }
+
+// IsRoomFree reports whether a room has no booking overlapping the stay
+// [checkin, checkout). Cancelled and no-show bookings do not hold the room.
+func IsRoomFree(q db.Querier, roomID int, checkin, checkout time.Time) (bool, error) {
+	query := `SELECT NOT EXISTS (
+		SELECT 1 FROM booking
+		WHERE room_id = $1
+		AND status NOT IN ('cancelled', 'no_show')
+		AND daterange(checkin_date, checkout_date) && daterange($2::date, $3::date)
+	)`
+	var free bool
+	if err := q.QueryRow(query, roomID, checkin, checkout).Scan(&free); err != nil {
+		return false, fmt.Errorf("failed to check room availability: %v", err)
+	}
+	return free, nil
+}
@@ -0,0 +1,18 @@
+package repository
+
+import "database/sql"
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows, so a single scan
+// helper can serve single-row lookups and list queries.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// intPtr converts a nullable integer column to a *int, nil for NULL.
+func intPtr(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	id := int(n.Int64)
+	return &id
+}
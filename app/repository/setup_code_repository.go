@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"fmt"
+
+	"hotelm/db"
+)
+
+// SetPasswordSetupCode stores the hash of a new setup code for an account,
+// replacing any earlier code. The code expires after the given number of
+// hours.
+func SetPasswordSetupCode(q db.Querier, role string, accountID int, codeHash string, hours int) error {
+	query := `INSERT INTO password_setup_code (role, account_id, code_hash, expires_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP + make_interval(hours => $4))
+		ON CONFLICT (role, account_id) DO UPDATE
+		SET code_hash = EXCLUDED.code_hash, expires_at = EXCLUDED.expires_at, created_at = CURRENT_TIMESTAMP`
+	if _, err := q.Exec(query, role, accountID, codeHash, hours); err != nil {
+		return fmt.Errorf("failed to store setup code: %v", err)
+	}
+	return nil
+}
+
+// PasswordSetupCodeValid reports whether codeHash is the unexpired setup
+// code of an account
+func PasswordSetupCodeValid(q db.Querier, role string, accountID int, codeHash string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM password_setup_code
+		WHERE role = $1 AND account_id = $2 AND code_hash = $3 AND expires_at > CURRENT_TIMESTAMP)`
+	var valid bool
+	if err := q.QueryRow(query, role, accountID, codeHash).Scan(&valid); err != nil {
+		return false, fmt.Errorf("error checking setup code: %v", err)
+	}
+	return valid, nil
+}
+
+// UsePasswordSetupCode deletes the setup code of an account if codeHash is
+// its unexpired code, and reports whether it was. A code can be used once.
+func UsePasswordSetupCode(q db.Querier, role string, accountID int, codeHash string) (bool, error) {
+	query := `DELETE FROM password_setup_code
+		WHERE role = $1 AND account_id = $2 AND code_hash = $3 AND expires_at > CURRENT_TIMESTAMP`
+	result, err := q.Exec(query, role, accountID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use setup code: %v", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected > 0, nil
+}
@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"hotelm/db"
+	"hotelm/models"
+)
+
+// TicketFilter narrows the ticket list used for triage. Empty fields match
+// every ticket.
+type TicketFilter struct {
+	Status   string
+	Priority string
+	Category string
+}
+
+// ticketColumns lists the ticket columns in the order scanTicket reads them.
+const ticketColumns = `ticket_id, opener_role, customer_id, vendor_id, booking_id, payment_id, category, priority, status, subject, created_at, updated_at`
+
+// ticketOrder lists urgent tickets first, then the oldest.
+const ticketOrder = ` ORDER BY CASE priority WHEN 'urgent' THEN 0 WHEN 'high' THEN 1 WHEN 'normal' THEN 2 ELSE 3 END, created_at, ticket_id`
+
+// scanTicket reads a row selected with ticketColumns.
+func scanTicket(row rowScanner) (*models.SupportTicket, error) {
+	var t models.SupportTicket
+	var customerID, vendorID, bookingID, paymentID sql.NullInt64
+	if err := row.Scan(&t.TicketID, &t.OpenerRole, &customerID, &vendorID, &bookingID, &paymentID, &t.Category, &t.Priority, &t.Status, &t.Subject, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	t.CustomerID = intPtr(customerID)
+	t.VendorID = intPtr(vendorID)
+	t.BookingID = intPtr(bookingID)
+	t.PaymentID = intPtr(paymentID)
+	return &t, nil
+}
+
+// CreateTicket inserts a new support ticket
+func CreateTicket(q db.Querier, t models.SupportTicket) (int, error) {
+	query := `INSERT INTO support_ticket (opener_role, customer_id, vendor_id, booking_id, payment_id, category, priority, status, subject)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING ticket_id`
+	var id int
+	err := q.QueryRow(query, t.OpenerRole, t.CustomerID, t.VendorID, t.BookingID, t.PaymentID, t.Category, t.Priority, t.Status, t.Subject).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create ticket: %v", err)
+	}
+	return id, nil
+}
+
+// GetTicketByID retrieves a support ticket by id
+func GetTicketByID(q db.Querier, ticketID int) (*models.SupportTicket, error) {
+	return getTicket(q, `SELECT `+ticketColumns+` FROM support_ticket WHERE ticket_id = $1`, ticketID)
+}
+
+// GetTicketByIDForUpdate retrieves a support ticket and locks it until the
+// end of the transaction, so status changes are applied one at a time
+func GetTicketByIDForUpdate(q db.Querier, ticketID int) (*models.SupportTicket, error) {
+	return getTicket(q, `SELECT `+ticketColumns+` FROM support_ticket WHERE ticket_id = $1 FOR UPDATE`, ticketID)
+}
+
+func getTicket(q db.Querier, query string, ticketID int) (*models.SupportTicket, error) {
+	ticket, err := scanTicket(q.QueryRow(query, ticketID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("ticket %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("error retrieving ticket: %v", err)
+	}
+	return ticket, nil
+}
+
+// GetTicketsByOpener retrieves the tickets opened by a customer or vendor,
+// newest first
+func GetTicketsByOpener(q db.Querier, role string, id int) ([]models.SupportTicket, error) {
+	column := "customer_id"
+	if role == SideVendor {
+		column = "vendor_id"
+	}
+	query := `SELECT ` + ticketColumns + ` FROM support_ticket WHERE ` + column + ` = $1 ORDER BY created_at DESC, ticket_id DESC`
+	return queryTickets(q, query, id)
+}
+
+// SearchTickets retrieves the tickets matching a filter, most urgent first
+func SearchTickets(q db.Querier, filter TicketFilter) ([]models.SupportTicket, error) {
+	query := `SELECT ` + ticketColumns + ` FROM support_ticket
+		WHERE ($1 = '' OR status = $1) AND ($2 = '' OR priority = $2) AND ($3 = '' OR category = $3)` + ticketOrder
+	return queryTickets(q, query, filter.Status, filter.Priority, filter.Category)
+}
+
+// queryTickets runs a ticket query and scans the results.
+func queryTickets(q db.Querier, query string, args ...interface{}) ([]models.SupportTicket, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve tickets: %v", err)
+	}
+	defer rows.Close()
+
+	var tickets []models.SupportTicket
+	for rows.Next() {
+		ticket, err := scanTicket(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning ticket: %v", err)
+		}
+		tickets = append(tickets, *ticket)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading tickets: %v", err)
+	}
+	return tickets, nil
+}
+
+// UpdateTicketStatus sets the status of a ticket
+func UpdateTicketStatus(q db.Querier, ticketID int, status string) error {
+	query := `UPDATE support_ticket SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE ticket_id = $2`
+	return execTicketUpdate(q, query, status, ticketID)
+}
+
+// UpdateTicketTriage sets the category and priority of a ticket
+func UpdateTicketTriage(q db.Querier, ticketID int, category, priority string) error {
+	query := `UPDATE support_ticket SET category = $1, priority = $2, updated_at = CURRENT_TIMESTAMP WHERE ticket_id = $3`
+	return execTicketUpdate(q, query, category, priority, ticketID)
+}
+
+// TouchTicket marks a ticket as updated, e.g. after a reply
+func TouchTicket(q db.Querier, ticketID int) error {
+	return execTicketUpdate(q, `UPDATE support_ticket SET updated_at = CURRENT_TIMESTAMP WHERE ticket_id = $1`, ticketID)
+}
+
+func execTicketUpdate(q db.Querier, query string, args ...interface{}) error {
+	result, err := q.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update ticket: %v", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("ticket %w", ErrNotFound)
+	}
+	return nil
+}
+
+// CreateTicketReply adds a reply to a ticket. adminID is set for replies by
+// an admin.
+func CreateTicketReply(q db.Querier, reply models.TicketReply, adminID *int) (int, error) {
+	query := `INSERT INTO ticket_reply (ticket_id, author_role, admin_id, body) VALUES ($1, $2, $3, $4) RETURNING reply_id`
+	var id int
+	if err := q.QueryRow(query, reply.TicketID, reply.AuthorRole, adminID, reply.Body).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to create ticket reply: %v", err)
+	}
+	return id, nil
+}
+
+// GetTicketReplies retrieves the replies of a ticket, oldest first
+func GetTicketReplies(q db.Querier, ticketID int) ([]models.TicketReply, error) {
+	query := `SELECT reply_id, ticket_id, author_role, body, created_at FROM ticket_reply WHERE ticket_id = $1 ORDER BY reply_id`
+	rows, err := q.Query(query, ticketID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve ticket replies: %v", err)
+	}
+	defer rows.Close()
+
+	var replies []models.TicketReply
+	for rows.Next() {
+		var reply models.TicketReply
+		if err := rows.Scan(&reply.ReplyID, &reply.TicketID, &reply.AuthorRole, &reply.Body, &reply.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning ticket reply: %v", err)
+		}
+		replies = append(replies, reply)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading ticket replies: %v", err)
+	}
+	return replies, nil
+}
+
+// CreateTicketEvent records a status change of a ticket
+func CreateTicketEvent(q db.Querier, event models.TicketEvent) error {
+	query := `INSERT INTO ticket_event (ticket_id, from_status, to_status, actor_role) VALUES ($1, NULLIF($2, ''), $3, $4)`
+	if _, err := q.Exec(query, event.TicketID, event.FromStatus, event.ToStatus, event.ActorRole); err != nil {
+		return fmt.Errorf("failed to record ticket event: %v", err)
+	}
+	return nil
+}
+
+// GetTicketEvents retrieves the status history of a ticket, oldest first
+func GetTicketEvents(q db.Querier, ticketID int) ([]models.TicketEvent, error) {
+	query := `SELECT event_id, ticket_id, COALESCE(from_status, ''), to_status, actor_role, created_at FROM ticket_event WHERE ticket_id = $1 ORDER BY event_id`
+	rows, err := q.Query(query, ticketID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve ticket events: %v", err)
+	}
+	defer rows.Close()
+
+	var events []models.TicketEvent
+	for rows.Next() {
+		var event models.TicketEvent
+		if err := rows.Scan(&event.EventID, &event.TicketID, &event.FromStatus, &event.ToStatus, &event.ActorRole, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning ticket event: %v", err)
+		}
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading ticket events: %v", err)
+	}
+	return events, nil
+}
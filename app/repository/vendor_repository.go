@@ -8,11 +8,23 @@ import (
 	"hotelm/models"
 )
 
+// vendorColumns lists the vendor columns in the order scanVendor reads them.
+const vendorColumns = `vendor_id, name, email, COALESCE(phone, ''), COALESCE(hotel_name, ''), COALESCE(address, ''), COALESCE(password_hash, ''), suspended_at`
+
+// scanVendor reads a row selected with vendorColumns.
+func scanVendor(row rowScanner) (*models.Vendor, error) {
+	var vendor models.Vendor
+	if err := row.Scan(&vendor.VendorID, &vendor.Name, &vendor.Email, &vendor.Phone, &vendor.HotelName, &vendor.Address, &vendor.PasswordHash, &vendor.SuspendedAt); err != nil {
+		return nil, err
+	}
+	return &vendor, nil
+}
+
 // CreateVendor inserts a new vendor into the database
-func CreateVendor(vendor models.Vendor) (int, error) {
-	query := `INSERT INTO vendor (name, email, phone, hotel_name, address) VALUES ($1, $2, $3, $4, $5) RETURNING vendor_id`
+func CreateVendor(q db.Querier, vendor models.Vendor) (int, error) {
+	query := `INSERT INTO vendor (name, email, phone, hotel_name, address, password_hash) VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')) RETURNING vendor_id`
 	var id int
-	err := db.DB.QueryRow(query, vendor.Name, vendor.Email, vendor.Phone, vendor.HotelName, vendor.Address).Scan(&id)
+	err := q.QueryRow(query, vendor.Name, vendor.Email, vendor.Phone, vendor.HotelName, vendor.Address, vendor.PasswordHash).Scan(&id)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create vendor: %v", err)
 	}
@@ -20,52 +32,79 @@ func CreateVendor(vendor models.Vendor) (int, error) {
 }
 
 // GetVendorByID retrieves a vendor by ID
-func GetVendorByID(vendorID int) (*models.Vendor, error) {
-	query := `SELECT vendor_id, name, email, phone, hotel_name, address FROM vendor WHERE vendor_id = $1`
-	var vendor models.Vendor
+func GetVendorByID(q db.Querier, vendorID int) (*models.Vendor, error) {
+	query := `SELECT ` + vendorColumns + ` FROM vendor WHERE vendor_id = $1`
+	vendor, err := scanVendor(q.QueryRow(query, vendorID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("vendor %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("error retrieving vendor: %v", err)
+	}
+	return vendor, nil
+}
 
-	err := db.DB.QueryRow(query, vendorID).Scan(&vendor.VendorID, &vendor.Name, &vendor.Email, &vendor.Phone, &vendor.HotelName, &vendor.Address)
+// GetVendorByEmail retrieves a vendor by email, ignoring case
+func GetVendorByEmail(q db.Querier, email string) (*models.Vendor, error) {
+	query := `SELECT ` + vendorColumns + ` FROM vendor WHERE LOWER(email) = LOWER($1)`
+	vendor, err := scanVendor(q.QueryRow(query, email))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("vendor not found")
+			return nil, fmt.Errorf("vendor %w", ErrNotFound)
 		}
 		return nil, fmt.Errorf("error retrieving vendor: %v", err)
 	}
-	return &vendor, nil
+	return vendor, nil
+}
+
+// SetVendorPassword stores the first password hash of a vendor. It reports
+// ErrNotFound if there is no such vendor without a password, so that two
+// requests cannot both set it.
+func SetVendorPassword(q db.Querier, vendorID int, passwordHash string) error {
+	query := `UPDATE vendor SET password_hash = $1 WHERE vendor_id = $2 AND password_hash IS NULL`
+	result, err := q.Exec(query, passwordHash, vendorID)
+	if err != nil {
+		return fmt.Errorf("failed to set vendor password: %v", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("vendor without a password %w", ErrNotFound)
+	}
+	return nil
 }
 
 // UpdateVendor updates an existing vendor
-func UpdateVendor(vendor models.Vendor) error {
+func UpdateVendor(q db.Querier, vendor models.Vendor) error {
 	query := `UPDATE vendor SET name = $1, email = $2, phone = $3, hotel_name = $4, address = $5 WHERE vendor_id = $6`
-	result, err := db.DB.Exec(query, vendor.Name, vendor.Email, vendor.Phone, vendor.HotelName, vendor.Address, vendor.VendorID)
+	result, err := q.Exec(query, vendor.Name, vendor.Email, vendor.Phone, vendor.HotelName, vendor.Address, vendor.VendorID)
 	if err != nil {
 		return fmt.Errorf("failed to update vendor: %v", err)
 	}
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
-		return fmt.Errorf("vendor not found")
+		return fmt.Errorf("vendor %w", ErrNotFound)
 	}
 	return nil
 }
 
 // DeleteVendor removes a vendor by ID
-func DeleteVendor(vendorID int) error {
+func DeleteVendor(q db.Querier, vendorID int) error {
 	query := `DELETE FROM vendor WHERE vendor_id = $1`
-	result, err := db.DB.Exec(query, vendorID)
+	result, err := q.Exec(query, vendorID)
 	if err != nil {
 		return fmt.Errorf("failed to delete vendor: %v", err)
 	}
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
-		return fmt.Errorf("vendor not found")
+		return fmt.Errorf("vendor %w", ErrNotFound)
 	}
 	return nil
 }
 
 // GetAllVendors retrieves all vendors
-func GetAllVendors() ([]models.Vendor, error) {
-	query := `SELECT vendor_id, name, email, phone, hotel_name, address FROM vendor`
-	rows, err := db.DB.Query(query)
+func GetAllVendors(q db.Querier) ([]models.Vendor, error) {
+	query := `SELECT ` + vendorColumns + ` FROM vendor ORDER BY vendor_id`
+	rows, err := q.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve vendors: %v", err)
 	}
@@ -73,11 +112,37 @@ func GetAllVendors() ([]models.Vendor, error) {
 
 	var vendors []models.Vendor
 	for rows.Next() {
-		var vendor models.Vendor
-		if err := rows.Scan(&vendor.VendorID, &vendor.Name, &vendor.Email, &vendor.Phone, &vendor.HotelName, &vendor.Address); err != nil {
+		vendor, err := scanVendor(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning vendor: %v", err)
+		}
+		vendors = append(vendors, *vendor)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading vendors: %v", err)
+	}
+	return vendors, nil
+}
+
+// SearchVendors retrieves the vendors whose name or email contains term, ignoring case
+func SearchVendors(q db.Querier, term string) ([]models.Vendor, error) {
+	query := `SELECT ` + vendorColumns + ` FROM vendor
+		WHERE name ILIKE ('%' || $1 || '%') OR email ILIKE ('%' || $1 || '%')
+		ORDER BY vendor_id`
+	rows, err := q.Query(query, term)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search vendors: %v", err)
+	}
+	defer rows.Close()
+
+	var vendors []models.Vendor
+	for rows.Next() {
+		vendor, err := scanVendor(rows)
+		if err != nil {
 			return nil, fmt.Errorf("error scanning vendor: %v", err)
 		}
-		vendors = append(vendors, vendor)
+		vendors = append(vendors, *vendor)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -85,3 +150,17 @@ func GetAllVendors() ([]models.Vendor, error) {
 	}
 	return vendors, nil
 }
+
+// SetVendorSuspended suspends a vendor, or lifts the suspension
+func SetVendorSuspended(q db.Querier, vendorID int, suspended bool) error {
+	query := `UPDATE vendor SET suspended_at = CASE WHEN $1 THEN COALESCE(suspended_at, CURRENT_TIMESTAMP) END WHERE vendor_id = $2`
+	result, err := q.Exec(query, suspended, vendorID)
+	if err != nil {
+		return fmt.Errorf("failed to update vendor suspension: %v", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("vendor %w", ErrNotFound)
+	}
+	return nil
+}
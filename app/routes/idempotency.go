@@ -0,0 +1,138 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"hotelm/api"
+	"hotelm/models"
+	"hotelm/service"
+)
+
+// maxIdempotentBody is the largest request body accepted on idempotent routes.
+const maxIdempotentBody = 1 << 20
+
+// idempotencyFormField is the hidden form field that carries the key of an
+// HTML form; API clients send the Idempotency-Key header instead.
+const idempotencyFormField = "idempotency_key"
+
+// responseRecorder passes a response through while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
+
+// idempotent makes next safe to retry. A request carrying an idempotency key
+// runs once; a retry with the same key and body gets the stored response
+// with an Idempotent-Replayed header. Requests without a key run as usual.
+// It must be inside requireRole, since keys belong to the logged-in user.
+func idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		isAPI := strings.HasPrefix(r.URL.Path, "/api/")
+		fail := func(status int, code, message string) {
+			if isAPI {
+				api.WriteError(w, status, code, message)
+				return
+			}
+			http.Error(w, message, status)
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBody))
+		if err != nil {
+			fail(http.StatusBadRequest, "invalid_request", "error reading request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" && strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+			if err := r.ParseForm(); err != nil {
+				fail(http.StatusBadRequest, "invalid_request", "error parsing form")
+				return
+			}
+			key = r.PostFormValue(idempotencyFormField)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		sum := sha256.Sum256([]byte(r.Method + " " + r.URL.Path + "\n" + string(body)))
+		rec, err := service.BeginIdempotentRequest(r.Context(), key, hex.EncodeToString(sum[:]))
+		var invalid *service.ValidationError
+		switch {
+		case errors.As(err, &invalid):
+			fail(http.StatusBadRequest, "invalid_request", invalid.Message)
+			return
+		case errors.Is(err, service.ErrIdempotencyKeyReused):
+			fail(http.StatusUnprocessableEntity, "idempotency_key_reused", err.Error())
+			return
+		case errors.Is(err, service.ErrIdempotencyKeyInFlight):
+			fail(http.StatusConflict, "idempotency_key_in_use", err.Error())
+			return
+		case err != nil:
+			log.Printf("idempotency: %v", err)
+			fail(http.StatusInternalServerError, "internal_error", "internal server error")
+			return
+		}
+
+		if rec != nil {
+			if rec.ResponseType != "" {
+				w.Header().Set("Content-Type", rec.ResponseType)
+			}
+			if rec.ResponseLocation != "" {
+				w.Header().Set("Location", rec.ResponseLocation)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(rec.ResponseStatus)
+			w.Write(rec.ResponseBody)
+			return
+		}
+
+		rr := &responseRecorder{ResponseWriter: w}
+		next(rr, r)
+		if rr.status == 0 {
+			rr.status = http.StatusOK
+		}
+
+		// A server error left nothing behind, so a retry should run again.
+		if rr.status >= http.StatusInternalServerError {
+			if err := service.AbandonIdempotentRequest(r.Context(), key); err != nil {
+				log.Printf("idempotency: %v", err)
+			}
+			return
+		}
+		err = service.FinishIdempotentRequest(r.Context(), models.IdempotencyRecord{
+			Key:              key,
+			ResponseStatus:   rr.status,
+			ResponseType:     w.Header().Get("Content-Type"),
+			ResponseLocation: w.Header().Get("Location"),
+			ResponseBody:     rr.body.Bytes(),
+		})
+		if err != nil {
+			log.Printf("idempotency: %v", err)
+		}
+	}
+}
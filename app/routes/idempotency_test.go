@@ -0,0 +1,231 @@
+package routes
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"hotelm/db"
+	"hotelm/db/dbtest"
+	"hotelm/models"
+	"hotelm/session"
+)
+
+// keyTable is an idempotency_key table kept in memory.
+type keyTable struct {
+	mu   sync.Mutex
+	rows map[string]*models.IdempotencyRecord // by owner and key
+}
+
+// useKeyTable makes the services store idempotency keys in a keyTable for
+// the rest of the test.
+func useKeyTable(t *testing.T) *keyTable {
+	t.Helper()
+	kt := &keyTable{rows: map[string]*models.IdempotencyRecord{}}
+	conn, _ := dbtest.Open(kt.answer)
+	previous := db.DB
+	db.DB = conn
+	t.Cleanup(func() {
+		db.DB = previous
+		conn.Close()
+	})
+	return kt
+}
+
+func (kt *keyTable) answer(query string, args []driver.Value) dbtest.Result {
+	kt.mu.Lock()
+	defer kt.mu.Unlock()
+	id := func(owner, key driver.Value) string { return fmt.Sprint(owner, " ", key) }
+	switch {
+	case strings.HasPrefix(query, "INSERT INTO idempotency_key"):
+		if kt.rows[id(args[0], args[1])] != nil {
+			return dbtest.Affected(0)
+		}
+		kt.rows[id(args[0], args[1])] = &models.IdempotencyRecord{Owner: args[0].(string), Key: args[1].(string), Fingerprint: args[2].(string), CreatedAt: time.Now()}
+		return dbtest.Affected(1)
+	case strings.HasPrefix(query, "SELECT owner, idem_key"):
+		columns := strings.Split("owner key fingerprint status type location body created_at", " ")
+		rec := kt.rows[id(args[0], args[1])]
+		if rec == nil {
+			return dbtest.Rows(columns)
+		}
+		return dbtest.Rows(columns, []driver.Value{rec.Owner, rec.Key, rec.Fingerprint, int64(rec.ResponseStatus), rec.ResponseType, rec.ResponseLocation, rec.ResponseBody, rec.CreatedAt})
+	case strings.HasPrefix(query, "UPDATE idempotency_key"):
+		if rec := kt.rows[id(args[4], args[5])]; rec != nil {
+			rec.ResponseStatus = int(args[0].(int64))
+			rec.ResponseType, rec.ResponseLocation, rec.ResponseBody = args[1].(string), args[2].(string), args[3].([]byte)
+		}
+		return dbtest.Affected(1)
+	case strings.HasPrefix(query, "DELETE FROM idempotency_key WHERE owner"):
+		delete(kt.rows, id(args[0], args[1]))
+		return dbtest.Affected(1)
+	case strings.HasPrefix(query, "DELETE FROM idempotency_key WHERE created_at"):
+		return dbtest.Affected(0)
+	}
+	return dbtest.Fail(fmt.Errorf("unexpected query %q", query))
+}
+
+// has reports whether the key of customer 7 is stored.
+func (kt *keyTable) has(key string) bool {
+	kt.mu.Lock()
+	defer kt.mu.Unlock()
+	return kt.rows["customer:7 "+key] != nil
+}
+
+// asCustomer returns r as sent by customer 7.
+func asCustomer(r *http.Request) *http.Request {
+	return r.WithContext(session.NewContext(r.Context(), &session.Principal{
+		Role:     session.RoleCustomer,
+		Customer: &models.Customer{CustomerID: 7},
+	}))
+}
+
+// post sends a booking request of customer 7 through h.
+func post(h http.HandlerFunc, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/bookings", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Idempotency-Key", key)
+	w := httptest.NewRecorder()
+	h(w, asCustomer(r))
+	return w
+}
+
+// createBooking answers like the booking API and counts its calls.
+func createBooking(calls *int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/api/v1/bookings/42")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"booking_id":42,"call":%d,"request":%s}`, *calls, body)
+	}
+}
+
+func TestIdempotentReplay(t *testing.T) {
+	useKeyTable(t)
+	calls := 0
+	h := idempotent(createBooking(&calls))
+
+	first := post(h, "k1", `{"room_id":3}`)
+	if first.Code != http.StatusCreated || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("first request: %d %v", first.Code, first.Header())
+	}
+	retry := post(h, "k1", `{"room_id":3}`)
+	if calls != 1 {
+		t.Errorf("the handler ran %d times, want once", calls)
+	}
+	if retry.Code != http.StatusCreated || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry: %d, Idempotent-Replayed %q, want the stored 201 replayed", retry.Code, retry.Header().Get("Idempotent-Replayed"))
+	}
+	if retry.Body.String() != first.Body.String() {
+		t.Errorf("retry body %s, want %s", retry.Body, first.Body)
+	}
+	for _, h := range []string{"Content-Type", "Location"} {
+		if retry.Header().Get(h) != first.Header().Get(h) {
+			t.Errorf("retry %s %q, want %q", h, retry.Header().Get(h), first.Header().Get(h))
+		}
+	}
+
+	// Another key is another request.
+	if w := post(h, "k2", `{"room_id":3}`); w.Code != http.StatusCreated || calls != 2 {
+		t.Errorf("request with a new key: %d after %d calls, want it run", w.Code, calls)
+	}
+}
+
+func TestIdempotentKeyReused(t *testing.T) {
+	useKeyTable(t)
+	calls := 0
+	h := idempotent(createBooking(&calls))
+
+	post(h, "k1", `{"room_id":3}`)
+	w := post(h, "k1", `{"room_id":4}`)
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "idempotency_key_reused") {
+		t.Errorf("same key, other body: %d %s, want 422 idempotency_key_reused", w.Code, w.Body)
+	}
+	if calls != 1 {
+		t.Errorf("the handler ran %d times, want once", calls)
+	}
+}
+
+func TestIdempotentServerErrorDropsKey(t *testing.T) {
+	kt := useKeyTable(t)
+	calls := 0
+	h := idempotent(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			http.Error(w, "database unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	if w := post(h, "k1", `{"room_id":3}`); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("first request: %d, want 503", w.Code)
+	}
+	if kt.has("k1") {
+		t.Error("the key was kept after a server error")
+	}
+	w := post(h, "k1", `{"room_id":3}`)
+	if w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "" || calls != 2 {
+		t.Errorf("retry: %d after %d calls, want it run again", w.Code, calls)
+	}
+	if !kt.has("k1") {
+		t.Error("the key of the successful retry was not stored")
+	}
+}
+
+func TestIdempotentInFlight(t *testing.T) {
+	useKeyTable(t)
+	started, release := make(chan struct{}), make(chan struct{})
+	h := idempotent(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- post(h, "k1", `{"room_id":3}`) }()
+	<-started
+
+	w := post(h, "k1", `{"room_id":3}`)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "idempotency_key_in_use") {
+		t.Errorf("request while the first runs: %d %s, want 409 idempotency_key_in_use", w.Code, w.Body)
+	}
+	close(release)
+	if first := <-done; first.Code != http.StatusCreated {
+		t.Errorf("first request: %d, want 201", first.Code)
+	}
+}
+
+func TestIdempotentFormKey(t *testing.T) {
+	useKeyTable(t)
+	calls := 0
+	h := idempotent(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.FormValue("room_id") != "3" {
+			t.Errorf("the handler got room_id %q", r.FormValue("room_id"))
+		}
+		http.Redirect(w, r, "/my-bookings", http.StatusSeeOther)
+	})
+	form := url.Values{"room_id": {"3"}, idempotencyFormField: {"form-1"}}.Encode()
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest(http.MethodPost, "/book", strings.NewReader(form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h(w, asCustomer(r))
+		if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/my-bookings" {
+			t.Errorf("submission %d: %d to %q, want the redirect", i+1, w.Code, w.Header().Get("Location"))
+		}
+	}
+	if calls != 1 {
+		t.Errorf("the form was handled %d times, want once", calls)
+	}
+}
@@ -0,0 +1,78 @@
+package routes
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"hotelm/api"
+	"hotelm/session"
+)
+
+// requireRole only lets requests from a logged-in user with one of the given
+// roles reach next, and puts the user on the request context for the service layer.
+// Anonymous page requests are redirected to the login page, which sends the
+// user back afterwards; API calls get a JSON 401. A user with another role
+// gets a 403.
+func requireRole(next http.HandlerFunc, roles ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		isAPI := strings.HasPrefix(r.URL.Path, "/api/")
+		p := session.LoadPrincipal(r)
+
+		if p == nil {
+			if isAPI {
+				api.WriteError(w, http.StatusUnauthorized, "unauthenticated", "login required")
+				return
+			}
+			target := "/login"
+			if r.Method == http.MethodGet {
+				target += "?" + url.Values{"next": {r.URL.RequestURI()}}.Encode()
+			}
+			http.Redirect(w, r, target, http.StatusSeeOther)
+			return
+		}
+
+		if !slices.Contains(roles, p.Role) {
+			if isAPI {
+				api.WriteError(w, http.StatusForbidden, "forbidden", "this endpoint requires a "+strings.Join(roles, " or ")+" account")
+				return
+			}
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next(w, r.WithContext(session.NewContext(r.Context(), p)))
+	}
+}
+
+// customerOnly, vendorOnly and adminOnly guard the customer, vendor and admin
+// route groups.
+func customerOnly(next http.HandlerFunc) http.HandlerFunc {
+	return requireRole(next, session.RoleCustomer)
+}
+
+func vendorOnly(next http.HandlerFunc) http.HandlerFunc {
+	return requireRole(next, session.RoleVendor)
+}
+
+func adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return requireRole(next, session.RoleAdmin)
+}
+
+// anyUser guards routes shared by all roles, such as message threads, whose
+// services check access themselves.
+func anyUser(next http.HandlerFunc) http.HandlerFunc {
+	return requireRole(next, session.RoleCustomer, session.RoleVendor, session.RoleAdmin)
+}
+
+// optionalUser puts the logged-in user, if any, on the request context of a
+// public route, so that services can tailor the answer to them.
+func optionalUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if p := session.LoadPrincipal(r); p != nil {
+			r = r.WithContext(session.NewContext(r.Context(), p))
+		}
+		next(w, r)
+	}
+}
@@ -3,7 +3,9 @@ package routes
 import (
 	"net/http"
 
+	"hotelm/api"
 	"hotelm/handlers"
+	"hotelm/models"
 )
 
 // SetupRoutes registers all the HTTP routes for the application.
@@ -18,33 +20,59 @@ func SetupRoutes() {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		}
 	})
+	http.HandleFunc("/login/set-password", func(w http.ResponseWriter, r *http.Request) {
+		// First-login flow for accounts created before passwords existed.
+		if r.Method == http.MethodGet {
+			handlers.SetPasswordPageHandler(w, r)
+		} else if r.Method == http.MethodPost {
+			handlers.SetPasswordPostHandler(w, r)
+		} else {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
 	http.HandleFunc("/logout", handlers.LogoutHandler)
 
-	// Customer routes
-	http.HandleFunc("/customer", handlers.CustomerDashboardHandler)
-	http.HandleFunc("/customer/rooms", handlers.AvailableRoomsHandler)         // List available rooms
-	http.HandleFunc("/customer/booking/new", handlers.NewBookingPageHandler)     // Show booking form
-	http.HandleFunc("/customer/booking", func(w http.ResponseWriter, r *http.Request) { // Create booking (POST)
+	// Room photos are public, like the rooms they show.
+	http.HandleFunc(models.PhotoPath, handlers.PhotoHandler)
+
+	// Customer routes, only for logged-in customers
+	http.HandleFunc("/customer", customerOnly(handlers.CustomerDashboardHandler))
+	http.HandleFunc("/customer/rooms", customerOnly(handlers.AvailableRoomsHandler))                 // List available rooms
+	http.HandleFunc("/customer/properties", customerOnly(handlers.PropertiesHandler))                // Browse properties; each links to its rooms
+	http.HandleFunc("/customer/booking/new", customerOnly(handlers.NewBookingPageHandler))           // Show booking form
+	http.HandleFunc("/customer/booking", customerOnly(func(w http.ResponseWriter, r *http.Request) { // Create booking (POST)
 		if r.Method == http.MethodPost {
-			handlers.CreateBookingHandler(w, r)
+			idempotent(handlers.CreateBookingHandler)(w, r) // the form carries a token, so a double submit books once
 		} else {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		}
-	})
-	http.HandleFunc("/customer/bookings", handlers.MyBookingsHandler)
-	http.HandleFunc("/customer/booking/delete", handlers.DeleteBookingHandler)
+	}))
+	http.HandleFunc("/customer/bookings", customerOnly(handlers.MyBookingsHandler))
+	http.HandleFunc("/customer/display-currency", customerOnly(handlers.DisplayCurrencyHandler)) // POST display_currency, next
+	http.HandleFunc("/customer/booking/cancel", customerOnly(handlers.CancelBookingHandler))
+	http.HandleFunc("/customer/booking/pay", customerOnly(idempotent(handlers.CompletePaymentHandler))) // complete a payment waiting on the bank
+	http.HandleFunc("/customer/bookings/history", customerOnly(handlers.BookingHistoryHandler))
+	http.HandleFunc("/customer/rooms/reviews", customerOnly(handlers.RoomReviewsHandler))           // Show a room's reviews
+	http.HandleFunc("/customer/review/new", customerOnly(handlers.NewReviewPageHandler))            // Show review form
+	http.HandleFunc("/customer/review", customerOnly(func(w http.ResponseWriter, r *http.Request) { // Post review (POST)
+		if r.Method == http.MethodPost {
+			handlers.CreateReviewHandler(w, r)
+		} else {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}))
 
-	// Vendor routes
-	http.HandleFunc("/vendor", handlers.VendorDashboardHandler)
-	http.HandleFunc("/vendor/rooms", func(w http.ResponseWriter, r *http.Request) {
+	// Vendor routes, only for logged-in vendors
+	http.HandleFunc("/vendor", vendorOnly(handlers.VendorDashboardHandler))
+	http.HandleFunc("/vendor/rooms", vendorOnly(func(w http.ResponseWriter, r *http.Request) {
 		// This route is used to list rooms.
 		if r.Method == http.MethodGet {
 			handlers.VendorRoomsHandler(w, r)
 		} else {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		}
-	})
-	http.HandleFunc("/vendor/rooms/new", func(w http.ResponseWriter, r *http.Request) {
+	}))
+	http.HandleFunc("/vendor/rooms/new", vendorOnly(func(w http.ResponseWriter, r *http.Request) {
 		// Route to display the new room form (GET) and create a new room (POST).
 		if r.Method == http.MethodGet {
 			handlers.NewRoomPageHandler(w, r)
@@ -53,8 +81,8 @@ func SetupRoutes() {
 		} else {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		}
-	})
-	http.HandleFunc("/vendor/rooms/edit", func(w http.ResponseWriter, r *http.Request) {
+	}))
+	http.HandleFunc("/vendor/rooms/edit", vendorOnly(func(w http.ResponseWriter, r *http.Request) {
 		// Route to display the edit room form (GET) and update room details (POST).
 		if r.Method == http.MethodGet {
 			handlers.EditRoomPageHandler(w, r)
@@ -63,46 +91,209 @@ func SetupRoutes() {
 		} else {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		}
-	})
-	http.HandleFunc("/vendor/rooms/delete", func(w http.ResponseWriter, r *http.Request) {
+	}))
+	http.HandleFunc("/vendor/rooms/delete", vendorOnly(func(w http.ResponseWriter, r *http.Request) {
 		// Route to delete a room (POST only).
 		if r.Method == http.MethodPost {
 			handlers.DeleteRoomHandler(w, r)
 		} else {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		}
+	}))
+	http.HandleFunc("/vendor/rooms/policy", vendorOnly(handlers.RoomPolicyHandler)) // Set a room's cancellation policy (POST)
+	http.HandleFunc("/vendor/rooms/rates", vendorOnly(func(w http.ResponseWriter, r *http.Request) {
+		// Route to show a room's rate calendar (GET) and save a rate plan (POST).
+		if r.Method == http.MethodGet {
+			handlers.RateCalendarHandler(w, r)
+		} else if r.Method == http.MethodPost {
+			handlers.SaveRatePlanHandler(w, r)
+		} else {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	http.HandleFunc("/vendor/rooms/rates/delete", vendorOnly(handlers.DeleteRatePlanHandler))
+	http.HandleFunc("/vendor/rooms/photos", vendorOnly(handlers.UploadRoomPhotosHandler)) // Add photos to a room (POST, multipart)
+	http.HandleFunc("/vendor/rooms/photos/delete", vendorOnly(handlers.DeleteRoomPhotoHandler))
+	http.HandleFunc("/vendor/rooms/photos/cover", vendorOnly(handlers.CoverPhotoHandler))
+	http.HandleFunc("/vendor/rooms/photos/move", vendorOnly(handlers.MoveRoomPhotoHandler)) // direction=up or down
+	http.HandleFunc("/vendor/properties", vendorOnly(handlers.VendorPropertiesHandler))
+	http.HandleFunc("/vendor/properties/new", vendorOnly(handlers.NewPropertyHandler))       // form (GET) and create (POST)
+	http.HandleFunc("/vendor/properties/edit", vendorOnly(handlers.EditPropertyHandler))     // ?property_id=; form (GET) and save (POST)
+	http.HandleFunc("/vendor/properties/delete", vendorOnly(handlers.DeletePropertyHandler)) // only once it has no rooms
+
+	// Registration routes
+	http.HandleFunc("/register/customer", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			handlers.RegistrationCustomerPageHandler(w, r)
+		} else if r.Method == http.MethodPost {
+			handlers.RegistrationCustomerPostHandler(w, r)
+		} else {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
 	})
+	http.HandleFunc("/register/vendor", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			handlers.RegistrationVendorPageHandler(w, r)
+		} else if r.Method == http.MethodPost {
+			handlers.RegistrationVendorPostHandler(w, r)
+		} else {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	http.HandleFunc("/vendor/payments", vendorOnly(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			handlers.VendorPaymentsHandler(w, r)
+		} else {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	http.HandleFunc("/vendor/bookings", vendorOnly(handlers.VendorBookingsHandler))
+	http.HandleFunc("/vendor/promo-codes", vendorOnly(handlers.PromoCodesHandler))
+	http.HandleFunc("/vendor/promo-codes/new", vendorOnly(handlers.NewPromoCodeHandler))
+	http.HandleFunc("/vendor/promo-codes/active", vendorOnly(handlers.PromoCodeActiveHandler)) // enable or disable a code
+	http.HandleFunc("/vendor/bookings/status", vendorOnly(handlers.BookingStatusHandler))      // check in, check out, no-show, cancel
+	http.HandleFunc("/vendor/bookings/history", vendorOnly(handlers.BookingHistoryHandler))
 
+	// Message threads. Customers and vendors see their own threads; admins
+	// can read every thread but not post.
+	http.HandleFunc("/customer/messages", customerOnly(handlers.MessagesHandler))
+	http.HandleFunc("/customer/messages/new", customerOnly(handlers.NewThreadHandler))
+	http.HandleFunc("/customer/messages/thread", customerOnly(handlers.ThreadHandler)) // ?id=
+	http.HandleFunc("/vendor/messages", vendorOnly(handlers.MessagesHandler))
+	http.HandleFunc("/vendor/messages/new", vendorOnly(handlers.NewThreadHandler))
+	http.HandleFunc("/vendor/messages/thread", vendorOnly(handlers.ThreadHandler))
+	http.HandleFunc("/admin/messages", adminOnly(handlers.MessagesHandler))
+	http.HandleFunc("/admin/messages/thread", adminOnly(handlers.ThreadHandler))
 
+	// Support tickets. Customers and vendors see the tickets they opened;
+	// admins see and triage every ticket.
+	http.HandleFunc("/customer/tickets", customerOnly(handlers.TicketsHandler))
+	http.HandleFunc("/customer/tickets/view", customerOnly(handlers.TicketHandler)) // ?id=
+	http.HandleFunc("/customer/tickets/new", customerOnly(handlers.NewTicketHandler))
+	http.HandleFunc("/customer/tickets/status", customerOnly(handlers.TicketStatusHandler))
+	http.HandleFunc("/vendor/tickets", vendorOnly(handlers.TicketsHandler))
+	http.HandleFunc("/vendor/tickets/view", vendorOnly(handlers.TicketHandler))
+	http.HandleFunc("/vendor/tickets/new", vendorOnly(handlers.NewTicketHandler))
+	http.HandleFunc("/vendor/tickets/status", vendorOnly(handlers.TicketStatusHandler))
+	http.HandleFunc("/admin/tickets", adminOnly(handlers.TicketsHandler))
+	http.HandleFunc("/admin/tickets/view", adminOnly(handlers.TicketHandler))
+	http.HandleFunc("/admin/tickets/triage", adminOnly(handlers.TicketTriageHandler))
+	http.HandleFunc("/admin/tickets/status", adminOnly(handlers.TicketStatusHandler))
 
-	// Registration routes
-http.HandleFunc("/register/customer", func(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
-		handlers.RegistrationCustomerPageHandler(w, r)
-	} else if r.Method == http.MethodPost {
-		handlers.RegistrationCustomerPostHandler(w, r)
-	} else {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-	}
-})
-http.HandleFunc("/register/vendor", func(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
-		handlers.RegistrationVendorPageHandler(w, r)
-	} else if r.Method == http.MethodPost {
-		handlers.RegistrationVendorPostHandler(w, r)
-	} else {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-	}
-})
-
-http.HandleFunc("/vendor/payments", func(w http.ResponseWriter, r *http.Request) {
-    if r.Method == http.MethodGet {
-        handlers.VendorPaymentsHandler(w, r)
-    } else {
-        http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-    }
-})
-
-
-	
+	// Admin console, only for logged-in admins. Every change is recorded in
+	// the audit log.
+	http.HandleFunc("/admin", adminOnly(handlers.AdminDashboardHandler))
+	http.HandleFunc("/admin/customers", adminOnly(handlers.AdminCustomersHandler)) // ?q= searches name and email
+	http.HandleFunc("/admin/customers/suspend", adminOnly(handlers.AdminSuspendCustomerHandler))
+	http.HandleFunc("/admin/customers/delete", adminOnly(handlers.AdminDeleteCustomerHandler))
+	http.HandleFunc("/admin/customers/setup-code", adminOnly(handlers.AdminCustomerSetupCodeHandler)) // one-time code to set a first password
+	http.HandleFunc("/admin/vendors", adminOnly(handlers.AdminVendorsHandler))
+	http.HandleFunc("/admin/vendors/suspend", adminOnly(handlers.AdminSuspendVendorHandler))
+	http.HandleFunc("/admin/vendors/delete", adminOnly(handlers.AdminDeleteVendorHandler))
+	http.HandleFunc("/admin/vendors/setup-code", adminOnly(handlers.AdminVendorSetupCodeHandler)) // one-time code to set a first password
+	http.HandleFunc("/admin/bookings", adminOnly(handlers.AdminBookingsHandler))
+	http.HandleFunc("/admin/bookings/refund", adminOnly(handlers.AdminRefundHandler))
+	http.HandleFunc("/admin/bookings/status", adminOnly(handlers.BookingStatusHandler))
+	http.HandleFunc("/admin/bookings/history", adminOnly(handlers.BookingHistoryHandler))
+	http.HandleFunc("/admin/payments", adminOnly(handlers.AdminPaymentsHandler))
+	http.HandleFunc("/admin/promo-codes", adminOnly(handlers.PromoCodesHandler))
+	http.HandleFunc("/admin/promo-codes/new", adminOnly(handlers.NewPromoCodeHandler)) // platform-wide codes
+	http.HandleFunc("/admin/promo-codes/active", adminOnly(handlers.PromoCodeActiveHandler))
+	http.HandleFunc("/admin/reviews", adminOnly(handlers.AdminReviewsHandler))
+	http.HandleFunc("/admin/reviews/hide", adminOnly(handlers.AdminHideReviewHandler))
+	http.HandleFunc("/admin/audit", adminOnly(handlers.AdminAuditHandler))
+	http.HandleFunc("/admin/exchange-rates", adminOnly(handlers.AdminExchangeRatesHandler))
+	http.HandleFunc("/admin/exchange-rates/set", adminOnly(handlers.AdminSetExchangeRateHandler))
+	http.HandleFunc("/admin/exchange-rates/delete", adminOnly(handlers.AdminDeleteExchangeRateHandler))
+	http.HandleFunc("/admin/exchange-rates/reload", adminOnly(handlers.AdminReloadExchangeRatesHandler)) // reads the configured rates file
+	http.HandleFunc("/admin/amenities", adminOnly(handlers.AdminAmenitiesHandler))
+	http.HandleFunc("/admin/amenities/new", adminOnly(handlers.AdminCreateAmenityHandler))
+	http.HandleFunc("/admin/amenities/rename", adminOnly(handlers.AdminRenameAmenityHandler))
+	http.HandleFunc("/admin/amenities/delete", adminOnly(handlers.AdminDeleteAmenityHandler)) // also removes it from rooms
+
+	// JSON API routes. Rooms are public; bookings and reviews need a customer
+	// and /api/v1/vendor needs a vendor.
+	http.HandleFunc("POST /api/v1/session", api.Login)
+	http.HandleFunc("DELETE /api/v1/session", api.Logout)
+	http.HandleFunc("POST /api/v1/customers", api.RegisterCustomer)
+	http.HandleFunc("GET /api/v1/customers/me", customerOnly(api.CurrentCustomer))
+	http.HandleFunc("PUT /api/v1/customers/me/display-currency", customerOnly(api.SetDisplayCurrency))
+	http.HandleFunc("POST /api/v1/vendors", api.RegisterVendor)
+	http.HandleFunc("GET /api/v1/vendors/me", vendorOnly(api.CurrentVendor))
+
+	http.HandleFunc("GET /api/v1/rooms", api.ListRooms) // search filters in the query string; amenity_id repeats
+	http.HandleFunc("GET /api/v1/properties", api.ListProperties)
+	http.HandleFunc("GET /api/v1/properties/{id}", api.GetProperty)
+	http.HandleFunc("GET /api/v1/rooms/{id}", api.GetRoom)
+	http.HandleFunc("GET /api/v1/rooms/{id}/reviews", api.ListRoomReviews)
+	http.HandleFunc("GET /api/v1/rooms/{id}/quote", optionalUser(api.QuoteRoom)) // ?checkin_date=&checkout_date=&promo_code=; promo caps are checked for a logged-in customer
+	http.HandleFunc("GET /api/v1/rooms/{id}/cancellation-policy", api.GetCancellationPolicy)
+	http.HandleFunc("GET /api/v1/rooms/{id}/photos", api.ListRoomPhotos)
+	http.HandleFunc("GET /api/v1/exchange-rates", api.ListExchangeRates)
+	http.HandleFunc("PUT /api/v1/admin/exchange-rates/{currency}", adminOnly(api.SetExchangeRate))
+	http.HandleFunc("DELETE /api/v1/admin/exchange-rates/{currency}", adminOnly(api.DeleteExchangeRate))
+	http.HandleFunc("GET /api/v1/amenities", api.ListAmenities)
+	http.HandleFunc("POST /api/v1/admin/amenities", adminOnly(api.CreateAmenity))
+	http.HandleFunc("PUT /api/v1/admin/amenities/{id}", adminOnly(api.RenameAmenity))
+	http.HandleFunc("DELETE /api/v1/admin/amenities/{id}", adminOnly(api.DeleteAmenity))
+	http.HandleFunc("GET /api/v1/admin/promo-codes", adminOnly(api.ListPromoCodes))
+	http.HandleFunc("POST /api/v1/admin/promo-codes", adminOnly(api.CreatePromoCode))
+	http.HandleFunc("PUT /api/v1/admin/promo-codes/{id}/active", adminOnly(api.SetPromoCodeActive))
+
+	http.HandleFunc("GET /api/v1/bookings", customerOnly(api.ListBookings))
+	http.HandleFunc("POST /api/v1/bookings", customerOnly(idempotent(api.CreateBooking))) // retries with the same Idempotency-Key book once
+	http.HandleFunc("GET /api/v1/bookings/{id}", customerOnly(api.GetBooking))
+	http.HandleFunc("DELETE /api/v1/bookings/{id}", customerOnly(api.CancelBooking))
+	http.HandleFunc("PUT /api/v1/bookings/{id}/status", anyUser(api.SetBookingStatus)) // customers cancel; vendors and admins check in and out
+	http.HandleFunc("GET /api/v1/bookings/{id}/history", anyUser(api.GetBookingHistory))
+	http.HandleFunc("GET /api/v1/bookings/{id}/payments", customerOnly(api.ListBookingPayments))
+	http.HandleFunc("POST /api/v1/bookings/{id}/payments/complete", customerOnly(idempotent(api.CompleteBookingPayment)))
+	http.HandleFunc("GET /api/v1/bookings/{id}/cancellation", customerOnly(api.QuoteCancellation)) // refund if cancelled now
+	http.HandleFunc("POST /api/v1/reviews", customerOnly(api.CreateReview))
+
+	http.HandleFunc("GET /api/v1/vendor/properties", vendorOnly(api.ListVendorProperties))
+	http.HandleFunc("POST /api/v1/vendor/properties", vendorOnly(api.CreateVendorProperty))
+	http.HandleFunc("GET /api/v1/vendor/properties/{id}", vendorOnly(api.GetVendorProperty))
+	http.HandleFunc("PUT /api/v1/vendor/properties/{id}", vendorOnly(api.UpdateVendorProperty))
+	http.HandleFunc("DELETE /api/v1/vendor/properties/{id}", vendorOnly(api.DeleteVendorProperty))
+	http.HandleFunc("GET /api/v1/vendor/rooms", vendorOnly(api.ListVendorRooms)) // ?property_id= for one property
+	http.HandleFunc("POST /api/v1/vendor/rooms", vendorOnly(api.CreateVendorRoom))
+	http.HandleFunc("GET /api/v1/vendor/rooms/{id}", vendorOnly(api.GetVendorRoom))
+	http.HandleFunc("PUT /api/v1/vendor/rooms/{id}", vendorOnly(api.UpdateVendorRoom))
+	http.HandleFunc("DELETE /api/v1/vendor/rooms/{id}", vendorOnly(api.DeleteVendorRoom))
+	http.HandleFunc("PUT /api/v1/vendor/rooms/{id}/cancellation-policy", vendorOnly(api.SetCancellationPolicy))
+	http.HandleFunc("GET /api/v1/vendor/rooms/{id}/rate-plans", vendorOnly(api.ListRatePlans))
+	http.HandleFunc("POST /api/v1/vendor/rooms/{id}/rate-plans", vendorOnly(api.CreateRatePlan))
+	http.HandleFunc("GET /api/v1/vendor/rooms/{id}/rate-calendar", vendorOnly(api.GetRateCalendar)) // ?month=YYYY-MM
+	http.HandleFunc("GET /api/v1/vendor/rooms/{id}/photos", vendorOnly(api.ListVendorRoomPhotos))
+	http.HandleFunc("POST /api/v1/vendor/rooms/{id}/photos", vendorOnly(api.CreateRoomPhoto)) // body is the image
+	http.HandleFunc("PUT /api/v1/vendor/rooms/{id}/photos/order", vendorOnly(api.OrderRoomPhotos))
+	http.HandleFunc("PUT /api/v1/vendor/photos/{id}/cover", vendorOnly(api.SetCoverPhoto))
+	http.HandleFunc("DELETE /api/v1/vendor/photos/{id}", vendorOnly(api.DeleteRoomPhoto))
+	http.HandleFunc("PUT /api/v1/vendor/rate-plans/{id}", vendorOnly(api.UpdateRatePlan))
+	http.HandleFunc("DELETE /api/v1/vendor/rate-plans/{id}", vendorOnly(api.DeleteRatePlan))
+	http.HandleFunc("GET /api/v1/vendor/promo-codes", vendorOnly(api.ListVendorPromoCodes))
+	http.HandleFunc("POST /api/v1/vendor/promo-codes", vendorOnly(api.CreateVendorPromoCode))
+	http.HandleFunc("PUT /api/v1/vendor/promo-codes/{id}/active", vendorOnly(api.SetVendorPromoCodeActive))
+	http.HandleFunc("GET /api/v1/vendor/payments", vendorOnly(api.ListVendorPayments)) // with promo code discounts
+	http.HandleFunc("GET /api/v1/vendor/bookings", vendorOnly(api.ListVendorBookings))
+
+	// Message threads are open to both participants and admins; the service
+	// checks who may read or post.
+	http.HandleFunc("GET /api/v1/threads", anyUser(api.ListThreads))
+	http.HandleFunc("POST /api/v1/threads", anyUser(api.CreateThread))
+	http.HandleFunc("GET /api/v1/threads/unread", anyUser(api.UnreadMessages))
+	http.HandleFunc("GET /api/v1/threads/{id}", anyUser(api.GetThread))
+	http.HandleFunc("POST /api/v1/threads/{id}/messages", anyUser(api.CreateMessage))
+
+	// Support tickets; admins list every ticket and filter with ?status=,
+	// ?priority= and ?category=.
+	http.HandleFunc("GET /api/v1/tickets", anyUser(api.ListTickets))
+	http.HandleFunc("POST /api/v1/tickets", anyUser(api.CreateTicket))
+	http.HandleFunc("GET /api/v1/tickets/{id}", anyUser(api.GetTicket))
+	http.HandleFunc("POST /api/v1/tickets/{id}/replies", anyUser(api.CreateTicketReply))
+	http.HandleFunc("PUT /api/v1/tickets/{id}/status", anyUser(api.SetTicketStatus))
+	http.HandleFunc("PUT /api/v1/tickets/{id}/triage", adminOnly(api.TriageTicket))
+	http.HandleFunc("/api/", api.NotFound)
 }
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"hotelm/db"
+	"hotelm/models"
+	"hotelm/money"
+	"hotelm/repository"
+	"hotelm/session"
+)
+
+// Actions recorded in the audit log.
+const (
+	AuditSuspend    = "suspend"
+	AuditUnsuspend  = "unsuspend"
+	AuditDelete     = "delete"
+	AuditRefund     = "refund"
+	AuditHideReview = "hide"
+	AuditShowReview = "show"
+	AuditSetupCode  = "issue_setup_code"
+)
+
+// DefaultAuditLogSize is the number of audit entries shown by default.
+const DefaultAuditLogSize = 200
+
+// currentAdmin returns the logged-in admin.
+func currentAdmin(ctx context.Context) (*models.Admin, error) {
+	admin, ok := session.AdminFromContext(ctx)
+	if !ok {
+		return nil, ErrNoAdmin
+	}
+	return admin, nil
+}
+
+// audit records an action of the admin in the audit log.
+func audit(q db.Querier, admin *models.Admin, action, targetType string, targetID int, details string) error {
+	return repository.CreateAuditEntry(q, models.AuditEntry{
+		AdminID:    admin.AdminID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Details:    details,
+	})
+}
+
+// CreateAdmin validates a new admin's details, hashes the password and
+// creates the account. Admins cannot register themselves; this is used by the
+// create-admin command.
+func CreateAdmin(admin models.Admin, password string) (int, error) {
+	admin.Name = strings.TrimSpace(admin.Name)
+	admin.Email = strings.TrimSpace(admin.Email)
+	if admin.Name == "" || admin.Email == "" {
+		return 0, invalidf("name and email are required")
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return 0, err
+	}
+	admin.PasswordHash = hash
+
+	id, err := repository.CreateAdmin(db.DB, admin)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create admin: %w", err)
+	}
+	return id, nil
+}
+
+// ListCustomers returns all customers, or those whose name or email contains
+// search.
+func ListCustomers(ctx context.Context, search string) ([]models.Customer, error) {
+	if _, err := currentAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if search = strings.TrimSpace(search); search != "" {
+		return repository.SearchCustomers(db.DB, search)
+	}
+	return repository.GetAllCustomers(db.DB)
+}
+
+// SuspendCustomer suspends a customer, or lifts the suspension. A suspended
+// customer cannot log in and is logged out of existing sessions.
+func SuspendCustomer(ctx context.Context, customerID int, suspended bool) error {
+	admin, err := currentAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	action := AuditSuspend
+	if !suspended {
+		action = AuditUnsuspend
+	}
+	return db.WithTx(func(tx *sql.Tx) error {
+		if err := repository.SetCustomerSuspended(tx, customerID, suspended); err != nil {
+			return err
+		}
+		return audit(tx, admin, action, "customer", customerID, "")
+	})
+}
+
+// DeleteCustomerAsAdmin deletes a customer together with their bookings,
+// payments and reviews.
+func DeleteCustomerAsAdmin(ctx context.Context, customerID int) error {
+	admin, err := currentAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	return db.WithTx(func(tx *sql.Tx) error {
+		customer, err := repository.GetCustomerByID(tx, customerID)
+		if err != nil {
+			return err
+		}
+		if err := repository.DeleteCustomer(tx, customerID); err != nil {
+			return err
+		}
+		return audit(tx, admin, AuditDelete, "customer", customerID, customer.Email)
+	})
+}
+
+// ListVendors returns all vendors, or those whose name or email contains
+// search.
+func ListVendors(ctx context.Context, search string) ([]models.Vendor, error) {
+	if _, err := currentAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if search = strings.TrimSpace(search); search != "" {
+		return repository.SearchVendors(db.DB, search)
+	}
+	return repository.GetAllVendors(db.DB)
+}
+
+// SuspendVendor suspends a vendor, or lifts the suspension. A suspended
+// vendor cannot log in and is logged out of existing sessions.
+func SuspendVendor(ctx context.Context, vendorID int, suspended bool) error {
+	admin, err := currentAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	action := AuditSuspend
+	if !suspended {
+		action = AuditUnsuspend
+	}
+	return db.WithTx(func(tx *sql.Tx) error {
+		if err := repository.SetVendorSuspended(tx, vendorID, suspended); err != nil {
+			return err
+		}
+		return audit(tx, admin, action, "vendor", vendorID, "")
+	})
+}
+
+// DeleteVendorAsAdmin deletes a vendor together with their rooms and the
+// bookings of those rooms.
+func DeleteVendorAsAdmin(ctx context.Context, vendorID int) error {
+	admin, err := currentAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	return db.WithTx(func(tx *sql.Tx) error {
+		vendor, err := repository.GetVendorByID(tx, vendorID)
+		if err != nil {
+			return err
+		}
+		if err := repository.DeleteVendor(tx, vendorID); err != nil {
+			return err
+		}
+		return audit(tx, admin, AuditDelete, "vendor", vendorID, vendor.Email)
+	})
+}
+
+// ListAllBookings returns every booking, newest first.
+func ListAllBookings(ctx context.Context) ([]models.Booking, error) {
+	if _, err := currentAdmin(ctx); err != nil {
+		return nil, err
+	}
+	return repository.GetAllBookings(db.DB)
+}
+
+// ListAllPayments returns every payment, refunds included, newest first.
+func ListAllPayments(ctx context.Context) ([]models.Payment, error) {
+	if _, err := currentAdmin(ctx); err != nil {
+		return nil, err
+	}
+	return repository.GetAllPayments(db.DB)
+}
+
+// RefundBooking refunds part or all of what was paid for a booking. The
+// refund is recorded as a payment with a negative amount; once everything has
+// been refunded the booking is marked 'Refunded'. It returns the ID of the
+// refund payment. The amount must be in the booking's currency. The refund is
+// sent to the payment gateway after it has been recorded; if the gateway
+// fails, the error is returned and the refund payment shows its outcome.
+func RefundBooking(ctx context.Context, bookingID int, amount money.Money, reason string) (int, error) {
+	admin, err := currentAdmin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !amount.IsPositive() {
+		return 0, invalidf("refund amount must be positive")
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return 0, invalidf("a reason is required for a refund")
+	}
+
+	var refund pendingRefund
+	err = db.WithTx(func(tx *sql.Tx) error {
+		// Lock the booking so concurrent refunds cannot both pass the check.
+		if _, err := repository.GetBookingByIDForUpdate(tx, bookingID); err != nil {
+			return err
+		}
+		paid, err := repository.GetNetPaidForBooking(tx, bookingID)
+		if err != nil {
+			return err
+		}
+		if !amount.SameCurrency(paid) {
+			return invalidf("refund must be in %s, the currency of the booking", paid.Currency)
+		}
+		if amount.Cmp(paid) > 0 {
+			return invalidf("refund of %s exceeds the %s paid for this booking", amount, paid)
+		}
+
+		refund, err = recordRefund(tx, bookingID, amount, paid)
+		if err != nil {
+			return err
+		}
+		return audit(tx, admin, AuditRefund, "booking", bookingID, fmt.Sprintf("%s: %s", amount, reason))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return refund.PaymentID, sendRefund(ctx, refund)
+}
+
+// ListAllReviews returns every review, hidden ones included, newest first.
+func ListAllReviews(ctx context.Context) ([]models.Review, error) {
+	if _, err := currentAdmin(ctx); err != nil {
+		return nil, err
+	}
+	reviews, err := repository.GetAllReviews(db.DB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve reviews: %w", err)
+	}
+	return reviews, nil
+}
+
+// SetReviewHidden hides a review from its room and the room's rating, or
+// shows it again.
+func SetReviewHidden(ctx context.Context, reviewID int, hidden bool) error {
+	admin, err := currentAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	action := AuditHideReview
+	if !hidden {
+		action = AuditShowReview
+	}
+	return db.WithTx(func(tx *sql.Tx) error {
+		if err := repository.SetReviewHidden(tx, reviewID, hidden); err != nil {
+			return err
+		}
+		return audit(tx, admin, action, "review", reviewID, "")
+	})
+}
+
+// GetAuditLog returns the most recent admin actions, newest first.
+func GetAuditLog(ctx context.Context, limit int) ([]models.AuditEntry, error) {
+	if _, err := currentAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = DefaultAuditLogSize
+	}
+	return repository.GetAuditEntries(db.DB, limit)
+}
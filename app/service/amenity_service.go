@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"hotelm/db"
+	"hotelm/models"
+	"hotelm/repository"
+)
+
+// Audit actions for the amenity catalog.
+const (
+	AuditCreateAmenity = "create_amenity"
+	AuditRenameAmenity = "rename_amenity"
+	AuditDeleteAmenity = "delete_amenity"
+)
+
+// maxAmenityName is the longest amenity name, in characters.
+const maxAmenityName = 100
+
+// GetAmenities returns the amenity catalog, by name.
+func GetAmenities() ([]models.Amenity, error) {
+	return repository.GetAmenities(db.DB)
+}
+
+// normalizeAmenity tidies the spacing of an amenity's name, sets its slug
+// and checks them.
+func normalizeAmenity(a *models.Amenity) error {
+	a.Name = strings.Join(strings.Fields(a.Name), " ")
+	a.Slug = models.AmenitySlug(a.Name)
+	if a.Slug == "" {
+		return invalidf("amenity name must contain a letter or digit")
+	}
+	if utf8.RuneCountInString(a.Name) > maxAmenityName {
+		return invalidf("amenity name must be at most %d characters", maxAmenityName)
+	}
+	return nil
+}
+
+// duplicateAmenity converts a clash of slugs to a validation error naming
+// the amenity that already exists.
+func duplicateAmenity(q db.Querier, a models.Amenity, err error) error {
+	if !errors.Is(err, repository.ErrDuplicateAmenity) {
+		return err
+	}
+	amenities, lookupErr := repository.GetAmenities(q)
+	if lookupErr != nil {
+		return lookupErr
+	}
+	for _, existing := range amenities {
+		if existing.Slug == a.Slug {
+			return invalidf("amenity %q already exists as %q", a.Name, existing.Name)
+		}
+	}
+	return invalidf("amenity %q already exists", a.Name)
+}
+
+// CreateAmenity adds an amenity to the catalog on behalf of the logged-in
+// admin.
+func CreateAmenity(ctx context.Context, name string) (int, error) {
+	admin, err := currentAdmin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	a := models.Amenity{Name: name}
+	if err := normalizeAmenity(&a); err != nil {
+		return 0, err
+	}
+	var id int
+	err = db.WithTx(func(tx *sql.Tx) error {
+		if id, err = repository.CreateAmenity(tx, a); err != nil {
+			return err
+		}
+		return audit(tx, admin, AuditCreateAmenity, "amenity", id, a.Name)
+	})
+	if err != nil {
+		return 0, duplicateAmenity(db.DB, a, err)
+	}
+	return id, nil
+}
+
+// GetAmenity returns an amenity of the catalog.
+func GetAmenity(id int) (*models.Amenity, error) {
+	return repository.GetAmenityByID(db.DB, id)
+}
+
+// RenameAmenity renames an amenity on behalf of the logged-in admin. The
+// rooms offering it keep it under the new name.
+func RenameAmenity(ctx context.Context, id int, name string) error {
+	admin, err := currentAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	a := models.Amenity{AmenityID: id, Name: name}
+	if err := normalizeAmenity(&a); err != nil {
+		return err
+	}
+	err = db.WithTx(func(tx *sql.Tx) error {
+		old, err := repository.GetAmenityByID(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := repository.UpdateAmenity(tx, a); err != nil {
+			return err
+		}
+		return audit(tx, admin, AuditRenameAmenity, "amenity", id, fmt.Sprintf("%s -> %s", old.Name, a.Name))
+	})
+	return duplicateAmenity(db.DB, a, err)
+}
+
+// DeleteAmenity removes an amenity from the catalog, and from the rooms
+// offering it, on behalf of the logged-in admin.
+func DeleteAmenity(ctx context.Context, id int) error {
+	admin, err := currentAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	return db.WithTx(func(tx *sql.Tx) error {
+		a, err := repository.GetAmenityByID(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := repository.DeleteAmenity(tx, id); err != nil {
+			return err
+		}
+		return audit(tx, admin, AuditDeleteAmenity, "amenity", id, fmt.Sprintf("%s, offered by %d rooms", a.Name, a.Rooms))
+	})
+}
+
+// roomAmenityIDs checks that the amenities of a room are in the catalog and
+// returns their IDs, each once.
+func roomAmenityIDs(q db.Querier, amenities []models.Amenity) ([]int, error) {
+	if len(amenities) == 0 {
+		return nil, nil
+	}
+	catalog, err := repository.GetAmenities(q)
+	if err != nil {
+		return nil, err
+	}
+	known := map[int]bool{}
+	for _, a := range catalog {
+		known[a.AmenityID] = true
+	}
+	seen := map[int]bool{}
+	var ids []int
+	for _, a := range amenities {
+		if !known[a.AmenityID] {
+			return nil, invalidf("there is no amenity %d", a.AmenityID)
+		}
+		if !seen[a.AmenityID] {
+			seen[a.AmenityID] = true
+			ids = append(ids, a.AmenityID)
+		}
+	}
+	return ids, nil
+}
@@ -1,42 +1,334 @@
 package service
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 
+	"golang.org/x/crypto/bcrypt"
+
+	"hotelm/db"
+	"hotelm/models"
 	"hotelm/repository"
 	"hotelm/session"
 )
 
-// LoginCustomer checks if a customer exists with the given id and name.
-// If successful, it sets the global session pointer to the customer.
-func LoginCustomer(customerID int, name string) error {
-	customer, err := repository.GetCustomerByID(customerID)
+// MinPasswordLength is the shortest password accepted at registration.
+const MinPasswordLength = 8
+
+// maxPasswordLength is the longest password bcrypt can hash without
+// silently truncating it.
+const maxPasswordLength = 72
+
+// ErrInvalidCredentials is returned for an unknown email or a wrong password,
+// so a failed login does not reveal which accounts exist.
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+// ErrPasswordNotSet is returned when an account created before passwords
+// existed logs in with the setup code an admin issued for it. The user must
+// set a password first.
+var ErrPasswordNotSet = errors.New("password has not been set for this account")
+
+// PasswordSetupCodeHours is how long a password setup code stays valid.
+const PasswordSetupCodeHours = 72
+
+// ErrAccountSuspended is returned when a suspended customer or vendor tries
+// to log in.
+var ErrAccountSuspended = errors.New("this account has been suspended")
+
+// ValidatePassword checks that a password meets the length requirements.
+func ValidatePassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return invalidf("password must be at least %d characters", MinPasswordLength)
+	}
+	if len(password) > maxPasswordLength {
+		return invalidf("password must be at most %d bytes", maxPasswordLength)
+	}
+	if strings.TrimSpace(password) == "" {
+		return invalidf("password must not be blank")
+	}
+	return nil
+}
+
+// HashPassword validates a password and returns its bcrypt hash.
+func HashPassword(password string) (string, error) {
+	if err := ValidatePassword(password); err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// checkPassword reports whether password matches the stored bcrypt hash.
+func checkPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// RegisterCustomer validates a new customer's details, hashes the password
+// and creates the account.
+func RegisterCustomer(customer models.Customer, password string) (int, error) {
+	if customer.Name == "" || customer.Phone == "" || customer.Email == "" || customer.Address == "" {
+		return 0, invalidf("all fields are required")
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return 0, err
+	}
+	customer.PasswordHash = hash
+
+	id, err := repository.CreateCustomer(db.DB, customer)
+	if err != nil {
+		return 0, fmt.Errorf("registration failed: %w", err)
+	}
+	return id, nil
+}
+
+// RegisterVendor validates a new vendor's details, hashes the password and
+// creates the account.
+func RegisterVendor(vendor models.Vendor, password string) (int, error) {
+	if vendor.Name == "" || vendor.Email == "" || vendor.Phone == "" || vendor.HotelName == "" || vendor.Address == "" {
+		return 0, invalidf("all fields are required")
+	}
+	hash, err := HashPassword(password)
 	if err != nil {
-		return fmt.Errorf("customer login failed: %v", err)
+		return 0, err
 	}
-	// Check if the provided name matches the retrieved customer
-	if customer.Name != name {
-		return fmt.Errorf("customer login failed: name does not match")
+	vendor.PasswordHash = hash
+
+	// The vendor's hotel becomes their first property.
+	var id int
+	err = db.WithTx(func(tx *sql.Tx) error {
+		if id, err = repository.CreateVendor(tx, vendor); err != nil {
+			return err
+		}
+		_, err := repository.CreateProperty(tx, models.Property{
+			VendorID:     id,
+			Name:         vendor.HotelName,
+			Address:      vendor.Address,
+			Timezone:     DefaultTimezone,
+			CheckinTime:  DefaultCheckinTime,
+			CheckoutTime: DefaultCheckoutTime,
+			Phone:        vendor.Phone,
+			Email:        vendor.Email,
+		})
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("registration failed: %w", err)
 	}
+	return id, nil
+}
 
-	// Set the global session pointer for the logged-in customer.
-	session.SetCurrentUser(customer)
+// LoginCustomer checks the customer's email and password.
+// If successful, it stores the customer in the request's session.
+func LoginCustomer(w http.ResponseWriter, r *http.Request, email, password string) error {
+	customer, err := repository.GetCustomerByEmail(db.DB, email)
+	if err != nil {
+		return ErrInvalidCredentials
+	}
+	if customer.PasswordHash == "" {
+		return passwordNotSet(session.RoleCustomer, customer.CustomerID, password)
+	}
+	if !checkPassword(customer.PasswordHash, password) {
+		return ErrInvalidCredentials
+	}
+	if customer.SuspendedAt != nil {
+		return ErrAccountSuspended
+	}
+
+	// Store the logged-in customer in the session.
+	if err := session.SetCurrentUser(w, r, customer); err != nil {
+		return fmt.Errorf("customer login failed: %w", err)
+	}
 	return nil
 }
 
-// LoginVendor checks if a vendor exists with the given id and name.
-// If successful, it sets the global session pointer to the vendor.
-func LoginVendor(vendorID int, name string) error {
-	vendor, err := repository.GetVendorByID(vendorID)
+// LoginVendor checks the vendor's email and password.
+// If successful, it stores the vendor in the request's session.
+func LoginVendor(w http.ResponseWriter, r *http.Request, email, password string) error {
+	vendor, err := repository.GetVendorByEmail(db.DB, email)
 	if err != nil {
-		return fmt.Errorf("vendor login failed: %v", err)
+		return ErrInvalidCredentials
+	}
+	if vendor.PasswordHash == "" {
+		return passwordNotSet(session.RoleVendor, vendor.VendorID, password)
+	}
+	if !checkPassword(vendor.PasswordHash, password) {
+		return ErrInvalidCredentials
 	}
-	// Check if the provided name matches the retrieved vendor
-	if vendor.Name != name {
-		return fmt.Errorf("vendor login failed: name does not match")
+	if vendor.SuspendedAt != nil {
+		return ErrAccountSuspended
 	}
 
-	// Set the global session pointer for the logged-in vendor.
-	session.SetCurrentUser(vendor)
+	// Store the logged-in vendor in the session.
+	if err := session.SetCurrentUser(w, r, vendor); err != nil {
+		return fmt.Errorf("vendor login failed: %w", err)
+	}
 	return nil
 }
+
+// LoginAdmin checks the admin's email and password.
+// If successful, it stores the admin in the request's session.
+func LoginAdmin(w http.ResponseWriter, r *http.Request, email, password string) error {
+	admin, err := repository.GetAdminByEmail(db.DB, email)
+	if err != nil {
+		return ErrInvalidCredentials
+	}
+	if !checkPassword(admin.PasswordHash, password) {
+		return ErrInvalidCredentials
+	}
+
+	// Store the logged-in admin in the session.
+	if err := session.SetCurrentUser(w, r, admin); err != nil {
+		return fmt.Errorf("admin login failed: %w", err)
+	}
+	return nil
+}
+
+// hashSetupCode returns the hash under which a setup code is stored.
+func hashSetupCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToUpper(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
+
+// passwordNotSet reports a login to an account without a password. Only a
+// login with the account's setup code learns that the account exists; any
+// other password fails like a wrong one.
+func passwordNotSet(role string, accountID int, code string) error {
+	valid, err := repository.PasswordSetupCodeValid(db.DB, role, accountID, hashSetupCode(code))
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return ErrInvalidCredentials
+	}
+	return ErrPasswordNotSet
+}
+
+// useSetupCode consumes the setup code of an account and stores its first
+// password, in one transaction so a code sets one password.
+func useSetupCode(role string, accountID int, code, hash string, setPassword func(q db.Querier) error) error {
+	return db.WithTx(func(tx *sql.Tx) error {
+		used, err := repository.UsePasswordSetupCode(tx, role, accountID, hashSetupCode(code))
+		if err != nil {
+			return err
+		}
+		if !used {
+			return invalidf("the email or setup code is wrong, or the code has expired")
+		}
+		if err := setPassword(tx); errors.Is(err, repository.ErrNotFound) {
+			return invalidf("a password is already set for this account")
+		} else if err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// SetInitialCustomerPassword sets the first password for a customer account
+// created before passwords existed, then logs the customer in. The caller
+// proves ownership with the setup code an admin issued for the account.
+func SetInitialCustomerPassword(w http.ResponseWriter, r *http.Request, email, code, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	customer, err := repository.GetCustomerByEmail(db.DB, email)
+	if err != nil {
+		return invalidf("the email or setup code is wrong, or the code has expired")
+	}
+	err = useSetupCode(session.RoleCustomer, customer.CustomerID, code, hash, func(q db.Querier) error {
+		return repository.SetCustomerPassword(q, customer.CustomerID, hash)
+	})
+	if err != nil {
+		return err
+	}
+	customer.PasswordHash = hash
+
+	if err := session.SetCurrentUser(w, r, customer); err != nil {
+		return fmt.Errorf("customer login failed: %w", err)
+	}
+	return nil
+}
+
+// SetInitialVendorPassword sets the first password for a vendor account
+// created before passwords existed, then logs the vendor in. The caller
+// proves ownership with the setup code an admin issued for the account.
+func SetInitialVendorPassword(w http.ResponseWriter, r *http.Request, email, code, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	vendor, err := repository.GetVendorByEmail(db.DB, email)
+	if err != nil {
+		return invalidf("the email or setup code is wrong, or the code has expired")
+	}
+	err = useSetupCode(session.RoleVendor, vendor.VendorID, code, hash, func(q db.Querier) error {
+		return repository.SetVendorPassword(q, vendor.VendorID, hash)
+	})
+	if err != nil {
+		return err
+	}
+	vendor.PasswordHash = hash
+
+	if err := session.SetCurrentUser(w, r, vendor); err != nil {
+		return fmt.Errorf("vendor login failed: %w", err)
+	}
+	return nil
+}
+
+// IssuePasswordSetupCode creates a one-time code with which the customer or
+// vendor accountID, created before passwords existed, can set its first
+// password, and returns it with the account's email. The admin hands the
+// code to the account holder; only its hash is kept.
+func IssuePasswordSetupCode(ctx context.Context, role string, accountID int) (email, code string, err error) {
+	admin, err := currentAdmin(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	var passwordHash string
+	switch role {
+	case session.RoleCustomer:
+		customer, err := repository.GetCustomerByID(db.DB, accountID)
+		if err != nil {
+			return "", "", err
+		}
+		email, passwordHash = customer.Email, customer.PasswordHash
+	case session.RoleVendor:
+		vendor, err := repository.GetVendorByID(db.DB, accountID)
+		if err != nil {
+			return "", "", err
+		}
+		email, passwordHash = vendor.Email, vendor.PasswordHash
+	default:
+		return "", "", invalidf("unknown role %q", role)
+	}
+	if passwordHash != "" {
+		return "", "", invalidf("%s already has a password", email)
+	}
+
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate setup code: %w", err)
+	}
+	code = strings.ToUpper(hex.EncodeToString(b))
+	err = db.WithTx(func(tx *sql.Tx) error {
+		if err := repository.SetPasswordSetupCode(tx, role, accountID, hashSetupCode(code), PasswordSetupCodeHours); err != nil {
+			return err
+		}
+		return audit(tx, admin, AuditSetupCode, role, accountID, email)
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return email, code, nil
+}
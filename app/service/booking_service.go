@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"hotelm/db"
+	"hotelm/models"
+	"hotelm/repository"
+	"hotelm/session"
+)
+
+// Booking statuses. A booking is confirmed when made. The vendor checks the
+// guest in and out, or marks a no-show; a confirmed booking can also be
+// cancelled. Checked-out, cancelled and no-show bookings are final.
+const (
+	BookingConfirmed  = "confirmed"
+	BookingCheckedIn  = "checked_in"
+	BookingCheckedOut = "checked_out"
+	BookingCancelled  = "cancelled"
+	BookingNoShow     = "no_show"
+)
+
+// AuditBookingStatus is the audit action for a booking status changed by an
+// admin.
+const AuditBookingStatus = "booking_status"
+
+// maxReasonLength is the longest reason accepted for a status change.
+const maxReasonLength = 500
+
+// bookingTransitions lists, for each status, the statuses it can move to and
+// the roles allowed to make each move.
+var bookingTransitions = map[string]map[string][]string{
+	BookingConfirmed: {
+		BookingCheckedIn: {session.RoleVendor, session.RoleAdmin},
+		BookingCancelled: {session.RoleCustomer, session.RoleVendor, session.RoleAdmin},
+		BookingNoShow:    {session.RoleVendor, session.RoleAdmin},
+	},
+	BookingCheckedIn: {
+		BookingCheckedOut: {session.RoleVendor, session.RoleAdmin},
+	},
+}
+
+// bookingStatusOrder fixes the order in which transitions are offered.
+var bookingStatusOrder = []string{BookingCheckedIn, BookingCheckedOut, BookingNoShow, BookingCancelled}
+
+// BookingTransitions returns the statuses a booking in the given status can
+// move to when changed by role, ignoring dates.
+func BookingTransitions(status, role string) []string {
+	var next []string
+	for _, to := range bookingStatusOrder {
+		for _, r := range bookingTransitions[status][to] {
+			if r == role {
+				next = append(next, to)
+			}
+		}
+	}
+	return next
+}
+
+// CanCancelBooking reports whether the customer can still cancel a booking:
+// it is confirmed and the stay has not started.
+func CanCancelBooking(booking models.Booking) bool {
+	return booking.Status == BookingConfirmed && checkBookingDates(booking, BookingCancelled, session.RoleCustomer) == nil
+}
+
+// checkBookingDates returns an error if the move to status is not allowed yet
+// or any more, as of today where the property is. Guests are checked in
+// during their stay and marked as no-show from the check-in date; customers
+// cancel before the stay starts.
+func checkBookingDates(booking models.Booking, status, role string) error {
+	today := today(bookingLocation(booking))
+	switch status {
+	case BookingCheckedIn:
+		if today.Before(booking.CheckinDate) {
+			return invalidf("guests cannot be checked in before %s", booking.CheckinDate.Format(dateLayout))
+		}
+		if !today.Before(booking.CheckoutDate) {
+			return invalidf("the stay ended on %s", booking.CheckoutDate.Format(dateLayout))
+		}
+	case BookingNoShow:
+		if today.Before(booking.CheckinDate) {
+			return invalidf("a no-show cannot be recorded before %s", booking.CheckinDate.Format(dateLayout))
+		}
+	case BookingCancelled:
+		if role == session.RoleCustomer && !today.Before(booking.CheckinDate) {
+			return invalidf("a booking can only be cancelled before check-in")
+		}
+	}
+	return nil
+}
+
+// checkBookingAccess returns an error unless p may act on the booking: as its
+// customer, as the vendor of its room, or as an admin.
+func checkBookingAccess(q db.Querier, p participant, booking *models.Booking) error {
+	switch p.side {
+	case repository.SideCustomer:
+		if booking.CustomerID != p.id {
+			return fmt.Errorf("%w: booking does not belong to the logged-in customer", ErrForbidden)
+		}
+	case repository.SideVendor:
+		room, err := repository.GetRoomByID(q, booking.RoomID)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve room: %w", err)
+		}
+		if room.VendorID != p.id {
+			return fmt.Errorf("%w: booking is not for a room of the logged-in vendor", ErrForbidden)
+		}
+	}
+	return nil
+}
+
+// SetBookingStatus moves a booking to a new status on behalf of the
+// logged-in customer, vendor or admin, and records who made the change. A
+// cancelled booking is refunded as refundCancellation describes. An admin's
+// change is also written to the audit log.
+func SetBookingStatus(ctx context.Context, bookingID int, status, reason string) error {
+	p, err := currentParticipant(ctx)
+	if err != nil {
+		return err
+	}
+	reason = strings.TrimSpace(reason)
+	if len(reason) > maxReasonLength {
+		return invalidf("reason must be at most %d characters", maxReasonLength)
+	}
+
+	var settle settlement
+	err = db.WithTx(func(tx *sql.Tx) error {
+		booking, err := repository.GetBookingByIDForUpdate(tx, bookingID)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve booking: %w", err)
+		}
+		if err := checkBookingAccess(tx, p, booking); err != nil {
+			return err
+		}
+
+		allowed := false
+		for _, to := range BookingTransitions(booking.Status, p.role()) {
+			if to == status {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return invalidf("a %s booking cannot be moved to %s", strings.ReplaceAll(booking.Status, "_", " "), strings.ReplaceAll(status, "_", " "))
+		}
+		if err := checkBookingDates(*booking, status, p.role()); err != nil {
+			return err
+		}
+
+		if err := repository.UpdateBookingStatus(tx, bookingID, status); err != nil {
+			return err
+		}
+		if status == BookingCancelled {
+			settle, err = refundCancellation(tx, booking, p.role())
+			if err != nil {
+				return err
+			}
+			if settle.Refund.Amount.IsPositive() {
+				if reason != "" {
+					reason += "; "
+				}
+				reason += "refunded " + settle.Refund.Amount.String()
+			}
+		}
+		event := models.BookingStatusEvent{
+			BookingID:  bookingID,
+			FromStatus: booking.Status,
+			ToStatus:   status,
+			ActorRole:  p.role(),
+			ActorID:    p.id,
+			Reason:     reason,
+		}
+		if err := repository.CreateBookingStatusEvent(tx, event); err != nil {
+			return err
+		}
+		if p.admin {
+			admin, err := currentAdmin(ctx)
+			if err != nil {
+				return err
+			}
+			details := booking.Status + " -> " + status
+			if reason != "" {
+				details += ": " + reason
+			}
+			return audit(tx, admin, AuditBookingStatus, "booking", bookingID, details)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// The booking is cancelled whatever the gateway answers; a void or
+	// refund that did not go through is logged for follow-up.
+	_ = settle.send(ctx)
+	return nil
+}
+
+// CancelBookingForCustomer cancels a booking of the logged-in customer before
+// the stay starts and refunds it under the booking's cancellation policy.
+// The booking, its payments and any review are kept; the dates become free
+// for other guests.
+func CancelBookingForCustomer(ctx context.Context, bookingID int, reason string) error {
+	if _, ok := session.CustomerFromContext(ctx); !ok {
+		return ErrNoCustomer
+	}
+	return SetBookingStatus(ctx, bookingID, BookingCancelled, reason)
+}
+
+// GetVendorBookings retrieves the bookings of the logged-in vendor's rooms.
+func GetVendorBookings(ctx context.Context) ([]models.Booking, error) {
+	vendor, ok := session.VendorFromContext(ctx)
+	if !ok {
+		return nil, ErrNoVendor
+	}
+	bookings, err := repository.GetBookingsByVendorID(db.DB, vendor.VendorID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve vendor bookings: %w", err)
+	}
+	return bookings, nil
+}
+
+// GetBookingHistory returns the status changes of a booking the logged-in
+// user may see, oldest first.
+func GetBookingHistory(ctx context.Context, bookingID int) ([]models.BookingStatusEvent, error) {
+	p, err := currentParticipant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	booking, err := repository.GetBookingByID(db.DB, bookingID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve booking: %w", err)
+	}
+	if err := checkBookingAccess(db.DB, p, booking); err != nil {
+		return nil, err
+	}
+	return repository.GetBookingStatusEvents(db.DB, bookingID)
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"hotelm/db"
+	"hotelm/models"
+	"hotelm/money"
+	"hotelm/repository"
+	"hotelm/session"
+)
+
+// maxFreeCancellationDays is the longest free cancellation window a vendor
+// can offer.
+const maxFreeCancellationDays = 365
+
+// CancellationQuote is what a customer gets back when cancelling a booking,
+// in the booking's currency.
+type CancellationQuote struct {
+	Policy  models.CancellationPolicy `json:"policy"`
+	Paid    money.Money               `json:"paid"`
+	Refund  money.Money               `json:"refund"`
+	Penalty money.Money               `json:"penalty"`
+}
+
+// DescribeCancellationPolicy returns the policy in words, as shown to
+// customers.
+func DescribeCancellationPolicy(policy models.CancellationPolicy) string {
+	switch {
+	case policy.NonRefundable:
+		return "Non-refundable."
+	case policy.FreeDays == 0 && policy.PenaltyPercent == 0:
+		return "Free cancellation until check-in."
+	case policy.FreeDays == 0:
+		return fmt.Sprintf("Cancellation before check-in costs %g%% of the amount paid.", policy.PenaltyPercent)
+	case policy.PenaltyPercent == 0:
+		// A penalty-free policy with a window is the same as no window.
+		return "Free cancellation until check-in."
+	case policy.PenaltyPercent == 100:
+		return fmt.Sprintf("Free cancellation until %d days before check-in, non-refundable after.", policy.FreeDays)
+	}
+	return fmt.Sprintf("Free cancellation until %d days before check-in, %g%% penalty after.", policy.FreeDays, policy.PenaltyPercent)
+}
+
+// validateCancellationPolicy checks the limits of a policy.
+func validateCancellationPolicy(policy models.CancellationPolicy) error {
+	if policy.FreeDays < 0 || policy.FreeDays > maxFreeCancellationDays {
+		return invalidf("free cancellation days must be between 0 and %d", maxFreeCancellationDays)
+	}
+	if policy.PenaltyPercent < 0 || policy.PenaltyPercent > 100 {
+		return invalidf("penalty must be between 0 and 100 percent")
+	}
+	return nil
+}
+
+// cancellationRefund applies the booking's policy to a cancellation by the
+// customer on the given day. The penalty is rounded to the currency's minor
+// unit and the refund is the rest of what was paid.
+func cancellationRefund(booking models.Booking, paid money.Money, today time.Time) CancellationQuote {
+	policy := booking.CancellationPolicy
+	none := money.Zero(paid.Currency)
+	quote := CancellationQuote{Policy: policy, Paid: paid, Refund: none, Penalty: none}
+	if !paid.IsPositive() {
+		return quote
+	}
+	daysBefore := int(booking.CheckinDate.Sub(today).Hours() / 24)
+	switch {
+	case policy.NonRefundable:
+		quote.Penalty = paid
+	case policy.FreeDays > 0 && daysBefore >= policy.FreeDays:
+		// Within the free window. Without a window the penalty applies
+		// to every cancellation, as DescribeCancellationPolicy says.
+		quote.Penalty = none
+	default:
+		quote.Penalty = paid.Percent(policy.PenaltyPercent)
+	}
+	quote.Refund = paid.Sub(quote.Penalty)
+	return quote
+}
+
+// recordRefund records a refund of amount of the paid total of a locked
+// booking as a payment with a negative amount. A charge taken through the
+// payment gateway is refunded as pending; the caller sends it with
+// sendRefund once the transaction has committed, so a rollback can never
+// follow a refund that already went out. Charges made before gateways
+// existed are refunded in the payment records only, and once everything has
+// been refunded the booking is marked 'Refunded'.
+func recordRefund(tx *sql.Tx, bookingID int, amount, paid money.Money) (pendingRefund, error) {
+	charge, err := refundableCharge(tx, bookingID)
+	if err != nil {
+		return pendingRefund{}, err
+	}
+	refund := models.Payment{
+		PaymentMethod:   "refund",
+		PaymentStatus:   "Refunded",
+		TransactionDate: time.Now(),
+		Amount:          amount.Neg(),
+		BookingID:       bookingID,
+	}
+	if charge != "" {
+		if gateway == nil {
+			return pendingRefund{}, errNoGateway
+		}
+		refund.PaymentStatus = "Pending"
+		refund.Gateway = gateway.Name()
+	}
+	paymentID, err := repository.CreatePayment(tx, refund)
+	if err != nil {
+		return pendingRefund{}, err
+	}
+	full := paid.Sub(amount).IsZero()
+	if charge == "" && full {
+		if err := repository.UpdateBookingPaymentStatus(tx, bookingID, "Refunded"); err != nil {
+			return pendingRefund{}, err
+		}
+	}
+	return pendingRefund{PaymentID: paymentID, BookingID: bookingID, Charge: charge, Amount: amount, Full: full}, nil
+}
+
+// settlement is what a cancellation leaves to do at the gateway once its
+// transaction has committed.
+type settlement struct {
+	Voids  []models.Payment // charges to void with sendVoids
+	Refund pendingRefund
+}
+
+// send voids and refunds at the gateway. Failures are logged by sendVoids
+// and sendRefund for follow-up; the refund's error is returned.
+func (s settlement) send(ctx context.Context) error {
+	sendVoids(ctx, s.Voids)
+	return sendRefund(ctx, s.Refund)
+}
+
+// refundCancellation settles the payments of a locked booking being
+// cancelled by role. A charge still waiting on the customer is marked to be
+// voided. A customer is refunded according to the booking's policy, as of
+// today where the property is; a cancellation by the vendor, an admin or the
+// system is refunded in full.
+// Nothing is sent to the gateway: the returned settlement is sent once the
+// transaction has committed, so a rollback never releases a charge. Its
+// refund amount is zero when nothing is refunded.
+func refundCancellation(tx *sql.Tx, booking *models.Booking, role string) (settlement, error) {
+	s := settlement{Refund: pendingRefund{Amount: money.Zero(booking.TotalAmount.Currency)}}
+	voids, err := voidPendingPayments(tx, booking.BookingID)
+	if err != nil {
+		return settlement{}, err
+	}
+	s.Voids = voids
+	paid, err := repository.GetNetPaidForBooking(tx, booking.BookingID)
+	if err != nil {
+		return settlement{}, err
+	}
+	if len(voids) > 0 && !paid.IsPositive() {
+		return s, repository.UpdateBookingPaymentStatus(tx, booking.BookingID, "Voided")
+	}
+	refund := paid
+	if role == session.RoleCustomer {
+		refund = cancellationRefund(*booking, paid, today(bookingLocation(*booking))).Refund
+	}
+	if !refund.IsPositive() {
+		return s, nil
+	}
+	s.Refund, err = recordRefund(tx, booking.BookingID, refund, paid)
+	return s, err
+}
+
+// GetRoomCancellationPolicy returns the cancellation policy of a room.
+func GetRoomCancellationPolicy(roomID int) (models.CancellationPolicy, error) {
+	if _, err := repository.GetRoomByID(db.DB, roomID); err != nil {
+		return models.CancellationPolicy{}, fmt.Errorf("failed to retrieve room: %w", err)
+	}
+	return repository.GetCancellationPolicy(db.DB, roomID)
+}
+
+// SetRoomCancellationPolicy sets the cancellation policy of a room of the
+// logged-in vendor. It applies to bookings made from now on.
+func SetRoomCancellationPolicy(ctx context.Context, roomID int, policy models.CancellationPolicy) error {
+	if _, err := GetRoomByIDForVendor(ctx, roomID); err != nil {
+		return err
+	}
+	if err := validateCancellationPolicy(policy); err != nil {
+		return err
+	}
+	return repository.SetCancellationPolicy(db.DB, roomID, policy)
+}
+
+// QuoteCancellation returns the refund the logged-in customer would get for
+// cancelling a booking today, in the time zone of its property.
+func QuoteCancellation(ctx context.Context, bookingID int) (*CancellationQuote, error) {
+	booking, _, err := GetMyBooking(ctx, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	if !CanCancelBooking(*booking) {
+		return nil, invalidf("this booking can no longer be cancelled")
+	}
+	paid, err := repository.GetNetPaidForBooking(db.DB, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	quote := cancellationRefund(*booking, paid, today(bookingLocation(*booking)))
+	return &quote, nil
+}
@@ -0,0 +1,293 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"hotelm/db"
+	"hotelm/db/dbtest"
+	"hotelm/models"
+	"hotelm/money"
+	"hotelm/session"
+)
+
+func TestCancellationRefund(t *testing.T) {
+	checkin := time.Date(2026, 6, 20, 0, 0, 0, 0, time.UTC)
+	paid := money.New(10000, "USD")
+	tests := []struct {
+		name       string
+		policy     models.CancellationPolicy
+		daysBefore int
+		refund     int64
+		describe   string
+	}{
+		{"no window, no penalty", models.CancellationPolicy{}, 10, 10000,
+			"Free cancellation until check-in."},
+		{"no window, no penalty, check-in day", models.CancellationPolicy{}, 0, 10000,
+			"Free cancellation until check-in."},
+		{"no window, half penalty", models.CancellationPolicy{PenaltyPercent: 50}, 30, 5000,
+			"Cancellation before check-in costs 50% of the amount paid."},
+		{"no window, full penalty", models.CancellationPolicy{PenaltyPercent: 100}, 30, 0,
+			"Cancellation before check-in costs 100% of the amount paid."},
+		{"window, no penalty, outside", models.CancellationPolicy{FreeDays: 7}, 2, 10000,
+			"Free cancellation until check-in."},
+		{"window, half penalty, inside", models.CancellationPolicy{FreeDays: 7, PenaltyPercent: 50}, 8, 10000,
+			"Free cancellation until 7 days before check-in, 50% penalty after."},
+		{"window, half penalty, last free day", models.CancellationPolicy{FreeDays: 7, PenaltyPercent: 50}, 7, 10000,
+			"Free cancellation until 7 days before check-in, 50% penalty after."},
+		{"window, half penalty, outside", models.CancellationPolicy{FreeDays: 7, PenaltyPercent: 50}, 6, 5000,
+			"Free cancellation until 7 days before check-in, 50% penalty after."},
+		{"window, half penalty, check-in day", models.CancellationPolicy{FreeDays: 7, PenaltyPercent: 50}, 0, 5000,
+			"Free cancellation until 7 days before check-in, 50% penalty after."},
+		{"window, full penalty, inside", models.CancellationPolicy{FreeDays: 3, PenaltyPercent: 100}, 3, 10000,
+			"Free cancellation until 3 days before check-in, non-refundable after."},
+		{"window, full penalty, outside", models.CancellationPolicy{FreeDays: 3, PenaltyPercent: 100}, 1, 0,
+			"Free cancellation until 3 days before check-in, non-refundable after."},
+		{"non-refundable", models.CancellationPolicy{NonRefundable: true, FreeDays: 7}, 30, 0,
+			"Non-refundable."},
+		{"non-refundable, check-in day", models.CancellationPolicy{NonRefundable: true}, 0, 0,
+			"Non-refundable."},
+	}
+	for _, tt := range tests {
+		booking := models.Booking{CheckinDate: checkin, CancellationPolicy: tt.policy}
+		today := checkin.AddDate(0, 0, -tt.daysBefore)
+		quote := cancellationRefund(booking, paid, today)
+		if want := money.New(tt.refund, "USD"); quote.Refund != want {
+			t.Errorf("%s: refund = %s, want %s", tt.name, quote.Refund, want)
+		}
+		if sum := quote.Refund.Add(quote.Penalty); sum != paid {
+			t.Errorf("%s: refund %s and penalty %s do not add up to %s", tt.name, quote.Refund, quote.Penalty, paid)
+		}
+		if got := DescribeCancellationPolicy(tt.policy); got != tt.describe {
+			t.Errorf("%s: DescribeCancellationPolicy = %q, want %q", tt.name, got, tt.describe)
+		}
+	}
+}
+
+func TestCancellationRefundNothingPaid(t *testing.T) {
+	booking := models.Booking{
+		CheckinDate:        time.Date(2026, 6, 20, 0, 0, 0, 0, time.UTC),
+		CancellationPolicy: models.CancellationPolicy{PenaltyPercent: 50},
+	}
+	quote := cancellationRefund(booking, money.Zero("EUR"), booking.CheckinDate.AddDate(0, 0, -5))
+	if !quote.Refund.IsZero() || !quote.Penalty.IsZero() {
+		t.Errorf("refund %s, penalty %s, want nothing", quote.Refund, quote.Penalty)
+	}
+}
+
+// useTestDB makes the services use a scripted database answering with h for
+// the rest of the test.
+func useTestDB(t *testing.T, h dbtest.Handler) *dbtest.DB {
+	t.Helper()
+	conn, rec := dbtest.Open(h)
+	previous := db.DB
+	db.DB = conn
+	t.Cleanup(func() {
+		db.DB = previous
+		conn.Close()
+	})
+	return rec
+}
+
+// asCustomer returns a context logged in as the customer.
+func asCustomer(customerID int) context.Context {
+	return session.NewContext(context.Background(), &session.Principal{
+		Role:     session.RoleCustomer,
+		Customer: &models.Customer{CustomerID: customerID},
+	})
+}
+
+// testBooking returns booking 1 of customer 7 in room 3, a stay of two
+// nights at $100 starting in ten days, in a property on UTC.
+func testBooking(status, paymentStatus string) models.Booking {
+	checkin := time.Now().AddDate(0, 0, 10).Truncate(24 * time.Hour)
+	return models.Booking{
+		BookingID: 1, BookingDate: time.Now(), CheckinDate: checkin, CheckoutDate: checkin.AddDate(0, 0, 2),
+		PaymentStatus: paymentStatus, Status: status, RoomID: 3, CustomerID: 7,
+		Nights: 2, NightlyRate: usd(100), TotalAmount: usd(200), Timezone: "UTC",
+	}
+}
+
+// bookingRow returns the row of a booking.
+func bookingRow(b models.Booking) dbtest.Result {
+	return dbtest.Rows(strings.Split("booking_id booking_date checkin_date checkout_date payment_status status room_id customer_id nights nightly_rate total_amount currency cancel_free_days cancel_penalty_percent non_refundable display_currency display_rate timezone", " "),
+		[]driver.Value{int64(b.BookingID), b.BookingDate, b.CheckinDate, b.CheckoutDate, b.PaymentStatus, b.Status, int64(b.RoomID), int64(b.CustomerID), int64(b.Nights),
+			float64(b.NightlyRate.Cents) / 100, float64(b.TotalAmount.Cents) / 100, b.TotalAmount.Currency,
+			int64(b.CancellationPolicy.FreeDays), b.CancellationPolicy.PenaltyPercent, b.CancellationPolicy.NonRefundable, "", nil, b.Timezone})
+}
+
+// timezoneRow is the timezone of a room's property.
+func timezoneRow(timezone string) dbtest.Result {
+	return dbtest.Rows([]string{"timezone"}, []driver.Value{timezone})
+}
+
+// paymentRows returns the payments of booking 1.
+func paymentRows(payments ...models.Payment) dbtest.Result {
+	var rows [][]driver.Value
+	for _, p := range payments {
+		rows = append(rows, []driver.Value{int64(p.PaymentID), p.PaymentMethod, p.PaymentStatus, p.TransactionDate, float64(p.Amount.Cents) / 100, p.Amount.Currency, int64(1), p.Gateway, p.GatewayRef})
+	}
+	return dbtest.Rows(strings.Split("payment_id payment_method payment_status transaction_date amount currency booking_id gateway gateway_ref", " "), rows...)
+}
+
+// cancellationDB answers the queries of a customer cancelling booking 1,
+// which has a charge waiting for 3-D Secure. Recording the status change
+// fails if failEvent is set.
+func cancellationDB(failEvent bool) dbtest.Handler {
+	pending := models.Payment{PaymentID: 5, PaymentMethod: "tok_3ds", PaymentStatus: "Pending", Amount: money.New(20000, "USD"), Gateway: "fake", GatewayRef: "fake_1_3ds"}
+	return func(query string, args []driver.Value) dbtest.Result {
+		switch {
+		case strings.Contains(query, "FROM booking WHERE booking_id = $1"):
+			return bookingRow(testBooking(BookingConfirmed, "Pending"))
+		case strings.Contains(query, "FROM payment WHERE booking_id"):
+			return paymentRows(pending)
+		case strings.Contains(query, "SUM(p.amount)"):
+			return dbtest.Rows([]string{"sum", "currency"}, []driver.Value{"0", "USD"})
+		case strings.Contains(query, "INSERT INTO booking_status_event"):
+			if failEvent {
+				return dbtest.Fail(errors.New("connection reset"))
+			}
+		}
+		return dbtest.Affected(1)
+	}
+}
+
+func TestCancellationVoidsAfterCommit(t *testing.T) {
+	g := useFakeGateway(t)
+	rec := useTestDB(t, cancellationDB(false))
+
+	if err := SetBookingStatus(asCustomer(7), 1, BookingCancelled, ""); err != nil {
+		t.Fatalf("SetBookingStatus: %v", err)
+	}
+	if len(g.calls) != 1 || g.calls[0] != "void fake_1_3ds" {
+		t.Errorf("gateway calls %v, want a void of the pending charge", g.calls)
+	}
+	marked, settled := false, false
+	for _, s := range rec.Statements() {
+		if strings.Contains(s.Query, "SET payment_status = $1") && s.Args[0] == "Voiding" {
+			marked = s.InTx
+		}
+		if strings.Contains(s.Query, "payment_status = 'Voided'") {
+			settled = !s.InTx
+		}
+	}
+	if !marked || !settled {
+		t.Errorf("payment marked Voiding in the transaction: %v, Voided after it: %v", marked, settled)
+	}
+}
+
+func TestCancellationRollbackDoesNotVoid(t *testing.T) {
+	g := useFakeGateway(t)
+	rec := useTestDB(t, cancellationDB(true))
+
+	if err := SetBookingStatus(asCustomer(7), 1, BookingCancelled, ""); err == nil {
+		t.Fatal("SetBookingStatus succeeded, want the error recording the event")
+	}
+	if rec.Rollbacks() != 1 || rec.Commits() != 0 {
+		t.Errorf("%d rollbacks, %d commits, want the transaction rolled back", rec.Rollbacks(), rec.Commits())
+	}
+	// The payment is still pending after the rollback, so its charge must
+	// still be held.
+	if len(g.calls) != 0 {
+		t.Errorf("gateway calls %v after a rollback, want none", g.calls)
+	}
+}
+
+func TestToday(t *testing.T) {
+	// Kiritimati is 26 hours ahead of Etc/GMT+12, so it is always a day or
+	// two later there.
+	ahead, err := time.LoadLocation("Pacific/Kiritimati")
+	if err != nil {
+		t.Skip(err)
+	}
+	behind, err := time.LoadLocation("Etc/GMT+12")
+	if err != nil {
+		t.Skip(err)
+	}
+	later, earlier := today(ahead), today(behind)
+	if d := later.Sub(earlier); d != 24*time.Hour && d != 48*time.Hour {
+		t.Errorf("today is %s at Kiritimati and %s at GMT-12", later.Format(dateLayout), earlier.Format(dateLayout))
+	}
+	if later.Location() != time.UTC || !later.Equal(later.Truncate(24*time.Hour)) {
+		t.Errorf("today(Kiritimati) = %v, want midnight UTC", later)
+	}
+}
+
+// TestQuoteCancellationTimezone checks that the free cancellation window is
+// counted in days where the property is: seven days before check-in on the
+// westernmost clocks is already within seven days on the easternmost ones.
+func TestQuoteCancellationTimezone(t *testing.T) {
+	behind, err := time.LoadLocation("Etc/GMT+12")
+	if err != nil {
+		t.Skip(err)
+	}
+	booking := testBooking(BookingConfirmed, "Paid")
+	booking.CheckinDate = today(behind).AddDate(0, 0, 7)
+	booking.CheckoutDate = booking.CheckinDate.AddDate(0, 0, 2)
+	booking.CancellationPolicy = models.CancellationPolicy{FreeDays: 7, PenaltyPercent: 50}
+
+	for timezone, refund := range map[string]money.Money{"Etc/GMT+12": usd(200), "Pacific/Kiritimati": usd(100)} {
+		booking.Timezone = timezone
+		useTestDB(t, func(query string, args []driver.Value) dbtest.Result {
+			switch {
+			case strings.Contains(query, "FROM booking WHERE booking_id = $1"):
+				return bookingRow(booking)
+			case strings.Contains(query, "SUM(p.amount)"):
+				return dbtest.Rows([]string{"sum", "currency"}, []driver.Value{"200.00", "USD"})
+			}
+			return dbtest.Rows([]string{"none"})
+		})
+		quote, err := QuoteCancellation(asCustomer(7), 1)
+		if err != nil {
+			t.Fatalf("%s: QuoteCancellation: %v", timezone, err)
+		}
+		if quote.Refund != refund {
+			t.Errorf("%s: refund %s, want %s", timezone, quote.Refund, refund)
+		}
+	}
+}
+
+// TestStayDatesTimezone checks that "today" is where the property is: the
+// first day on the westernmost clocks is already past on the easternmost.
+func TestStayDatesTimezone(t *testing.T) {
+	behind, err := time.LoadLocation("Etc/GMT+12")
+	if err != nil {
+		t.Skip(err)
+	}
+	first := today(behind)
+
+	for _, tt := range []struct {
+		timezone string
+		ok       bool
+	}{
+		{"Etc/GMT+12", true},
+		{"Pacific/Kiritimati", false},
+	} {
+		useTestDB(t, func(query string, args []driver.Value) dbtest.Result {
+			return timezoneRow(tt.timezone)
+		})
+		err := ValidateStayDates(3, first, first.AddDate(0, 0, 1))
+		if tt.ok != (err == nil) {
+			t.Errorf("check-in %s in %s: ValidateStayDates = %v", first.Format(dateLayout), tt.timezone, err)
+		}
+
+		booking := testBooking(BookingConfirmed, "Paid")
+		booking.CheckinDate, booking.CheckoutDate = first.AddDate(0, 0, 1), first.AddDate(0, 0, 2)
+		booking.Timezone = tt.timezone
+		if got := CanCancelBooking(booking); got != tt.ok {
+			t.Errorf("check-in %s in %s: CanCancelBooking = %v, want %v", booking.CheckinDate.Format(dateLayout), tt.timezone, got, tt.ok)
+		}
+	}
+
+	// Without a room, only a date past everywhere is rejected.
+	if err := ValidateStayDates(0, first, first.AddDate(0, 0, 1)); err != nil {
+		t.Errorf("check-in %s in any room: %v", first.Format(dateLayout), err)
+	}
+	if err := ValidateStayDates(0, first.AddDate(0, 0, -1), first); err == nil {
+		t.Errorf("check-in %s in any room was accepted", first.AddDate(0, 0, -1).Format(dateLayout))
+	}
+}
@@ -1,116 +1,442 @@
 package service
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	"hotelm/db"
 	"hotelm/models"
+	"hotelm/money"
+	"hotelm/payment"
 	"hotelm/repository"
 	"hotelm/session"
 )
 
-// GetAvailableRooms returns a global list of available rooms.
-func GetAvailableRooms() ([]models.Room, error) {
-	rooms, err := repository.GetAvailableRooms()
+// dateLayout is the format of dates in query strings.
+const dateLayout = "2006-01-02"
+
+// lastZone is the time zone where each day ends last. A date before today
+// there is in the past everywhere.
+var lastZone = time.FixedZone("UTC-12", -12*60*60)
+
+// ValidateStayDates checks that a stay in a room starts today or later where
+// the room's property is, and lasts at least one night. With roomID 0 the
+// stay may be in any room, so only a check-in date in the past everywhere is
+// rejected.
+func ValidateStayDates(roomID int, checkin, checkout time.Time) error {
+	loc := lastZone
+	if roomID != 0 {
+		var err error
+		if loc, err = roomLocation(db.DB, roomID); err != nil {
+			return fmt.Errorf("failed to retrieve room: %w", err)
+		}
+	}
+	if checkin.Before(today(loc)) {
+		return invalidf("check-in date cannot be in the past")
+	}
+	if !checkout.After(checkin) {
+		return invalidf("check-out date must be after check-in date")
+	}
+	return nil
+}
+
+// Page sizes for room searches.
+const (
+	DefaultRoomPageSize = 20
+	MaxRoomPageSize     = 100
+)
+
+// RoomSearchResult is one page of a room search.
+type RoomSearchResult struct {
+	Filter  repository.RoomFilter `json:"-"`
+	Rooms   []models.Room         `json:"rooms"`
+	Offset  int                   `json:"offset"`
+	Limit   int                   `json:"limit"`
+	HasMore bool                  `json:"has_more"`
+}
+
+// ParseRoomSearch reads a room search from query parameters: checkin_date,
+// checkout_date, property_id, location, room_type, min_price, max_price, currency,
+// min_rating, amenities (comma-separated names), amenity_id (repeated),
+// sort, limit and offset. The stay
+// defaults to one night starting today and prices to the default currency.
+func ParseRoomSearch(values url.Values) (repository.RoomFilter, error) {
+	var filter repository.RoomFilter
+	var err error
+
+	filter.CheckinDate = today(time.UTC)
+	if v := values.Get("checkin_date"); v != "" {
+		if filter.CheckinDate, err = time.Parse(dateLayout, v); err != nil {
+			return filter, invalidf("checkin_date must be a date in YYYY-MM-DD format")
+		}
+	}
+	filter.CheckoutDate = filter.CheckinDate.AddDate(0, 0, 1)
+	if v := values.Get("checkout_date"); v != "" {
+		if filter.CheckoutDate, err = time.Parse(dateLayout, v); err != nil {
+			return filter, invalidf("checkout_date must be a date in YYYY-MM-DD format")
+		}
+	}
+
+	if v := values.Get("property_id"); v != "" {
+		if filter.PropertyID, err = strconv.Atoi(v); err != nil || filter.PropertyID < 1 {
+			return filter, invalidf("property_id must be a property ID")
+		}
+	}
+	filter.Location = strings.TrimSpace(values.Get("location"))
+	filter.RoomType = strings.TrimSpace(values.Get("room_type"))
+	filter.Sort = values.Get("sort")
+	for _, a := range strings.Split(values.Get("amenities"), ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			filter.Amenities = append(filter.Amenities, a)
+		}
+	}
+	for _, v := range values["amenity_id"] {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 1 {
+			return filter, invalidf("amenity_id must be an amenity ID")
+		}
+		filter.AmenityIDs = append(filter.AmenityIDs, id)
+	}
+
+	currency := strings.ToUpper(strings.TrimSpace(values.Get("currency")))
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+	if _, ok := money.LookupCurrency(currency); !ok {
+		return filter, invalidf("unsupported currency %q", currency)
+	}
+	prices := []struct {
+		name string
+		dst  *money.Money
+	}{
+		{"min_price", &filter.MinPrice},
+		{"max_price", &filter.MaxPrice},
+	}
+	for _, f := range prices {
+		*f.dst = money.Zero(currency)
+		if v := values.Get(f.name); v != "" {
+			if *f.dst, err = money.Parse(v, currency); err != nil {
+				return filter, invalidf("%s must be an amount in %s", f.name, currency)
+			}
+		}
+	}
+	if v := values.Get("min_rating"); v != "" {
+		if filter.MinRating, err = strconv.ParseFloat(v, 64); err != nil {
+			return filter, invalidf("min_rating must be a number")
+		}
+	}
+	ints := []struct {
+		name string
+		dst  *int
+	}{
+		{"limit", &filter.Limit},
+		{"offset", &filter.Offset},
+	}
+	for _, f := range ints {
+		if v := values.Get(f.name); v != "" {
+			if *f.dst, err = strconv.Atoi(v); err != nil {
+				return filter, invalidf("%s must be a whole number", f.name)
+			}
+		}
+	}
+	return filter, nil
+}
+
+// SearchRooms returns one page of the rooms that are free for the whole stay
+// and match the filter.
+func SearchRooms(filter repository.RoomFilter) (*RoomSearchResult, error) {
+	if err := ValidateStayDates(0, filter.CheckinDate, filter.CheckoutDate); err != nil {
+		return nil, err
+	}
+	if filter.MinPrice.IsNegative() || filter.MaxPrice.IsNegative() {
+		return nil, invalidf("prices cannot be negative")
+	}
+	if !filter.MinPrice.SameCurrency(filter.MaxPrice) {
+		return nil, invalidf("min_price and max_price must be in the same currency")
+	}
+	if filter.MaxPrice.IsPositive() && filter.MinPrice.Cmp(filter.MaxPrice) > 0 {
+		return nil, invalidf("min_price cannot be greater than max_price")
+	}
+	if filter.MinRating < 0 || filter.MinRating > 5 {
+		return nil, invalidf("min_rating must be between 0 and 5")
+	}
+	if !repository.IsValidRoomSort(filter.Sort) {
+		return nil, invalidf("unknown sort order %q", filter.Sort)
+	}
+	if filter.Offset < 0 {
+		return nil, invalidf("offset cannot be negative")
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultRoomPageSize
+	}
+	if filter.Limit > MaxRoomPageSize {
+		filter.Limit = MaxRoomPageSize
+	}
+
+	// Fetch one extra row to learn whether there is a next page.
+	query := filter
+	query.Limit++
+	rooms, err := repository.SearchRooms(db.DB, query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve available rooms: %v", err)
+		return nil, fmt.Errorf("failed to search rooms: %w", err)
+	}
+
+	result := &RoomSearchResult{Filter: filter, Offset: filter.Offset, Limit: filter.Limit}
+	if len(rooms) > filter.Limit {
+		rooms = rooms[:filter.Limit]
+		result.HasMore = true
 	}
-	return rooms, nil
+	result.Rooms = rooms
+	if result.Rooms == nil {
+		result.Rooms = []models.Room{}
+	}
+	return result, nil
 }
 
-// CreateBookingForCustomer creates a new booking for the logged-in customer.
-// It sets the Booking.CustomerID to the current customer's ID.
-func CreateBookingForCustomer(booking models.Booking) (int, error) {
+// ErrQuoteChanged is returned when the price of a stay changed between the
+// quote shown to the customer and the booking.
+var ErrQuoteChanged = errors.New("the price of this stay has changed, please review the new quote")
+
+// CreateBookingForCustomer books a room for the logged-in customer and charges
+// the stay through the payment gateway. The stay is priced per night and the
+// quote is stored with the booking. quotedTotal is the total the customer
+// confirmed, in the room's currency; if the price or currency has changed
+// since, ErrQuoteChanged is returned. A
+// refused authorization returns ErrPaymentDeclined and books nothing. The
+// booking, its line items and the pending payment are written in a single
+// transaction; if it fails the authorization is released, and once it has
+// committed the charge is captured. A capture the provider refuses cancels
+// the booking and returns its ID with ErrPaymentDeclined. A charge that waits
+// on the customer, or whose capture got no answer, leaves the booking
+// pending until CompleteBookingPayment. The exchange rate to the customer's display
+// currency is recorded with the booking. A non-empty promoCode is checked
+// and redeemed by the booking; quotedTotal must include its discount.
+func CreateBookingForCustomer(ctx context.Context, booking models.Booking, paymentMethod string, quotedTotal money.Money, promoCode string) (int, error) {
 	// Ensure a customer is logged in.
-	user := session.GetCurrentUser()
-	customer, ok := user.(*models.Customer)
+	customer, ok := session.CustomerFromContext(ctx)
 	if !ok {
-		return 0, fmt.Errorf("no customer is currently logged in")
+		return 0, ErrNoCustomer
 	}
 	booking.CustomerID = customer.CustomerID
 
-	// Retrieve the room details.
-	room, err := repository.GetRoomByID(booking.RoomID)
+	if err := ValidateStayDates(booking.RoomID, booking.CheckinDate, booking.CheckoutDate); err != nil {
+		return 0, err
+	}
+	if _, ok := money.LookupCurrency(quotedTotal.Currency); !ok {
+		return 0, invalidf("the quoted total needs a supported currency")
+	}
+	// Stays are charged in the room's currency; a total in another one is
+	// not a quote of this room.
+	room, err := repository.GetRoomByID(db.DB, booking.RoomID)
 	if err != nil {
-		return 0, fmt.Errorf("failed to retrieve room: %v", err)
+		return 0, fmt.Errorf("failed to retrieve room: %w", err)
 	}
-	// Check if the room is available.
-	if !room.Availability {
-		return 0, fmt.Errorf("room is not available")
+	if quotedTotal.Currency != room.Price.Currency {
+		return 0, invalidf("the quoted total must be in %s, the currency of the room", room.Price.Currency)
 	}
 
-	// Create the booking.
-	bookingID, err := repository.CreateBooking(booking)
+	// Hold the confirmed total before taking the room. The transaction
+	// below checks it against the current price.
+	charge, err := authorizeStay(ctx, quotedTotal, paymentMethod, fmt.Sprintf("Room %d, %s to %s",
+		booking.RoomID, booking.CheckinDate.Format(dateLayout), booking.CheckoutDate.Format(dateLayout)))
 	if err != nil {
-		return 0, fmt.Errorf("failed to create booking: %v", err)
+		return 0, err
 	}
 
-	// Update room availability to false.
-	room.Availability = false
-	if err := repository.UpdateRoom(*room); err != nil {
-		return 0, fmt.Errorf("booking created but failed to update room availability: %v", err)
+	var bookingID int
+	var pending models.Payment
+	err = db.WithTx(func(tx *sql.Tx) error {
+		// Retrieve the room details.
+		room, err := repository.GetRoomByID(tx, booking.RoomID)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve room: %w", err)
+		}
+		// Check that the vendor has the room listed and that it is free for the stay.
+		if !room.Availability {
+			return invalidf("room is not available")
+		}
+		free, err := repository.IsRoomFree(tx, room.RoomID, booking.CheckinDate, booking.CheckoutDate)
+		if err != nil {
+			return err
+		}
+		if !free {
+			return repository.ErrRoomUnavailable
+		}
+
+		// The room's current cancellation policy applies to the booking.
+		booking.CancellationPolicy, err = repository.GetCancellationPolicy(tx, room.RoomID)
+		if err != nil {
+			return err
+		}
+
+		// Price the stay and make sure it matches what the customer confirmed.
+		// The promo code is locked so its usage caps hold under concurrent
+		// bookings.
+		promo, err := findPromoCode(tx, promoCode, true)
+		if err != nil {
+			return err
+		}
+		quote, err := quoteStay(tx, room.RoomID, booking.CheckinDate, booking.CheckoutDate, promo, customer.CustomerID)
+		if err != nil {
+			return err
+		}
+		if quote.Total != quotedTotal {
+			return ErrQuoteChanged
+		}
+		booking.Nights = quote.Nights
+		booking.NightlyRate = quote.NightlyRate
+		booking.TotalAmount = quote.Total
+
+		// Record the rate at which the customer saw the price if they view
+		// prices in another currency. The charge stays in the room's currency.
+		booking.DisplayCurrency, booking.DisplayRate = "", money.Rate{}
+		if display := customer.DisplayCurrency; display != "" && display != quote.Total.Currency {
+			rates, err := loadRates(tx)
+			if err != nil {
+				return err
+			}
+			if rate, ok := rates.Rate(quote.Total.Currency, display); ok {
+				booking.DisplayCurrency, booking.DisplayRate = display, rate
+			}
+		}
+
+		// Create the booking. The database still rejects an overlap if another
+		// booking for the same dates was made since the check above.
+		booking.PaymentStatus = "Pending"
+		booking.Status = BookingConfirmed
+		bookingID, err = repository.CreateBooking(tx, booking)
+		if err != nil {
+			if errors.Is(err, repository.ErrRoomUnavailable) {
+				return err
+			}
+			return fmt.Errorf("failed to create booking: %w", err)
+		}
+		if err := repository.CreateBookingLineItems(tx, bookingID, quote.Lines); err != nil {
+			return err
+		}
+		if promo != nil && quote.Discount.IsPositive() {
+			redemption := models.PromoRedemption{
+				PromoCodeID: promo.PromoCodeID,
+				BookingID:   bookingID,
+				CustomerID:  customer.CustomerID,
+				Discount:    quote.Discount,
+			}
+			if _, err := repository.CreatePromoRedemption(tx, redemption); err != nil {
+				return err
+			}
+		}
+		event := models.BookingStatusEvent{
+			BookingID: bookingID,
+			ToStatus:  BookingConfirmed,
+			ActorRole: session.RoleCustomer,
+			ActorID:   customer.CustomerID,
+		}
+		if err := repository.CreateBookingStatusEvent(tx, event); err != nil {
+			return err
+		}
+
+		// Record the charge for the full stay as pending. The booking is
+		// paid once the gateway has captured it.
+		pending = gatewayPayment(bookingID, paymentMethod, quote.Total, charge)
+		pending.PaymentID, err = repository.CreatePayment(tx, pending)
+		if err != nil {
+			return fmt.Errorf("failed to create payment: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		releaseCharge(ctx, charge, quotedTotal)
+		return 0, err
 	}
 
+	// Take the held funds now that the booking is saved. A charge waiting
+	// on the customer is completed with CompleteBookingPayment, as is one
+	// whose capture did not get an answer.
+	if charge.Status != payment.StatusAuthorized {
+		return bookingID, nil
+	}
+	err = capturePayment(ctx, pending)
+	if errors.Is(err, ErrPaymentDeclined) {
+		return bookingID, err
+	}
+	if err != nil {
+		log.Printf("payment: booking %d is saved but its payment is pending: %v", bookingID, err)
+	}
 	return bookingID, nil
 }
 
 // GetMyBookings retrieves all bookings for the logged-in customer.
-func GetMyBookings() ([]models.Booking, error) {
+func GetMyBookings(ctx context.Context) ([]models.Booking, error) {
 	// Ensure a customer is logged in.
-	user := session.GetCurrentUser()
-	customer, ok := user.(*models.Customer)
+	customer, ok := session.CustomerFromContext(ctx)
 	if !ok {
-		return nil, fmt.Errorf("no customer is currently logged in")
+		return nil, ErrNoCustomer
 	}
 
-	bookings, err := repository.GetBookingsByCustomerID(customer.CustomerID)
+	bookings, err := repository.GetBookingsByCustomerID(db.DB, customer.CustomerID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve customer bookings: %v", err)
+		return nil, fmt.Errorf("failed to retrieve customer bookings: %w", err)
 	}
 	return bookings, nil
 }
 
-// DeleteBookingForCustomer deletes a booking if it belongs to the logged-in customer.
-func DeleteBookingForCustomer(bookingID int) error {
-	// Ensure a customer is logged in.
-	user := session.GetCurrentUser()
-	customer, ok := user.(*models.Customer)
+// GetCurrentCustomer returns the logged-in customer.
+func GetCurrentCustomer(ctx context.Context) (*models.Customer, error) {
+	customer, ok := session.CustomerFromContext(ctx)
 	if !ok {
-		return fmt.Errorf("no customer is currently logged in")
+		return nil, ErrNoCustomer
 	}
+	return customer, nil
+}
 
-	// Retrieve the customer's bookings to verify ownership.
-	bookings, err := repository.GetBookingsByCustomerID(customer.CustomerID)
+// GetRoom returns a room by ID.
+func GetRoom(roomID int) (*models.Room, error) {
+	room, err := repository.GetRoomByID(db.DB, roomID)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve customer bookings: %v", err)
+		return nil, fmt.Errorf("failed to retrieve room: %w", err)
 	}
+	return room, nil
+}
 
-	var bookingFound *models.Booking
-	for _, b := range bookings {
-		if b.BookingID == bookingID {
-			bookingFound = &b
-			break
-		}
-	}
-	if bookingFound == nil {
-		return fmt.Errorf("unauthorized: booking does not belong to the logged-in customer")
+// GetMyBooking retrieves a booking of the logged-in customer together with its
+// itemized price.
+func GetMyBooking(ctx context.Context, bookingID int) (*models.Booking, []models.BookingLineItem, error) {
+	customer, err := GetCurrentCustomer(ctx)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Delete the booking.
-	if err := repository.DeleteBooking(bookingID); err != nil {
-		return fmt.Errorf("failed to delete booking: %v", err)
+	booking, err := repository.GetBookingByID(db.DB, bookingID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve booking: %w", err)
+	}
+	if booking.CustomerID != customer.CustomerID {
+		return nil, nil, fmt.Errorf("%w: booking does not belong to the logged-in customer", ErrForbidden)
 	}
 
-	// Retrieve the room associated with the booking.
-	room, err := repository.GetRoomByID(bookingFound.RoomID)
+	items, err := repository.GetBookingLineItems(db.DB, bookingID)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve room: %v", err)
+		return nil, nil, fmt.Errorf("failed to retrieve booking line items: %w", err)
 	}
+	return booking, items, nil
+}
 
-	// Mark the room as available.
-	room.Availability = true
-	if err := repository.UpdateRoom(*room); err != nil {
-		return fmt.Errorf("booking deleted but failed to update room availability: %v", err)
+// GetMyBookingPayments retrieves the payments of a booking owned by the
+// logged-in customer.
+func GetMyBookingPayments(ctx context.Context, bookingID int) ([]models.Payment, error) {
+	if _, _, err := GetMyBooking(ctx, bookingID); err != nil {
+		return nil, err
 	}
-
-	return nil
-}
\ No newline at end of file
+	payments, err := repository.GetPaymentsByBookingID(db.DB, bookingID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve payments: %w", err)
+	}
+	return payments, nil
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned when the request has no logged-in user of the right kind.
+var (
+	ErrNoCustomer = errors.New("no customer is currently logged in")
+	ErrNoVendor   = errors.New("no vendor is currently logged in")
+	ErrNoAdmin    = errors.New("no admin is currently logged in")
+	ErrNoUser     = errors.New("no user is currently logged in")
+)
+
+// ErrForbidden is wrapped by errors returned when the logged-in user does not
+// own the resource they are acting on.
+var ErrForbidden = errors.New("unauthorized")
+
+// ValidationError reports input that the service rejected.
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// invalidf returns a ValidationError with a formatted message.
+func invalidf(format string, args ...interface{}) error {
+	return &ValidationError{Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"hotelm/db"
+	"hotelm/models"
+	"hotelm/money"
+	"hotelm/repository"
+	"hotelm/session"
+)
+
+// Sources of exchange rates.
+const (
+	RateSourceAdmin = "admin"
+	RateSourceFile  = "file"
+)
+
+// Audit actions for exchange rates. Their audit entries have no target ID;
+// the details name the currency.
+const (
+	AuditExchangeRate       = "exchange_rate"
+	AuditDeleteExchangeRate = "delete_exchange_rate"
+	AuditLoadExchangeRates  = "load_exchange_rates"
+)
+
+// exchangeRatesFile is the file LoadExchangeRatesFile reads, if any.
+var exchangeRatesFile string
+
+// SetExchangeRatesFile sets the file exchange rates are loaded from.
+func SetExchangeRatesFile(path string) {
+	exchangeRatesFile = path
+}
+
+// ExchangeRatesFile returns the file exchange rates are loaded from, or ""
+// if none is configured.
+func ExchangeRatesFile() string {
+	return exchangeRatesFile
+}
+
+// ratesFile is the format of the exchange rates file:
+//
+//	{"base": "USD", "rates": {"EUR": 0.92, "JPY": "151.3"}}
+//
+// Each rate is how many units of the currency one unit of base buys. A base
+// other than the default currency needs a rate for the default currency.
+type ratesFile struct {
+	Base  string                 `json:"base"`
+	Rates map[string]json.Number `json:"rates"`
+}
+
+// Conversion is an amount shown in another currency than it is charged in.
+type Conversion struct {
+	Amount money.Money `json:"amount"`
+	// Rate is the number of units of Amount's currency per unit of the
+	// charged currency.
+	Rate money.Rate `json:"rate"`
+}
+
+// GetExchangeRates returns the stored exchange rates.
+func GetExchangeRates() ([]models.ExchangeRate, error) {
+	return repository.GetExchangeRates(db.DB)
+}
+
+// loadRates returns the stored exchange rates as a money.Rates.
+func loadRates(q db.Querier) (money.Rates, error) {
+	list, err := repository.GetExchangeRates(q)
+	if err != nil {
+		return nil, err
+	}
+	rates := money.Rates{}
+	for _, r := range list {
+		rates[r.Currency] = r.Rate
+	}
+	return rates, nil
+}
+
+// GetRates returns the stored exchange rates for converting amounts.
+func GetRates() (money.Rates, error) {
+	return loadRates(db.DB)
+}
+
+// ConvertForDisplay converts amount to currency with the stored rates. It
+// returns nil when currency is empty or the amount's own, or when either
+// currency has no rate.
+func ConvertForDisplay(amount money.Money, currency string) (*Conversion, error) {
+	if currency == "" || currency == amount.Currency {
+		return nil, nil
+	}
+	rates, err := GetRates()
+	if err != nil {
+		return nil, err
+	}
+	converted, rate, ok := rates.Convert(amount, currency)
+	if !ok {
+		return nil, nil
+	}
+	return &Conversion{Amount: converted, Rate: rate}, nil
+}
+
+// checkRateCurrency returns an error unless an exchange rate can be set for
+// currency.
+func checkRateCurrency(currency string) error {
+	if _, ok := money.LookupCurrency(currency); !ok {
+		return invalidf("unsupported currency %q", currency)
+	}
+	if currency == money.DefaultCurrency {
+		return invalidf("rates are quoted against %s, which needs no rate", money.DefaultCurrency)
+	}
+	return nil
+}
+
+// SetExchangeRate sets the rate of a currency on behalf of the logged-in
+// admin: how many units of it one unit of the default currency buys.
+func SetExchangeRate(ctx context.Context, currency, rate string) error {
+	admin, err := currentAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if err := checkRateCurrency(currency); err != nil {
+		return err
+	}
+	r, err := money.ParseRate(rate)
+	if err != nil {
+		return invalidf("rate must be a positive number")
+	}
+
+	return db.WithTx(func(tx *sql.Tx) error {
+		err := repository.SetExchangeRate(tx, models.ExchangeRate{Currency: currency, Rate: r, Source: RateSourceAdmin})
+		if err != nil {
+			return err
+		}
+		details := fmt.Sprintf("1 %s = %s %s", money.DefaultCurrency, r, currency)
+		return audit(tx, admin, AuditExchangeRate, "exchange_rate", 0, details)
+	})
+}
+
+// DeleteExchangeRate removes the rate of a currency on behalf of the
+// logged-in admin. Prices in it are no longer converted.
+func DeleteExchangeRate(ctx context.Context, currency string) error {
+	admin, err := currentAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	return db.WithTx(func(tx *sql.Tx) error {
+		if err := repository.DeleteExchangeRate(tx, currency); err != nil {
+			return err
+		}
+		return audit(tx, admin, AuditDeleteExchangeRate, "exchange_rate", 0, currency)
+	})
+}
+
+// readRatesFile reads the exchange rates file and returns the rates against
+// the default currency, by currency.
+func readRatesFile(path string) (map[string]money.Rate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exchange rates file: %v", err)
+	}
+	var file ratesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid exchange rates file %s: %v", path, err)
+	}
+
+	base := strings.ToUpper(strings.TrimSpace(file.Base))
+	if base == "" {
+		base = money.DefaultCurrency
+	}
+	one, _ := money.ParseRate("1")
+	perBase := map[string]money.Rate{base: one}
+	for currency, n := range file.Rates {
+		r, err := money.ParseRate(n.String())
+		if err != nil {
+			return nil, fmt.Errorf("exchange rates file %s: %s: %v", path, currency, err)
+		}
+		perBase[strings.ToUpper(currency)] = r
+	}
+
+	// Rebase the rates on the default currency.
+	perDefault, ok := perBase[money.DefaultCurrency]
+	if !ok {
+		return nil, fmt.Errorf("exchange rates file %s: base %s needs a rate for %s", path, base, money.DefaultCurrency)
+	}
+	rates := map[string]money.Rate{}
+	for currency, r := range perBase {
+		if currency != money.DefaultCurrency {
+			rates[currency] = r.Div(perDefault)
+		}
+	}
+	return rates, nil
+}
+
+// LoadExchangeRatesFile loads the configured exchange rates file into the
+// rates table. Rates in the file replace stored rates of the same currency;
+// other rates are kept. Unsupported currencies in the file are skipped. It
+// returns the currencies loaded.
+func LoadExchangeRatesFile() ([]string, error) {
+	var loaded []string
+	err := db.WithTx(func(tx *sql.Tx) error {
+		var err error
+		loaded, err = loadExchangeRatesFile(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return loaded, nil
+}
+
+// loadExchangeRatesFile stores the rates of the exchange rates file as
+// LoadExchangeRatesFile describes, within tx.
+func loadExchangeRatesFile(tx *sql.Tx) ([]string, error) {
+	if exchangeRatesFile == "" {
+		return nil, invalidf("no exchange rates file is configured")
+	}
+	rates, err := readRatesFile(exchangeRatesFile)
+	if err != nil {
+		return nil, err
+	}
+	var loaded []string
+	for currency := range rates {
+		if _, ok := money.LookupCurrency(currency); ok {
+			loaded = append(loaded, currency)
+		}
+	}
+	sort.Strings(loaded)
+
+	for _, currency := range loaded {
+		rate := models.ExchangeRate{Currency: currency, Rate: rates[currency], Source: RateSourceFile}
+		if err := repository.SetExchangeRate(tx, rate); err != nil {
+			return nil, err
+		}
+	}
+	return loaded, nil
+}
+
+// ReloadExchangeRates loads the exchange rates file on behalf of the
+// logged-in admin. The rates and the audit entry are stored together.
+func ReloadExchangeRates(ctx context.Context) ([]string, error) {
+	admin, err := currentAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var loaded []string
+	err = db.WithTx(func(tx *sql.Tx) error {
+		var err error
+		loaded, err = loadExchangeRatesFile(tx)
+		if err != nil {
+			return err
+		}
+		details := fmt.Sprintf("%s: %s", exchangeRatesFile, strings.Join(loaded, ", "))
+		return audit(tx, admin, AuditLoadExchangeRates, "exchange_rate", 0, details)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return loaded, nil
+}
+
+// SetDisplayCurrency sets the currency the logged-in customer wants prices
+// shown in. An empty currency shows prices in each room's currency.
+func SetDisplayCurrency(ctx context.Context, currency string) error {
+	customer, ok := session.CustomerFromContext(ctx)
+	if !ok {
+		return ErrNoCustomer
+	}
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency != "" {
+		if _, ok := money.LookupCurrency(currency); !ok {
+			return invalidf("unsupported currency %q", currency)
+		}
+	}
+	if err := repository.SetCustomerDisplayCurrency(db.DB, customer.CustomerID, currency); err != nil {
+		return err
+	}
+	customer.DisplayCurrency = currency
+	return nil
+}
+
+// DisplayCurrency returns the currency the logged-in customer wants prices
+// shown in, or "" for each room's own currency.
+func DisplayCurrency(ctx context.Context) string {
+	if customer, ok := session.CustomerFromContext(ctx); ok {
+		return customer.DisplayCurrency
+	}
+	return ""
+}
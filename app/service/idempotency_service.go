@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"hotelm/db"
+	"hotelm/models"
+	"hotelm/repository"
+)
+
+// IdempotencyKeyTTL is how long a key is remembered. A retry after that
+// runs the request again.
+const IdempotencyKeyTTL = 24 * time.Hour
+
+// maxIdempotencyKeyLength is the longest key accepted.
+const maxIdempotencyKeyLength = 255
+
+// Errors returned for a key that cannot be used for the request.
+var (
+	ErrIdempotencyKeyReused   = errors.New("idempotency key was already used for a different request")
+	ErrIdempotencyKeyInFlight = errors.New("a request with this idempotency key is still being processed")
+)
+
+// idempotencyOwner returns the owner of the logged-in user's keys.
+func idempotencyOwner(ctx context.Context) (string, error) {
+	p, err := currentParticipant(ctx)
+	if err != nil {
+		return "", err
+	}
+	return p.role() + ":" + strconv.Itoa(p.id), nil
+}
+
+// BeginIdempotentRequest claims key for a request of the logged-in user with
+// the given fingerprint. It returns nil if the request is new: the caller
+// runs it, then calls FinishIdempotentRequest or AbandonIdempotentRequest.
+// If the same request already finished it returns the record to replay. A
+// key used for another request returns ErrIdempotencyKeyReused; one whose
+// request is still running returns ErrIdempotencyKeyInFlight.
+func BeginIdempotentRequest(ctx context.Context, key, fingerprint string) (*models.IdempotencyRecord, error) {
+	owner, err := idempotencyOwner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, invalidf("idempotency key must be at most %d characters", maxIdempotencyKeyLength)
+	}
+
+	if err := repository.DeleteExpiredIdempotencyKeys(db.DB, time.Now().Add(-IdempotencyKeyTTL)); err != nil {
+		return nil, err
+	}
+	claimed, err := repository.ClaimIdempotencyKey(db.DB, owner, key, fingerprint)
+	if err != nil || claimed {
+		return nil, err
+	}
+
+	rec, err := repository.GetIdempotencyKey(db.DB, owner, key)
+	if errors.Is(err, repository.ErrNotFound) {
+		// The first request failed and gave the key up in the meantime.
+		return nil, ErrIdempotencyKeyInFlight
+	}
+	if err != nil {
+		return nil, err
+	}
+	if rec.Fingerprint != fingerprint {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if rec.ResponseStatus == 0 {
+		return nil, ErrIdempotencyKeyInFlight
+	}
+	return rec, nil
+}
+
+// FinishIdempotentRequest stores the response of a request claimed with
+// BeginIdempotentRequest, to be replayed for retries.
+func FinishIdempotentRequest(ctx context.Context, rec models.IdempotencyRecord) error {
+	owner, err := idempotencyOwner(ctx)
+	if err != nil {
+		return err
+	}
+	rec.Owner = owner
+	if err := repository.SaveIdempotentResponse(db.DB, rec); err != nil {
+		return fmt.Errorf("failed to store response: %w", err)
+	}
+	return nil
+}
+
+// AbandonIdempotentRequest releases a key whose request failed without a
+// lasting effect, so that a retry runs it again.
+func AbandonIdempotentRequest(ctx context.Context, key string) error {
+	owner, err := idempotencyOwner(ctx)
+	if err != nil {
+		return err
+	}
+	return repository.DeleteIdempotencyKey(db.DB, owner, key)
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"hotelm/db"
+	"hotelm/models"
+	"hotelm/repository"
+	"hotelm/session"
+)
+
+// Limits on message threads.
+const (
+	maxSubjectLength = 200
+	maxMessageLength = 5000
+)
+
+// NewThread is the first message of a thread. A customer writes to the
+// vendor of RoomID, or of the room of BookingID; a vendor can only write
+// about one of their bookings.
+type NewThread struct {
+	RoomID    int
+	BookingID int
+	Subject   string
+	Body      string
+}
+
+// participant is the logged-in user as seen by the messaging service: a
+// customer or vendor side of a thread, or an admin, who may read any thread
+// but not post.
+type participant struct {
+	side  string // repository.SideCustomer or repository.SideVendor; empty for an admin
+	id    int    // customer, vendor or admin ID
+	admin bool
+}
+
+// currentParticipant returns the logged-in customer, vendor or admin.
+func currentParticipant(ctx context.Context) (participant, error) {
+	if customer, ok := session.CustomerFromContext(ctx); ok {
+		return participant{side: repository.SideCustomer, id: customer.CustomerID}, nil
+	}
+	if vendor, ok := session.VendorFromContext(ctx); ok {
+		return participant{side: repository.SideVendor, id: vendor.VendorID}, nil
+	}
+	if admin, ok := session.AdminFromContext(ctx); ok {
+		return participant{id: admin.AdminID, admin: true}, nil
+	}
+	return participant{}, ErrNoUser
+}
+
+// canRead reports whether p is one of the thread's participants or an admin.
+func (p participant) canRead(thread *models.MessageThread) bool {
+	switch p.side {
+	case repository.SideCustomer:
+		return thread.CustomerID == p.id
+	case repository.SideVendor:
+		return thread.VendorID == p.id
+	}
+	return p.admin
+}
+
+// validateMessage trims a message body and checks its length.
+func validateMessage(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", invalidf("message must not be empty")
+	}
+	if len(body) > maxMessageLength {
+		return "", invalidf("message must be at most %d characters", maxMessageLength)
+	}
+	return body, nil
+}
+
+// StartThread opens a thread between the logged-in customer or vendor and
+// the other party, and posts its first message. It returns the thread ID.
+func StartThread(ctx context.Context, nt NewThread) (int, error) {
+	p, err := currentParticipant(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if p.admin {
+		return 0, fmt.Errorf("%w: admins cannot start message threads", ErrForbidden)
+	}
+
+	subject := strings.TrimSpace(nt.Subject)
+	if subject == "" {
+		return 0, invalidf("subject is required")
+	}
+	if len(subject) > maxSubjectLength {
+		return 0, invalidf("subject must be at most %d characters", maxSubjectLength)
+	}
+	body, err := validateMessage(nt.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	thread := models.MessageThread{Subject: subject}
+	if nt.BookingID != 0 {
+		booking, err := repository.GetBookingByID(db.DB, nt.BookingID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to retrieve booking: %w", err)
+		}
+		room, err := repository.GetRoomByID(db.DB, booking.RoomID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to retrieve room: %w", err)
+		}
+		if (p.side == repository.SideCustomer && booking.CustomerID != p.id) ||
+			(p.side == repository.SideVendor && room.VendorID != p.id) {
+			return 0, fmt.Errorf("%w: booking does not belong to the logged-in user", ErrForbidden)
+		}
+		thread.CustomerID = booking.CustomerID
+		thread.VendorID = room.VendorID
+		thread.BookingID = &booking.BookingID
+	} else {
+		if p.side == repository.SideVendor {
+			return 0, invalidf("vendors can only start a thread about a booking")
+		}
+		if nt.RoomID == 0 {
+			return 0, invalidf("a room or booking is required")
+		}
+		room, err := repository.GetRoomByID(db.DB, nt.RoomID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to retrieve room: %w", err)
+		}
+		thread.CustomerID = p.id
+		thread.VendorID = room.VendorID
+	}
+
+	var threadID int
+	err = db.WithTx(func(tx *sql.Tx) error {
+		threadID, err = repository.CreateThread(tx, thread)
+		if err != nil {
+			return err
+		}
+		_, err = repository.CreateMessage(tx, models.Message{ThreadID: threadID, SenderRole: p.side, Body: body})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return threadID, nil
+}
+
+// GetMyThreads returns the threads of the logged-in customer or vendor with
+// their unread counts, or every thread for an admin.
+func GetMyThreads(ctx context.Context) ([]models.MessageThread, error) {
+	p, err := currentParticipant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if p.admin {
+		return repository.GetAllThreads(db.DB)
+	}
+	return repository.GetThreadsForParticipant(db.DB, p.side, p.id)
+}
+
+// GetThread returns a thread and its messages, and marks them read for the
+// participant viewing it. Admins can read any thread without changing what
+// the participants have read.
+func GetThread(ctx context.Context, threadID int) (*models.MessageThread, []models.Message, error) {
+	p, err := currentParticipant(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	side := p.side
+	if p.admin {
+		side = repository.SideCustomer // any side; the unread count is not shown to admins
+	}
+
+	thread, err := repository.GetThreadByID(db.DB, threadID, side)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !p.canRead(thread) {
+		return nil, nil, fmt.Errorf("%w: not a participant in this thread", ErrForbidden)
+	}
+	messages, err := repository.GetMessagesByThreadID(db.DB, threadID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if p.admin {
+		thread.Unread = 0
+	} else if len(messages) > 0 {
+		if err := repository.MarkThreadRead(db.DB, threadID, p.side, messages[len(messages)-1].MessageID); err != nil {
+			return nil, nil, err
+		}
+		thread.Unread = 0
+	}
+	return thread, messages, nil
+}
+
+// PostMessage adds a message from the logged-in customer or vendor to one of
+// their threads. It returns the message ID.
+func PostMessage(ctx context.Context, threadID int, body string) (int, error) {
+	p, err := currentParticipant(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if p.admin {
+		return 0, fmt.Errorf("%w: admins cannot post in message threads", ErrForbidden)
+	}
+	body, err = validateMessage(body)
+	if err != nil {
+		return 0, err
+	}
+
+	thread, err := repository.GetThreadByID(db.DB, threadID, p.side)
+	if err != nil {
+		return 0, err
+	}
+	if !p.canRead(thread) {
+		return 0, fmt.Errorf("%w: not a participant in this thread", ErrForbidden)
+	}
+
+	var messageID int
+	err = db.WithTx(func(tx *sql.Tx) error {
+		messageID, err = repository.CreateMessage(tx, models.Message{ThreadID: threadID, SenderRole: p.side, Body: body})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return messageID, nil
+}
+
+// CountMyUnreadMessages returns the number of messages the logged-in customer
+// or vendor has not read. It is zero for admins.
+func CountMyUnreadMessages(ctx context.Context) (int, error) {
+	p, err := currentParticipant(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if p.admin {
+		return 0, nil
+	}
+	return repository.CountUnreadMessages(db.DB, p.side, p.id)
+}
@@ -0,0 +1,410 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"hotelm/db"
+	"hotelm/models"
+	"hotelm/money"
+	"hotelm/payment"
+	"hotelm/repository"
+)
+
+// gateway is the payment provider used by every payment flow.
+var gateway payment.Gateway
+
+// SetPaymentGateway sets the payment provider. It must be called before the
+// services take payments.
+func SetPaymentGateway(g payment.Gateway) {
+	gateway = g
+}
+
+// ErrPaymentDeclined is wrapped by errors returned when the payment provider
+// refused a charge.
+var ErrPaymentDeclined = errors.New("payment declined")
+
+// errNoGateway is returned when no payment gateway was set.
+var errNoGateway = errors.New("no payment gateway is configured")
+
+// paymentStatus maps a gateway status to the status stored on a payment.
+func paymentStatus(status payment.Status) string {
+	switch status {
+	case payment.StatusCaptured:
+		return "Completed"
+	case payment.StatusRefunded:
+		return "Refunded"
+	case payment.StatusVoided:
+		return "Voided"
+	case payment.StatusDeclined:
+		return "Failed"
+	}
+	return "Pending"
+}
+
+// declined returns the error for a charge the gateway refused.
+func declined(res payment.Result) error {
+	if res.Message == "" {
+		return ErrPaymentDeclined
+	}
+	return fmt.Errorf("%w: %s", ErrPaymentDeclined, res.Message)
+}
+
+// authorizeStay holds the price of a stay. The result is either authorized,
+// to be captured once the booking is saved, or pending when the customer
+// still has to confirm the charge. A refused charge returns
+// ErrPaymentDeclined.
+func authorizeStay(ctx context.Context, amount money.Money, method, description string) (payment.Result, error) {
+	if gateway == nil {
+		return payment.Result{}, errNoGateway
+	}
+	method = strings.TrimSpace(method)
+	if method == "" {
+		return payment.Result{}, invalidf("payment method is required")
+	}
+
+	res, err := gateway.Authorize(ctx, payment.Charge{Amount: amount, Method: method, Description: description})
+	if err != nil {
+		return payment.Result{}, fmt.Errorf("failed to authorize payment: %w", err)
+	}
+	if res.Status == payment.StatusDeclined {
+		return res, declined(res)
+	}
+	return res, nil
+}
+
+// releaseCharge undoes a charge whose booking could not be saved or was
+// cancelled meanwhile: a captured charge is refunded, anything else is
+// voided. It runs even if the request
+// was cancelled; a failure is logged for manual follow-up.
+func releaseCharge(ctx context.Context, res payment.Result, amount money.Money) {
+	ctx = context.WithoutCancel(ctx)
+	var err error
+	if res.Status == payment.StatusCaptured {
+		_, err = gateway.Refund(ctx, res.Reference, amount)
+	} else {
+		_, err = gateway.Void(ctx, res.Reference)
+	}
+	if err != nil {
+		log.Printf("payment: failed to release charge %s at %s: %v", res.Reference, gateway.Name(), err)
+	}
+}
+
+// gatewayPayment returns the payment record of a gateway result.
+func gatewayPayment(bookingID int, method string, amount money.Money, res payment.Result) models.Payment {
+	return models.Payment{
+		PaymentMethod:   method,
+		PaymentStatus:   paymentStatus(res.Status),
+		TransactionDate: time.Now(),
+		Amount:          amount,
+		BookingID:       bookingID,
+		Gateway:         gateway.Name(),
+		GatewayRef:      res.Reference,
+	}
+}
+
+// refundableCharge returns the gateway reference of the captured charge of a
+// locked booking that refunds go to, or "" when the booking was paid before
+// gateways existed.
+func refundableCharge(tx *sql.Tx, bookingID int) (string, error) {
+	payments, err := repository.GetPaymentsByBookingID(tx, bookingID)
+	if err != nil {
+		return "", err
+	}
+	charge := ""
+	for _, p := range payments {
+		if p.PaymentStatus == "Completed" && p.Amount.IsPositive() && p.GatewayRef != "" {
+			charge = p.GatewayRef
+		}
+	}
+	return charge, nil
+}
+
+// pendingRefund is a refund recorded as a pending payment, to be sent to the
+// gateway after the transaction that recorded it has committed.
+type pendingRefund struct {
+	PaymentID int
+	BookingID int
+	Charge    string      // gateway reference of the refunded charge, "" if there is nothing to send
+	Amount    money.Money // positive
+	Full      bool        // the refund returns everything paid for the booking
+}
+
+// sendRefund sends a pending refund to the gateway and records the outcome:
+// the payment is marked 'Refunded', or 'Failed' if the provider refused it.
+// If the provider could not be reached the outcome is unknown, so the
+// payment stays pending and counts as refunded; the failure is logged for
+// manual follow-up. It runs even if the request was cancelled.
+func sendRefund(ctx context.Context, r pendingRefund) error {
+	if r.Charge == "" {
+		return nil
+	}
+	ctx = context.WithoutCancel(ctx)
+	res, err := gateway.Refund(ctx, r.Charge, r.Amount)
+	if err != nil {
+		log.Printf("payment: refund payment %d of charge %s at %s is pending: %v", r.PaymentID, r.Charge, gateway.Name(), err)
+		return fmt.Errorf("failed to refund payment: %w", err)
+	}
+	if res.Status != payment.StatusRefunded {
+		if err := repository.SettlePayment(db.DB, r.PaymentID, "Failed", res.Reference); err != nil {
+			log.Printf("payment: failed to record refused refund payment %d: %v", r.PaymentID, err)
+			return err
+		}
+		return fmt.Errorf("payment provider did not refund the charge: %s", res.Message)
+	}
+	err = db.WithTx(func(tx *sql.Tx) error {
+		if err := repository.SettlePayment(tx, r.PaymentID, "Refunded", res.Reference); err != nil {
+			return err
+		}
+		if r.Full {
+			return repository.UpdateBookingPaymentStatus(tx, r.BookingID, "Refunded")
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("payment: refund %s of payment %d was sent but not recorded: %v", res.Reference, r.PaymentID, err)
+	}
+	return err
+}
+
+// voidPendingPayments marks the charges of a locked booking that are still
+// waiting on the customer as 'Voiding' and returns them, to be voided with
+// sendVoids once the transaction has committed. A capture that races with
+// the cancellation no longer finds them pending and releases its charge.
+func voidPendingPayments(tx *sql.Tx, bookingID int) ([]models.Payment, error) {
+	payments, err := repository.GetPaymentsByBookingID(tx, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	var voids []models.Payment
+	for _, p := range payments {
+		if p.PaymentStatus != "Pending" || !p.Amount.IsPositive() || p.GatewayRef == "" {
+			continue
+		}
+		if gateway == nil {
+			return nil, errNoGateway
+		}
+		if err := repository.UpdatePaymentStatus(tx, p.PaymentID, "Voiding"); err != nil {
+			return nil, err
+		}
+		voids = append(voids, p)
+	}
+	return voids, nil
+}
+
+// sendVoids releases at the gateway the charges voidPendingPayments marked,
+// and marks each 'Voided' once released. A void that fails leaves its
+// payment 'Voiding', to be retried; the failure is logged. It runs even if
+// the request was cancelled.
+func sendVoids(ctx context.Context, voids []models.Payment) {
+	ctx = context.WithoutCancel(ctx)
+	for _, p := range voids {
+		res, err := gateway.Void(ctx, p.GatewayRef)
+		if err == nil && res.Status != payment.StatusVoided {
+			err = fmt.Errorf("payment provider did not void the charge: %s", res.Message)
+		}
+		if err != nil {
+			log.Printf("payment: void of payment %d (charge %s) at %s failed and will be retried: %v", p.PaymentID, p.GatewayRef, gateway.Name(), err)
+			continue
+		}
+		if err := repository.SettleVoid(db.DB, p.PaymentID); err != nil {
+			log.Printf("payment: void of payment %d was sent but not recorded: %v", p.PaymentID, err)
+		}
+	}
+}
+
+// pendingPaymentTTL is how long a charge may wait for the customer to
+// confirm it with their bank before its booking is cancelled.
+const pendingPaymentTTL = 30 * time.Minute
+
+// ExpirePendingPayments cancels the confirmed bookings whose charge has been
+// waiting on the customer for longer than pendingPaymentTTL, so that their
+// dates become free again, and voids the charges. It also retries the voids
+// that failed earlier. It returns the number of bookings cancelled.
+func ExpirePendingPayments(ctx context.Context) (int, error) {
+	if gateway == nil {
+		return 0, errNoGateway
+	}
+	before := time.Now().Add(-pendingPaymentTTL)
+	stale, err := repository.GetUnconfirmedChargesBefore(db.DB, before)
+	if err != nil {
+		return 0, err
+	}
+	expired := 0
+	for _, pending := range stale {
+		var settle settlement
+		cancelled := false
+		err := db.WithTx(func(tx *sql.Tx) error {
+			booking, err := repository.GetBookingByIDForUpdate(tx, pending.BookingID)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve booking: %w", err)
+			}
+			current, err := repository.GetPaymentByID(tx, pending.PaymentID)
+			if err != nil {
+				return err
+			}
+			if booking.Status != BookingConfirmed || current.PaymentStatus != "Pending" {
+				// Completed or cancelled meanwhile.
+				return nil
+			}
+			if err := repository.UpdateBookingStatus(tx, booking.BookingID, BookingCancelled); err != nil {
+				return err
+			}
+			settle, err = refundCancellation(tx, booking, "system")
+			if err != nil {
+				return err
+			}
+			cancelled = true
+			return repository.CreateBookingStatusEvent(tx, models.BookingStatusEvent{
+				BookingID:  booking.BookingID,
+				FromStatus: booking.Status,
+				ToStatus:   BookingCancelled,
+				ActorRole:  "system",
+				Reason:     "the payment was not confirmed in time",
+			})
+		})
+		if err != nil {
+			log.Printf("payment: failed to expire payment %d: %v", pending.PaymentID, err)
+			continue
+		}
+		if cancelled {
+			expired++
+		}
+		_ = settle.send(ctx)
+	}
+
+	voiding, err := repository.GetVoidingPaymentsBefore(db.DB, before)
+	if err != nil {
+		return expired, err
+	}
+	sendVoids(ctx, voiding)
+	return expired, nil
+}
+
+// ExpirePendingPaymentsEvery runs ExpirePendingPayments every interval until
+// ctx is done.
+func ExpirePendingPaymentsEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n, err := ExpirePendingPayments(ctx)
+		if err != nil {
+			log.Printf("payment: failed to expire pending payments: %v", err)
+		}
+		if n > 0 {
+			log.Printf("payment: cancelled %d bookings whose payment was not confirmed in time", n)
+		}
+	}
+}
+
+// CompleteBookingPayment completes the pending charge of a booking of the
+// logged-in customer once they have confirmed it with their bank. If the
+// provider declines, the booking is cancelled so its dates become free, and
+// ErrPaymentDeclined is returned.
+func CompleteBookingPayment(ctx context.Context, bookingID int) error {
+	booking, _, err := GetMyBooking(ctx, bookingID)
+	if err != nil {
+		return err
+	}
+	if gateway == nil {
+		return errNoGateway
+	}
+	payments, err := repository.GetPaymentsByBookingID(db.DB, bookingID)
+	if err != nil {
+		return err
+	}
+	var pending *models.Payment
+	for i := range payments {
+		if payments[i].PaymentStatus == "Pending" && payments[i].Amount.IsPositive() && payments[i].GatewayRef != "" {
+			pending = &payments[i]
+		}
+	}
+	if pending == nil || booking.Status != BookingConfirmed {
+		return invalidf("this booking has no payment waiting to be completed")
+	}
+	return capturePayment(ctx, *pending)
+}
+
+// capturePayment captures the pending charge of a booking and records the
+// outcome. The gateway is called outside any transaction, so funds are never
+// taken by a transaction that could still roll back; the outcome is then
+// recorded against the booking as it is by then. If the charge was settled
+// meanwhile, e.g. voided by a cancellation, a capture is released again. If
+// the provider declines, the booking is cancelled so its dates become free,
+// and ErrPaymentDeclined is returned. If recording fails the payment stays
+// pending and capturing it again is safe.
+func capturePayment(ctx context.Context, pending models.Payment) error {
+	res, err := gateway.Capture(ctx, pending.GatewayRef, pending.Amount)
+	if err != nil {
+		return fmt.Errorf("failed to capture payment: %w", err)
+	}
+	if res.Status != payment.StatusCaptured && res.Status != payment.StatusDeclined {
+		// Still waiting on the customer.
+		return invalidf("the payment is still waiting for confirmation")
+	}
+
+	var failure error
+	release := false
+	err = db.WithTx(func(tx *sql.Tx) error {
+		booking, err := repository.GetBookingByIDForUpdate(tx, pending.BookingID)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve booking: %w", err)
+		}
+		current, err := repository.GetPaymentByID(tx, pending.PaymentID)
+		if err != nil {
+			return err
+		}
+		if current.PaymentStatus != "Pending" {
+			// A concurrent completion recorded the same capture; anything
+			// else means the charge must not be kept.
+			release = res.Status == payment.StatusCaptured && current.PaymentStatus != "Completed"
+			return nil
+		}
+		if res.Status == payment.StatusCaptured {
+			if err := repository.UpdatePaymentStatus(tx, pending.PaymentID, "Completed"); err != nil {
+				return err
+			}
+			return repository.UpdateBookingPaymentStatus(tx, pending.BookingID, "Paid")
+		}
+
+		failure = declined(res)
+		if err := repository.UpdatePaymentStatus(tx, pending.PaymentID, "Failed"); err != nil {
+			return err
+		}
+		if err := repository.UpdateBookingPaymentStatus(tx, pending.BookingID, "Failed"); err != nil {
+			return err
+		}
+		if booking.Status != BookingConfirmed {
+			return nil
+		}
+		if err := repository.UpdateBookingStatus(tx, pending.BookingID, BookingCancelled); err != nil {
+			return err
+		}
+		return repository.CreateBookingStatusEvent(tx, models.BookingStatusEvent{
+			BookingID:  pending.BookingID,
+			FromStatus: booking.Status,
+			ToStatus:   BookingCancelled,
+			ActorRole:  "system",
+			Reason:     failure.Error(),
+		})
+	})
+	if err != nil {
+		log.Printf("payment: capture %s of payment %d was taken but not recorded: %v", res.Reference, pending.PaymentID, err)
+		return err
+	}
+	if release {
+		releaseCharge(ctx, res, pending.Amount)
+		return invalidf("this booking has no payment waiting to be completed")
+	}
+	return failure
+}
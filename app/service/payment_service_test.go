@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"hotelm/db/dbtest"
+	"hotelm/models"
+	"hotelm/money"
+	"hotelm/payment"
+)
+
+// recordingGateway is a fake gateway that records the operations it was
+// asked for after authorization.
+type recordingGateway struct {
+	*payment.Fake
+	calls []string
+}
+
+func (g *recordingGateway) Capture(ctx context.Context, reference string, amount money.Money) (payment.Result, error) {
+	g.calls = append(g.calls, "capture "+reference+" "+amount.String())
+	return g.Fake.Capture(ctx, reference, amount)
+}
+
+func (g *recordingGateway) Refund(ctx context.Context, reference string, amount money.Money) (payment.Result, error) {
+	g.calls = append(g.calls, "refund "+reference+" "+amount.String())
+	return g.Fake.Refund(ctx, reference, amount)
+}
+
+func (g *recordingGateway) Void(ctx context.Context, reference string) (payment.Result, error) {
+	g.calls = append(g.calls, "void "+reference)
+	return g.Fake.Void(ctx, reference)
+}
+
+// useFakeGateway makes the services use a recording fake gateway for the
+// rest of the test.
+func useFakeGateway(t *testing.T) *recordingGateway {
+	t.Helper()
+	g := &recordingGateway{Fake: payment.NewFake()}
+	previous := gateway
+	SetPaymentGateway(g)
+	t.Cleanup(func() { SetPaymentGateway(previous) })
+	return g
+}
+
+func TestAuthorizeStay(t *testing.T) {
+	amount := money.New(25000, "USD")
+	tests := []struct {
+		method  string
+		status  payment.Status
+		wantErr error
+	}{
+		{"tok_visa", payment.StatusAuthorized, nil},
+		{"tok_3ds", payment.StatusPending, nil},
+		{"tok_3ds-fail", payment.StatusPending, nil},
+		{"tok_decline", payment.StatusDeclined, ErrPaymentDeclined},
+		{"tok_timeout", "", payment.ErrTimeout},
+	}
+	for _, tt := range tests {
+		g := useFakeGateway(t)
+		res, err := authorizeStay(context.Background(), amount, tt.method, "Room 1")
+		if tt.wantErr == nil && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.method, err)
+		}
+		if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: error = %v, want %v", tt.method, err, tt.wantErr)
+		}
+		if res.Status != tt.status {
+			t.Errorf("%s: status = %q, want %q", tt.method, res.Status, tt.status)
+		}
+		// Nothing is taken before the booking is saved.
+		if len(g.calls) != 0 {
+			t.Errorf("%s: gateway calls %v, want none", tt.method, g.calls)
+		}
+	}
+}
+
+func TestAuthorizeStayNeedsMethod(t *testing.T) {
+	useFakeGateway(t)
+	_, err := authorizeStay(context.Background(), money.New(100, "USD"), "  ", "Room 1")
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Errorf("error = %v, want a validation error", err)
+	}
+}
+
+func TestAuthorizeStayWithoutGateway(t *testing.T) {
+	useFakeGateway(t)
+	SetPaymentGateway(nil)
+	if _, err := authorizeStay(context.Background(), money.New(100, "USD"), "tok_visa", "Room 1"); !errors.Is(err, errNoGateway) {
+		t.Errorf("error = %v, want errNoGateway", err)
+	}
+}
+
+func TestReleaseCharge(t *testing.T) {
+	g := useFakeGateway(t)
+	amount := money.New(9900, "EUR")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // the request is gone; the charge is still released
+
+	held, err := authorizeStay(context.Background(), amount, "tok_visa", "Room 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseCharge(ctx, held, amount)
+
+	captured, err := gateway.Capture(context.Background(), held.Reference, amount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseCharge(ctx, captured, amount)
+
+	want := []string{
+		"void " + held.Reference,
+		"capture " + held.Reference + " " + amount.String(),
+		"refund " + held.Reference + " " + amount.String(),
+	}
+	if len(g.calls) != len(want) {
+		t.Fatalf("gateway calls %v, want %v", g.calls, want)
+	}
+	for i := range want {
+		if g.calls[i] != want[i] {
+			t.Errorf("call %d = %q, want %q", i, g.calls[i], want[i])
+		}
+	}
+}
+
+func TestSendRefundWithoutCharge(t *testing.T) {
+	g := useFakeGateway(t)
+	// A booking paid before gateways existed is refunded in the records only.
+	if err := sendRefund(context.Background(), pendingRefund{PaymentID: 1, Amount: money.New(500, "USD")}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if len(g.calls) != 0 {
+		t.Errorf("gateway calls %v, want none", g.calls)
+	}
+}
+
+func TestSendRefundGatewayError(t *testing.T) {
+	g := useFakeGateway(t)
+	// The gateway does not know the charge, so the refund stays pending and
+	// the error is reported; nothing is recorded.
+	r := pendingRefund{PaymentID: 1, BookingID: 1, Charge: "other_1", Amount: money.New(500, "USD")}
+	if err := sendRefund(context.Background(), r); err == nil {
+		t.Error("expected an error")
+	}
+	if len(g.calls) != 1 {
+		t.Errorf("gateway calls %v, want one refund", g.calls)
+	}
+}
+
+// expiryDB answers the queries of ExpirePendingPayments for a charge of
+// booking 1 that has waited an hour, and is in the given status once the
+// booking is locked.
+func expiryDB(status string) dbtest.Handler {
+	stale := models.Payment{PaymentID: 5, PaymentMethod: "tok_3ds", PaymentStatus: "Pending", TransactionDate: time.Now().Add(-time.Hour), Amount: money.New(20000, "USD"), Gateway: "fake", GatewayRef: "fake_1_3ds"}
+	current := stale
+	current.PaymentStatus = status
+	return func(query string, args []driver.Value) dbtest.Result {
+		switch {
+		case strings.Contains(query, "payment_status = 'Pending' AND amount > 0"):
+			return paymentRows(stale)
+		case strings.Contains(query, "payment_status = 'Voiding' AND transaction_date"):
+			return paymentRows()
+		case strings.Contains(query, "FROM booking WHERE booking_id = $1"):
+			return bookingRow(testBooking(BookingConfirmed, "Pending"))
+		case strings.Contains(query, "FROM payment WHERE payment_id = $1"), strings.Contains(query, "FROM payment WHERE booking_id"):
+			return paymentRows(current)
+		case strings.Contains(query, "SUM(p.amount)"):
+			return dbtest.Rows([]string{"sum", "currency"}, []driver.Value{"0", "USD"})
+		}
+		return dbtest.Affected(1)
+	}
+}
+
+func TestExpirePendingPayments(t *testing.T) {
+	g := useFakeGateway(t)
+	rec := useTestDB(t, expiryDB("Pending"))
+
+	n, err := ExpirePendingPayments(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("ExpirePendingPayments = %d, %v, want 1 booking cancelled", n, err)
+	}
+	cancelled, event := false, false
+	for _, s := range rec.Statements() {
+		if strings.Contains(s.Query, "UPDATE booking SET status") && s.Args[0] == BookingCancelled {
+			cancelled = s.InTx
+		}
+		if strings.Contains(s.Query, "INSERT INTO booking_status_event") && s.Args[3] == "system" {
+			event = s.InTx
+		}
+	}
+	if !cancelled || !event {
+		t.Errorf("booking cancelled: %v, event recorded: %v", cancelled, event)
+	}
+	if len(g.calls) != 1 || g.calls[0] != "void fake_1_3ds" {
+		t.Errorf("gateway calls %v, want a void of the expired charge", g.calls)
+	}
+}
+
+func TestExpirePendingPaymentsCompletedMeanwhile(t *testing.T) {
+	g := useFakeGateway(t)
+	rec := useTestDB(t, expiryDB("Completed"))
+
+	n, err := ExpirePendingPayments(context.Background())
+	if err != nil || n != 0 {
+		t.Fatalf("ExpirePendingPayments = %d, %v, want nothing cancelled", n, err)
+	}
+	if rec.Ran("UPDATE booking SET status") || len(g.calls) != 0 {
+		t.Errorf("a paid booking was cancelled; gateway calls %v", g.calls)
+	}
+}
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"hotelm/db"
+	"hotelm/imaging"
+	"hotelm/models"
+	"hotelm/repository"
+	"hotelm/storage"
+)
+
+// Limits on room photos.
+const (
+	MaxPhotoBytes      = 8 << 20 // size of an uploaded photo
+	MaxRoomPhotos      = 20      // photos per room
+	MaxPhotosPerUpload = 5       // photos sent in one form
+	ThumbnailWidth     = 480
+	ThumbnailHeight    = 360
+)
+
+// blobStore keeps the photos and their thumbnails.
+var blobStore storage.BlobStore
+
+// SetBlobStore sets the store uploaded files are kept in. It must be called
+// before the services handle photos.
+func SetBlobStore(s storage.BlobStore) {
+	blobStore = s
+}
+
+// errNoBlobStore is returned when no blob store was set.
+var errNoBlobStore = errors.New("no blob store is configured")
+
+// newPhotoKeys returns fresh storage keys for a photo of a room with the
+// given file extension and for its thumbnail.
+func newPhotoKeys(roomID int, ext string) (string, string) {
+	b := make([]byte, 16)
+	rand.Read(b) // never fails on supported platforms
+	base := "rooms/" + strconv.Itoa(roomID) + "/" + hex.EncodeToString(b)
+	return base + ext, base + "_thumb.jpg"
+}
+
+// deleteBlobs removes blobs that are no longer referenced. A blob that
+// cannot be deleted is only logged: it is orphaned, not lost.
+func deleteBlobs(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if err := blobStore.Delete(ctx, key); err != nil {
+			log.Printf("failed to delete blob %s from %s store: %v", key, blobStore.Name(), err)
+		}
+	}
+}
+
+// checkPhoto returns the type and size of an uploaded photo, or an error if
+// it is too large or not a supported image.
+func checkPhoto(data []byte) (imaging.Info, error) {
+	if len(data) > MaxPhotoBytes {
+		return imaging.Info{}, invalidf("photos must be at most %d MB", MaxPhotoBytes>>20)
+	}
+	info, err := imaging.Inspect(data)
+	if errors.Is(err, imaging.ErrUnsupported) {
+		return info, invalidf("photos must be JPEG, PNG or GIF images")
+	}
+	if err != nil {
+		return info, invalidf("%s", err.Error())
+	}
+	return info, nil
+}
+
+// CheckRoomPhoto returns an error unless data can be added as a room photo,
+// so a form can be rejected before anything is saved.
+func CheckRoomPhoto(data []byte) error {
+	_, err := checkPhoto(data)
+	return err
+}
+
+// AddRoomPhotoForVendor checks an uploaded photo of a room of the logged-in
+// vendor, stores it with a thumbnail and adds it after the room's other
+// photos. The first photo of a room becomes its cover.
+func AddRoomPhotoForVendor(ctx context.Context, roomID int, data []byte) (int, error) {
+	if blobStore == nil {
+		return 0, errNoBlobStore
+	}
+	if _, err := GetRoomByIDForVendor(ctx, roomID); err != nil {
+		return 0, err
+	}
+	info, err := checkPhoto(data)
+	if err != nil {
+		return 0, err
+	}
+	thumbnail, err := imaging.Thumbnail(data, ThumbnailWidth, ThumbnailHeight)
+	if err != nil {
+		return 0, invalidf("photo could not be read: %s", err.Error())
+	}
+
+	photo := models.RoomPhoto{
+		RoomID:      roomID,
+		ContentType: info.ContentType,
+		Size:        len(data),
+		Width:       info.Width,
+		Height:      info.Height,
+	}
+	photo.Key, photo.ThumbnailKey = newPhotoKeys(roomID, info.Ext)
+	if err := blobStore.Put(ctx, photo.Key, data, info.ContentType); err != nil {
+		return 0, err
+	}
+	if err := blobStore.Put(ctx, photo.ThumbnailKey, thumbnail, "image/jpeg"); err != nil {
+		deleteBlobs(ctx, photo.Key)
+		return 0, err
+	}
+
+	var id int
+	err = db.WithTx(func(tx *sql.Tx) error {
+		// Locking the room serializes uploads, so each photo gets its own
+		// position and only the first becomes the cover.
+		if _, err := repository.GetRoomByIDForUpdate(tx, roomID); err != nil {
+			return err
+		}
+		photos, err := repository.GetRoomPhotos(tx, roomID)
+		if err != nil {
+			return err
+		}
+		if len(photos) >= MaxRoomPhotos {
+			return invalidf("a room can have at most %d photos", MaxRoomPhotos)
+		}
+		id, err = repository.CreateRoomPhoto(tx, photo)
+		return err
+	})
+	if err != nil {
+		deleteBlobs(ctx, photo.Key, photo.ThumbnailKey)
+		return 0, err
+	}
+	return id, nil
+}
+
+// GetRoomPhotos returns the photos of a room in display order.
+func GetRoomPhotos(roomID int) ([]models.RoomPhoto, error) {
+	return repository.GetRoomPhotos(db.DB, roomID)
+}
+
+// GetRoomPhotosForVendor returns the photos of a room of the logged-in
+// vendor in display order.
+func GetRoomPhotosForVendor(ctx context.Context, roomID int) ([]models.RoomPhoto, error) {
+	if _, err := GetRoomByIDForVendor(ctx, roomID); err != nil {
+		return nil, err
+	}
+	return repository.GetRoomPhotos(db.DB, roomID)
+}
+
+// GetRoomPhotoForVendor retrieves a photo and checks that its room belongs
+// to the logged-in vendor.
+func GetRoomPhotoForVendor(ctx context.Context, photoID int) (*models.RoomPhoto, error) {
+	photo, err := repository.GetRoomPhotoByID(db.DB, photoID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := GetRoomByIDForVendor(ctx, photo.RoomID); err != nil {
+		return nil, err
+	}
+	return photo, nil
+}
+
+// DeleteRoomPhotoForVendor deletes a photo of a room of the logged-in vendor
+// and returns the room's ID. If it was the cover, the room's first remaining
+// photo becomes the cover.
+func DeleteRoomPhotoForVendor(ctx context.Context, photoID int) (int, error) {
+	photo, err := GetRoomPhotoForVendor(ctx, photoID)
+	if err != nil {
+		return 0, err
+	}
+	err = db.WithTx(func(tx *sql.Tx) error {
+		if _, err := repository.GetRoomByIDForUpdate(tx, photo.RoomID); err != nil {
+			return err
+		}
+		if err := repository.DeleteRoomPhoto(tx, photoID); err != nil {
+			return err
+		}
+		if !photo.IsCover {
+			return nil
+		}
+		rest, err := repository.GetRoomPhotos(tx, photo.RoomID)
+		if err != nil || len(rest) == 0 {
+			return err
+		}
+		return repository.SetRoomCoverPhoto(tx, photo.RoomID, rest[0].PhotoID)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if blobStore != nil {
+		deleteBlobs(ctx, photo.Key, photo.ThumbnailKey)
+	}
+	return photo.RoomID, nil
+}
+
+// SetCoverPhotoForVendor makes a photo the cover of its room, a room of the
+// logged-in vendor, and returns the room's ID.
+func SetCoverPhotoForVendor(ctx context.Context, photoID int) (int, error) {
+	photo, err := GetRoomPhotoForVendor(ctx, photoID)
+	if err != nil {
+		return 0, err
+	}
+	err = db.WithTx(func(tx *sql.Tx) error {
+		return repository.SetRoomCoverPhoto(tx, photo.RoomID, photoID)
+	})
+	return photo.RoomID, err
+}
+
+// OrderRoomPhotosForVendor sets the display order of the photos of a room
+// of the logged-in vendor. photoIDs must list every photo of the room once.
+func OrderRoomPhotosForVendor(ctx context.Context, roomID int, photoIDs []int) error {
+	if _, err := GetRoomByIDForVendor(ctx, roomID); err != nil {
+		return err
+	}
+	return db.WithTx(func(tx *sql.Tx) error {
+		if _, err := repository.GetRoomByIDForUpdate(tx, roomID); err != nil {
+			return err
+		}
+		photos, err := repository.GetRoomPhotos(tx, roomID)
+		if err != nil {
+			return err
+		}
+		if !samePhotos(photos, photoIDs) {
+			return invalidf("the order must list each photo of the room once")
+		}
+		return repository.SetRoomPhotoOrder(tx, roomID, photoIDs)
+	})
+}
+
+// samePhotos reports whether photoIDs lists each of photos exactly once.
+func samePhotos(photos []models.RoomPhoto, photoIDs []int) bool {
+	if len(photos) != len(photoIDs) {
+		return false
+	}
+	listed := map[int]bool{}
+	for _, id := range photoIDs {
+		listed[id] = true
+	}
+	for _, p := range photos {
+		if !listed[p.PhotoID] {
+			return false
+		}
+	}
+	return true
+}
+
+// MoveRoomPhotoForVendor moves a photo of a room of the logged-in vendor by
+// offset places in the display order, e.g. -1 to show it one place earlier,
+// and returns the room's ID. Moves past either end stop there.
+func MoveRoomPhotoForVendor(ctx context.Context, photoID, offset int) (int, error) {
+	photo, err := GetRoomPhotoForVendor(ctx, photoID)
+	if err != nil {
+		return 0, err
+	}
+	photos, err := repository.GetRoomPhotos(db.DB, photo.RoomID)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	from := 0
+	for i, p := range photos {
+		if p.PhotoID == photoID {
+			from = i
+			continue
+		}
+		ids = append(ids, p.PhotoID)
+	}
+	to := min(max(from+offset, 0), len(ids))
+	ids = append(ids[:to], append([]int{photoID}, ids[to:]...)...)
+	return photo.RoomID, OrderRoomPhotosForVendor(ctx, photo.RoomID, ids)
+}
+
+// OpenPhoto opens the photo or thumbnail stored under key for serving.
+// Only room photos are served.
+func OpenPhoto(ctx context.Context, key string) (*storage.Object, error) {
+	if blobStore == nil {
+		return nil, errNoBlobStore
+	}
+	if !strings.HasPrefix(key, "rooms/") || storage.CheckKey(key) != nil {
+		return nil, fmt.Errorf("photo %w", repository.ErrNotFound)
+	}
+	obj, err := blobStore.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("photo %w", repository.ErrNotFound)
+	}
+	return obj, err
+}
+
+// deleteRoomPhotoBlobs removes the stored images of photos of a deleted
+// room.
+func deleteRoomPhotoBlobs(ctx context.Context, photos []models.RoomPhoto) {
+	if blobStore == nil {
+		return
+	}
+	for _, p := range photos {
+		deleteBlobs(ctx, p.Key, p.ThumbnailKey)
+	}
+}
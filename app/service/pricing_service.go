@@ -0,0 +1,160 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"hotelm/db"
+	"hotelm/models"
+	"hotelm/money"
+	"hotelm/repository"
+)
+
+// Quote is the itemized price of a stay in a room, in the room's currency.
+type Quote struct {
+	RoomID       int                      `json:"room_id"`
+	CheckinDate  time.Time                `json:"checkin_date"`
+	CheckoutDate time.Time                `json:"checkout_date"`
+	Nights       int                      `json:"nights"`
+	NightlyRate  money.Money              `json:"nightly_rate"` // average of NightRates
+	NightRates   []NightRate              `json:"night_rates"`
+	Subtotal     money.Money              `json:"subtotal"`
+	PromoCode    string                   `json:"promo_code,omitempty"`
+	PromoNote    string                   `json:"promo_note,omitempty"` // for visitors: limits checked only at booking
+	Discount     money.Money              `json:"discount"`
+	TaxTotal     money.Money              `json:"tax_total"`
+	FeeTotal     money.Money              `json:"fee_total"`
+	Total        money.Money              `json:"total"`
+	Lines        []models.BookingLineItem `json:"lines"`
+	// Display is the total in the customer's display currency, when shown
+	// in one. The stay is charged in the room's currency.
+	Display *Conversion `json:"display,omitempty"`
+}
+
+// CountNights returns the number of nights between check-in and check-out.
+func CountNights(checkin, checkout time.Time) int {
+	return int(checkout.Sub(checkin).Hours()+12) / 24
+}
+
+// QuoteStay prices a stay in a room: the price of each night, from the
+// room's rate plans or its own price, plus the active taxes and fees. Each
+// line is rounded to the currency's minor unit and the totals are the sums
+// of the lines.
+func QuoteStay(roomID int, checkin, checkout time.Time) (*Quote, error) {
+	return quoteStay(db.DB, roomID, checkin, checkout, nil, 0)
+}
+
+// quoteStay is QuoteStay run on the given querier, so bookings can price the
+// stay inside their transaction. A promo code, if not nil, is checked for
+// the customer and taken off the room charge before taxes and fees.
+func quoteStay(q db.Querier, roomID int, checkin, checkout time.Time, promo *models.PromoCode, customerID int) (*Quote, error) {
+	nights := CountNights(checkin, checkout)
+	if nights < 1 {
+		return nil, invalidf("check-out date must be after check-in date")
+	}
+
+	room, err := repository.GetRoomByID(q, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve room: %w", err)
+	}
+	fees, err := repository.GetActivePricingFees(q)
+	if err != nil {
+		return nil, err
+	}
+
+	nightRates, err := stayRates(q, room, checkin, checkout)
+	if err != nil {
+		return nil, err
+	}
+
+	currency := room.Price.Currency
+	quote := &Quote{
+		RoomID:       roomID,
+		CheckinDate:  checkin,
+		CheckoutDate: checkout,
+		Nights:       nights,
+		NightRates:   nightRates,
+		Subtotal:     money.Zero(currency),
+		Discount:     money.Zero(currency),
+		TaxTotal:     money.Zero(currency),
+		FeeTotal:     money.Zero(currency),
+	}
+
+	// One line per run of nights at the same price from the same plan.
+	for start := 0; start < len(nightRates); {
+		night := nightRates[start]
+		end := start + 1
+		for end < len(nightRates) && nightRates[end].Price == night.Price && nightRates[end].RatePlanID == night.RatePlanID {
+			end++
+		}
+		description := fmt.Sprintf("%s: %d night(s) x %s", room.Name, end-start, night.Price)
+		if night.Plan != "" {
+			description += " (" + night.Plan + ")"
+		}
+		amount := night.Price.Mul(end - start).Round()
+		quote.Lines = append(quote.Lines, models.BookingLineItem{
+			Kind:        "room",
+			Description: description,
+			Amount:      amount,
+		})
+		quote.Subtotal = quote.Subtotal.Add(amount)
+		start = end
+	}
+	quote.NightlyRate = quote.Subtotal.Div(nights)
+
+	if promo != nil {
+		// The code's dates are days where the room's property is.
+		loc, err := roomLocation(q, roomID)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkPromoCode(q, promo, room, nights, customerID, today(loc)); err != nil {
+			return nil, err
+		}
+		quote.PromoCode = promo.Code
+		quote.Discount = promoDiscount(promo, quote.Subtotal)
+		if quote.Discount.IsPositive() {
+			quote.Lines = append(quote.Lines, models.BookingLineItem{
+				Kind:        "discount",
+				Description: fmt.Sprintf("Promo code %s (%s)", promo.Code, DescribePromoCode(*promo)),
+				Amount:      quote.Discount.Neg(),
+			})
+		}
+	}
+	// Taxes and fees are charged on the room charge after the discount.
+	discounted := quote.Subtotal.Sub(quote.Discount)
+
+	for _, fee := range fees {
+		amount := discounted.Percent(fee.Percent)
+		// A flat amount only applies to rooms priced in its currency.
+		if fee.FlatAmount.Currency == currency {
+			if fee.PerNight {
+				amount = amount.Add(fee.FlatAmount.Mul(nights))
+			} else {
+				amount = amount.Add(fee.FlatAmount)
+			}
+		}
+		amount = amount.Round()
+		if amount.IsZero() {
+			continue
+		}
+
+		description := fee.Name
+		if fee.Percent != 0 {
+			description = fmt.Sprintf("%s (%.2f%%)", fee.Name, fee.Percent)
+		}
+		quote.Lines = append(quote.Lines, models.BookingLineItem{
+			Kind:        fee.Kind,
+			Description: description,
+			Amount:      amount,
+		})
+		if fee.Kind == "tax" {
+			quote.TaxTotal = quote.TaxTotal.Add(amount)
+		} else {
+			quote.FeeTotal = quote.FeeTotal.Add(amount)
+		}
+	}
+
+	quote.Total = discounted.Add(quote.TaxTotal).Add(quote.FeeTotal)
+	return quote, nil
+}
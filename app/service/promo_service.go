@@ -0,0 +1,303 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"hotelm/db"
+	"hotelm/models"
+	"hotelm/money"
+	"hotelm/repository"
+	"hotelm/session"
+)
+
+// Audit actions for platform-wide promo codes and for admins enabling or
+// disabling any code.
+const (
+	AuditCreatePromoCode  = "create_promo_code"
+	AuditEnablePromoCode  = "enable_promo_code"
+	AuditDisablePromoCode = "disable_promo_code"
+)
+
+// promoCodePattern is the form of a promo code, after upper-casing.
+var promoCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,40}$`)
+
+// normalizeCode returns a promo code as stored: trimmed and upper-cased.
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// DescribePromoCode returns the discount of a code in words, e.g. "15% off".
+func DescribePromoCode(promo models.PromoCode) string {
+	if promo.Amount != nil {
+		return promo.Amount.String() + " off"
+	}
+	return fmt.Sprintf("%g%% off", promo.Percent)
+}
+
+// promoDiscount returns the discount of a code on a room subtotal. A fixed
+// amount never takes more than the subtotal.
+func promoDiscount(promo *models.PromoCode, subtotal money.Money) money.Money {
+	if promo.Amount == nil {
+		return subtotal.Percent(promo.Percent)
+	}
+	if promo.Amount.Cmp(subtotal) > 0 {
+		return subtotal
+	}
+	return *promo.Amount
+}
+
+// checkPromoCode returns an error unless a customer can use the code on a
+// stay of the given length in the room on the given day. customerID is 0 for quotes
+// to visitors, which skips the per-customer cap.
+func checkPromoCode(q db.Querier, promo *models.PromoCode, room *models.Room, nights, customerID int, today time.Time) error {
+	switch {
+	case !promo.Active:
+		return invalidf("promo code %s is no longer active", promo.Code)
+	case promo.ValidFrom != nil && today.Before(*promo.ValidFrom):
+		return invalidf("promo code %s is not valid until %s", promo.Code, promo.ValidFrom.Format(dateLayout))
+	case promo.ValidUntil != nil && today.After(*promo.ValidUntil):
+		return invalidf("promo code %s expired on %s", promo.Code, promo.ValidUntil.Format(dateLayout))
+	case promo.VendorID != nil && *promo.VendorID != room.VendorID,
+		promo.RoomID != nil && *promo.RoomID != room.RoomID,
+		promo.RoomType != "" && !strings.EqualFold(promo.RoomType, strings.TrimSpace(room.RoomType)):
+		return invalidf("promo code %s does not apply to this room", promo.Code)
+	case promo.Amount != nil && promo.Amount.Currency != room.Price.Currency:
+		return invalidf("promo code %s does not apply to rooms priced in %s", promo.Code, room.Price.Currency)
+	case nights < promo.MinNights:
+		return invalidf("promo code %s requires a stay of at least %d nights", promo.Code, promo.MinNights)
+	case promo.MaxUses > 0 && promo.Uses >= promo.MaxUses:
+		return invalidf("promo code %s has been fully redeemed", promo.Code)
+	}
+	if promo.MaxUsesPerCustomer > 0 && customerID != 0 {
+		used, err := repository.CountPromoCodeUsesByCustomer(q, promo.PromoCodeID, customerID)
+		if err != nil {
+			return err
+		}
+		if used >= promo.MaxUsesPerCustomer {
+			return invalidf("you have already used promo code %s", promo.Code)
+		}
+	}
+	return nil
+}
+
+// findPromoCode looks up a code entered by a customer, locking it when
+// forUpdate is set. It returns nil for an empty code.
+func findPromoCode(q db.Querier, code string, forUpdate bool) (*models.PromoCode, error) {
+	code = normalizeCode(code)
+	if code == "" {
+		return nil, nil
+	}
+	lookup := repository.GetPromoCodeByCode
+	if forUpdate {
+		lookup = repository.GetPromoCodeByCodeForUpdate
+	}
+	promo, err := lookup(q, code)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, invalidf("unknown promo code %s", code)
+	}
+	return promo, err
+}
+
+// QuoteStayWithPromo prices a stay like QuoteStay with a promo code taken
+// off the room charge. The code is checked for the logged-in customer, if
+// any; a visitor's quote notes that a per-customer limit is checked at
+// booking. An empty code quotes the stay without a discount.
+func QuoteStayWithPromo(ctx context.Context, roomID int, checkin, checkout time.Time, code string) (*Quote, error) {
+	promo, err := findPromoCode(db.DB, code, false)
+	if err != nil {
+		return nil, err
+	}
+	customerID := 0
+	if customer, ok := session.CustomerFromContext(ctx); ok {
+		customerID = customer.CustomerID
+	}
+	quote, err := quoteStay(db.DB, roomID, checkin, checkout, promo, customerID)
+	if err != nil {
+		return nil, err
+	}
+	if customerID == 0 && promo != nil && promo.MaxUsesPerCustomer > 0 && quote.Discount.IsPositive() {
+		quote.PromoNote = fmt.Sprintf("promo code %s is limited to %d uses per customer, checked when booking", promo.Code, promo.MaxUsesPerCustomer)
+	}
+	return quote, nil
+}
+
+// normalizePromoCode checks a new promo code. An amount without a currency
+// is in the default currency.
+func normalizePromoCode(promo *models.PromoCode) error {
+	promo.Code = normalizeCode(promo.Code)
+	if !promoCodePattern.MatchString(promo.Code) {
+		return invalidf("promo code must be 3 to 40 letters, digits, dashes or underscores")
+	}
+	promo.Description = strings.TrimSpace(promo.Description)
+	if len(promo.Description) > 255 {
+		return invalidf("description must be at most 255 characters")
+	}
+	promo.RoomType = strings.TrimSpace(promo.RoomType)
+	if len(promo.RoomType) > 50 {
+		return invalidf("room type must be at most 50 characters")
+	}
+
+	switch {
+	case promo.Amount != nil && promo.Percent != 0:
+		return invalidf("a promo code takes a percentage or an amount off, not both")
+	case promo.Amount != nil:
+		amount := promo.Amount.WithDefault(money.DefaultCurrency)
+		if _, ok := money.LookupCurrency(amount.Currency); !ok {
+			return invalidf("unsupported currency %q", amount.Currency)
+		}
+		if !amount.IsPositive() {
+			return invalidf("discount amount must be positive")
+		}
+		if amount.Round() != amount {
+			return invalidf("discount amount has more decimals than %s allows", amount.Currency)
+		}
+		promo.Amount = &amount
+	case promo.Percent <= 0 || promo.Percent > 100:
+		return invalidf("discount percentage must be more than 0 and at most 100")
+	}
+
+	if promo.ValidFrom != nil && promo.ValidUntil != nil && promo.ValidUntil.Before(*promo.ValidFrom) {
+		return invalidf("promo code cannot expire before it starts")
+	}
+	if promo.MaxUses < 0 || promo.MaxUsesPerCustomer < 0 || promo.MinNights < 0 {
+		return invalidf("usage caps and minimum nights cannot be negative")
+	}
+	return nil
+}
+
+// createPromoCode stores a checked promo code.
+func createPromoCode(q db.Querier, promo models.PromoCode) (int, error) {
+	promo.Active = true
+	id, err := repository.CreatePromoCode(q, promo)
+	if errors.Is(err, repository.ErrDuplicatePromoCode) {
+		return 0, invalidf("promo code %s already exists", promo.Code)
+	}
+	return id, err
+}
+
+// GetVendorPromoCodes retrieves the promo codes of the logged-in vendor.
+func GetVendorPromoCodes(ctx context.Context) ([]models.PromoCode, error) {
+	vendor, ok := session.VendorFromContext(ctx)
+	if !ok {
+		return nil, ErrNoVendor
+	}
+	return repository.GetPromoCodesByVendor(db.DB, vendor.VendorID)
+}
+
+// CreatePromoCodeForVendor creates a promo code for the logged-in vendor's
+// rooms. A code restricted to one room must be restricted to one of theirs.
+func CreatePromoCodeForVendor(ctx context.Context, promo models.PromoCode) (int, error) {
+	vendor, ok := session.VendorFromContext(ctx)
+	if !ok {
+		return 0, ErrNoVendor
+	}
+	promo.VendorID = &vendor.VendorID
+	if err := normalizePromoCode(&promo); err != nil {
+		return 0, err
+	}
+	if promo.RoomID != nil {
+		if _, err := GetRoomByIDForVendor(ctx, *promo.RoomID); err != nil {
+			return 0, err
+		}
+	}
+	return createPromoCode(db.DB, promo)
+}
+
+// GetPromoCodeForVendor retrieves a promo code and checks that it belongs
+// to the logged-in vendor.
+func GetPromoCodeForVendor(ctx context.Context, promoCodeID int) (*models.PromoCode, error) {
+	vendor, ok := session.VendorFromContext(ctx)
+	if !ok {
+		return nil, ErrNoVendor
+	}
+	promo, err := repository.GetPromoCodeByID(db.DB, promoCodeID)
+	if err != nil {
+		return nil, err
+	}
+	if promo.VendorID == nil || *promo.VendorID != vendor.VendorID {
+		return nil, fmt.Errorf("%w: this promo code does not belong to the logged-in vendor", ErrForbidden)
+	}
+	return promo, nil
+}
+
+// SetPromoCodeActiveForVendor enables or disables a promo code of the
+// logged-in vendor.
+func SetPromoCodeActiveForVendor(ctx context.Context, promoCodeID int, active bool) error {
+	if _, err := GetPromoCodeForVendor(ctx, promoCodeID); err != nil {
+		return err
+	}
+	return repository.SetPromoCodeActive(db.DB, promoCodeID, active)
+}
+
+// ListAllPromoCodes returns every promo code, platform-wide and of vendors,
+// for the logged-in admin.
+func ListAllPromoCodes(ctx context.Context) ([]models.PromoCode, error) {
+	if _, err := currentAdmin(ctx); err != nil {
+		return nil, err
+	}
+	return repository.GetAllPromoCodes(db.DB)
+}
+
+// GetPromoCode retrieves any promo code for the logged-in admin.
+func GetPromoCode(ctx context.Context, promoCodeID int) (*models.PromoCode, error) {
+	if _, err := currentAdmin(ctx); err != nil {
+		return nil, err
+	}
+	return repository.GetPromoCodeByID(db.DB, promoCodeID)
+}
+
+// CreatePlatformPromoCode creates a promo code for every room on behalf of
+// the logged-in admin.
+func CreatePlatformPromoCode(ctx context.Context, promo models.PromoCode) (int, error) {
+	admin, err := currentAdmin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	promo.VendorID = nil
+	if err := normalizePromoCode(&promo); err != nil {
+		return 0, err
+	}
+	if promo.RoomID != nil {
+		if _, err := repository.GetRoomByID(db.DB, *promo.RoomID); err != nil {
+			return 0, err
+		}
+	}
+
+	var id int
+	err = db.WithTx(func(tx *sql.Tx) error {
+		if id, err = createPromoCode(tx, promo); err != nil {
+			return err
+		}
+		return audit(tx, admin, AuditCreatePromoCode, "promo_code", id, fmt.Sprintf("%s: %s", promo.Code, DescribePromoCode(promo)))
+	})
+	return id, err
+}
+
+// SetPromoCodeActive enables or disables any promo code on behalf of the
+// logged-in admin.
+func SetPromoCodeActive(ctx context.Context, promoCodeID int, active bool) error {
+	admin, err := currentAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	return db.WithTx(func(tx *sql.Tx) error {
+		promo, err := repository.GetPromoCodeByID(tx, promoCodeID)
+		if err != nil {
+			return err
+		}
+		if err := repository.SetPromoCodeActive(tx, promoCodeID, active); err != nil {
+			return err
+		}
+		action := AuditDisablePromoCode
+		if active {
+			action = AuditEnablePromoCode
+		}
+		return audit(tx, admin, action, "promo_code", promoCodeID, promo.Code)
+	})
+}
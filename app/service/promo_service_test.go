@@ -0,0 +1,58 @@
+package service
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"hotelm/db"
+	"hotelm/db/dbtest"
+	"hotelm/models"
+)
+
+// TestQuotePromoTimezone checks that a promo code's last day is counted
+// where the room's property is: on the easternmost clocks, the last day on
+// the westernmost ones is already over.
+func TestQuotePromoTimezone(t *testing.T) {
+	behind, err := time.LoadLocation("Etc/GMT+12")
+	if err != nil {
+		t.Skip(err)
+	}
+	last := today(behind)
+	promo := &models.PromoCode{Code: "LASTDAY", Percent: 10, ValidUntil: &last, Active: true}
+	checkin := last.AddDate(0, 0, 5)
+
+	for _, tt := range []struct {
+		timezone string
+		expired  bool
+	}{
+		{"Etc/GMT+12", false},
+		{"Pacific/Kiritimati", true},
+	} {
+		useTestDB(t, func(query string, args []driver.Value) dbtest.Result {
+			switch {
+			case strings.Contains(query, "FROM room WHERE room_id = $1"):
+				return roomRow()
+			case strings.Contains(query, "p.timezone"):
+				return timezoneRow(tt.timezone)
+			}
+			return dbtest.Rows([]string{"none"})
+		})
+		quote, err := quoteStay(db.DB, 3, checkin, checkin.AddDate(0, 0, 2), promo, 0)
+		if tt.expired {
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) || !strings.Contains(err.Error(), "expired") {
+				t.Errorf("%s: error = %v, want the code expired", tt.timezone, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: quoteStay: %v", tt.timezone, err)
+		}
+		if quote.Discount != usd(20) {
+			t.Errorf("%s: discount %s, want %s", tt.timezone, quote.Discount, usd(20))
+		}
+	}
+}
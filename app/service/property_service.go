@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"hotelm/db"
+	"hotelm/models"
+	"hotelm/repository"
+	"hotelm/session"
+)
+
+// Defaults for the details a vendor leaves blank on a property.
+const (
+	DefaultTimezone     = "UTC"
+	DefaultCheckinTime  = "15:00"
+	DefaultCheckoutTime = "11:00"
+)
+
+// clockLayout is the layout of check-in and check-out times.
+const clockLayout = "15:04"
+
+// today returns the current date at loc as midnight UTC, the way the dates
+// of stays are stored.
+func today(loc *time.Location) time.Time {
+	y, m, d := time.Now().In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// bookingLocation returns the time zone the dates of a booking are in. A
+// zone that does not load, which a property cannot be saved with, counts as
+// UTC.
+func bookingLocation(booking models.Booking) *time.Location {
+	loc, err := time.LoadLocation(booking.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// roomLocation returns the time zone of the property a room belongs to,
+// which the dates of its stays are in.
+func roomLocation(q db.Querier, roomID int) (*time.Location, error) {
+	timezone, err := repository.GetRoomTimezone(q, roomID)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("room %d is in an unknown timezone: %v", roomID, err)
+	}
+	return loc, nil
+}
+
+// normalizeProperty trims the details of a property, fills in the defaults
+// and checks them.
+func normalizeProperty(p *models.Property) error {
+	p.Name = strings.Join(strings.Fields(p.Name), " ")
+	p.Address = strings.TrimSpace(p.Address)
+	p.Timezone = strings.TrimSpace(p.Timezone)
+	p.CheckinTime = strings.TrimSpace(p.CheckinTime)
+	p.CheckoutTime = strings.TrimSpace(p.CheckoutTime)
+	p.Policies = strings.TrimSpace(p.Policies)
+	p.Phone = strings.TrimSpace(p.Phone)
+	p.Email = strings.TrimSpace(p.Email)
+
+	if p.Name == "" {
+		return invalidf("property name is required")
+	}
+	for _, field := range []struct {
+		label, value string
+		max          int
+	}{
+		{"property name", p.Name, 255},
+		{"address", p.Address, 255},
+		{"phone", p.Phone, 20},
+		{"email", p.Email, 100},
+	} {
+		if utf8.RuneCountInString(field.value) > field.max {
+			return invalidf("%s must be at most %d characters", field.label, field.max)
+		}
+	}
+	if p.Email != "" {
+		if _, err := mail.ParseAddress(p.Email); err != nil {
+			return invalidf("invalid email address %q", p.Email)
+		}
+	}
+
+	if (p.Latitude == nil) != (p.Longitude == nil) {
+		return invalidf("latitude and longitude must be given together")
+	}
+	if p.Latitude != nil && (*p.Latitude < -90 || *p.Latitude > 90) {
+		return invalidf("latitude must be between -90 and 90")
+	}
+	if p.Longitude != nil && (*p.Longitude < -180 || *p.Longitude > 180) {
+		return invalidf("longitude must be between -180 and 180")
+	}
+
+	if p.Timezone == "" {
+		p.Timezone = DefaultTimezone
+	}
+	if _, err := time.LoadLocation(p.Timezone); err != nil || p.Timezone == "Local" || len(p.Timezone) > 64 {
+		return invalidf("unknown timezone %q", p.Timezone)
+	}
+
+	if p.CheckinTime == "" {
+		p.CheckinTime = DefaultCheckinTime
+	}
+	if p.CheckoutTime == "" {
+		p.CheckoutTime = DefaultCheckoutTime
+	}
+	if _, err := time.Parse(clockLayout, p.CheckinTime); err != nil {
+		return invalidf("check-in time must be given as HH:MM")
+	}
+	if _, err := time.Parse(clockLayout, p.CheckoutTime); err != nil {
+		return invalidf("check-out time must be given as HH:MM")
+	}
+	return nil
+}
+
+// vendorProperty retrieves a property and checks that it belongs to the
+// vendor.
+func vendorProperty(q db.Querier, vendor *models.Vendor, propertyID int) (*models.Property, error) {
+	p, err := repository.GetPropertyByID(q, propertyID)
+	if err != nil {
+		return nil, err
+	}
+	if p.VendorID != vendor.VendorID {
+		return nil, fmt.Errorf("%w: this property does not belong to the logged-in vendor", ErrForbidden)
+	}
+	return p, nil
+}
+
+// roomProperty resolves the property a vendor's room is placed in. A room
+// without one goes to the vendor's only property; a vendor with several
+// must choose.
+func roomProperty(q db.Querier, vendor *models.Vendor, propertyID int) (int, error) {
+	if propertyID != 0 {
+		_, err := vendorProperty(q, vendor, propertyID)
+		if errors.Is(err, repository.ErrNotFound) || errors.Is(err, ErrForbidden) {
+			return 0, invalidf("unknown property %d", propertyID)
+		}
+		return propertyID, err
+	}
+	properties, err := repository.GetPropertiesByVendor(q, vendor.VendorID)
+	if err != nil {
+		return 0, err
+	}
+	if len(properties) != 1 {
+		return 0, invalidf("choose the property the room belongs to")
+	}
+	return properties[0].PropertyID, nil
+}
+
+// GetVendorProperties retrieves the properties of the logged-in vendor.
+func GetVendorProperties(ctx context.Context) ([]models.Property, error) {
+	vendor, ok := session.VendorFromContext(ctx)
+	if !ok {
+		return nil, ErrNoVendor
+	}
+	return repository.GetPropertiesByVendor(db.DB, vendor.VendorID)
+}
+
+// GetPropertyForVendor retrieves a property of the logged-in vendor.
+func GetPropertyForVendor(ctx context.Context, propertyID int) (*models.Property, error) {
+	vendor, ok := session.VendorFromContext(ctx)
+	if !ok {
+		return nil, ErrNoVendor
+	}
+	return vendorProperty(db.DB, vendor, propertyID)
+}
+
+// CreatePropertyForVendor adds a property to the logged-in vendor.
+func CreatePropertyForVendor(ctx context.Context, p models.Property) (int, error) {
+	vendor, ok := session.VendorFromContext(ctx)
+	if !ok {
+		return 0, ErrNoVendor
+	}
+	p.VendorID = vendor.VendorID
+	if err := normalizeProperty(&p); err != nil {
+		return 0, err
+	}
+	return repository.CreateProperty(db.DB, p)
+}
+
+// UpdatePropertyForVendor updates a property of the logged-in vendor.
+func UpdatePropertyForVendor(ctx context.Context, p models.Property) error {
+	vendor, ok := session.VendorFromContext(ctx)
+	if !ok {
+		return ErrNoVendor
+	}
+	if _, err := vendorProperty(db.DB, vendor, p.PropertyID); err != nil {
+		return err
+	}
+	p.VendorID = vendor.VendorID
+	if err := normalizeProperty(&p); err != nil {
+		return err
+	}
+	return repository.UpdateProperty(db.DB, p)
+}
+
+// DeletePropertyForVendor deletes a property of the logged-in vendor. Its
+// rooms must be deleted or moved to another property first.
+func DeletePropertyForVendor(ctx context.Context, propertyID int) error {
+	vendor, ok := session.VendorFromContext(ctx)
+	if !ok {
+		return ErrNoVendor
+	}
+	return db.WithTx(func(tx *sql.Tx) error {
+		p, err := vendorProperty(tx, vendor, propertyID)
+		if err != nil {
+			return err
+		}
+		if p.Rooms > 0 {
+			return invalidf("%s still has %d rooms; move or delete them first", p.Name, p.Rooms)
+		}
+		return repository.DeleteProperty(tx, propertyID)
+	})
+}
+
+// GetListedProperties returns the properties customers can book rooms at.
+func GetListedProperties() ([]models.Property, error) {
+	return repository.GetListedProperties(db.DB)
+}
+
+// GetProperty retrieves a property for customers to view.
+func GetProperty(propertyID int) (*models.Property, error) {
+	return repository.GetPropertyByID(db.DB, propertyID)
+}
+
+// GetRoomProperty retrieves the property a room belongs to.
+func GetRoomProperty(roomID int) (*models.Property, error) {
+	room, err := repository.GetRoomByID(db.DB, roomID)
+	if err != nil {
+		return nil, err
+	}
+	return repository.GetPropertyByID(db.DB, room.PropertyID)
+}
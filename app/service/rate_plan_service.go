@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"hotelm/db"
+	"hotelm/models"
+	"hotelm/money"
+	"hotelm/repository"
+)
+
+// maxRatePlanDays is the longest date range a rate plan can cover.
+const maxRatePlanDays = 2 * 366
+
+// NightRate is the price of one night of a stay.
+type NightRate struct {
+	Date  time.Time   `json:"date"`
+	Price money.Money `json:"price"`
+	// Plan names the rate plan pricing the night; it is empty for nights
+	// at the room's own price.
+	Plan       string `json:"plan,omitempty"`
+	RatePlanID int    `json:"rate_plan_id,omitempty"`
+}
+
+// planForNight returns the plan pricing the night starting on date, or nil
+// for the room's own price. Of the plans covering the night, the one with
+// the shortest date range applies, and the newest of those. Plans in
+// another currency than the room's are ignored.
+func planForNight(plans []models.RatePlan, currency string, date time.Time) *models.RatePlan {
+	var best *models.RatePlan
+	for i := range plans {
+		p := &plans[i]
+		if p.Price.Currency != currency || date.Before(p.StartDate) || date.After(p.EndDate) {
+			continue
+		}
+		if best == nil {
+			best = p
+			continue
+		}
+		span, bestSpan := p.EndDate.Sub(p.StartDate), best.EndDate.Sub(best.StartDate)
+		if span < bestSpan || (span == bestSpan && p.RatePlanID > best.RatePlanID) {
+			best = p
+		}
+	}
+	return best
+}
+
+// nightlyRates prices each night from first to last, both included.
+func nightlyRates(room *models.Room, plans []models.RatePlan, first, last time.Time) []NightRate {
+	var nights []NightRate
+	for date := first; !date.After(last); date = date.AddDate(0, 0, 1) {
+		night := NightRate{Date: date, Price: room.Price}
+		if plan := planForNight(plans, room.Price.Currency, date); plan != nil {
+			night.Plan = plan.Name
+			night.RatePlanID = plan.RatePlanID
+			night.Price = plan.Price
+			if price, ok := plan.WeekdayPrices[date.Weekday()]; ok {
+				night.Price = price
+			}
+		}
+		nights = append(nights, night)
+	}
+	return nights
+}
+
+// stayRates prices each night of a stay and checks the length of the stay
+// against the rate plans it uses.
+func stayRates(q db.Querier, room *models.Room, checkin, checkout time.Time) ([]NightRate, error) {
+	plans, err := repository.GetRatePlansForDates(q, room.RoomID, checkin, checkout.AddDate(0, 0, -1))
+	if err != nil {
+		return nil, err
+	}
+	return priceStay(room, plans, checkin, checkout)
+}
+
+// priceStay prices each night of the stay from checkin to checkout with the
+// given plans and checks the length of the stay against the plans it uses.
+func priceStay(room *models.Room, plans []models.RatePlan, checkin, checkout time.Time) ([]NightRate, error) {
+	nights := nightlyRates(room, plans, checkin, checkout.AddDate(0, 0, -1))
+
+	checked := map[int]bool{}
+	for _, night := range nights {
+		if night.RatePlanID == 0 || checked[night.RatePlanID] {
+			continue
+		}
+		checked[night.RatePlanID] = true
+		for _, plan := range plans {
+			if plan.RatePlanID != night.RatePlanID {
+				continue
+			}
+			if plan.MinStay > 0 && len(nights) < plan.MinStay {
+				return nil, invalidf("stays during %s must be at least %d nights", plan.Name, plan.MinStay)
+			}
+			if plan.MaxStay > 0 && len(nights) > plan.MaxStay {
+				return nil, invalidf("stays during %s can be at most %d nights", plan.Name, plan.MaxStay)
+			}
+		}
+	}
+	return nights, nil
+}
+
+// normalizeRatePlan checks a rate plan of a room. Prices without a currency
+// are in the room's currency.
+func normalizeRatePlan(room *models.Room, plan *models.RatePlan) error {
+	plan.RoomID = room.RoomID
+	plan.Name = strings.TrimSpace(plan.Name)
+	if plan.Name == "" {
+		return invalidf("rate plan name is required")
+	}
+	if len(plan.Name) > 100 {
+		return invalidf("rate plan name must be at most 100 characters")
+	}
+	if plan.StartDate.IsZero() || plan.EndDate.IsZero() {
+		return invalidf("rate plan start and end dates are required")
+	}
+	if plan.EndDate.Before(plan.StartDate) {
+		return invalidf("rate plan cannot end before it starts")
+	}
+	if plan.EndDate.Sub(plan.StartDate) > maxRatePlanDays*24*time.Hour {
+		return invalidf("rate plan can cover at most %d days", maxRatePlanDays)
+	}
+
+	currency := room.Price.Currency
+	checkPrice := func(what string, price *money.Money) error {
+		*price = price.WithDefault(currency)
+		if price.Currency != currency {
+			return invalidf("%s must be in the room's currency, %s", what, currency)
+		}
+		if !price.IsPositive() {
+			return invalidf("%s must be positive", what)
+		}
+		if price.Round() != *price {
+			return invalidf("%s has more decimals than %s allows", what, currency)
+		}
+		return nil
+	}
+	if err := checkPrice("price", &plan.Price); err != nil {
+		return err
+	}
+	for weekday, price := range plan.WeekdayPrices {
+		if weekday < time.Sunday || weekday > time.Saturday {
+			return invalidf("invalid day of the week %d", weekday)
+		}
+		if err := checkPrice(weekday.String()+" price", &price); err != nil {
+			return err
+		}
+		plan.WeekdayPrices[weekday] = price
+	}
+
+	if plan.MinStay < 0 || plan.MaxStay < 0 {
+		return invalidf("stay limits cannot be negative")
+	}
+	if plan.MaxStay > 0 && plan.MaxStay < plan.MinStay {
+		return invalidf("maximum stay cannot be shorter than the minimum stay")
+	}
+	return nil
+}
+
+// GetRatePlansForVendor retrieves the rate plans of a room of the logged-in
+// vendor.
+func GetRatePlansForVendor(ctx context.Context, roomID int) ([]models.RatePlan, error) {
+	if _, err := GetRoomByIDForVendor(ctx, roomID); err != nil {
+		return nil, err
+	}
+	return repository.GetRatePlansForRoom(db.DB, roomID)
+}
+
+// GetRatePlanForVendor retrieves a rate plan of a room of the logged-in
+// vendor.
+func GetRatePlanForVendor(ctx context.Context, ratePlanID int) (*models.RatePlan, error) {
+	plan, err := repository.GetRatePlanByID(db.DB, ratePlanID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := GetRoomByIDForVendor(ctx, plan.RoomID); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// CreateRatePlanForVendor adds a rate plan to a room of the logged-in
+// vendor. Quotes use it from then on; existing bookings keep their price.
+func CreateRatePlanForVendor(ctx context.Context, roomID int, plan models.RatePlan) (int, error) {
+	room, err := GetRoomByIDForVendor(ctx, roomID)
+	if err != nil {
+		return 0, err
+	}
+	if err := normalizeRatePlan(room, &plan); err != nil {
+		return 0, err
+	}
+	var id int
+	err = db.WithTx(func(tx *sql.Tx) error {
+		id, err = repository.CreateRatePlan(tx, plan)
+		return err
+	})
+	return id, err
+}
+
+// UpdateRatePlanForVendor changes a rate plan of a room of the logged-in
+// vendor.
+func UpdateRatePlanForVendor(ctx context.Context, plan models.RatePlan) error {
+	existing, err := GetRatePlanForVendor(ctx, plan.RatePlanID)
+	if err != nil {
+		return err
+	}
+	room, err := repository.GetRoomByID(db.DB, existing.RoomID)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve room: %w", err)
+	}
+	if err := normalizeRatePlan(room, &plan); err != nil {
+		return err
+	}
+	return db.WithTx(func(tx *sql.Tx) error {
+		return repository.UpdateRatePlan(tx, plan)
+	})
+}
+
+// DeleteRatePlanForVendor removes a rate plan of a room of the logged-in
+// vendor. It returns the room the plan belonged to.
+func DeleteRatePlanForVendor(ctx context.Context, ratePlanID int) (int, error) {
+	plan, err := GetRatePlanForVendor(ctx, ratePlanID)
+	if err != nil {
+		return 0, err
+	}
+	return plan.RoomID, repository.DeleteRatePlan(db.DB, ratePlanID)
+}
+
+// CalendarDay is a day of a rate calendar with the price of its night.
+type CalendarDay struct {
+	NightRate
+	// InMonth is false for the days of the first and last week that fall
+	// in the months around.
+	InMonth bool `json:"in_month"`
+}
+
+// RateCalendar is a month of nightly prices of a room, in weeks from Sunday
+// to Saturday.
+type RateCalendar struct {
+	Room  *models.Room      `json:"room"`
+	Month time.Time         `json:"month"`
+	Weeks [][]CalendarDay   `json:"weeks"`
+	Plans []models.RatePlan `json:"plans"`
+}
+
+// GetRateCalendarForVendor returns the nightly prices of a room of the
+// logged-in vendor for the month of the given date, with all its rate plans.
+func GetRateCalendarForVendor(ctx context.Context, roomID int, month time.Time) (*RateCalendar, error) {
+	room, err := GetRoomByIDForVendor(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	plans, err := repository.GetRatePlansForRoom(db.DB, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	month = time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	first := month.AddDate(0, 0, -int(month.Weekday()))
+	end := month.AddDate(0, 1, -1)
+	last := end.AddDate(0, 0, int(time.Saturday-end.Weekday()))
+
+	calendar := &RateCalendar{Room: room, Month: month, Plans: plans}
+	var week []CalendarDay
+	for _, night := range nightlyRates(room, plans, first, last) {
+		week = append(week, CalendarDay{NightRate: night, InMonth: night.Date.Month() == month.Month()})
+		if len(week) == 7 {
+			calendar.Weeks = append(calendar.Weeks, week)
+			week = nil
+		}
+	}
+	return calendar, nil
+}
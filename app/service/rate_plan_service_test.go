@@ -0,0 +1,140 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"hotelm/models"
+	"hotelm/money"
+)
+
+// day returns midnight UTC of a date in 2026.
+func day(month time.Month, d int) time.Time {
+	return time.Date(2026, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func usd(dollars int64) money.Money {
+	return money.New(dollars*100, "USD")
+}
+
+// testRoom is priced at $100 a night outside its plans.
+var testRoom = &models.Room{RoomID: 1, Price: usd(100)}
+
+// testPlans returns a summer season with a Saturday price and a holiday
+// inside it that limits the length of stays.
+func testPlans() []models.RatePlan {
+	return []models.RatePlan{
+		{
+			RatePlanID: 1, RoomID: 1, Name: "Summer",
+			StartDate: day(time.June, 1), EndDate: day(time.August, 31),
+			Price:         usd(150),
+			WeekdayPrices: map[time.Weekday]money.Money{time.Saturday: usd(200)},
+		},
+		{
+			RatePlanID: 2, RoomID: 1, Name: "Holiday",
+			StartDate: day(time.July, 3), EndDate: day(time.July, 5),
+			Price:   usd(300),
+			MinStay: 2, MaxStay: 5,
+		},
+	}
+}
+
+func TestPlanForNight(t *testing.T) {
+	plans := append(testPlans(),
+		// A plan in another currency is ignored, however short.
+		models.RatePlan{RatePlanID: 3, RoomID: 1, Name: "Euro", StartDate: day(time.July, 1), EndDate: day(time.July, 1), Price: money.New(9000, "EUR")},
+		// Of two plans as long as each other, the newer applies.
+		models.RatePlan{RatePlanID: 4, RoomID: 1, Name: "Festival", StartDate: day(time.August, 10), EndDate: day(time.August, 12), Price: usd(250)},
+		models.RatePlan{RatePlanID: 5, RoomID: 1, Name: "Festival late deal", StartDate: day(time.August, 10), EndDate: day(time.August, 12), Price: usd(220)},
+	)
+	tests := []struct {
+		date time.Time
+		want int // rate plan ID, 0 for the room's own price
+	}{
+		{day(time.May, 31), 0},
+		{day(time.June, 1), 1}, // first day of a plan
+		{day(time.July, 1), 1}, // the euro plan does not count
+		{day(time.July, 2), 1}, // the day before the holiday
+		{day(time.July, 3), 2}, // the shorter plan wins
+		{day(time.July, 5), 2}, // last day of the holiday
+		{day(time.July, 6), 1}, // back in the season
+		{day(time.August, 11), 5},
+		{day(time.August, 31), 1}, // last day of a plan
+		{day(time.September, 1), 0},
+	}
+	for _, tt := range tests {
+		got := 0
+		if plan := planForNight(plans, "USD", tt.date); plan != nil {
+			got = plan.RatePlanID
+		}
+		if got != tt.want {
+			t.Errorf("planForNight(%s) = plan %d, want plan %d", tt.date.Format(dateLayout), got, tt.want)
+		}
+	}
+}
+
+func TestNightlyRates(t *testing.T) {
+	nights := nightlyRates(testRoom, testPlans(), day(time.June, 26), day(time.June, 28))
+	want := []NightRate{
+		{Date: day(time.June, 26), Price: usd(150), Plan: "Summer", RatePlanID: 1}, // Friday
+		{Date: day(time.June, 27), Price: usd(200), Plan: "Summer", RatePlanID: 1}, // Saturday price
+		{Date: day(time.June, 28), Price: usd(150), Plan: "Summer", RatePlanID: 1}, // Sunday
+	}
+	checkNights(t, "June 26 to 28", nights, want)
+}
+
+func TestPriceStay(t *testing.T) {
+	tests := []struct {
+		name              string
+		checkin, checkout time.Time
+		prices            []int64 // in dollars, one per night
+		wantErr           bool
+	}{
+		// The check-out day is not a night of the stay.
+		{"check-out on the first day of a plan", day(time.May, 30), day(time.June, 1), []int64{100, 100}, false},
+		{"check-in the day before a plan", day(time.May, 31), day(time.June, 2), []int64{100, 150}, false},
+		{"check-in on the last day of a plan", day(time.August, 31), day(time.September, 2), []int64{150, 100}, false},
+		{"weekend in the season", day(time.June, 26), day(time.June, 28), []int64{150, 200}, false},
+		// The holiday replaces the season's Saturday price too.
+		{"into the holiday", day(time.July, 2), day(time.July, 5), []int64{150, 300, 300}, false},
+		{"holiday too short", day(time.July, 5), day(time.July, 6), nil, true},
+		{"holiday too long", day(time.July, 1), day(time.July, 8), nil, true},
+		{"season without limits", day(time.June, 1), day(time.June, 15), nil, false},
+	}
+	for _, tt := range tests {
+		nights, err := priceStay(testRoom, testPlans(), tt.checkin, tt.checkout)
+		if tt.wantErr {
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) {
+				t.Errorf("%s: error = %v, want a validation error", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if n := int(tt.checkout.Sub(tt.checkin).Hours() / 24); len(nights) != n {
+			t.Errorf("%s: %d nights, want %d", tt.name, len(nights), n)
+			continue
+		}
+		for i, dollars := range tt.prices {
+			if nights[i].Price != usd(dollars) {
+				t.Errorf("%s: night %s costs %s, want %s", tt.name, nights[i].Date.Format(dateLayout), nights[i].Price, usd(dollars))
+			}
+		}
+	}
+}
+
+func checkNights(t *testing.T, name string, got, want []NightRate) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: %d nights, want %d", name, len(got), len(want))
+	}
+	for i := range want {
+		if !got[i].Date.Equal(want[i].Date) || got[i].Price != want[i].Price || got[i].Plan != want[i].Plan || got[i].RatePlanID != want[i].RatePlanID {
+			t.Errorf("%s: night %d = %+v, want %+v", name, i, got[i], want[i])
+		}
+	}
+}
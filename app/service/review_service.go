@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"hotelm/db"
+	"hotelm/models"
+	"hotelm/repository"
+	"hotelm/session"
+)
+
+// maxReviewLength is the longest review comment accepted.
+const maxReviewLength = 2000
+
+// IsBookingCompleted reports whether the stay of a booking is over, which
+// is once the vendor has checked the guest out. A booking whose check-out
+// date has passed without that, such as a no-show never marked as one or a
+// stay that was never paid, does not count.
+func IsBookingCompleted(booking models.Booking) bool {
+	return booking.Status == BookingCheckedOut
+}
+
+// CreateReviewForCustomer posts a review for a completed booking owned by the
+// logged-in customer. Each booking can be reviewed once.
+func CreateReviewForCustomer(ctx context.Context, bookingID, rating int, comment string) (int, error) {
+	// Ensure a customer is logged in.
+	customer, ok := session.CustomerFromContext(ctx)
+	if !ok {
+		return 0, ErrNoCustomer
+	}
+
+	if rating < 1 || rating > 5 {
+		return 0, invalidf("rating must be between 1 and 5")
+	}
+	comment = strings.TrimSpace(comment)
+	if len(comment) > maxReviewLength {
+		return 0, invalidf("review must be at most %d characters", maxReviewLength)
+	}
+
+	booking, err := repository.GetBookingByID(db.DB, bookingID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve booking: %w", err)
+	}
+	if booking.CustomerID != customer.CustomerID {
+		return 0, fmt.Errorf("%w: booking does not belong to the logged-in customer", ErrForbidden)
+	}
+	if !IsBookingCompleted(*booking) {
+		return 0, invalidf("a booking can only be reviewed after check-out")
+	}
+
+	// The unique index on review.booking_id also guards against a double post.
+	reviews, err := repository.GetReviewsByCustomerID(db.DB, customer.CustomerID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve reviews: %w", err)
+	}
+	for _, review := range reviews {
+		if review.BookingID == bookingID {
+			return 0, invalidf("this booking has already been reviewed")
+		}
+	}
+
+	id, err := repository.CreateReview(db.DB, models.Review{
+		Comment:    comment,
+		Rating:     rating,
+		ReviewDate: time.Now(),
+		BookingID:  booking.BookingID,
+		CustomerID: customer.CustomerID,
+		RoomID:     booking.RoomID,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create review: %w", err)
+	}
+	return id, nil
+}
+
+// GetReviewedBookingIDs returns the IDs of the logged-in customer's bookings
+// that already have a review.
+func GetReviewedBookingIDs(ctx context.Context) (map[int]bool, error) {
+	// Ensure a customer is logged in.
+	customer, ok := session.CustomerFromContext(ctx)
+	if !ok {
+		return nil, ErrNoCustomer
+	}
+
+	reviews, err := repository.GetReviewsByCustomerID(db.DB, customer.CustomerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve reviews: %w", err)
+	}
+	reviewed := make(map[int]bool, len(reviews))
+	for _, review := range reviews {
+		reviewed[review.BookingID] = true
+	}
+	return reviewed, nil
+}
+
+// GetRoomReviews returns a room together with its reviews.
+func GetRoomReviews(roomID int) (*models.Room, []models.Review, error) {
+	room, err := repository.GetRoomByID(db.DB, roomID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve room: %w", err)
+	}
+	reviews, err := repository.GetReviewsByRoomID(db.DB, roomID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve reviews: %w", err)
+	}
+	return room, reviews, nil
+}
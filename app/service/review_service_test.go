@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"hotelm/db/dbtest"
+	"hotelm/models"
+	"hotelm/session"
+)
+
+func TestIsBookingCompleted(t *testing.T) {
+	tests := []struct {
+		status string
+		want   bool
+	}{
+		{BookingCheckedOut, true},
+		{BookingConfirmed, false},
+		{BookingCheckedIn, false},
+		{BookingNoShow, false},
+		{BookingCancelled, false},
+	}
+	for _, tt := range tests {
+		if got := IsBookingCompleted(models.Booking{Status: tt.status}); got != tt.want {
+			t.Errorf("IsBookingCompleted(%s) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+// roomRow is room 3 of vendor 4 in property 2, rated 4.5.
+func roomRow() dbtest.Result {
+	return dbtest.Rows(strings.Split("room_id name description location availability price currency room_type average_rating vendor_id property_id property amenities cover", " "),
+		[]driver.Value{int64(3), "Sea view", "", "Nice", true, "100.00", "USD", "double", float64(4.5), int64(4), int64(2), "Hotel du Port", []byte("[]"), ""})
+}
+
+// propertyRow is property 2 of vendor 4, in the given time zone.
+func propertyRow(timezone string) dbtest.Result {
+	return dbtest.Rows(strings.Split("property_id vendor_id name address latitude longitude timezone checkin_time checkout_time policies phone email created_at rooms listed", " "),
+		[]driver.Value{int64(2), int64(4), "Hotel du Port", "1 Quai", nil, nil, timezone, "15:00", "11:00", "", "", "", time.Now(), int64(1), int64(1)})
+}
+
+// reviewRows returns reviews of customer 7 for the given bookings.
+func reviewRows(bookingIDs ...int) dbtest.Result {
+	var rows [][]driver.Value
+	for i, id := range bookingIDs {
+		rows = append(rows, []driver.Value{int64(i + 1), "", int64(4), time.Now(), int64(id), int64(7), int64(3), nil})
+	}
+	return dbtest.Rows(strings.Split("review_id comment rating review_date booking_id customer_id room_id hidden_at", " "), rows...)
+}
+
+func TestCreateReviewForCustomer(t *testing.T) {
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		rating   int
+		status   string // of booking 1
+		reviewed []int  // bookings of customer 7 already reviewed
+		wantErr  error
+		invalid  bool // a validation error is expected
+	}{
+		{"checked out", asCustomer(7), 4, BookingCheckedOut, []int{2}, nil, false},
+		{"not logged in", context.Background(), 4, BookingCheckedOut, nil, ErrNoCustomer, false},
+		{"someone else's booking", asCustomer(8), 4, BookingCheckedOut, nil, ErrForbidden, false},
+		{"rating too low", asCustomer(7), 0, BookingCheckedOut, nil, nil, true},
+		{"rating too high", asCustomer(7), 6, BookingCheckedOut, nil, nil, true},
+		{"before check-out", asCustomer(7), 4, BookingCheckedIn, nil, nil, true},
+		{"never stayed", asCustomer(7), 4, BookingNoShow, nil, nil, true},
+		{"already reviewed", asCustomer(7), 4, BookingCheckedOut, []int{1}, nil, true},
+	}
+	for _, tt := range tests {
+		rec := useTestDB(t, func(query string, args []driver.Value) dbtest.Result {
+			switch {
+			case strings.Contains(query, "FROM booking WHERE booking_id = $1"):
+				return bookingRow(testBooking(tt.status, "Paid"))
+			case strings.Contains(query, "FROM review WHERE customer_id"):
+				return reviewRows(tt.reviewed...)
+			case strings.Contains(query, "INSERT INTO review"):
+				return dbtest.Rows([]string{"review_id"}, []driver.Value{int64(9)})
+			}
+			return dbtest.Fail(errors.New("unexpected query"))
+		})
+
+		id, err := CreateReviewForCustomer(tt.ctx, 1, tt.rating, "  Lovely stay  ")
+		var invalid *ValidationError
+		switch {
+		case tt.invalid:
+			if !errors.As(err, &invalid) {
+				t.Errorf("%s: error = %v, want a validation error", tt.name, err)
+			}
+		case tt.wantErr != nil:
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+			}
+		case err != nil || id != 9:
+			t.Errorf("%s: CreateReviewForCustomer = %d, %v, want review 9", tt.name, id, err)
+		}
+
+		inserted := false
+		for _, s := range rec.Statements() {
+			if !strings.Contains(s.Query, "INSERT INTO review") {
+				continue
+			}
+			inserted = true
+			// comment, rating, date, booking, customer, room
+			if s.Args[0] != "Lovely stay" || s.Args[1] != int64(tt.rating) || s.Args[3] != int64(1) || s.Args[4] != int64(7) || s.Args[5] != int64(3) {
+				t.Errorf("%s: review inserted with %v", tt.name, s.Args)
+			}
+		}
+		if inserted != (err == nil) {
+			t.Errorf("%s: review inserted: %v, error: %v", tt.name, inserted, err)
+		}
+	}
+}
+
+// TestUpdateRoomKeepsRating checks that a vendor cannot set the rating of a
+// room: it is recomputed by the database from the room's reviews.
+func TestUpdateRoomKeepsRating(t *testing.T) {
+	rec := useTestDB(t, func(query string, args []driver.Value) dbtest.Result {
+		switch {
+		case strings.Contains(query, "FROM room WHERE room_id = $1"):
+			return roomRow()
+		case strings.Contains(query, "FROM property WHERE property_id = $1"):
+			return propertyRow("Europe/Paris")
+		}
+		return dbtest.Affected(1)
+	})
+	ctx := session.NewContext(context.Background(), &session.Principal{
+		Role:   session.RoleVendor,
+		Vendor: &models.Vendor{VendorID: 4},
+	})
+
+	room := models.Room{RoomID: 3, Name: "Sea view", Price: usd(120), AverageRating: 5}
+	if err := UpdateRoomForVendor(ctx, room); err != nil {
+		t.Fatalf("UpdateRoomForVendor: %v", err)
+	}
+	updated := false
+	for _, s := range rec.Statements() {
+		if !strings.HasPrefix(s.Query, "UPDATE room ") {
+			continue
+		}
+		updated = true
+		if strings.Contains(s.Query, "average_rating") {
+			t.Errorf("room update writes the rating: %s", s.Query)
+		}
+		for _, arg := range s.Args {
+			if arg == float64(5) {
+				t.Errorf("room update was given the submitted rating: %v", s.Args)
+			}
+		}
+	}
+	if !updated {
+		t.Error("the room was not updated")
+	}
+}
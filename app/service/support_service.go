@@ -0,0 +1,351 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+
+	"hotelm/db"
+	"hotelm/models"
+	"hotelm/repository"
+	"hotelm/session"
+)
+
+// Ticket statuses. A ticket is open while support owes an answer, pending
+// while it waits on the opener, resolved once support considers it done and
+// closed when nothing more will happen.
+const (
+	TicketOpen     = "open"
+	TicketPending  = "pending"
+	TicketResolved = "resolved"
+	TicketClosed   = "closed"
+)
+
+// Values accepted for ticket fields, in display order.
+var (
+	TicketStatuses   = []string{TicketOpen, TicketPending, TicketResolved, TicketClosed}
+	TicketCategories = []string{"booking", "payment", "account", "room", "other"}
+	TicketPriorities = []string{"low", "normal", "high", "urgent"}
+)
+
+// ticketTransitions lists the statuses an admin can move a ticket to from
+// each status. Openers can only close a ticket or reopen a resolved one.
+var ticketTransitions = map[string][]string{
+	TicketOpen:     {TicketPending, TicketResolved, TicketClosed},
+	TicketPending:  {TicketOpen, TicketResolved, TicketClosed},
+	TicketResolved: {TicketOpen, TicketClosed},
+	TicketClosed:   {},
+}
+
+// TicketTransitions returns the statuses an admin can move a ticket in the
+// given status to.
+func TicketTransitions(status string) []string {
+	return ticketTransitions[status]
+}
+
+// AuditTicket is the audit action for admin changes to a ticket.
+const AuditTicket = "ticket"
+
+// NewTicket is a support request with its description. BookingID and
+// PaymentID are optional and must belong to the opener.
+type NewTicket struct {
+	Category  string
+	Priority  string
+	Subject   string
+	Body      string
+	BookingID int
+	PaymentID int
+}
+
+// canAccessTicket reports whether p opened the ticket or is an admin.
+func (p participant) canAccessTicket(ticket *models.SupportTicket) bool {
+	switch p.side {
+	case repository.SideCustomer:
+		return ticket.CustomerID != nil && *ticket.CustomerID == p.id
+	case repository.SideVendor:
+		return ticket.VendorID != nil && *ticket.VendorID == p.id
+	}
+	return p.admin
+}
+
+// role returns the participant's role as recorded on replies and events.
+func (p participant) role() string {
+	if p.admin {
+		return session.RoleAdmin
+	}
+	return p.side
+}
+
+// checkBookingOwner returns an error unless the booking belongs to p, as its
+// customer or as the vendor of its room.
+func checkBookingOwner(p participant, bookingID int) error {
+	booking, err := repository.GetBookingByID(db.DB, bookingID)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve booking: %w", err)
+	}
+	return checkBookingAccess(db.DB, p, booking)
+}
+
+// OpenTicket opens a support ticket for the logged-in customer or vendor and
+// records its description as the first reply. It returns the ticket ID.
+func OpenTicket(ctx context.Context, nt NewTicket) (int, error) {
+	p, err := currentParticipant(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if p.admin {
+		return 0, fmt.Errorf("%w: admins cannot open tickets", ErrForbidden)
+	}
+
+	if !slices.Contains(TicketCategories, nt.Category) {
+		return 0, invalidf("invalid category %q", nt.Category)
+	}
+	if nt.Priority == "" {
+		nt.Priority = "normal"
+	}
+	if !slices.Contains(TicketPriorities, nt.Priority) {
+		return 0, invalidf("invalid priority %q", nt.Priority)
+	}
+	subject := strings.TrimSpace(nt.Subject)
+	if subject == "" {
+		return 0, invalidf("subject is required")
+	}
+	if len(subject) > maxSubjectLength {
+		return 0, invalidf("subject must be at most %d characters", maxSubjectLength)
+	}
+	body, err := validateMessage(nt.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	ticket := models.SupportTicket{
+		OpenerRole: p.side,
+		Category:   nt.Category,
+		Priority:   nt.Priority,
+		Status:     TicketOpen,
+		Subject:    subject,
+	}
+	if p.side == repository.SideCustomer {
+		ticket.CustomerID = &p.id
+	} else {
+		ticket.VendorID = &p.id
+	}
+	if nt.PaymentID != 0 {
+		payment, err := repository.GetPaymentByID(db.DB, nt.PaymentID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to retrieve payment: %w", err)
+		}
+		if nt.BookingID == 0 {
+			nt.BookingID = payment.BookingID
+		} else if nt.BookingID != payment.BookingID {
+			return 0, invalidf("payment %d is not for booking %d", nt.PaymentID, nt.BookingID)
+		}
+		ticket.PaymentID = &nt.PaymentID
+	}
+	if nt.BookingID != 0 {
+		if err := checkBookingOwner(p, nt.BookingID); err != nil {
+			return 0, err
+		}
+		ticket.BookingID = &nt.BookingID
+	}
+
+	var ticketID int
+	err = db.WithTx(func(tx *sql.Tx) error {
+		ticketID, err = repository.CreateTicket(tx, ticket)
+		if err != nil {
+			return err
+		}
+		if _, err = repository.CreateTicketReply(tx, models.TicketReply{TicketID: ticketID, AuthorRole: p.side, Body: body}, nil); err != nil {
+			return err
+		}
+		return repository.CreateTicketEvent(tx, models.TicketEvent{TicketID: ticketID, ToStatus: TicketOpen, ActorRole: p.side})
+	})
+	if err != nil {
+		return 0, err
+	}
+	return ticketID, nil
+}
+
+// GetMyTickets returns the tickets opened by the logged-in customer or
+// vendor, newest first.
+func GetMyTickets(ctx context.Context) ([]models.SupportTicket, error) {
+	p, err := currentParticipant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if p.admin {
+		return nil, fmt.Errorf("%w: admins have no tickets of their own", ErrForbidden)
+	}
+	return repository.GetTicketsByOpener(db.DB, p.side, p.id)
+}
+
+// ListTickets returns the tickets matching the filter for triage, most
+// urgent first.
+func ListTickets(ctx context.Context, filter repository.TicketFilter) ([]models.SupportTicket, error) {
+	if _, err := currentAdmin(ctx); err != nil {
+		return nil, err
+	}
+	return repository.SearchTickets(db.DB, filter)
+}
+
+// GetTicket returns a ticket with its replies and status history, for its
+// opener or an admin.
+func GetTicket(ctx context.Context, ticketID int) (*models.SupportTicket, []models.TicketReply, []models.TicketEvent, error) {
+	p, err := currentParticipant(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ticket, err := repository.GetTicketByID(db.DB, ticketID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !p.canAccessTicket(ticket) {
+		return nil, nil, nil, fmt.Errorf("%w: ticket was opened by another user", ErrForbidden)
+	}
+	replies, err := repository.GetTicketReplies(db.DB, ticketID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	events, err := repository.GetTicketEvents(db.DB, ticketID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return ticket, replies, events, nil
+}
+
+// changeTicketStatus moves a locked ticket to a new status and records the
+// event.
+func changeTicketStatus(tx *sql.Tx, ticket *models.SupportTicket, status, actorRole string) error {
+	if err := repository.UpdateTicketStatus(tx, ticket.TicketID, status); err != nil {
+		return err
+	}
+	event := models.TicketEvent{TicketID: ticket.TicketID, FromStatus: ticket.Status, ToStatus: status, ActorRole: actorRole}
+	ticket.Status = status
+	return repository.CreateTicketEvent(tx, event)
+}
+
+// ReplyToTicket adds a reply from the opener or an admin. A reply from
+// support puts an open ticket in pending; a reply from the opener reopens a
+// pending or resolved ticket. Closed tickets take no replies. It returns the
+// reply ID.
+func ReplyToTicket(ctx context.Context, ticketID int, body string) (int, error) {
+	p, err := currentParticipant(ctx)
+	if err != nil {
+		return 0, err
+	}
+	body, err = validateMessage(body)
+	if err != nil {
+		return 0, err
+	}
+	admin, _ := session.AdminFromContext(ctx)
+
+	var replyID int
+	err = db.WithTx(func(tx *sql.Tx) error {
+		ticket, err := repository.GetTicketByIDForUpdate(tx, ticketID)
+		if err != nil {
+			return err
+		}
+		if !p.canAccessTicket(ticket) {
+			return fmt.Errorf("%w: ticket was opened by another user", ErrForbidden)
+		}
+		if ticket.Status == TicketClosed {
+			return invalidf("this ticket is closed")
+		}
+
+		var adminID *int
+		if admin != nil {
+			adminID = &admin.AdminID
+		}
+		replyID, err = repository.CreateTicketReply(tx, models.TicketReply{TicketID: ticketID, AuthorRole: p.role(), Body: body}, adminID)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case p.admin && ticket.Status == TicketOpen:
+			err = changeTicketStatus(tx, ticket, TicketPending, p.role())
+		case !p.admin && (ticket.Status == TicketPending || ticket.Status == TicketResolved):
+			err = changeTicketStatus(tx, ticket, TicketOpen, p.role())
+		default:
+			err = repository.TouchTicket(tx, ticketID)
+		}
+		if err != nil {
+			return err
+		}
+
+		if admin != nil {
+			return audit(tx, admin, AuditTicket, "ticket", ticketID, "reply")
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return replyID, nil
+}
+
+// SetTicketStatus moves a ticket to a new status. Admins can make any of the
+// ticketTransitions; the opener can close the ticket or reopen it once
+// resolved.
+func SetTicketStatus(ctx context.Context, ticketID int, status string) error {
+	p, err := currentParticipant(ctx)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(TicketStatuses, status) {
+		return invalidf("invalid status %q", status)
+	}
+	admin, _ := session.AdminFromContext(ctx)
+
+	return db.WithTx(func(tx *sql.Tx) error {
+		ticket, err := repository.GetTicketByIDForUpdate(tx, ticketID)
+		if err != nil {
+			return err
+		}
+		if !p.canAccessTicket(ticket) {
+			return fmt.Errorf("%w: ticket was opened by another user", ErrForbidden)
+		}
+		if ticket.Status == status {
+			return nil
+		}
+
+		allowed := slices.Contains(ticketTransitions[ticket.Status], status)
+		if !p.admin {
+			allowed = allowed && (status == TicketClosed || (ticket.Status == TicketResolved && status == TicketOpen))
+		}
+		if !allowed {
+			return invalidf("a %s ticket cannot be moved to %s", ticket.Status, status)
+		}
+
+		from := ticket.Status
+		if err := changeTicketStatus(tx, ticket, status, p.role()); err != nil {
+			return err
+		}
+		if admin != nil {
+			return audit(tx, admin, AuditTicket, "ticket", ticketID, "status "+from+" -> "+status)
+		}
+		return nil
+	})
+}
+
+// TriageTicket sets the category and priority of a ticket.
+func TriageTicket(ctx context.Context, ticketID int, category, priority string) error {
+	admin, err := currentAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(TicketCategories, category) {
+		return invalidf("invalid category %q", category)
+	}
+	if !slices.Contains(TicketPriorities, priority) {
+		return invalidf("invalid priority %q", priority)
+	}
+	return db.WithTx(func(tx *sql.Tx) error {
+		if err := repository.UpdateTicketTriage(tx, ticketID, category, priority); err != nil {
+			return err
+		}
+		return audit(tx, admin, AuditTicket, "ticket", ticketID, "category "+category+", priority "+priority)
+	})
+}
@@ -1,200 +1,298 @@
 package service
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"sort"
 
 	"hotelm/db"
 	"hotelm/models"
+	"hotelm/money"
 	"hotelm/repository"
 	"hotelm/session"
 )
 
-// GetVendorRooms retrieves all rooms belonging to the currently logged-in vendor.
-func GetVendorRooms() ([]models.Room, error) {
-	// Ensure we have a vendor logged in.
-	user := session.GetCurrentUser()
-	vendor, ok := user.(*models.Vendor)
+// GetCurrentVendor returns the logged-in vendor.
+func GetCurrentVendor(ctx context.Context) (*models.Vendor, error) {
+	vendor, ok := session.VendorFromContext(ctx)
 	if !ok {
-		return nil, fmt.Errorf("no vendor is currently logged in")
+		return nil, ErrNoVendor
 	}
+	return vendor, nil
+}
 
-	// Query rooms where vendor_id matches the current vendor.
-	query := `
-		SELECT room_id, name, description, location, availability, price, room_type, average_rating, amenities, vendor_id 
-		FROM room
-		WHERE vendor_id = $1
-	`
-	rows, err := db.DB.Query(query, vendor.VendorID)
-	if err != nil {
-		return nil, fmt.Errorf("error querying vendor rooms: %v", err)
+// GetVendorRooms retrieves all rooms belonging to the currently logged-in vendor,
+// or only those of one of its properties if propertyID is not 0.
+func GetVendorRooms(ctx context.Context, propertyID int) ([]models.Room, error) {
+	// Ensure we have a vendor logged in.
+	vendor, ok := session.VendorFromContext(ctx)
+	if !ok {
+		return nil, ErrNoVendor
 	}
-	defer rows.Close()
-
-	var rooms []models.Room
-	for rows.Next() {
-		var room models.Room
-		// Since amenities is now stored as a simple TEXT field (per our earlier decision),
-		// we can scan it directly into room.Amenities.
-		if err := rows.Scan(
-			&room.RoomID,
-			&room.Name,
-			&room.Description,
-			&room.Location,
-			&room.Availability,
-			&room.Price,
-			&room.RoomType,
-			&room.AverageRating,
-			&room.Amenities,
-			&room.VendorID,
-		); err != nil {
-			return nil, fmt.Errorf("error scanning room: %v", err)
+	if propertyID != 0 {
+		if _, err := vendorProperty(db.DB, vendor, propertyID); err != nil {
+			return nil, err
 		}
-		rooms = append(rooms, room)
-	}
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error reading vendor rooms: %v", err)
 	}
 
-	return rooms, nil
+	return repository.GetRoomsByVendor(db.DB, vendor.VendorID, propertyID)
+}
+
+// normalizeRoomPrice checks the nightly price of a room. A price without a
+// currency is in the default currency.
+func normalizeRoomPrice(room *models.Room) error {
+	room.Price = room.Price.WithDefault(money.DefaultCurrency)
+	if _, ok := money.LookupCurrency(room.Price.Currency); !ok {
+		return invalidf("unsupported currency %q", room.Price.Currency)
+	}
+	if !room.Price.IsPositive() {
+		return invalidf("price must be positive")
+	}
+	if room.Price.Round() != room.Price {
+		return invalidf("price has more decimals than %s allows", room.Price.Currency)
+	}
+	return nil
 }
 
 // CreateRoomForVendor creates a new room for the logged-in vendor.
 // It sets the VendorID in the room to that of the logged-in vendor.
-func CreateRoomForVendor(room models.Room) (int, error) {
+func CreateRoomForVendor(ctx context.Context, room models.Room) (int, error) {
 	// Ensure we have a vendor logged in.
-	user := session.GetCurrentUser()
-	vendor, ok := user.(*models.Vendor)
+	vendor, ok := session.VendorFromContext(ctx)
 	if !ok {
-		return 0, fmt.Errorf("no vendor is currently logged in")
+		return 0, ErrNoVendor
 	}
 
 	// Set the room's VendorID to the current vendor.
 	room.VendorID = vendor.VendorID
+	if err := normalizeRoomPrice(&room); err != nil {
+		return 0, err
+	}
 
-	// Call repository function to create the room.
-	id, err := repository.CreateRoom(room)
+	// Create the room in one of the vendor's properties, with its amenities.
+	var id int
+	err := db.WithTx(func(tx *sql.Tx) error {
+		propertyID, err := roomProperty(tx, vendor, room.PropertyID)
+		if err != nil {
+			return err
+		}
+		room.PropertyID = propertyID
+		amenityIDs, err := roomAmenityIDs(tx, room.Amenities)
+		if err != nil {
+			return err
+		}
+		if id, err = repository.CreateRoom(tx, room); err != nil {
+			return err
+		}
+		return repository.SetRoomAmenities(tx, id, amenityIDs)
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to create room: %v", err)
+		return 0, fmt.Errorf("failed to create room: %w", err)
 	}
 	return id, nil
 }
 
 // UpdateRoomForVendor updates an existing room if it belongs to the logged-in vendor.
-func UpdateRoomForVendor(room models.Room) error {
+func UpdateRoomForVendor(ctx context.Context, room models.Room) error {
 	// Ensure we have a vendor logged in.
-	user := session.GetCurrentUser()
-	vendor, ok := user.(*models.Vendor)
+	vendor, ok := session.VendorFromContext(ctx)
 	if !ok {
-		return fmt.Errorf("no vendor is currently logged in")
+		return ErrNoVendor
 	}
 
 	// Retrieve the current room to verify ownership.
-	existingRoom, err := repository.GetRoomByID(room.RoomID)
+	existingRoom, err := repository.GetRoomByID(db.DB, room.RoomID)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve room: %v", err)
+		return fmt.Errorf("failed to retrieve room: %w", err)
 	}
 	if existingRoom.VendorID != vendor.VendorID {
-		return fmt.Errorf("unauthorized: this room does not belong to the logged-in vendor")
+		return fmt.Errorf("%w: this room does not belong to the logged-in vendor", ErrForbidden)
 	}
 
 	// Ensure that the VendorID is correct.
 	room.VendorID = vendor.VendorID
+	if err := normalizeRoomPrice(&room); err != nil {
+		return err
+	}
 
-	// Call repository function to update the room.
-	if err := repository.UpdateRoom(room); err != nil {
-		return fmt.Errorf("failed to update room: %v", err)
+	// Update the room, keeping its property unless another of the vendor's
+	// is given, and replace its amenities.
+	if room.PropertyID == 0 {
+		room.PropertyID = existingRoom.PropertyID
+	}
+	err = db.WithTx(func(tx *sql.Tx) error {
+		if _, err := roomProperty(tx, vendor, room.PropertyID); err != nil {
+			return err
+		}
+		amenityIDs, err := roomAmenityIDs(tx, room.Amenities)
+		if err != nil {
+			return err
+		}
+		if err := repository.UpdateRoom(tx, room); err != nil {
+			return err
+		}
+		return repository.SetRoomAmenities(tx, room.RoomID, amenityIDs)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update room: %w", err)
 	}
 	return nil
 }
 
 // DeleteRoomForVendor deletes a room if it belongs to the logged-in vendor.
-func DeleteRoomForVendor(roomID int) error {
+func DeleteRoomForVendor(ctx context.Context, roomID int) error {
 	// Ensure we have a vendor logged in.
-	user := session.GetCurrentUser()
-	vendor, ok := user.(*models.Vendor)
+	vendor, ok := session.VendorFromContext(ctx)
 	if !ok {
-		return fmt.Errorf("no vendor is currently logged in")
+		return ErrNoVendor
 	}
 
 	// Retrieve the room to verify ownership.
-	room, err := repository.GetRoomByID(roomID)
+	room, err := repository.GetRoomByID(db.DB, roomID)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve room: %v", err)
+		return fmt.Errorf("failed to retrieve room: %w", err)
 	}
 	if room.VendorID != vendor.VendorID {
-		return fmt.Errorf("unauthorized: this room does not belong to the logged-in vendor")
+		return fmt.Errorf("%w: this room does not belong to the logged-in vendor", ErrForbidden)
+	}
+
+	// The photo rows go with the room; their images are removed after.
+	photos, err := repository.GetRoomPhotos(db.DB, roomID)
+	if err != nil {
+		return err
 	}
 
 	// Call repository function to delete the room.
-	if err := repository.DeleteRoom(roomID); err != nil {
-		return fmt.Errorf("failed to delete room: %v", err)
+	if err := repository.DeleteRoom(db.DB, roomID); err != nil {
+		return fmt.Errorf("failed to delete room: %w", err)
 	}
+	deleteRoomPhotoBlobs(ctx, photos)
 	return nil
 }
 
+// VendorPayment is a payment for a booking on a vendor's room, with the
+// promo code discount the booking was given. Discount is zero except on
+// completed charges of bookings that were not cancelled.
+type VendorPayment struct {
+	models.Payment
+	PromoCode string      `json:"promo_code,omitempty"`
+	Discount  money.Money `json:"discount"`
+}
+
+// RevenueTotal is what a vendor received in one currency: Gross is what the
+// rooms would have earned without promo codes, Discounts what promo codes
+// took off and Net what was received, less refunds.
+type RevenueTotal struct {
+	Currency  string      `json:"currency"`
+	Gross     money.Money `json:"gross"`
+	Discounts money.Money `json:"discounts"`
+	Net       money.Money `json:"net"`
+}
+
 // GetVendorPayments retrieves all payments for bookings on rooms belonging to the logged-in vendor.
-func GetVendorPayments() ([]models.Payment, error) {
+func GetVendorPayments(ctx context.Context) ([]VendorPayment, error) {
 	// Ensure we have a vendor logged in.
-	user := session.GetCurrentUser()
-	vendor, ok := user.(*models.Vendor)
+	vendor, ok := session.VendorFromContext(ctx)
 	if !ok {
-		return nil, fmt.Errorf("no vendor is currently logged in")
+		return nil, ErrNoVendor
 	}
 
-	// This query joins payments, bookings, and rooms to retrieve payments for the vendor's rooms.
+	// This query joins payments, bookings, and rooms to retrieve payments for the vendor's rooms,
+	// and the promo code redemption of each booking.
 	query := `
-		SELECT p.payment_id, p.payment_method, p.payment_status, p.transaction_date, p.amount, p.booking_id
+		SELECT p.payment_id, p.payment_method, p.payment_status, p.transaction_date, p.amount, p.currency, p.booking_id,
+			COALESCE(pc.code, ''),
+			CASE WHEN p.amount > 0 AND p.payment_status = 'Completed' AND b.status <> 'cancelled'
+				THEN COALESCE(pr.discount, 0) ELSE 0 END
 		FROM payment p
 		JOIN booking b ON p.booking_id = b.booking_id
 		JOIN room r ON b.room_id = r.room_id
+		LEFT JOIN promo_redemption pr ON pr.booking_id = b.booking_id
+		LEFT JOIN promo_code pc ON pc.promo_code_id = pr.promo_code_id
 		WHERE r.vendor_id = $1
+		ORDER BY p.payment_id
 	`
 	rows, err := db.DB.Query(query, vendor.VendorID)
 	if err != nil {
-		return nil, fmt.Errorf("error querying vendor payments: %v", err)
+		return nil, fmt.Errorf("error querying vendor payments: %w", err)
 	}
 	defer rows.Close()
 
-	var payments []models.Payment
+	var payments []VendorPayment
 	for rows.Next() {
-		var payment models.Payment
+		var payment VendorPayment
 		if err := rows.Scan(
 			&payment.PaymentID,
 			&payment.PaymentMethod,
 			&payment.PaymentStatus,
 			&payment.TransactionDate,
 			&payment.Amount,
+			&payment.Amount.Currency,
 			&payment.BookingID,
+			&payment.PromoCode,
+			&payment.Discount,
 		); err != nil {
-			return nil, fmt.Errorf("error scanning payment: %v", err)
+			return nil, fmt.Errorf("error scanning payment: %w", err)
 		}
+		payment.Discount.Currency = payment.Amount.Currency
 		payments = append(payments, payment)
 	}
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error reading vendor payments: %v", err)
+		return nil, fmt.Errorf("error reading vendor payments: %w", err)
 	}
 
 	return payments, nil
 }
 
+// RevenueTotals adds up what was received in a list of payments, less
+// refunds, and what promo codes took off, with one total per currency in
+// alphabetical order. A booking's discount counts once.
+func RevenueTotals(payments []VendorPayment) []RevenueTotal {
+	byCurrency := map[string]*RevenueTotal{}
+	discounted := map[int]bool{}
+	for _, p := range payments {
+		if p.PaymentStatus != "Completed" && p.PaymentStatus != "Refunded" {
+			continue
+		}
+		total, ok := byCurrency[p.Amount.Currency]
+		if !ok {
+			zero := money.Zero(p.Amount.Currency)
+			total = &RevenueTotal{Currency: p.Amount.Currency, Gross: zero, Discounts: zero, Net: zero}
+			byCurrency[p.Amount.Currency] = total
+		}
+		total.Net = total.Net.Add(p.Amount)
+		if p.Discount.IsPositive() && !discounted[p.BookingID] {
+			discounted[p.BookingID] = true
+			total.Discounts = total.Discounts.Add(p.Discount)
+		}
+	}
+	totals := make([]RevenueTotal, 0, len(byCurrency))
+	for _, total := range byCurrency {
+		total.Gross = total.Net.Add(total.Discounts)
+		totals = append(totals, *total)
+	}
+	sort.Slice(totals, func(i, j int) bool { return totals[i].Currency < totals[j].Currency })
+	return totals
+}
+
 
 
 
 
 // GetRoomByIDForVendor retrieves a room by its ID and checks that it belongs to the logged-in vendor.
-func GetRoomByIDForVendor(roomID int) (*models.Room, error) {
-    room, err := repository.GetRoomByID(roomID)
+func GetRoomByIDForVendor(ctx context.Context, roomID int) (*models.Room, error) {
+    room, err := repository.GetRoomByID(db.DB, roomID)
     if err != nil {
-        return nil, fmt.Errorf("failed to retrieve room: %v", err)
+        return nil, fmt.Errorf("failed to retrieve room: %w", err)
     }
     // Retrieve the logged-in vendor from session
-    user := session.GetCurrentUser()
-    vendor, ok := user.(*models.Vendor)
+    vendor, ok := session.VendorFromContext(ctx)
     if !ok {
-        return nil, fmt.Errorf("no vendor is currently logged in")
+        return nil, ErrNoVendor
     }
     if room.VendorID != vendor.VendorID {
-        return nil, fmt.Errorf("unauthorized: this room does not belong to the logged-in vendor")
+        return nil, fmt.Errorf("%w: this room does not belong to the logged-in vendor", ErrForbidden)
     }
     return room, nil
 }
\ No newline at end of file
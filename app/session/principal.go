@@ -0,0 +1,69 @@
+package session
+
+import (
+	"context"
+	"net/http"
+
+	"hotelm/models"
+)
+
+// Principal is the authenticated user of a request.
+type Principal struct {
+	Role     string
+	Customer *models.Customer // set when Role is RoleCustomer
+	Vendor   *models.Vendor   // set when Role is RoleVendor
+	Admin    *models.Admin    // set when Role is RoleAdmin
+}
+
+// principalKey is the context key of the request's Principal.
+type principalKey struct{}
+
+// LoadPrincipal returns the user logged in on the request's session, or nil
+// if nobody is logged in.
+func LoadPrincipal(r *http.Request) *Principal {
+	switch u := GetCurrentUser(r).(type) {
+	case *models.Customer:
+		return &Principal{Role: RoleCustomer, Customer: u}
+	case *models.Vendor:
+		return &Principal{Role: RoleVendor, Vendor: u}
+	case *models.Admin:
+		return &Principal{Role: RoleAdmin, Admin: u}
+	}
+	return nil
+}
+
+// NewContext returns a copy of ctx carrying the principal.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal stored in ctx, or nil for an anonymous
+// request.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// CustomerFromContext returns the logged-in customer, if the principal is one.
+func CustomerFromContext(ctx context.Context) (*models.Customer, bool) {
+	if p := FromContext(ctx); p != nil && p.Customer != nil {
+		return p.Customer, true
+	}
+	return nil, false
+}
+
+// VendorFromContext returns the logged-in vendor, if the principal is one.
+func VendorFromContext(ctx context.Context) (*models.Vendor, bool) {
+	if p := FromContext(ctx); p != nil && p.Vendor != nil {
+		return p.Vendor, true
+	}
+	return nil, false
+}
+
+// AdminFromContext returns the logged-in admin, if the principal is one.
+func AdminFromContext(ctx context.Context) (*models.Admin, bool) {
+	if p := FromContext(ctx); p != nil && p.Admin != nil {
+		return p.Admin, true
+	}
+	return nil, false
+}
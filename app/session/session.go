@@ -1,22 +1,120 @@
 package session
 
+import (
+	"log"
+	"net/http"
 
-// CurrentUser holds the pointer to the currently logged-in user.
-// It can store either a *models.Customer or *models.Vendor.
-var CurrentUser interface{}
+	"github.com/gorilla/securecookie"
 
-// SetCurrentUser sets the current user (customer or vendor) after login.
-func SetCurrentUser(user interface{}) {
-	CurrentUser = user
+	"hotelm/db"
+	"hotelm/models"
+	"hotelm/repository"
+)
+
+// cookieName is the name of the cookie that carries the session ID.
+const cookieName = "hotelm_session"
+
+// Keys stored in the session values.
+const (
+	roleKey   = "role"
+	userIDKey = "user_id"
+)
+
+// Roles that can be stored in a session.
+const (
+	RoleCustomer = "customer"
+	RoleVendor   = "vendor"
+	RoleAdmin    = "admin"
+)
+
+// Store is the server-side session store used by the application.
+var Store *PGStore
+
+// Init configures the session store. The secret signs the session cookie; if
+// it is empty a random key is generated, which logs everyone out on restart.
+func Init(secret string) {
+	key := []byte(secret)
+	if len(key) == 0 {
+		log.Println("Warning: no session secret configured, using a random key.")
+		key = securecookie.GenerateRandomKey(64)
+	}
+	Store = NewPGStore(key)
 }
 
-// GetCurrentUser returns the current logged-in user.
-func GetCurrentUser() interface{} {
-	return CurrentUser
+// SetCurrentUser stores the user (customer, vendor or admin) in the request's
+// session after login. The session ID is rotated so a session cookie issued
+// before login cannot be reused afterwards.
+func SetCurrentUser(w http.ResponseWriter, r *http.Request, user interface{}) error {
+	sess, err := Store.Get(r, cookieName)
+	if err != nil {
+		return err
+	}
+	if sess.ID != "" {
+		if err := deleteSession(sess.ID); err != nil {
+			return err
+		}
+		sess.ID = ""
+	}
+	sess.Values = map[interface{}]interface{}{}
+
+	switch u := user.(type) {
+	case *models.Customer:
+		sess.Values[roleKey] = RoleCustomer
+		sess.Values[userIDKey] = u.CustomerID
+	case *models.Vendor:
+		sess.Values[roleKey] = RoleVendor
+		sess.Values[userIDKey] = u.VendorID
+	case *models.Admin:
+		sess.Values[roleKey] = RoleAdmin
+		sess.Values[userIDKey] = u.AdminID
+	}
+	return sess.Save(r, w)
 }
 
-// ClearCurrentUser clears the current session.
-func ClearCurrentUser() {
-	CurrentUser = nil
+// GetCurrentUser returns the user logged in on this request's session, as a
+// *models.Customer, *models.Vendor or *models.Admin, or nil if nobody is
+// logged in. Suspended customers and vendors count as logged out.
+func GetCurrentUser(r *http.Request) interface{} {
+	sess, err := Store.Get(r, cookieName)
+	if err != nil {
+		log.Printf("Error loading session: %v", err)
+		return nil
+	}
+	role, _ := sess.Values[roleKey].(string)
+	userID, ok := sess.Values[userIDKey].(int)
+	if !ok {
+		return nil
+	}
+
+	switch role {
+	case RoleCustomer:
+		customer, err := repository.GetCustomerByID(db.DB, userID)
+		if err != nil || customer.SuspendedAt != nil {
+			return nil
+		}
+		return customer
+	case RoleVendor:
+		vendor, err := repository.GetVendorByID(db.DB, userID)
+		if err != nil || vendor.SuspendedAt != nil {
+			return nil
+		}
+		return vendor
+	case RoleAdmin:
+		admin, err := repository.GetAdminByID(db.DB, userID)
+		if err != nil {
+			return nil
+		}
+		return admin
+	}
+	return nil
 }
 
+// ClearCurrentUser ends the request's session.
+func ClearCurrentUser(w http.ResponseWriter, r *http.Request) error {
+	sess, err := Store.Get(r, cookieName)
+	if err != nil {
+		return err
+	}
+	sess.Options.MaxAge = -1
+	return sess.Save(r, w)
+}
@@ -0,0 +1,153 @@
+package session
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+
+	"hotelm/db"
+)
+
+// PGStore is a gorilla/sessions store that keeps session values in the
+// http_session table. The browser only receives a signed cookie holding the
+// session ID, so nothing about the user can be read or forged client-side.
+type PGStore struct {
+	Codecs  []securecookie.Codec
+	Options *sessions.Options // default configuration
+}
+
+// NewPGStore returns a PGStore whose cookies are signed with the given keys.
+func NewPGStore(keyPairs ...[]byte) *PGStore {
+	return &PGStore{
+		Codecs: securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{
+			Path:     "/",
+			MaxAge:   86400 * 7,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		},
+	}
+}
+
+// Get returns the session for the request, cached in the request registry.
+func (s *PGStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session referenced by the request cookie, or returns a fresh
+// session when there is no valid cookie or the stored session has expired.
+func (s *PGStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	sess := sessions.NewSession(s, name)
+	opts := *s.Options
+	sess.Options = &opts
+	sess.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return sess, nil
+	}
+	if err := securecookie.DecodeMulti(name, cookie.Value, &sess.ID, s.Codecs...); err != nil {
+		// A tampered or stale cookie simply starts a new session.
+		sess.ID = ""
+		return sess, nil
+	}
+	found, err := s.load(sess)
+	if err != nil {
+		return sess, err
+	}
+	if !found {
+		sess.ID = ""
+		return sess, nil
+	}
+	sess.IsNew = false
+	return sess, nil
+}
+
+// Save persists the session values and writes the signed session cookie.
+// A session with MaxAge <= 0 is deleted from the database and the browser.
+func (s *PGStore) Save(r *http.Request, w http.ResponseWriter, sess *sessions.Session) error {
+	if sess.Options.MaxAge <= 0 {
+		if sess.ID != "" {
+			if err := deleteSession(sess.ID); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(sess.Name(), "", sess.Options))
+		return nil
+	}
+
+	if sess.ID == "" {
+		id, err := newSessionID()
+		if err != nil {
+			return err
+		}
+		sess.ID = id
+		// New sessions are rare compared to reads, so this is a cheap place
+		// to clear out sessions that have expired.
+		if _, err := db.DB.Exec(`DELETE FROM http_session WHERE expires_at < NOW()`); err != nil {
+			return fmt.Errorf("failed to purge expired sessions: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(sess.Values); err != nil {
+		return fmt.Errorf("failed to encode session: %v", err)
+	}
+	expiresAt := time.Now().Add(time.Duration(sess.Options.MaxAge) * time.Second)
+	query := `INSERT INTO http_session (session_id, data, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (session_id) DO UPDATE SET data = EXCLUDED.data, expires_at = EXCLUDED.expires_at`
+	if _, err := db.DB.Exec(query, sess.ID, buf.Bytes(), expiresAt); err != nil {
+		return fmt.Errorf("failed to save session: %v", err)
+	}
+
+	encoded, err := securecookie.EncodeMulti(sess.Name(), sess.ID, s.Codecs...)
+	if err != nil {
+		return fmt.Errorf("failed to sign session cookie: %v", err)
+	}
+	http.SetCookie(w, sessions.NewCookie(sess.Name(), encoded, sess.Options))
+	return nil
+}
+
+// load reads the session values from the database. It reports false if the
+// session does not exist or has expired.
+func (s *PGStore) load(sess *sessions.Session) (bool, error) {
+	var data []byte
+	err := db.DB.QueryRow(`SELECT data FROM http_session WHERE session_id = $1 AND expires_at > NOW()`, sess.ID).Scan(&data)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error retrieving session: %v", err)
+	}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&sess.Values); err != nil {
+		return false, fmt.Errorf("error decoding session: %v", err)
+	}
+	return true, nil
+}
+
+// deleteSession removes a stored session.
+func deleteSession(id string) error {
+	if _, err := db.DB.Exec(`DELETE FROM http_session WHERE session_id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete session: %v", err)
+	}
+	return nil
+}
+
+// newSessionID returns a random, URL-safe session identifier.
+func newSessionID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate session id: %v", err)
+	}
+	return strings.TrimRight(base32.StdEncoding.EncodeToString(b), "="), nil
+}
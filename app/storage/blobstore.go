@@ -0,0 +1,69 @@
+// Package storage keeps uploaded files, such as room photos, in a blob
+// store: the local filesystem or an S3-compatible object store. Blobs are
+// addressed by keys like "rooms/12/3f9c.jpg" and are written once; a blob
+// is replaced by storing a new key and deleting the old one.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// ErrNotFound is returned when no blob is stored under a key.
+var ErrNotFound = errors.New("blob not found")
+
+// Object is a stored blob being read. The caller must close Body.
+type Object struct {
+	Body        io.ReadCloser
+	ContentType string
+	Size        int64
+}
+
+// BlobStore stores blobs by key.
+type BlobStore interface {
+	// Name identifies the backend, e.g. in logs.
+	Name() string
+	// Put stores data under key, replacing any blob already there.
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get opens the blob stored under key. It returns ErrNotFound if there
+	// is none.
+	Get(ctx context.Context, key string) (*Object, error)
+	// Delete removes the blob stored under key. Deleting a missing blob is
+	// not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Options selects and configures a blob store.
+type Options struct {
+	Backend string // "local" or "s3"
+	Dir     string // root directory of the local store
+	S3      S3Config
+}
+
+// New returns the blob store selected by opts.
+func New(opts Options) (BlobStore, error) {
+	switch opts.Backend {
+	case "local":
+		return NewLocal(opts.Dir)
+	case "s3":
+		return NewS3(opts.S3)
+	}
+	return nil, fmt.Errorf("unknown blob store %q", opts.Backend)
+}
+
+// keyPattern is the form of a blob key: slash-separated names of lower-case
+// letters, digits, dots, dashes and underscores.
+var keyPattern = regexp.MustCompile(`^[a-z0-9_-][a-z0-9._-]*(/[a-z0-9_-][a-z0-9._-]*)*$`)
+
+// CheckKey returns an error unless key is a valid blob key. Keys cannot
+// start with a slash or contain "..", so they stay inside the store.
+func CheckKey(key string) error {
+	if len(key) > 255 || !keyPattern.MatchString(key) || strings.Contains(key, "..") {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Local stores blobs as files under a root directory, one file per key.
+// The content type of a blob is taken from its key's extension.
+type Local struct {
+	root string
+}
+
+// NewLocal returns a store rooted at dir, creating the directory if needed.
+func NewLocal(dir string) (*Local, error) {
+	if dir == "" {
+		return nil, errors.New("local blob store: no directory configured")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("local blob store: %v", err)
+	}
+	return &Local{root: dir}, nil
+}
+
+// Name returns "local".
+func (l *Local) Name() string {
+	return "local"
+}
+
+// path returns the file a key is stored in.
+func (l *Local) path(key string) (string, error) {
+	if err := CheckKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes data to a temporary file next to the blob's file and renames
+// it into place, so readers never see a partly written blob.
+func (l *Local) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	file, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return fmt.Errorf("failed to store blob %s: %v", key, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to store blob %s: %v", key, err)
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to store blob %s: %v", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to store blob %s: %v", key, err)
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("failed to store blob %s: %v", key, err)
+	}
+	return nil
+}
+
+// Get opens the file of a blob.
+func (l *Local) Get(ctx context.Context, key string) (*Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	file, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %v", key, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read blob %s: %v", key, err)
+	}
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return &Object{Body: f, ContentType: contentType, Size: info.Size()}, nil
+}
+
+// Delete removes the file of a blob.
+func (l *Local) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	file, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete blob %s: %v", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckKey(t *testing.T) {
+	valid := []string{"rooms/12/3f9c.jpg", "a", "rooms/1/a.b.c", "x_y-z/1"}
+	for _, key := range valid {
+		if err := CheckKey(key); err != nil {
+			t.Errorf("CheckKey(%q) = %v, want nil", key, err)
+		}
+	}
+	invalid := []string{
+		"", "/etc/passwd", "../secret", "rooms/../../secret", "rooms/..", "rooms/..hidden",
+		"rooms//1", "rooms/1/", ".hidden", "rooms/.x", `rooms\..\x`, "Rooms/1.jpg",
+		"rooms/1 2.jpg", "rooms/%2e%2e/x",
+	}
+	for _, key := range invalid {
+		if err := CheckKey(key); err == nil {
+			t.Errorf("CheckKey(%q) = nil, want an error", key)
+		}
+	}
+}
+
+func TestLocalRejectsTraversal(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "blobs")
+	l, err := NewLocal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	outside := filepath.Join(dir, "outside.txt")
+	if err := os.WriteFile(outside, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.Put(ctx, "../escape.txt", []byte("x"), "text/plain"); err == nil {
+		t.Error("Put of ../escape.txt succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("a file was written outside the store: %v", err)
+	}
+	if _, err := l.Get(ctx, "../outside.txt"); err == nil {
+		t.Error("Get of ../outside.txt succeeded")
+	}
+	if err := l.Delete(ctx, "../outside.txt"); err == nil {
+		t.Error("Delete of ../outside.txt succeeded")
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("the file outside the store is gone: %v", err)
+	}
+}
+
+func TestLocalRoundTrip(t *testing.T) {
+	l, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := l.Put(ctx, "rooms/3/a.png", []byte("png data"), "image/png"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	obj, err := l.Get(ctx, "rooms/3/a.png")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	body, _ := io.ReadAll(obj.Body)
+	obj.Body.Close()
+	if string(body) != "png data" || obj.ContentType != "image/png" || obj.Size != 8 {
+		t.Errorf("Get = %q, %q, %d bytes", body, obj.ContentType, obj.Size)
+	}
+	if err := l.Delete(ctx, "rooms/3/a.png"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := l.Get(ctx, "rooms/3/a.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: %v, want ErrNotFound", err)
+	}
+	if err := l.Delete(ctx, "rooms/3/a.png"); err != nil {
+		t.Errorf("Delete of a missing blob: %v", err)
+	}
+}
@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config configures an S3-compatible store.
+type S3Config struct {
+	// Endpoint is the base URL of the service, e.g.
+	// https://s3.eu-west-1.amazonaws.com, or http://localhost:9000 for a
+	// local stand-in such as MinIO.
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PathStyle addresses the bucket in the path (endpoint/bucket/key)
+	// instead of the host name (bucket.endpoint/key). Local stand-ins
+	// usually need it.
+	PathStyle bool
+}
+
+// S3 stores blobs as objects in a bucket of an S3-compatible service. It
+// signs requests with AWS Signature Version 4.
+type S3 struct {
+	cfg    S3Config
+	base   *url.URL
+	client *http.Client
+	now    func() time.Time // returns the signing time
+}
+
+// NewS3 returns a store for the bucket described by cfg.
+func NewS3(cfg S3Config) (*S3, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("s3 blob store: endpoint and bucket are required")
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("s3 blob store: access key and secret key are required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	base, err := url.Parse(strings.TrimRight(cfg.Endpoint, "/"))
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("s3 blob store: invalid endpoint %q", cfg.Endpoint)
+	}
+	return &S3{
+		cfg:    cfg,
+		base:   base,
+		client: &http.Client{Timeout: 30 * time.Second},
+		now:    time.Now,
+	}, nil
+}
+
+// Name returns "s3".
+func (s *S3) Name() string {
+	return "s3"
+}
+
+// objectURL returns the URL of the object stored under key.
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.base
+	if s.cfg.PathStyle {
+		u.Path += "/" + s.cfg.Bucket + "/" + key
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path += "/" + key
+	}
+	return &u
+}
+
+// do sends a signed request for the object stored under key.
+func (s *S3) do(ctx context.Context, method, key string, body []byte, contentType string) (*http.Response, error) {
+	if err := CheckKey(key); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, body)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s %s: %v", method, key, err)
+	}
+	return resp, nil
+}
+
+// responseError returns an error describing a failed response and closes
+// its body.
+func responseError(method, key string, resp *http.Response) error {
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("s3 %s %s: %s: %s", method, key, resp.Status, bytes.TrimSpace(msg))
+}
+
+// Put uploads data as the object stored under key.
+func (s *S3) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	resp, err := s.do(ctx, http.MethodPut, key, data, contentType)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return responseError(http.MethodPut, key, resp)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get downloads the object stored under key.
+func (s *S3) Get(ctx context.Context, key string) (*Object, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	case resp.StatusCode/100 != 2:
+		return nil, responseError(http.MethodGet, key, resp)
+	}
+	return &Object{Body: resp.Body, ContentType: resp.Header.Get("Content-Type"), Size: resp.ContentLength}, nil
+}
+
+// Delete removes the object stored under key. S3 answers a delete of a
+// missing object with success, and so does this.
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, "")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return responseError(http.MethodDelete, key, resp)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// sign adds the AWS Signature Version 4 headers to a request with the
+// given body.
+func (s *S3) sign(req *http.Request, body []byte) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// The canonical headers are the lower-cased names in order, each with
+	// its trimmed value; Host is not in req.Header but is signed too.
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncodePath(req.URL.Path),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + s.cfg.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), day)
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+// uriEncodePath encodes a path as Signature Version 4 expects: every byte
+// but unreserved characters and slashes is percent-encoded.
+func uriEncodePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}